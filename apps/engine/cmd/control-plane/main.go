@@ -11,6 +11,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/linkflow/engine/internal/controlplane"
 	"github.com/linkflow/engine/internal/version"
 )
 
@@ -37,6 +38,35 @@ func main() {
 		cancel()
 	}()
 
+	svc := controlplane.NewService(controlplane.Config{Logger: logger})
+	if err := svc.Start(ctx); err != nil {
+		logger.Error("failed to start control plane", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	defer func() { _ = svc.Stop(context.Background()) }()
+
+	// Serve the namespace API the other services read their namespace
+	// configuration from.
+	go func() {
+		mux := http.NewServeMux()
+		controlplane.NewHTTPHandler(svc, logger).RegisterRoutes(mux)
+
+		apiServer := &http.Server{
+			Addr:              fmt.Sprintf(":%d", *port),
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+		}
+
+		logger.Info("starting API server", slog.Int("port", *port))
+		if err := apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("api server failed", slog.String("error", err.Error()))
+			cancel()
+		}
+	}()
+
 	// Start HTTP Server for Health Checks
 	go func() {
 		mux := http.NewServeMux()
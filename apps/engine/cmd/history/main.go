@@ -19,6 +19,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
 	matchingv1 "github.com/linkflow/engine/api/gen/linkflow/matching/v1"
+	"github.com/linkflow/engine/internal/controlplane"
 	"github.com/linkflow/engine/internal/history"
 	"github.com/linkflow/engine/internal/history/shard"
 	"github.com/linkflow/engine/internal/history/store"
@@ -40,9 +41,21 @@ func run() error {
 		shardCount   = flag.Int("shard-count", 16, "Number of shards")
 		dbUrl        = flag.String("db-url", getEnv("DATABASE_URL", "postgres://linkflow-postgres:5432/linkflow"), "Database URL")
 		matchingAddr = flag.String("matching-addr", getEnv("MATCHING_ADDR", "localhost:7235"), "Matching service address")
+		hostID       = flag.String("host-id", getEnv("HISTORY_HOST_ID", ""), "Unique ID of this history host (default hostname:port)")
+		shardLease   = flag.Duration("shard-lease", 30*time.Second, "Shard lease duration")
+		cacheSize    = flag.Int("state-cache-size", 10000, "Number of mutable states cached in memory")
+		controlPlane = flag.String("control-plane-addr", getEnv("CONTROL_PLANE_ADDR", ""), "Control plane address to read namespace configuration from (disabled if empty)")
 	)
 	flag.Parse()
 
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	if *hostID == "" {
+		*hostID = fmt.Sprintf("%s:%d", hostname, *port)
+	}
+
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
 
 	printBanner("History", logger)
@@ -70,21 +83,43 @@ func run() error {
 	defer matchingConn.Close()
 	matchingClient := matchingv1.NewMatchingServiceClient(matchingConn)
 
-	shardController := shard.NewController(int32(*shardCount))
-
-	// Initialize stores
-	eventStore := store.NewPostgresEventStore(dbpool, int32(*shardCount))
-	stateStore := store.NewPostgresMutableStateStore(dbpool, int32(*shardCount))
+	// Shards are leased in Postgres and spread over the live history hosts.
+	shardController := shard.NewControllerWithConfig(shard.Config{
+		NumShards:     int32(*shardCount),
+		HostID:        *hostID,
+		Address:       hostname,
+		Port:          *port,
+		LeaseStore:    shard.NewPostgresLeaseStore(dbpool),
+		LeaseDuration: *shardLease,
+		Logger:        logger,
+	})
+
+	// Initialize stores. The execution store serves events, mutable state and
+	// the transfer queue, and writes all of them in one transaction fenced by
+	// the shard's range ID.
+	executionStore := store.NewPostgresExecutionStore(dbpool, int32(*shardCount), shardController)
 	visibilityStore := visibility.NewPostgresStore(dbpool)
 
-	svc := history.NewService(
-		shardController,
-		eventStore,
-		stateStore,
-		visibilityStore,
-		matchingClient,
-		logger,
-	)
+	// Namespace execution TTLs and history limits come from the control
+	// plane; without it every namespace gets the service's defaults.
+	var namespaces history.NamespaceRegistry
+	if *controlPlane != "" {
+		namespaces = controlplane.NewClient(controlplane.ClientConfig{Address: *controlPlane})
+		logger.Info("reading namespace configuration from control plane", slog.String("address", *controlPlane))
+	}
+
+	svc := history.NewServiceWithConfig(history.Config{
+		ShardController:   shardController,
+		EventStore:        executionStore,
+		StateStore:        executionStore,
+		ExecutionStore:    executionStore,
+		TransferTaskStore: executionStore,
+		VisibilityStore:   visibilityStore,
+		MatchingClient:    matchingClient,
+		StateCacheSize:    *cacheSize,
+		Namespaces:        namespaces,
+		Logger:            logger,
+	})
 
 	server := grpc.NewServer()
 	historyv1.RegisterHistoryServiceServer(server, history.NewGRPCServer(svc))
@@ -115,7 +150,11 @@ func run() error {
 		server.GracefulStop()
 	}()
 
-	logger.Info("starting gRPC server", slog.Int("port", *port), slog.Int("shard_count", *shardCount))
+	logger.Info("starting gRPC server",
+		slog.Int("port", *port),
+		slog.Int("shard_count", *shardCount),
+		slog.String("host_id", *hostID),
+	)
 
 	go func() {
 		if err := server.Serve(lis); err != nil {
@@ -18,8 +18,9 @@ import (
 	"github.com/linkflow/engine/internal/timer/store"
 	"github.com/linkflow/engine/internal/version"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/grpc/status"
 )
 
 func main() {
@@ -145,57 +146,31 @@ type grpcHistoryClient struct {
 }
 
 func (c *grpcHistoryClient) RecordTimerFired(ctx context.Context, namespaceID, workflowID, runID, timerID string) error {
-	// Retry logic for optimistic locking
+	req := &historyv1.RecordTimerFiredRequest{
+		Namespace: namespaceID,
+		WorkflowExecution: &commonv1.WorkflowExecution{
+			WorkflowId: workflowID,
+			RunId:      runID,
+		},
+		TimerId: timerID,
+	}
+
+	// Aborted is an optimistic lock conflict and Unavailable a shard moving
+	// between history hosts; both are worth retrying. Anything else is
+	// returned so the timer service puts the timer back to pending.
 	maxRetries := 3
+	var err error
 	for i := 0; i < maxRetries; i++ {
-		err := c.tryRecordTimerFired(ctx, namespaceID, workflowID, runID, timerID)
+		_, err = c.client.RecordTimerFired(ctx, req)
 		if err == nil {
 			return nil
 		}
-		// If error is basic, return. If it's optimistic lock, retry.
-		// Since we don't have easy check for error codes here without partial error string matching or gRPC status code
-		// We will just retry everything for now or log and fail.
-		// Realistically, we should check status.Code(err) == codes.Aborted
+		if code := status.Code(err); code != codes.Aborted && code != codes.Unavailable {
+			return err
+		}
 
 		c.logger.Warn("failed to record timer fired, retrying", slog.Int("attempt", i+1), slog.String("error", err.Error()))
 		time.Sleep(100 * time.Millisecond)
 	}
-	return fmt.Errorf("failed after retries")
-}
-
-func (c *grpcHistoryClient) tryRecordTimerFired(ctx context.Context, namespaceID, workflowID, runID, timerID string) error {
-	reqState := &historyv1.GetMutableStateRequest{
-		Namespace: namespaceID,
-		WorkflowExecution: &commonv1.WorkflowExecution{
-			WorkflowId: workflowID,
-			RunId:      runID,
-		},
-	}
-	respState, err := c.client.GetMutableState(ctx, reqState)
-	if err != nil {
-		return fmt.Errorf("failed to get mutable state: %w", err)
-	}
-
-	event := &historyv1.HistoryEvent{
-		EventId:   respState.NextEventId,
-		EventType: commonv1.EventType_EVENT_TYPE_TIMER_FIRED,
-		EventTime: timestamppb.Now(),
-		Attributes: &historyv1.HistoryEvent_TimerFiredAttributes{
-			TimerFiredAttributes: &historyv1.TimerFiredEventAttributes{
-				TimerId:        timerID,
-				StartedEventId: 0, // NOTE: We don't have this info. History validation might fail or accept 0.
-			},
-		},
-	}
-
-	_, err = c.client.RecordEvent(ctx, &historyv1.RecordEventRequest{
-		Namespace: namespaceID,
-		WorkflowExecution: &commonv1.WorkflowExecution{
-			WorkflowId: workflowID,
-			RunId:      runID,
-		},
-		Event: event,
-	})
-
-	return err
+	return fmt.Errorf("failed after retries: %w", err)
 }
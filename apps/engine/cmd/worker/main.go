@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -30,8 +31,9 @@ func main() {
 
 func run() error {
 	var (
-		httpPort  = flag.Int("http-port", 8080, "HTTP server port")
-		taskQueue = flag.String("task-queue", getEnv("TASK_QUEUE", "default"), "Task queue name")
+		httpPort   = flag.Int("http-port", 8080, "HTTP server port")
+		taskQueue  = flag.String("task-queue", getEnv("TASK_QUEUE", "default"), "Comma-separated task queues to poll, each optionally with its concurrency as name:n")
+		nodeQueues = flag.String("node-task-queues", getEnv("NODE_TASK_QUEUES", ""), "Comma-separated node_type=queue routes for node activities")
 
 		matchingAddr = flag.String("matching-addr", getEnv("MATCHING_ADDR", "localhost:7235"), "Matching service address")
 		historyAddr  = flag.String("history-addr", getEnv("HISTORY_ADDR", "localhost:7234"), "History service address")
@@ -56,16 +58,26 @@ func run() error {
 	defer historyConn.Close()
 	historyClient := adapter.NewHistoryClient(historyConn)
 
+	taskQueues, queueConcurrency, err := parseTaskQueues(*taskQueue)
+	if err != nil {
+		return err
+	}
+	nodeTaskQueues, err := parseNodeTaskQueues(*nodeQueues)
+	if err != nil {
+		return err
+	}
+
 	svc, err := worker.NewService(worker.Config{
-		TaskQueues:      strings.Split(*taskQueue, ","),
-		NumPollers:      *numWorkers,
-		Identity:        fmt.Sprintf("worker-%d", os.Getpid()),
-		MatchingAddr:    *matchingAddr,
-		PollInterval:    time.Second,
-		Logger:          logger,
-		CallbackKey:     getEnv("CALLBACK_SECRET", ""),
-		CallbackTimeout: 10 * time.Second,
-		HistoryClient:   historyClient,
+		TaskQueues:       taskQueues,
+		QueueConcurrency: queueConcurrency,
+		NumPollers:       *numWorkers,
+		Identity:         fmt.Sprintf("worker-%d", os.Getpid()),
+		MatchingAddr:     *matchingAddr,
+		PollInterval:     time.Second,
+		Logger:           logger,
+		CallbackKey:      getEnv("CALLBACK_SECRET", ""),
+		CallbackTimeout:  10 * time.Second,
+		HistoryClient:    historyClient,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create worker service: %w", err)
@@ -76,6 +88,7 @@ func run() error {
 
 	// Register Workflow Executor (will get registry set after all executors are registered)
 	workflowExecutor := executor.NewWorkflowExecutor(historyClient, logger)
+	workflowExecutor.SetNodeTaskQueues(nodeTaskQueues)
 	svc.RegisterExecutor(workflowExecutor)
 
 	httpExecutor := executor.NewHTTPExecutor()
@@ -189,7 +202,7 @@ func run() error {
 	}()
 
 	logger.Info("worker pool started",
-		slog.String("task_queue", *taskQueue),
+		slog.Any("task_queues", taskQueues),
 		slog.String("matching_addr", *matchingAddr),
 		slog.Int("num_workers", *numWorkers),
 	)
@@ -207,6 +220,49 @@ func printBanner(service string, logger *slog.Logger) {
 	)
 }
 
+// parseTaskQueues parses a comma-separated list of task queues, each
+// optionally followed by ":n" to poll it with n concurrent tasks.
+func parseTaskQueues(spec string) ([]string, map[string]int, error) {
+	var queues []string
+	concurrency := make(map[string]int)
+	for _, item := range strings.Split(spec, ",") {
+		name, n, hasConcurrency := strings.Cut(strings.TrimSpace(item), ":")
+		if name == "" {
+			continue
+		}
+		if hasConcurrency {
+			value, err := strconv.Atoi(n)
+			if err != nil || value <= 0 {
+				return nil, nil, fmt.Errorf("invalid concurrency %q for task queue %s", n, name)
+			}
+			concurrency[name] = value
+		}
+		queues = append(queues, name)
+	}
+	if len(queues) == 0 {
+		return nil, nil, fmt.Errorf("no task queue to poll")
+	}
+	return queues, concurrency, nil
+}
+
+// parseNodeTaskQueues parses a comma-separated list of node_type=queue
+// routes.
+func parseNodeTaskQueues(spec string) (map[string]string, error) {
+	routes := make(map[string]string)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		nodeType, queue, ok := strings.Cut(item, "=")
+		if !ok || nodeType == "" || queue == "" {
+			return nil, fmt.Errorf("invalid node task queue route %q, want node_type=queue", item)
+		}
+		routes[nodeType] = queue
+	}
+	return routes, nil
+}
+
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
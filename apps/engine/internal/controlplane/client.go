@@ -0,0 +1,110 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientConfig holds configuration for the control plane client.
+type ClientConfig struct {
+	// Address is the control plane's HTTP address, such as
+	// "control-plane:7240" or "http://control-plane:7240".
+	Address    string
+	HTTPClient *http.Client
+	// CacheTTL is how long a namespace is served from the cache before it is
+	// read again.
+	CacheTTL time.Duration
+}
+
+// Client reads namespace configuration from the control plane's HTTP API.
+// Services look namespaces up on hot paths, so the client caches them for
+// CacheTTL; a change in the control plane reaches them within that time.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	cacheTTL   time.Duration
+
+	mu         sync.Mutex
+	namespaces map[string]cachedNamespace
+}
+
+// cachedNamespace is a namespace looked up in the control plane; ns is nil
+// for a namespace the control plane does not have.
+type cachedNamespace struct {
+	ns        *NamespaceConfig
+	expiresAt time.Time
+}
+
+// NewClient creates a new control plane client.
+func NewClient(cfg ClientConfig) *Client {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = 30 * time.Second
+	}
+	baseURL := strings.TrimSuffix(cfg.Address, "/")
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+
+	return &Client{
+		baseURL:    baseURL,
+		httpClient: cfg.HTTPClient,
+		cacheTTL:   cfg.CacheTTL,
+		namespaces: make(map[string]cachedNamespace),
+	}
+}
+
+// GetNamespace retrieves a namespace by name. It returns ErrNamespaceNotFound
+// if the control plane has no such namespace, which is cached like a found
+// one. Lookups that failed are not cached.
+func (c *Client) GetNamespace(ctx context.Context, name string) (*NamespaceConfig, error) {
+	now := time.Now()
+	c.mu.Lock()
+	cached, ok := c.namespaces[name]
+	c.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		if cached.ns == nil {
+			return nil, ErrNamespaceNotFound
+		}
+		return cached.ns, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/namespaces/"+url.PathEscape(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		c.mu.Lock()
+		c.namespaces[name] = cachedNamespace{expiresAt: now.Add(c.cacheTTL)}
+		c.mu.Unlock()
+		return nil, ErrNamespaceNotFound
+	default:
+		return nil, fmt.Errorf("failed to get namespace %s: control plane returned %s", name, resp.Status)
+	}
+
+	var ns NamespaceConfig
+	if err := json.NewDecoder(resp.Body).Decode(&ns); err != nil {
+		return nil, fmt.Errorf("failed to decode namespace %s: %w", name, err)
+	}
+
+	c.mu.Lock()
+	c.namespaces[name] = cachedNamespace{ns: &ns, expiresAt: now.Add(c.cacheTTL)}
+	c.mu.Unlock()
+	return &ns, nil
+}
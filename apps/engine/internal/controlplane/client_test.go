@@ -0,0 +1,53 @@
+package controlplane
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientGetNamespace(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewService(Config{Logger: logger})
+	err := svc.CreateNamespace(ctx, &NamespaceConfig{Name: "orders", WorkflowExecutionTTL: time.Hour, HistorySizeLimitMB: 20})
+	if err != nil {
+		t.Fatalf("CreateNamespace() error = %v", err)
+	}
+
+	mux := http.NewServeMux()
+	NewHTTPHandler(svc, logger).RegisterRoutes(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(ClientConfig{Address: server.URL, CacheTTL: time.Hour})
+
+	ns, err := client.GetNamespace(ctx, "orders")
+	if err != nil {
+		t.Fatalf("GetNamespace() error = %v", err)
+	}
+	if ns.WorkflowExecutionTTL != time.Hour || ns.HistorySizeLimitMB != 20 {
+		t.Errorf("GetNamespace() = %+v, want the namespace as created", ns)
+	}
+
+	if _, err := client.GetNamespace(ctx, "missing"); !errors.Is(err, ErrNamespaceNotFound) {
+		t.Errorf("GetNamespace(missing) error = %v, want %v", err, ErrNamespaceNotFound)
+	}
+
+	// Within the cache TTL the client keeps serving what it read.
+	if err := svc.UpdateNamespace(ctx, &NamespaceConfig{Name: "orders"}); err != nil {
+		t.Fatalf("UpdateNamespace() error = %v", err)
+	}
+	ns, err = client.GetNamespace(ctx, "orders")
+	if err != nil {
+		t.Fatalf("GetNamespace() error = %v", err)
+	}
+	if ns.WorkflowExecutionTTL != time.Hour {
+		t.Errorf("cached WorkflowExecutionTTL = %v, want %v", ns.WorkflowExecutionTTL, time.Hour)
+	}
+}
@@ -0,0 +1,106 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// maxRequestBodySize limits the body of a namespace request.
+const maxRequestBodySize = 1 << 20
+
+// HTTPHandler serves the namespace API of the control plane, which the other
+// services read namespace configuration from.
+type HTTPHandler struct {
+	service *Service
+	logger  *slog.Logger
+}
+
+// NewHTTPHandler creates a new HTTP handler.
+func NewHTTPHandler(service *Service, logger *slog.Logger) *HTTPHandler {
+	return &HTTPHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// RegisterRoutes registers the namespace routes.
+func (h *HTTPHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/namespaces", h.CreateNamespace)
+	mux.HandleFunc("GET /api/v1/namespaces", h.ListNamespaces)
+	mux.HandleFunc("GET /api/v1/namespaces/{name}", h.GetNamespace)
+	mux.HandleFunc("PUT /api/v1/namespaces/{name}", h.UpdateNamespace)
+}
+
+// CreateNamespace creates the namespace in the request body.
+func (h *HTTPHandler) CreateNamespace(w http.ResponseWriter, r *http.Request) {
+	var ns NamespaceConfig
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&ns); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if ns.Name == "" {
+		h.writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if err := h.service.CreateNamespace(r.Context(), &ns); err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusCreated, &ns)
+}
+
+// ListNamespaces returns all namespaces.
+func (h *HTTPHandler) ListNamespaces(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.service.ListNamespaces(r.Context()))
+}
+
+// GetNamespace returns a namespace by name.
+func (h *HTTPHandler) GetNamespace(w http.ResponseWriter, r *http.Request) {
+	ns, err := h.service.GetNamespace(r.Context(), r.PathValue("name"))
+	if err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, ns)
+}
+
+// UpdateNamespace replaces the configuration of a namespace.
+func (h *HTTPHandler) UpdateNamespace(w http.ResponseWriter, r *http.Request) {
+	var ns NamespaceConfig
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&ns); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	ns.Name = r.PathValue("name")
+	if err := h.service.UpdateNamespace(r.Context(), &ns); err != nil {
+		h.writeServiceError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, &ns)
+}
+
+func (h *HTTPHandler) writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNamespaceNotFound):
+		h.writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrNamespaceExists):
+		h.writeError(w, http.StatusConflict, err.Error())
+	default:
+		h.logger.Error("namespace request failed", slog.String("error", err.Error()))
+		h.writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func (h *HTTPHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Error("failed to encode response", slog.String("error", err.Error()))
+	}
+}
+
+func (h *HTTPHandler) writeError(w http.ResponseWriter, status int, message string) {
+	h.writeJSON(w, status, map[string]string{"error": message})
+}
@@ -12,6 +12,7 @@ import (
 var (
 	ErrClusterNotFound   = errors.New("cluster not found")
 	ErrNamespaceExists   = errors.New("namespace already exists")
+	ErrNamespaceNotFound = errors.New("namespace not found")
 	ErrServiceNotFound   = errors.New("service not found")
 	ErrConfigKeyNotFound = errors.New("config key not found")
 )
@@ -105,6 +106,9 @@ type NamespaceConfig struct {
 	OwnerEmail           string
 	RetentionDays        int
 	HistorySizeLimitMB   int
+	HistorySizeWarnMB    int
+	HistoryCountLimit    int
+	HistoryCountWarn     int
 	WorkflowExecutionTTL time.Duration
 	AllowedClusters      []string
 	DefaultCluster       string
@@ -341,7 +345,7 @@ func (s *Service) GetNamespace(ctx context.Context, name string) (*NamespaceConf
 
 	ns, exists := s.namespaces[name]
 	if !exists {
-		return nil, errors.New("namespace not found")
+		return nil, ErrNamespaceNotFound
 	}
 	return ns, nil
 }
@@ -352,7 +356,7 @@ func (s *Service) UpdateNamespace(ctx context.Context, ns *NamespaceConfig) erro
 	defer s.mu.Unlock()
 
 	if _, exists := s.namespaces[ns.Name]; !exists {
-		return errors.New("namespace not found")
+		return ErrNamespaceNotFound
 	}
 
 	s.namespaces[ns.Name] = ns
@@ -0,0 +1,112 @@
+package graph
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/linkflow/engine/internal/expression"
+)
+
+// ErrorHandle is the source handle of the edges a failed node routes its
+// error along. A node that completes never follows them.
+const ErrorHandle = "error"
+
+// branchNodeTypes are the node types that pick which of their outgoing edges
+// to follow. The output field of their result names the chosen branch and is
+// matched against the sourceHandle of each outgoing edge.
+var branchNodeTypes = map[string]bool{
+	"condition":       true,
+	"logic_condition": true,
+}
+
+// conditions evaluates the conditions of edges.
+var conditions = expression.NewEngine()
+
+// IsBranchNode reports whether nodes of a type pick the outgoing edges they
+// follow.
+func IsBranchNode(nodeType string) bool {
+	return branchNodeTypes[nodeType]
+}
+
+// NodeOutcome is how far a node got, as far as routing is concerned.
+type NodeOutcome int
+
+const (
+	// OutcomePending is a node that has not finished.
+	OutcomePending NodeOutcome = iota
+	// OutcomeCompleted is a node that completed.
+	OutcomeCompleted
+	// OutcomeFailed is a node that failed and routes its error on.
+	OutcomeFailed
+	// OutcomeSkipped is a node no branch reached.
+	OutcomeSkipped
+)
+
+// OutcomeFunc reports how a node finished and its output.
+type OutcomeFunc func(nodeID string) (NodeOutcome, json.RawMessage)
+
+// EdgeTaken reports whether an edge is resolved and, if so, whether its
+// source routes along it. An edge out of a skipped node is never taken, and
+// the error handle is only taken by a failed node. An edge with a condition
+// is only taken if the condition holds for its source's output.
+func (d *DAG) EdgeTaken(edge *EdgeInfo, outcome OutcomeFunc) (taken, resolved bool) {
+	state, output := outcome(edge.Source)
+	switch state {
+	case OutcomeSkipped:
+		return false, true
+	case OutcomeFailed:
+		if edge.SourceHandle != ErrorHandle {
+			return false, true
+		}
+		return conditionHolds(edge.Condition, output), true
+	case OutcomeCompleted:
+		if edge.SourceHandle == ErrorHandle {
+			return false, true
+		}
+		source, ok := d.Nodes[edge.Source]
+		if edge.SourceHandle != "" && ok && IsBranchNode(source.Type) {
+			var result struct {
+				Output string `json:"output"`
+			}
+			_ = json.Unmarshal(output, &result)
+			if result.Output != edge.SourceHandle {
+				return false, true
+			}
+		}
+		return conditionHolds(edge.Condition, output), true
+	}
+	return false, false
+}
+
+// conditionHolds evaluates an edge condition against the output of the
+// edge's source. An empty condition always holds; one that cannot be
+// evaluated does not.
+func conditionHolds(condition string, output json.RawMessage) bool {
+	if condition == "" {
+		return true
+	}
+	var data any
+	if len(output) > 0 {
+		if err := json.Unmarshal(output, &data); err != nil {
+			return false
+		}
+	}
+	holds, err := conditions.EvaluateBool(condition, data)
+	return err == nil && holds
+}
+
+// IncomingBranches resolves the incoming edges of a node. It returns the
+// sources of the taken edges in definition order, each once, and whether an
+// edge is still pending on a source that has not finished. A node runs once
+// none is pending and one is taken; it is skipped if none is either.
+func (d *DAG) IncomingBranches(nodeID string, outcome OutcomeFunc) (taken []string, pending bool) {
+	for _, edge := range d.InEdges[nodeID] {
+		ok, resolved := d.EdgeTaken(edge, outcome)
+		if !resolved {
+			pending = true
+		} else if ok && !slices.Contains(taken, edge.Source) {
+			taken = append(taken, edge.Source)
+		}
+	}
+	return taken, pending
+}
@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 )
 
 var (
 	ErrCycleDetected = errors.New("cycle detected in workflow graph")
 	ErrNoEntryNode   = errors.New("no entry node found")
 	ErrInvalidEdge   = errors.New("invalid edge")
+	ErrDuplicateNode = errors.New("duplicate node")
 )
 
 // DAG represents a directed acyclic graph of workflow nodes.
@@ -22,16 +24,24 @@ type DAG struct {
 	// This enables conditional branching by preserving sourceHandle
 	EdgeMap map[string]map[string]*EdgeInfo
 
+	// InEdges stores the incoming edges of each node in definition order.
+	// Unlike EdgeMap it keeps every edge between the same two nodes, e.g.
+	// both branches of a condition leading to one node.
+	InEdges map[string][]*EdgeInfo
+
 	EntryNodes []string
 	ExitNodes  []string
 
-	// Topological ordering
+	// Topological ordering, level by level and in definition order within a
+	// level, so the same definition always yields the same order.
 	Order  []string
 	Levels map[string]int
 }
 
 // EdgeInfo stores metadata about an edge.
 type EdgeInfo struct {
+	Source       string `json:"source"`
+	Target       string `json:"target"`
 	SourceHandle string `json:"sourceHandle"`
 	TargetHandle string `json:"targetHandle"`
 	Label        string `json:"label"`
@@ -44,6 +54,7 @@ type Node struct {
 	Type       string          `json:"type"`
 	Name       string          `json:"name"`
 	Config     json.RawMessage `json:"config"`
+	Merge      string          `json:"merge,omitempty"`
 	Position   Position        `json:"position"`
 	Conditions []Condition     `json:"conditions"`
 }
@@ -77,10 +88,12 @@ type NodeDef struct {
 	Data     NodeData `json:"data"`
 }
 
-// NodeData represents node data from the editor.
+// NodeData represents node data from the editor. Merge is the merge mode of
+// a node with several incoming edges.
 type NodeData struct {
 	Label  string          `json:"label"`
 	Config json.RawMessage `json:"config"`
+	Merge  string          `json:"merge,omitempty"`
 }
 
 // EdgeDef represents an edge definition from the editor.
@@ -101,16 +114,24 @@ func BuildDAG(workflow *WorkflowDefinition) (*DAG, error) {
 		Edges:        make(map[string][]string),
 		ReverseEdges: make(map[string][]string),
 		EdgeMap:      make(map[string]map[string]*EdgeInfo),
+		InEdges:      make(map[string][]*EdgeInfo),
 		Levels:       make(map[string]int),
 	}
 
-	// Add nodes
+	// Add nodes, remembering the definition order; map iteration order must
+	// not leak into the entry nodes, exit nodes or topological order.
+	ids := make([]string, 0, len(workflow.Nodes))
 	for _, n := range workflow.Nodes {
+		if _, exists := dag.Nodes[n.ID]; exists {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateNode, n.ID)
+		}
+		ids = append(ids, n.ID)
 		dag.Nodes[n.ID] = &Node{
 			ID:       n.ID,
 			Type:     n.Type,
 			Name:     n.Data.Label,
 			Config:   n.Data.Config,
+			Merge:    n.Data.Merge,
 			Position: n.Position,
 		}
 	}
@@ -131,12 +152,16 @@ func BuildDAG(workflow *WorkflowDefinition) (*DAG, error) {
 		if dag.EdgeMap[e.Source] == nil {
 			dag.EdgeMap[e.Source] = make(map[string]*EdgeInfo)
 		}
-		dag.EdgeMap[e.Source][e.Target] = &EdgeInfo{
+		info := &EdgeInfo{
+			Source:       e.Source,
+			Target:       e.Target,
 			SourceHandle: e.SourceHandle,
 			TargetHandle: e.TargetHandle,
 			Label:        e.Label,
 			Condition:    e.Condition,
 		}
+		dag.EdgeMap[e.Source][e.Target] = info
+		dag.InEdges[e.Target] = append(dag.InEdges[e.Target], info)
 
 		// Handle conditions
 		if e.Condition != "" {
@@ -150,7 +175,7 @@ func BuildDAG(workflow *WorkflowDefinition) (*DAG, error) {
 	}
 
 	// Find entry nodes (no incoming edges)
-	for id := range dag.Nodes {
+	for _, id := range ids {
 		if len(dag.ReverseEdges[id]) == 0 {
 			dag.EntryNodes = append(dag.EntryNodes, id)
 		}
@@ -161,21 +186,21 @@ func BuildDAG(workflow *WorkflowDefinition) (*DAG, error) {
 	}
 
 	// Find exit nodes (no outgoing edges)
-	for id := range dag.Nodes {
+	for _, id := range ids {
 		if len(dag.Edges[id]) == 0 {
 			dag.ExitNodes = append(dag.ExitNodes, id)
 		}
 	}
 
 	// Compute topological order
-	if err := dag.computeTopologicalOrder(); err != nil {
+	if err := dag.computeTopologicalOrder(ids); err != nil {
 		return nil, err
 	}
 
 	return dag, nil
 }
 
-func (d *DAG) computeTopologicalOrder() error {
+func (d *DAG) computeTopologicalOrder(ids []string) error {
 	visited := make(map[string]bool)
 	temp := make(map[string]bool)
 	order := make([]string, 0, len(d.Nodes))
@@ -199,20 +224,19 @@ func (d *DAG) computeTopologicalOrder() error {
 
 		delete(temp, id)
 		visited[id] = true
-		order = append([]string{id}, order...)
+		order = append(order, id)
 
 		return nil
 	}
 
-	for id := range d.Nodes {
+	for _, id := range ids {
 		if !visited[id] {
 			if err := visit(id); err != nil {
 				return err
 			}
 		}
 	}
-
-	d.Order = order
+	slices.Reverse(order)
 
 	// Compute levels for parallel execution
 	for _, id := range order {
@@ -225,14 +249,28 @@ func (d *DAG) computeTopologicalOrder() error {
 		d.Levels[id] = level
 	}
 
+	// Every edge leads to a higher level, so ordering by level keeps the
+	// order topological.
+	position := make(map[string]int, len(ids))
+	for i, id := range ids {
+		position[id] = i
+	}
+	slices.SortFunc(order, func(a, b string) int {
+		if d.Levels[a] != d.Levels[b] {
+			return d.Levels[a] - d.Levels[b]
+		}
+		return position[a] - position[b]
+	})
+	d.Order = order
+
 	return nil
 }
 
 // GetParallelNodes returns nodes that can execute in parallel at a given level.
 func (d *DAG) GetParallelNodes(level int) []string {
 	var nodes []string
-	for id, l := range d.Levels {
-		if l == level {
+	for _, id := range d.Order {
+		if d.Levels[id] == level {
 			nodes = append(nodes, id)
 		}
 	}
@@ -254,7 +292,7 @@ func (d *DAG) GetMaxLevel() int {
 func (d *DAG) GetNextNodes(completed map[string]bool) []string {
 	var ready []string
 
-	for id := range d.Nodes {
+	for _, id := range d.Order {
 		if completed[id] {
 			continue
 		}
@@ -316,9 +354,10 @@ func (d *DAG) GetPath(nodeID string) []string {
 func (d *DAG) Validate() []ValidationError {
 	var errors []ValidationError
 
-	// Check for isolated nodes
-	for id := range d.Nodes {
-		if len(d.Edges[id]) == 0 && len(d.ReverseEdges[id]) == 0 {
+	// Check for isolated nodes. A workflow of a single node has nothing to
+	// connect it to.
+	for _, id := range d.Order {
+		if len(d.Nodes) > 1 && len(d.Edges[id]) == 0 && len(d.ReverseEdges[id]) == 0 {
 			errors = append(errors, ValidationError{
 				NodeID:  id,
 				Message: "isolated node with no connections",
@@ -330,7 +369,7 @@ func (d *DAG) Validate() []ValidationError {
 	triggerCount := 0
 	for _, id := range d.EntryNodes {
 		node := d.Nodes[id]
-		if isTriggerNode(node.Type) {
+		if IsTriggerNode(node.Type) {
 			triggerCount++
 		}
 	}
@@ -341,6 +380,16 @@ func (d *DAG) Validate() []ValidationError {
 		})
 	}
 
+	// Check merge modes
+	for _, id := range d.Order {
+		if mode := d.Nodes[id].Merge; !mergeModes[mode] {
+			errors = append(errors, ValidationError{
+				NodeID:  id,
+				Message: fmt.Sprintf("unknown merge mode %q", mode),
+			})
+		}
+	}
+
 	return errors
 }
 
@@ -350,7 +399,15 @@ type ValidationError struct {
 	Message string
 }
 
-func isTriggerNode(nodeType string) bool {
+func (e ValidationError) Error() string {
+	if e.NodeID == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("node %s: %s", e.NodeID, e.Message)
+}
+
+// IsTriggerNode reports whether nodes of a type start a workflow.
+func IsTriggerNode(nodeType string) bool {
 	triggers := map[string]bool{
 		"trigger_manual":   true,
 		"trigger_webhook":  true,
@@ -367,6 +424,7 @@ func (d *DAG) Clone() *DAG {
 		Edges:        make(map[string][]string, len(d.Edges)),
 		ReverseEdges: make(map[string][]string, len(d.ReverseEdges)),
 		EdgeMap:      make(map[string]map[string]*EdgeInfo, len(d.EdgeMap)),
+		InEdges:      make(map[string][]*EdgeInfo, len(d.InEdges)),
 		Levels:       make(map[string]int, len(d.Levels)),
 		EntryNodes:   append([]string{}, d.EntryNodes...),
 		ExitNodes:    append([]string{}, d.ExitNodes...),
@@ -391,12 +449,25 @@ func (d *DAG) Clone() *DAG {
 		clone.Levels[id] = level
 	}
 
-	// Clone EdgeMap
+	// Clone EdgeMap and InEdges, which share their EdgeInfos
+	infos := make(map[*EdgeInfo]*EdgeInfo)
+	cloneInfo := func(info *EdgeInfo) *EdgeInfo {
+		if infoCopy, ok := infos[info]; ok {
+			return infoCopy
+		}
+		infoCopy := *info
+		infos[info] = &infoCopy
+		return &infoCopy
+	}
 	for source, targetMap := range d.EdgeMap {
 		clone.EdgeMap[source] = make(map[string]*EdgeInfo, len(targetMap))
 		for target, info := range targetMap {
-			infoCopy := *info
-			clone.EdgeMap[source][target] = &infoCopy
+			clone.EdgeMap[source][target] = cloneInfo(info)
+		}
+	}
+	for target, edges := range d.InEdges {
+		for _, info := range edges {
+			clone.InEdges[target] = append(clone.InEdges[target], cloneInfo(info))
 		}
 	}
 
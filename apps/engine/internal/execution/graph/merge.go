@@ -0,0 +1,118 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Merge modes of a node with several incoming edges. They decide when the
+// node runs and how the outputs of the sources that reach it become its
+// input. Sources are always taken in edge definition order, so the same
+// history always yields the same input.
+const (
+	// MergeDefault waits for every branch; one input is passed on as is
+	// and several are keyed by source node ID. Both the in-process
+	// scheduler and the decider merge in it when a node sets no mode.
+	MergeDefault = ""
+	// MergeKeyed waits for every branch and keys the inputs by source node
+	// ID, even a single one.
+	MergeKeyed = "keyed"
+	// MergeAppend waits for every branch and collects the inputs into an
+	// array.
+	MergeAppend = "append"
+	// MergeDeepMerge waits for every branch and merges the inputs, which
+	// must be objects, into one. Nested objects are merged too; on any
+	// other conflict the later source wins.
+	MergeDeepMerge = "deep_merge"
+	// MergeAny runs the node as soon as one branch reaches it, with the
+	// input of that branch. The branches that arrive later are ignored.
+	MergeAny = "any"
+)
+
+var mergeModes = map[string]bool{
+	MergeDefault:   true,
+	MergeKeyed:     true,
+	MergeAppend:    true,
+	MergeDeepMerge: true,
+	MergeAny:       true,
+}
+
+// Ready reports whether a node can run, and the sources whose outputs make up
+// its input. A node waits for every incoming branch to resolve and runs if
+// one reaches it, unless it merges in any mode: then it runs on the first
+// branch that reaches it. Of several that reached it at once, the first in
+// definition order is used.
+func (d *DAG) Ready(nodeID string, outcome OutcomeFunc) (sources []string, ready bool) {
+	taken, pending := d.IncomingBranches(nodeID, outcome)
+	if node, ok := d.Nodes[nodeID]; ok && node.Merge == MergeAny && len(taken) > 0 {
+		return taken[:1], true
+	}
+	return taken, !pending && len(taken) > 0
+}
+
+// MergeInputs returns the input of a node from the outputs of the sources
+// that reached it, according to the node's merge mode.
+func (d *DAG) MergeInputs(nodeID string, sources []string, output func(nodeID string) json.RawMessage) (json.RawMessage, error) {
+	var mode string
+	if node, ok := d.Nodes[nodeID]; ok {
+		mode = node.Merge
+	}
+	outputOrNull := func(source string) json.RawMessage {
+		if out := output(source); len(out) > 0 {
+			return out
+		}
+		return json.RawMessage("null")
+	}
+
+	switch mode {
+	case MergeDefault, MergeAny:
+		if len(sources) == 1 {
+			return output(sources[0]), nil
+		}
+		fallthrough
+	case MergeKeyed:
+		merged := make(map[string]json.RawMessage, len(sources))
+		for _, source := range sources {
+			merged[source] = outputOrNull(source)
+		}
+		return json.Marshal(merged)
+	case MergeAppend:
+		merged := make([]json.RawMessage, 0, len(sources))
+		for _, source := range sources {
+			merged = append(merged, outputOrNull(source))
+		}
+		return json.Marshal(merged)
+	case MergeDeepMerge:
+		merged := make(map[string]interface{})
+		for _, source := range sources {
+			out := output(source)
+			if len(out) == 0 {
+				continue
+			}
+			var value map[string]interface{}
+			decoder := json.NewDecoder(bytes.NewReader(out))
+			decoder.UseNumber()
+			if err := decoder.Decode(&value); err != nil || value == nil {
+				return nil, fmt.Errorf("deep merge: output of %s is not an object", source)
+			}
+			deepMerge(merged, value)
+		}
+		return json.Marshal(merged)
+	}
+	return nil, fmt.Errorf("unknown merge mode %q", mode)
+}
+
+// deepMerge merges src into dst. Objects on both sides are merged; any other
+// value in src replaces the one in dst.
+func deepMerge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcObj, srcIsObj := value.(map[string]interface{})
+		dstObj, dstIsObj := dst[key].(map[string]interface{})
+		if srcIsObj && dstIsObj {
+			deepMerge(dstObj, srcObj)
+			continue
+		}
+		dst[key] = value
+	}
+}
@@ -203,9 +203,11 @@ func (s *Scheduler) Execute(ctx context.Context, executionID string, input json.
 	}
 
 	// Start worker pool
+	workerCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
 	for i := 0; i < s.concurrency; i++ {
 		s.wg.Add(1)
-		go s.worker(ctx)
+		go s.worker(workerCtx)
 	}
 
 	// Schedule entry nodes
@@ -216,7 +218,8 @@ func (s *Scheduler) Execute(ctx context.Context, executionID string, input json.
 	// Process results until complete
 	err := s.processUntilComplete(ctx)
 
-	// Cleanup - rely on context cancellation, do not close taskQueue
+	// Cleanup - stop the workers by cancellation, do not close taskQueue
+	stopWorkers()
 	s.wg.Wait()
 
 	s.state.CompletedAt = time.Now()
@@ -288,6 +291,7 @@ func (s *Scheduler) scheduleNode(ctx context.Context, nodeID string, input json.
 	node := s.dag.Nodes[nodeID]
 
 	s.state.mu.Lock()
+	s.state.ScheduledNodes[nodeID] = true
 	s.state.NodeStates[nodeID] = &NodeState{
 		NodeID:    nodeID,
 		Status:    NodeStatusRunning,
@@ -314,7 +318,13 @@ func (s *Scheduler) executeNode(ctx context.Context, task *NodeTask) (*NodeResul
 		slog.String("node_type", task.NodeType),
 	)
 
-	return s.executor.Execute(ctx, task.NodeType, task.Input, task.Config)
+	result, err := s.executor.Execute(ctx, task.NodeType, task.Input, task.Config)
+	if err != nil {
+		return nil, err
+	}
+	// The executor only sees the node type; the result belongs to the task.
+	result.NodeID = task.NodeID
+	return result, nil
 }
 
 func (s *Scheduler) processUntilComplete(ctx context.Context) error {
@@ -324,7 +334,9 @@ func (s *Scheduler) processUntilComplete(ctx context.Context) error {
 			return ctx.Err()
 
 		case result := <-s.resultQueue:
-			s.handleNodeCompleted(ctx, result)
+			if err := s.handleNodeCompleted(ctx, result); err != nil {
+				return err
+			}
 
 			// Check if execution is complete
 			if s.isExecutionComplete() {
@@ -341,7 +353,7 @@ func (s *Scheduler) processUntilComplete(ctx context.Context) error {
 	}
 }
 
-func (s *Scheduler) handleNodeCompleted(ctx context.Context, result *NodeResult) {
+func (s *Scheduler) handleNodeCompleted(ctx context.Context, result *NodeResult) error {
 	s.state.mu.Lock()
 
 	// Update state
@@ -354,9 +366,9 @@ func (s *Scheduler) handleNodeCompleted(ctx context.Context, result *NodeResult)
 		slog.String("node_id", result.NodeID),
 	)
 
-	// Check if the completed node is a condition node (for logging)
+	// Check if the completed node is a branch node (for logging)
 	completedNode := s.dag.Nodes[result.NodeID]
-	if completedNode.Type == "condition" {
+	if graph.IsBranchNode(completedNode.Type) {
 		// Parse and log the condition output for debugging
 		var condResult struct {
 			Output string `json:"output"`
@@ -369,62 +381,62 @@ func (s *Scheduler) handleNodeCompleted(ctx context.Context, result *NodeResult)
 		}
 	}
 
-	// Find and schedule next nodes
-	nextNodes := s.dag.GetNextNodes(s.state.CompletedNodes)
+	// Resolve the nodes not yet scheduled in topological order, so a node
+	// skipped here is seen by the nodes after it in the same pass. A node
+	// runs once its incoming edges are all resolved and one of them is
+	// taken, or on the first taken one if it merges in any mode, and is
+	// skipped if none is.
+	nodesToSchedule := make(map[string]json.RawMessage)
+	var order []string
+	for _, nextID := range s.dag.Order {
+		if s.state.ScheduledNodes[nextID] || s.state.SkippedNodes[nextID] || len(s.dag.ReverseEdges[nextID]) == 0 {
+			continue
+		}
 
-	// Collect nodes to schedule (check if already scheduled)
-	var nodesToSchedule []string
-	for _, nextID := range nextNodes {
-		if s.state.ScheduledNodes[nextID] {
+		taken, pending := s.dag.IncomingBranches(nextID, s.outcome)
+		if !pending && len(taken) == 0 {
+			s.logger.Debug("skipping node on an untaken branch",
+				slog.String("node_id", nextID),
+			)
+			s.state.SkippedNodes[nextID] = true
 			continue
 		}
 
-		// Check if this node should be skipped due to conditional branching
-		shouldSchedule := true
-
-		// Check all upstream nodes to see if any are condition nodes
-		for _, upstreamID := range s.dag.ReverseEdges[nextID] {
-			upstreamNode := s.dag.Nodes[upstreamID]
-			if upstreamNode.Type == "condition" {
-				// Get the edge info to check sourceHandle
-				edgeInfo := s.dag.GetEdgeInfo(upstreamID, nextID)
-				if edgeInfo != nil && edgeInfo.SourceHandle != "" {
-					// This is a conditional edge - check if it matches the condition output
-					upstreamOutput := s.state.NodeOutputs[upstreamID]
-					var upstreamCondResult struct {
-						Output string `json:"output"`
-					}
-					if err := json.Unmarshal(upstreamOutput, &upstreamCondResult); err == nil {
-						// Only schedule if the edge sourceHandle matches the condition output
-						if edgeInfo.SourceHandle != upstreamCondResult.Output {
-							shouldSchedule = false
-							s.logger.Debug("skipping node due to unmatched condition branch",
-								slog.String("node_id", nextID),
-								slog.String("edge_handle", edgeInfo.SourceHandle),
-								slog.String("condition_output", upstreamCondResult.Output),
-							)
-							// Mark as skipped
-							s.state.SkippedNodes[nextID] = true
-							break
-						}
-					}
-				}
-			}
+		sources, ready := s.dag.Ready(nextID, s.outcome)
+		if !ready {
+			continue
 		}
 
-		if shouldSchedule {
-			s.state.ScheduledNodes[nextID] = true
-			nodesToSchedule = append(nodesToSchedule, nextID)
+		// Merge inputs from the upstream nodes that reached it
+		input, err := s.dag.MergeInputs(nextID, sources, func(nodeID string) json.RawMessage {
+			return s.state.NodeOutputs[nodeID]
+		})
+		if err != nil {
+			s.state.mu.Unlock()
+			return fmt.Errorf("%w: %s: %w", ErrNodeFailed, nextID, err)
 		}
+		nodesToSchedule[nextID] = input
+		order = append(order, nextID)
 	}
 
 	s.state.mu.Unlock()
 
-	for _, nextID := range nodesToSchedule {
-		// Merge inputs from all upstream nodes
-		input := s.mergeInputs(nextID)
-		s.scheduleNode(ctx, nextID, input)
+	for _, nextID := range order {
+		s.scheduleNode(ctx, nextID, nodesToSchedule[nextID])
+	}
+	return nil
+}
+
+// outcome reports how a node finished, for resolving the edges out of it.
+// The caller holds the state lock.
+func (s *Scheduler) outcome(nodeID string) (graph.NodeOutcome, json.RawMessage) {
+	switch {
+	case s.state.CompletedNodes[nodeID]:
+		return graph.OutcomeCompleted, s.state.NodeOutputs[nodeID]
+	case s.state.SkippedNodes[nodeID]:
+		return graph.OutcomeSkipped, nil
 	}
+	return graph.OutcomePending, nil
 }
 
 func (s *Scheduler) handleNodeFailed(nodeErr *NodeError) error {
@@ -469,22 +481,6 @@ func (s *Scheduler) scheduleRetry(ctx context.Context, nodeErr *NodeError) {
 	}
 }
 
-func (s *Scheduler) mergeInputs(nodeID string) json.RawMessage {
-	s.state.mu.RLock()
-	defer s.state.mu.RUnlock()
-
-	merged := make(map[string]json.RawMessage)
-
-	for _, upstream := range s.dag.ReverseEdges[nodeID] {
-		if output, ok := s.state.NodeOutputs[upstream]; ok {
-			merged[upstream] = output
-		}
-	}
-
-	result, _ := json.Marshal(merged)
-	return result
-}
-
 func (s *Scheduler) isExecutionComplete() bool {
 	s.state.mu.RLock()
 	defer s.state.mu.RUnlock()
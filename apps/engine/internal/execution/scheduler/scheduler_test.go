@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/linkflow/engine/internal/execution/graph"
+)
+
+// echoExecutor passes each node's input on as its output; condition nodes
+// pick the "true" branch.
+type echoExecutor struct{}
+
+func (echoExecutor) Execute(ctx context.Context, nodeType string, input, config json.RawMessage) (*NodeResult, error) {
+	if nodeType == "condition" {
+		return &NodeResult{Output: json.RawMessage(`{"output":"true"}`)}, nil
+	}
+	return &NodeResult{Output: input}, nil
+}
+
+func TestSchedulerBranches(t *testing.T) {
+	t.Parallel()
+
+	// check picks yes, so no and its successor are skipped; join waits for
+	// the branches that reach it and gets their outputs.
+	dag, err := graph.BuildDAG(&graph.WorkflowDefinition{
+		Nodes: []graph.NodeDef{
+			{ID: "start", Type: "trigger_manual"},
+			{ID: "check", Type: "condition"},
+			{ID: "yes", Type: "transform"},
+			{ID: "no", Type: "transform"},
+			{ID: "after_no", Type: "transform"},
+			{ID: "join", Type: "transform"},
+		},
+		Edges: []graph.EdgeDef{
+			{Source: "start", Target: "check"},
+			{Source: "check", Target: "yes", SourceHandle: "true"},
+			{Source: "check", Target: "no", SourceHandle: "false"},
+			{Source: "no", Target: "after_no"},
+			{Source: "start", Target: "join"},
+			{Source: "yes", Target: "join"},
+			{Source: "after_no", Target: "join"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildDAG() error = %v", err)
+	}
+
+	s := NewScheduler(dag, echoExecutor{}, DefaultConfig(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	result, err := s.Execute(context.Background(), "exec-1", json.RawMessage(`{"id":1}`))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if got, want := string(result.Outputs["join"]), `{"start":{"id":1},"yes":{"output":"true"}}`; got != want {
+		t.Errorf("output of join = %s, want %s", got, want)
+	}
+	for _, nodeID := range []string{"no", "after_no"} {
+		if !s.state.SkippedNodes[nodeID] {
+			t.Errorf("%s was not skipped", nodeID)
+		}
+	}
+}
+
+func TestSchedulerEdgeConditions(t *testing.T) {
+	t.Parallel()
+
+	// Only the edge whose condition holds for the output of start is taken.
+	dag, err := graph.BuildDAG(&graph.WorkflowDefinition{
+		Nodes: []graph.NodeDef{
+			{ID: "start", Type: "trigger_manual"},
+			{ID: "small", Type: "transform"},
+			{ID: "large", Type: "transform"},
+		},
+		Edges: []graph.EdgeDef{
+			{Source: "start", Target: "small", Condition: "amount < 100"},
+			{Source: "start", Target: "large", Condition: "amount >= 100"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildDAG() error = %v", err)
+	}
+
+	s := NewScheduler(dag, echoExecutor{}, DefaultConfig(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	result, err := s.Execute(context.Background(), "exec-1", json.RawMessage(`{"amount":250}`))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if _, ok := result.Outputs["large"]; !ok {
+		t.Errorf("large did not run")
+	}
+	if !s.state.SkippedNodes["small"] {
+		t.Errorf("small was not skipped")
+	}
+}
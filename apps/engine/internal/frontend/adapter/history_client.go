@@ -3,12 +3,16 @@ package adapter
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	apiv1 "github.com/linkflow/engine/api/gen/linkflow/api/v1"
 	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
 	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
 	"github.com/linkflow/engine/internal/frontend"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -22,6 +26,34 @@ func NewHistoryClient(conn *grpc.ClientConn) *HistoryClient {
 	}
 }
 
+func (c *HistoryClient) StartWorkflowExecution(ctx context.Context, req *frontend.StartWorkflowExecutionRequest) (*frontend.StartWorkflowExecutionResponse, error) {
+	protoReq := &historyv1.StartWorkflowExecutionRequest{
+		Namespace:             req.Namespace,
+		WorkflowId:            req.WorkflowID,
+		WorkflowType:          &apiv1.WorkflowType{Name: req.WorkflowType},
+		TaskQueue:             &apiv1.TaskQueue{Name: req.TaskQueue},
+		Input:                 &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: req.Input}}},
+		ExecutionTimeout:      durationpb.New(req.WorkflowExecutionTimeout),
+		RunTimeout:            durationpb.New(req.WorkflowRunTimeout),
+		TaskTimeout:           durationpb.New(req.WorkflowTaskTimeout),
+		RequestId:             req.RequestID,
+		WorkflowIdReusePolicy: mapWorkflowIDReusePolicy(req.WorkflowIDReusePolicy),
+	}
+
+	resp, err := c.client.StartWorkflowExecution(ctx, protoReq)
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return nil, fmt.Errorf("%w: %s", frontend.ErrWorkflowAlreadyStarted, status.Convert(err).Message())
+		}
+		return nil, err
+	}
+
+	return &frontend.StartWorkflowExecutionResponse{
+		RunID:   resp.GetRunId(),
+		Started: resp.GetStarted(),
+	}, nil
+}
+
 func (c *HistoryClient) RecordEvent(ctx context.Context, req *frontend.RecordEventRequest) error {
 	event := &historyv1.HistoryEvent{
 		EventId:   1,
@@ -55,6 +87,72 @@ func (c *HistoryClient) RecordEvent(ctx context.Context, req *frontend.RecordEve
 	return err
 }
 
+func (c *HistoryClient) SignalWorkflowExecution(ctx context.Context, req *frontend.SignalWorkflowExecutionRequest) error {
+	protoReq := &historyv1.SignalWorkflowExecutionRequest{
+		Namespace: req.Namespace,
+		WorkflowExecution: &commonv1.WorkflowExecution{
+			WorkflowId: req.WorkflowID,
+			RunId:      req.RunID,
+		},
+		SignalName: req.SignalName,
+		Input:      &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: req.Input}}},
+		RequestId:  req.RequestID,
+	}
+
+	_, err := c.client.SignalWorkflowExecution(ctx, protoReq)
+	return err
+}
+
+func (c *HistoryClient) RequestCancelWorkflowExecution(ctx context.Context, req *frontend.RequestCancelWorkflowExecutionRequest) error {
+	protoReq := &historyv1.RequestCancelWorkflowExecutionRequest{
+		Namespace: req.Namespace,
+		WorkflowExecution: &commonv1.WorkflowExecution{
+			WorkflowId: req.WorkflowID,
+			RunId:      req.RunID,
+		},
+		Reason:    req.Reason,
+		Identity:  req.Identity,
+		RequestId: req.RequestID,
+	}
+
+	_, err := c.client.RequestCancelWorkflowExecution(ctx, protoReq)
+	return err
+}
+
+func (c *HistoryClient) QueryWorkflow(ctx context.Context, req *frontend.QueryWorkflowRequest) (*frontend.QueryWorkflowResponse, error) {
+	protoReq := &historyv1.QueryWorkflowRequest{
+		Namespace: req.Namespace,
+		WorkflowExecution: &commonv1.WorkflowExecution{
+			WorkflowId: req.WorkflowID,
+			RunId:      req.RunID,
+		},
+		QueryType: req.QueryType,
+		QueryArgs: &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: req.QueryArgs}}},
+	}
+	if req.Timeout > 0 {
+		protoReq.Timeout = durationpb.New(req.Timeout)
+	}
+
+	resp, err := c.client.QueryWorkflow(ctx, protoReq)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.NotFound:
+			return nil, fmt.Errorf("%w: %s", frontend.ErrExecutionNotFound, status.Convert(err).Message())
+		case codes.InvalidArgument:
+			return nil, fmt.Errorf("%w: %s", frontend.ErrQueryFailed, status.Convert(err).Message())
+		case codes.DeadlineExceeded:
+			return nil, fmt.Errorf("%w: %s", frontend.ErrQueryTimedOut, status.Convert(err).Message())
+		}
+		return nil, err
+	}
+
+	var result []byte
+	if payloads := resp.GetQueryResult().GetPayloads(); len(payloads) > 0 {
+		result = payloads[0].GetData()
+	}
+	return &frontend.QueryWorkflowResponse{QueryResult: result}, nil
+}
+
 func (c *HistoryClient) GetHistory(ctx context.Context, req *frontend.GetHistoryRequest) (*frontend.GetHistoryResponse, error) {
 	protoReq := &historyv1.GetHistoryRequest{
 		Namespace: req.NamespaceID,
@@ -107,6 +205,10 @@ func extractAttributes(e *historyv1.HistoryEvent) ([]byte, error) {
 		if a := e.GetExecutionFailedAttributes(); a != nil {
 			attrs = a
 		}
+	case commonv1.EventType_EVENT_TYPE_EXECUTION_TIMED_OUT:
+		if a := e.GetExecutionTimedOutAttributes(); a != nil {
+			attrs = a
+		}
 	case commonv1.EventType_EVENT_TYPE_NODE_SCHEDULED:
 		if a := e.GetNodeScheduledAttributes(); a != nil {
 			attrs = a
@@ -123,6 +225,18 @@ func extractAttributes(e *historyv1.HistoryEvent) ([]byte, error) {
 		if a := e.GetNodeFailedAttributes(); a != nil {
 			attrs = a
 		}
+	case commonv1.EventType_EVENT_TYPE_NODE_TIMED_OUT:
+		if a := e.GetNodeTimedOutAttributes(); a != nil {
+			attrs = a
+		}
+	case commonv1.EventType_EVENT_TYPE_NODE_CANCELLED:
+		if a := e.GetNodeCancelledAttributes(); a != nil {
+			attrs = a
+		}
+	case commonv1.EventType_EVENT_TYPE_EXECUTION_CANCEL_REQUESTED:
+		if a := e.GetExecutionCancelRequestedAttributes(); a != nil {
+			attrs = a
+		}
 	case commonv1.EventType_EVENT_TYPE_TIMER_STARTED:
 		if a := e.GetTimerStartedAttributes(); a != nil {
 			attrs = a
@@ -155,16 +269,42 @@ func (c *HistoryClient) GetMutableState(ctx context.Context, key frontend.Execut
 		return nil, err
 	}
 
+	children := make(map[int64]*frontend.ChildExecutionInfo, len(resp.GetPendingChildren()))
+	for _, child := range resp.GetPendingChildren() {
+		children[child.GetInitiatedEventId()] = &frontend.ChildExecutionInfo{
+			InitiatedID:  child.GetInitiatedEventId(),
+			StartedID:    child.GetStartedEventId(),
+			Namespace:    key.NamespaceID,
+			WorkflowID:   child.GetWorkflowExecution().GetWorkflowId(),
+			RunID:        child.GetWorkflowExecution().GetRunId(),
+			WorkflowType: child.GetWorkflowType(),
+		}
+	}
+
+	var limits *frontend.HistoryLimits
+	if l := resp.GetHistoryLimits(); l != nil {
+		limits = &frontend.HistoryLimits{
+			SizeWarn:   l.GetSizeWarnBytes(),
+			SizeLimit:  l.GetSizeLimitBytes(),
+			CountWarn:  l.GetCountWarn(),
+			CountLimit: l.GetCountLimit(),
+		}
+	}
+
 	return &frontend.MutableState{
 		ExecutionInfo: &frontend.WorkflowExecution{
-			WorkflowID:   resp.WorkflowExecution.GetWorkflowId(),
-			RunID:        resp.WorkflowExecution.GetRunId(),
-			Status:       mapExecutionStatus(resp.WorkflowStatus),
-			WorkflowType: resp.WorkflowType,
-			TaskQueue:    resp.TaskQueue,
+			WorkflowID:    resp.WorkflowExecution.GetWorkflowId(),
+			RunID:         resp.WorkflowExecution.GetRunId(),
+			Status:        mapExecutionStatus(resp.WorkflowStatus),
+			WorkflowType:  resp.WorkflowType,
+			TaskQueue:     resp.TaskQueue,
+			HistoryLength: resp.GetHistoryLength(),
 		},
+		NextEventID:     resp.GetNextEventId(),
 		ActivityInfos:   make(map[int64]*frontend.ActivityInfo),
-		ChildExecutions: make(map[int64]*frontend.ChildExecutionInfo),
+		ChildExecutions: children,
+		HistorySize:     resp.GetHistorySize(),
+		HistoryLimits:   limits,
 	}, nil
 }
 
@@ -180,8 +320,6 @@ func mapEventType(eventType string) commonv1.EventType {
 		return commonv1.EventType_EVENT_TYPE_EXECUTION_COMPLETED
 	case "WorkflowExecutionFailed":
 		return commonv1.EventType_EVENT_TYPE_EXECUTION_FAILED
-	case "WorkflowExecutionSignaled":
-		return commonv1.EventType_EVENT_TYPE_SIGNAL_RECEIVED
 	case "WorkflowExecutionTerminated":
 		return commonv1.EventType_EVENT_TYPE_EXECUTION_TERMINATED
 	case "ActivityTaskScheduled", "NodeScheduled":
@@ -197,6 +335,21 @@ func mapEventType(eventType string) commonv1.EventType {
 	}
 }
 
+func mapWorkflowIDReusePolicy(policy frontend.WorkflowIDReusePolicy) commonv1.WorkflowIdReusePolicy {
+	switch policy {
+	case frontend.WorkflowIDReusePolicyAllowDuplicate:
+		return commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE
+	case frontend.WorkflowIDReusePolicyAllowDuplicateFailedOnly:
+		return commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE_FAILED_ONLY
+	case frontend.WorkflowIDReusePolicyRejectDuplicate:
+		return commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE
+	case frontend.WorkflowIDReusePolicyTerminateIfRunning:
+		return commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_TERMINATE_IF_RUNNING
+	default:
+		return commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_UNSPECIFIED
+	}
+}
+
 func mapExecutionStatus(status commonv1.ExecutionStatus) frontend.ExecutionStatus {
 	switch status {
 	case commonv1.ExecutionStatus_EXECUTION_STATUS_RUNNING:
@@ -211,6 +364,8 @@ func mapExecutionStatus(status commonv1.ExecutionStatus) frontend.ExecutionStatu
 		return frontend.ExecutionStatusTerminated
 	case commonv1.ExecutionStatus_EXECUTION_STATUS_TIMED_OUT:
 		return frontend.ExecutionStatusTimedOut
+	case commonv1.ExecutionStatus_EXECUTION_STATUS_CONTINUED_AS_NEW:
+		return frontend.ExecutionStatusContinuedAsNew
 	default:
 		return frontend.ExecutionStatusRunning
 	}
@@ -222,6 +222,10 @@ func (c *RedisConsumer) executeWithRetry(ctx context.Context, req *StartWorkflow
 		}
 
 		lastErr = err
+		if errors.Is(err, ErrWorkflowAlreadyStarted) {
+			// The reuse policy will reject the start again.
+			break
+		}
 		c.logger.Warn("workflow execution failed",
 			slog.String("job_id", job.JobID),
 			slog.Int("attempt", attempt),
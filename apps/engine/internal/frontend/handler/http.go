@@ -3,6 +3,7 @@ package handler
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"time"
@@ -35,8 +36,10 @@ func (h *HTTPHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /api/v1/workflows/execute", h.securityMiddleware(h.StartWorkflow))
 	mux.HandleFunc("GET /api/v1/workspaces/{workspace_id}/executions/{execution_id}", h.securityMiddleware(h.GetExecution))
 	mux.HandleFunc("POST /api/v1/workspaces/{workspace_id}/executions/{execution_id}/cancel", h.securityMiddleware(h.CancelExecution))
+	mux.HandleFunc("POST /api/v1/workspaces/{workspace_id}/executions/{execution_id}/terminate", h.securityMiddleware(h.TerminateExecution))
 	mux.HandleFunc("POST /api/v1/workspaces/{workspace_id}/executions/{execution_id}/retry", h.securityMiddleware(h.RetryExecution))
 	mux.HandleFunc("POST /api/v1/workspaces/{workspace_id}/executions/{execution_id}/signal", h.securityMiddleware(h.SendSignal))
+	mux.HandleFunc("POST /api/v1/workspaces/{workspace_id}/executions/{execution_id}/query", h.securityMiddleware(h.QueryExecution))
 
 	// List executions
 	mux.HandleFunc("GET /api/v1/workspaces/{workspace_id}/executions", h.securityMiddleware(h.ListExecutions))
@@ -77,6 +80,20 @@ type StartWorkflowRequest struct {
 	TaskQueue      string                 `json:"task_queue,omitempty"`
 	Priority       int                    `json:"priority,omitempty"`
 	CallbackURL    string                 `json:"callback_url,omitempty"`
+
+	// WorkflowIDReusePolicy is one of allow_duplicate,
+	// allow_duplicate_failed_only, reject_duplicate or terminate_if_running.
+	// It defaults to allowing a new run once the previous one closed.
+	WorkflowIDReusePolicy string `json:"workflow_id_reuse_policy,omitempty"`
+}
+
+// workflowIDReusePolicies maps the reuse policy names of the HTTP API.
+var workflowIDReusePolicies = map[string]frontend.WorkflowIDReusePolicy{
+	"":                            frontend.WorkflowIDReusePolicyUnspecified,
+	"allow_duplicate":             frontend.WorkflowIDReusePolicyAllowDuplicate,
+	"allow_duplicate_failed_only": frontend.WorkflowIDReusePolicyAllowDuplicateFailedOnly,
+	"reject_duplicate":            frontend.WorkflowIDReusePolicyRejectDuplicate,
+	"terminate_if_running":        frontend.WorkflowIDReusePolicyTerminateIfRunning,
 }
 
 // StartWorkflowResponse is the response from starting a workflow.
@@ -111,6 +128,12 @@ func (h *HTTPHandler) StartWorkflow(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	reusePolicy, ok := workflowIDReusePolicies[req.WorkflowIDReusePolicy]
+	if !ok {
+		h.writeError(w, http.StatusBadRequest, "invalid workflow_id_reuse_policy")
+		return
+	}
+
 	// Generate execution ID if not provided
 	if req.ExecutionID == "" {
 		req.ExecutionID = generateExecutionID()
@@ -124,10 +147,16 @@ func (h *HTTPHandler) StartWorkflow(w http.ResponseWriter, r *http.Request) {
 		TaskQueue:  req.TaskQueue,
 		RequestID:  req.IdempotencyKey,
 		Input:      inputBytes,
+
+		WorkflowIDReusePolicy: reusePolicy,
 	}
 
 	resp, err := h.service.StartWorkflowExecution(ctx, frontendReq)
 	if err != nil {
+		if errors.Is(err, frontend.ErrWorkflowAlreadyStarted) {
+			h.writeError(w, http.StatusConflict, err.Error())
+			return
+		}
 		h.logger.Error("failed to start workflow",
 			slog.String("workspace_id", req.WorkspaceID),
 			slog.String("workflow_id", req.WorkflowID),
@@ -147,7 +176,7 @@ func (h *HTTPHandler) StartWorkflow(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, http.StatusOK, StartWorkflowResponse{
 		ExecutionID: req.ExecutionID,
 		RunID:       resp.RunID,
-		Started:     true,
+		Started:     resp.Started,
 	})
 }
 
@@ -216,6 +245,8 @@ func (h *HTTPHandler) ListExecutions(w http.ResponseWriter, r *http.Request) {
 }
 
 // POST /api/v1/workspaces/{workspace_id}/executions/{execution_id}/cancel.
+// The execution runs its cleanup nodes before it closes as canceled, so the
+// response only confirms that the cancel was requested.
 func (h *HTTPHandler) CancelExecution(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	workspaceID := r.PathValue("workspace_id")
@@ -226,6 +257,33 @@ func (h *HTTPHandler) CancelExecution(w http.ResponseWriter, r *http.Request) {
 	}
 	json.NewDecoder(r.Body).Decode(&body)
 
+	req := &frontend.RequestCancelWorkflowExecutionRequest{
+		Namespace:  workspaceID,
+		WorkflowID: executionID,
+		Reason:     body.Reason,
+	}
+
+	if err := h.service.RequestCancelWorkflowExecution(ctx, req); err != nil {
+		h.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.writeJSON(w, http.StatusAccepted, map[string]string{"status": "cancel_requested"})
+}
+
+// POST /api/v1/workspaces/{workspace_id}/executions/{execution_id}/terminate.
+// Unlike a cancel, a terminate stops the execution at once without running
+// any of its nodes.
+func (h *HTTPHandler) TerminateExecution(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workspaceID := r.PathValue("workspace_id")
+	executionID := r.PathValue("execution_id")
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
 	req := &frontend.TerminateWorkflowExecutionRequest{
 		Namespace:  workspaceID,
 		WorkflowID: executionID,
@@ -237,7 +295,7 @@ func (h *HTTPHandler) CancelExecution(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.writeJSON(w, http.StatusOK, map[string]string{"status": "canceled"})
+	h.writeJSON(w, http.StatusOK, map[string]string{"status": "terminated"})
 }
 
 // RetryExecutionRequest contains optional retry configuration.
@@ -411,6 +469,7 @@ func (h *HTTPHandler) SendSignal(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		SignalName string      `json:"signal_name"`
 		Data       interface{} `json:"data"`
+		RequestID  string      `json:"request_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		h.writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -424,6 +483,7 @@ func (h *HTTPHandler) SendSignal(w http.ResponseWriter, r *http.Request) {
 		WorkflowID: executionID,
 		SignalName: body.SignalName,
 		Input:      inputData,
+		RequestID:  body.RequestID,
 	}
 
 	if err := h.service.SignalWorkflowExecution(ctx, req); err != nil {
@@ -434,6 +494,69 @@ func (h *HTTPHandler) SendSignal(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, http.StatusOK, map[string]string{"status": "signal_sent"})
 }
 
+// POST /api/v1/workspaces/{workspace_id}/executions/{execution_id}/query.
+// Built-in query types such as __node_states are answered by the engine;
+// any other type is answered by a worker, within timeout_seconds.
+func (h *HTTPHandler) QueryExecution(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	workspaceID := r.PathValue("workspace_id")
+	executionID := r.PathValue("execution_id")
+
+	var body struct {
+		QueryType      string      `json:"query_type"`
+		Args           interface{} `json:"args"`
+		TimeoutSeconds int         `json:"timeout_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if body.QueryType == "" {
+		h.writeError(w, http.StatusBadRequest, "query_type is required")
+		return
+	}
+
+	var args []byte
+	if body.Args != nil {
+		args, _ = json.Marshal(body.Args)
+	}
+
+	req := &frontend.QueryWorkflowRequest{
+		Namespace:  workspaceID,
+		WorkflowID: executionID,
+		QueryType:  body.QueryType,
+		QueryArgs:  args,
+		Timeout:    time.Duration(body.TimeoutSeconds) * time.Second,
+	}
+
+	resp, err := h.service.QueryWorkflow(ctx, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, frontend.ErrExecutionNotFound):
+			h.writeError(w, http.StatusNotFound, "Execution not found")
+		case errors.Is(err, frontend.ErrQueryFailed):
+			h.writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, frontend.ErrQueryTimedOut):
+			h.writeError(w, http.StatusGatewayTimeout, err.Error())
+		default:
+			h.writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	result := json.RawMessage("null")
+	if json.Valid(resp.QueryResult) {
+		result = resp.QueryResult
+	} else if len(resp.QueryResult) > 0 {
+		result, _ = json.Marshal(string(resp.QueryResult))
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"query_type": body.QueryType,
+		"result":     result,
+	})
+}
+
 // Health check endpoint.
 func (h *HTTPHandler) Health(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
@@ -491,6 +614,8 @@ func statusToString(status frontend.ExecutionStatus) string {
 		return "terminated"
 	case frontend.ExecutionStatusTimedOut:
 		return "timed_out"
+	case frontend.ExecutionStatusContinuedAsNew:
+		return "continued_as_new"
 	default:
 		return "pending"
 	}
@@ -50,6 +50,17 @@ func (h *WorkflowHandler) TerminateWorkflowExecution(
 	return h.service.TerminateWorkflowExecution(ctx, req)
 }
 
+func (h *WorkflowHandler) RequestCancelWorkflowExecution(
+	ctx context.Context,
+	req *frontend.RequestCancelWorkflowExecutionRequest,
+) error {
+	if err := validator.ValidateRequestCancelWorkflowRequest(req); err != nil {
+		return err
+	}
+
+	return h.service.RequestCancelWorkflowExecution(ctx, req)
+}
+
 func (h *WorkflowHandler) QueryWorkflow(
 	ctx context.Context,
 	req *frontend.QueryWorkflowRequest,
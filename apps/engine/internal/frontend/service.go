@@ -2,17 +2,33 @@ package frontend
 
 import (
 	"context"
-	"crypto/rand"
-	"fmt"
+	"errors"
 	"log/slog"
-	"time"
 
 	"github.com/linkflow/engine/internal/frontend/namespace"
 	"github.com/linkflow/engine/internal/frontend/ratelimit"
 )
 
+var (
+	// ErrWorkflowAlreadyStarted is returned when the workflow ID reuse
+	// policy of a start request does not allow a new run.
+	ErrWorkflowAlreadyStarted = errors.New("workflow execution already started")
+
+	ErrExecutionNotFound = errors.New("workflow execution not found")
+
+	// ErrQueryFailed is returned for a query of an unknown type or one the
+	// worker could not answer, ErrQueryTimedOut for a query no worker
+	// answered in time.
+	ErrQueryFailed   = errors.New("query failed")
+	ErrQueryTimedOut = errors.New("query timed out")
+)
+
 type HistoryClient interface {
+	StartWorkflowExecution(ctx context.Context, req *StartWorkflowExecutionRequest) (*StartWorkflowExecutionResponse, error)
 	RecordEvent(ctx context.Context, req *RecordEventRequest) error
+	QueryWorkflow(ctx context.Context, req *QueryWorkflowRequest) (*QueryWorkflowResponse, error)
+	SignalWorkflowExecution(ctx context.Context, req *SignalWorkflowExecutionRequest) error
+	RequestCancelWorkflowExecution(ctx context.Context, req *RequestCancelWorkflowExecutionRequest) error
 	GetHistory(ctx context.Context, req *GetHistoryRequest) (*GetHistoryResponse, error)
 	GetMutableState(ctx context.Context, key ExecutionKey) (*MutableState, error)
 }
@@ -75,54 +91,17 @@ func (s *Service) Logger() *slog.Logger {
 	return s.logger
 }
 
+// StartWorkflowExecution starts a run of the workflow ID. History checks the
+// request against the workflow ID's current run, so a retried request gets
+// the run it created back and a conflicting one fails with
+// ErrWorkflowAlreadyStarted. History dispatches the first workflow task
+// through its transfer queue.
 func (s *Service) StartWorkflowExecution(ctx context.Context, req *StartWorkflowExecutionRequest) (*StartWorkflowExecutionResponse, error) {
-	runID := req.RequestID
-	if runID == "" {
-		runID = generateRunID()
-	}
-
-	eventReq := &RecordEventRequest{
-		NamespaceID: req.Namespace,
-		WorkflowID:  req.WorkflowID,
-		RunID:       runID,
-		EventType:   "WorkflowExecutionStarted",
-		Attributes: &ExecutionStartedAttributes{
-			WorkflowType: req.WorkflowType,
-			TaskQueue:    req.TaskQueue,
-			Input:        req.Input,
-		},
-	}
-	if err := s.historyClient.RecordEvent(ctx, eventReq); err != nil {
-		return nil, err
-	}
-
-	taskReq := &AddTaskRequest{
-		NamespaceID:      req.Namespace,
-		WorkflowID:       req.WorkflowID,
-		RunID:            runID,
-		TaskQueue:        req.TaskQueue,
-		TaskType:         TaskTypeWorkflow,
-		TaskInfo:         nil,
-		ScheduledEventID: 1,
-	}
-	if err := s.matchingClient.AddTask(ctx, taskReq); err != nil {
-		return nil, err
-	}
-
-	return &StartWorkflowExecutionResponse{
-		RunID: runID,
-	}, nil
+	return s.historyClient.StartWorkflowExecution(ctx, req)
 }
 
 func (s *Service) SignalWorkflowExecution(ctx context.Context, req *SignalWorkflowExecutionRequest) error {
-	eventReq := &RecordEventRequest{
-		NamespaceID: req.Namespace,
-		WorkflowID:  req.WorkflowID,
-		RunID:       req.RunID,
-		EventType:   "WorkflowExecutionSignaled",
-		Attributes:  req.Input,
-	}
-	return s.historyClient.RecordEvent(ctx, eventReq)
+	return s.historyClient.SignalWorkflowExecution(ctx, req)
 }
 
 func (s *Service) TerminateWorkflowExecution(ctx context.Context, req *TerminateWorkflowExecutionRequest) error {
@@ -136,23 +115,18 @@ func (s *Service) TerminateWorkflowExecution(ctx context.Context, req *Terminate
 	return s.historyClient.RecordEvent(ctx, eventReq)
 }
 
-func (s *Service) QueryWorkflow(ctx context.Context, req *QueryWorkflowRequest) (*QueryWorkflowResponse, error) {
-	key := ExecutionKey{
-		NamespaceID: req.Namespace,
-		WorkflowID:  req.WorkflowID,
-		RunID:       req.RunID,
-	}
-
-	state, err := s.historyClient.GetMutableState(ctx, key)
-	if err != nil {
-		return nil, err
-	}
-
-	_ = state
+// RequestCancelWorkflowExecution asks the execution to cancel. Unlike
+// TerminateWorkflowExecution it returns before the execution closes, which
+// happens once the workflow has run its cleanup.
+func (s *Service) RequestCancelWorkflowExecution(ctx context.Context, req *RequestCancelWorkflowExecutionRequest) error {
+	return s.historyClient.RequestCancelWorkflowExecution(ctx, req)
+}
 
-	return &QueryWorkflowResponse{
-		QueryResult: nil,
-	}, nil
+// QueryWorkflow answers a read-only query about an execution; an empty RunID
+// queries its current run. History answers the built-in queries such as
+// __node_states itself and routes any other query type to a worker.
+func (s *Service) QueryWorkflow(ctx context.Context, req *QueryWorkflowRequest) (*QueryWorkflowResponse, error) {
+	return s.historyClient.QueryWorkflow(ctx, req)
 }
 
 func (s *Service) GetExecution(ctx context.Context, req *GetExecutionRequest) (*GetExecutionResponse, error) {
@@ -215,22 +189,7 @@ func (s *Service) DescribeExecution(ctx context.Context, req *DescribeExecutionR
 		Execution:         state.ExecutionInfo,
 		PendingActivities: pendingActivities,
 		PendingChildExecs: pendingChildren,
+		HistorySize:       state.HistorySize,
+		HistoryLimits:     state.HistoryLimits,
 	}, nil
 }
-
-func generateRunID() string {
-	return "run-" + secureRandomString(32)
-}
-
-func secureRandomString(n int) string {
-	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
-	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
-		// Fallback to a UUID-like format if crypto/rand fails
-		return fmt.Sprintf("%d", time.Now().UnixNano())
-	}
-	for i := range b {
-		b[i] = letters[int(b[i])%len(letters)]
-	}
-	return string(b)
-}
@@ -9,11 +9,31 @@ type StubHistoryClient struct {
 	Logger *slog.Logger
 }
 
+func (c *StubHistoryClient) StartWorkflowExecution(ctx context.Context, req *StartWorkflowExecutionRequest) (*StartWorkflowExecutionResponse, error) {
+	c.Logger.Info("STUB: StartWorkflowExecution", "namespace", req.Namespace, "workflow_id", req.WorkflowID)
+	return &StartWorkflowExecutionResponse{RunID: req.RequestID, Started: true}, nil
+}
+
 func (c *StubHistoryClient) RecordEvent(ctx context.Context, req *RecordEventRequest) error {
 	c.Logger.Info("STUB: RecordEvent", "namespace", req.NamespaceID, "workflow_id", req.WorkflowID, "event_type", req.EventType)
 	return nil
 }
 
+func (c *StubHistoryClient) SignalWorkflowExecution(ctx context.Context, req *SignalWorkflowExecutionRequest) error {
+	c.Logger.Info("STUB: SignalWorkflowExecution", "namespace", req.Namespace, "workflow_id", req.WorkflowID, "signal_name", req.SignalName)
+	return nil
+}
+
+func (c *StubHistoryClient) RequestCancelWorkflowExecution(ctx context.Context, req *RequestCancelWorkflowExecutionRequest) error {
+	c.Logger.Info("STUB: RequestCancelWorkflowExecution", "namespace", req.Namespace, "workflow_id", req.WorkflowID)
+	return nil
+}
+
+func (c *StubHistoryClient) QueryWorkflow(ctx context.Context, req *QueryWorkflowRequest) (*QueryWorkflowResponse, error) {
+	c.Logger.Info("STUB: QueryWorkflow", "namespace", req.Namespace, "workflow_id", req.WorkflowID, "query_type", req.QueryType)
+	return &QueryWorkflowResponse{}, nil
+}
+
 func (c *StubHistoryClient) GetHistory(ctx context.Context, req *GetHistoryRequest) (*GetHistoryResponse, error) {
 	c.Logger.Info("STUB: GetHistory")
 	return &GetHistoryResponse{}, nil
@@ -20,15 +20,35 @@ type StartWorkflowExecutionRequest struct {
 	WorkflowRunTimeout       time.Duration
 	WorkflowTaskTimeout      time.Duration
 	RequestID                string
+	WorkflowIDReusePolicy    WorkflowIDReusePolicy
 	RetryPolicy              *RetryPolicy
 	Memo                     map[string][]byte
 	SearchAttributes         map[string][]byte
 }
 
+// StartWorkflowExecutionResponse carries the run a start request resolved
+// to. Started is false when the request was a retry of an earlier start and
+// RunID is the run that start created.
 type StartWorkflowExecutionResponse struct {
-	RunID string
+	RunID   string
+	Started bool
 }
 
+// WorkflowIDReusePolicy decides whether a workflow ID may start a new run
+// next to its current run. A running current run rejects the start under
+// every policy but WorkflowIDReusePolicyTerminateIfRunning; the policies
+// differ in which closed runs they allow to be followed. The unspecified
+// policy allows any.
+type WorkflowIDReusePolicy int32
+
+const (
+	WorkflowIDReusePolicyUnspecified WorkflowIDReusePolicy = iota
+	WorkflowIDReusePolicyAllowDuplicate
+	WorkflowIDReusePolicyAllowDuplicateFailedOnly
+	WorkflowIDReusePolicyRejectDuplicate
+	WorkflowIDReusePolicyTerminateIfRunning
+)
+
 type SignalWorkflowExecutionRequest struct {
 	Namespace  string
 	WorkflowID string
@@ -46,12 +66,27 @@ type TerminateWorkflowExecutionRequest struct {
 	Details    []byte
 }
 
+// RequestCancelWorkflowExecutionRequest asks a workflow execution to cancel.
+// The execution runs its cleanup before it closes as canceled.
+type RequestCancelWorkflowExecutionRequest struct {
+	Namespace  string
+	WorkflowID string
+	RunID      string
+	Reason     string
+	Identity   string
+	RequestID  string
+}
+
 type QueryWorkflowRequest struct {
 	Namespace  string
 	WorkflowID string
 	RunID      string
 	QueryType  string
 	QueryArgs  []byte
+
+	// Timeout bounds the wait for a worker to answer a custom query. History
+	// applies its default when it is zero.
+	Timeout time.Duration
 }
 
 type QueryWorkflowResponse struct {
@@ -90,6 +125,18 @@ type DescribeExecutionResponse struct {
 	Execution         *WorkflowExecution
 	PendingActivities []*PendingActivity
 	PendingChildExecs []*PendingChildExecution
+	HistorySize       int64
+	HistoryLimits     *HistoryLimits
+}
+
+// HistoryLimits are the limits on an execution's history: its size in bytes
+// and its number of events. Crossing a warn limit records a warning marker;
+// reaching a hard limit fails the execution.
+type HistoryLimits struct {
+	SizeWarn   int64
+	SizeLimit  int64
+	CountWarn  int64
+	CountLimit int64
 }
 
 type WorkflowExecution struct {
@@ -204,6 +251,8 @@ type MutableState struct {
 	ChildExecutions map[int64]*ChildExecutionInfo
 	SignalInfos     map[int64]*SignalInfo
 	BufferedEvents  []*HistoryEvent
+	HistorySize     int64
+	HistoryLimits   *HistoryLimits
 }
 
 type ActivityInfo struct {
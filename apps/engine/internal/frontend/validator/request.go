@@ -110,6 +110,18 @@ func ValidateTerminateWorkflowRequest(req *frontend.TerminateWorkflowExecutionRe
 	return nil
 }
 
+func ValidateRequestCancelWorkflowRequest(req *frontend.RequestCancelWorkflowExecutionRequest) error {
+	if err := ValidateNamespace(req.Namespace); err != nil {
+		return fmt.Errorf("namespace: %w", err)
+	}
+
+	if err := ValidateWorkflowID(req.WorkflowID); err != nil {
+		return fmt.Errorf("workflow_id: %w", err)
+	}
+
+	return nil
+}
+
 func ValidateQueryWorkflowRequest(req *frontend.QueryWorkflowRequest) error {
 	if err := ValidateNamespace(req.Namespace); err != nil {
 		return fmt.Errorf("namespace: %w", err)
@@ -0,0 +1,120 @@
+package history
+
+import (
+	"time"
+
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/types"
+	"github.com/linkflow/engine/internal/retry"
+)
+
+// defaultActivityStartToClose bounds a node that was scheduled without a
+// start-to-close timeout, so a hung executor cannot block its workflow
+// forever.
+const defaultActivityStartToClose = 10 * time.Minute
+
+// activityRetryPolicy returns the retry policy for a node retry policy. The
+// fields the node leaves unset, including its maximum attempts, take the
+// defaults the worker retries with too, so a node is never retried forever.
+func activityRetryPolicy(policy *types.RetryPolicy) *retry.Policy {
+	p := retry.DefaultPolicy()
+	if policy.InitialInterval > 0 {
+		p.InitialInterval = policy.InitialInterval
+	}
+	if policy.BackoffCoefficient >= 1 {
+		p.BackoffCoefficient = policy.BackoffCoefficient
+	}
+	if policy.MaxInterval > 0 {
+		p.MaximumInterval = policy.MaxInterval
+	}
+	if p.MaximumInterval < p.InitialInterval {
+		p.MaximumInterval = p.InitialInterval
+	}
+	if policy.MaxAttempts > 0 {
+		p.MaximumAttempts = policy.MaxAttempts
+	}
+	if policy.NonRetryableErrors != nil {
+		p.NonRetryableErrors = policy.NonRetryableErrors
+	}
+	return p
+}
+
+// activityRetryDelay decides whether the failed current attempt of an
+// activity is retried. It returns the delay before the next attempt and
+// types.RetryStateInProgress if it is, and the retry state to record on the
+// failure otherwise.
+func activityRetryDelay(ai *types.ActivityInfo, errorType, message string) (time.Duration, int32) {
+	if ai.RetryPolicy == nil {
+		return 0, types.RetryStateRetryPolicyNotSet
+	}
+	policy := activityRetryPolicy(ai.RetryPolicy)
+	if !policy.ShouldRetry(ai.Attempt, errorType, message) {
+		if ai.Attempt >= policy.MaximumAttempts {
+			return 0, types.RetryStateMaximumAttemptsReached
+		}
+		return 0, types.RetryStateNonRetryableFailure
+	}
+	return policy.NextRetryDelay(ai.Attempt), types.RetryStateInProgress
+}
+
+// activityTimeoutDeadline returns when the given timeout of a pending
+// activity expires. ok is false if the timeout does not apply to the activity
+// in its current state: it is not configured, the activity has not started
+// yet for start-to-close and heartbeat, or already started for
+// schedule-to-start.
+func activityTimeoutDeadline(ai *types.ActivityInfo, timeoutType string) (deadline time.Time, ok bool) {
+	started := ai.StartedEventID != 0
+	switch timeoutType {
+	case types.TimeoutTypeScheduleToStart:
+		if started || ai.ScheduleTimeout <= 0 {
+			return time.Time{}, false
+		}
+		return ai.ScheduledTime.Add(ai.ScheduleTimeout), true
+	case types.TimeoutTypeStartToClose:
+		if !started || ai.StartToClose <= 0 {
+			return time.Time{}, false
+		}
+		return ai.StartedTime.Add(ai.StartToClose), true
+	case types.TimeoutTypeHeartbeat:
+		if !started || ai.HeartbeatTimeout <= 0 {
+			return time.Time{}, false
+		}
+		last := ai.StartedTime
+		if ai.LastHeartbeat.After(last) {
+			last = ai.LastHeartbeat
+		}
+		return last.Add(ai.HeartbeatTimeout), true
+	}
+	return time.Time{}, false
+}
+
+// activityTimedOutEvent returns the event timing out the activity scheduled
+// at scheduledEventID if the timeout has expired by now. If the timeout still
+// applies but has not expired, because a heartbeat moved it or the timer
+// fired early, it returns the deadline to re-arm the timer for instead.
+func activityTimedOutEvent(state *engine.MutableState, scheduledEventID int64, timeoutType string, now time.Time) (*types.HistoryEvent, time.Time) {
+	if !state.IsWorkflowExecutionRunning() {
+		return nil, time.Time{}
+	}
+	ai, ok := state.GetPendingActivity(scheduledEventID)
+	if !ok {
+		return nil, time.Time{}
+	}
+	deadline, ok := activityTimeoutDeadline(ai, timeoutType)
+	if !ok {
+		return nil, time.Time{}
+	}
+	if now.Before(deadline) {
+		return nil, deadline
+	}
+	return &types.HistoryEvent{
+		EventType: types.EventTypeNodeTimedOut,
+		Timestamp: now,
+		Attributes: &types.NodeTimedOutAttributes{
+			NodeID:           ai.ActivityID,
+			ScheduledEventID: scheduledEventID,
+			StartedEventID:   ai.StartedEventID,
+			TimeoutType:      timeoutType,
+		},
+	}, time.Time{}
+}
@@ -0,0 +1,186 @@
+// Package cache keeps recently used mutable states in memory and serializes
+// updates to the same execution within a history host.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+const DefaultMaxSize = 10000
+
+// Cache is an LRU cache of mutable states keyed by execution. Each entry also
+// carries the execution's lock: Acquire blocks until no other caller in this
+// process is updating the execution. Entries in use are never evicted, so the
+// cache can briefly hold more than its maximum size.
+type Cache struct {
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[types.ExecutionKey]*list.Element
+	lru     *list.List
+}
+
+type entry struct {
+	key     types.ExecutionKey
+	shardID int32
+	lock    chan struct{}
+	refs    int
+	// stale marks an in-use entry whose state was invalidated. The next
+	// caller to lock it drops the state. Guarded by Cache.mu.
+	stale bool
+
+	// Guarded by lock.
+	state *engine.MutableState
+}
+
+// New creates a cache holding up to maxSize mutable states.
+func New(maxSize int) *Cache {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	return &Cache{
+		maxSize: maxSize,
+		entries: make(map[types.ExecutionKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Execution is a locked cache entry. It must be released with Release.
+type Execution struct {
+	cache    *Cache
+	entry    *entry
+	released bool
+}
+
+// Acquire locks the execution and returns its cache entry. It blocks until
+// the lock is free or ctx is done.
+func (c *Cache) Acquire(ctx context.Context, shardID int32, key types.ExecutionKey) (*Execution, error) {
+	c.mu.Lock()
+	var e *entry
+	if elem, ok := c.entries[key]; ok {
+		e = elem.Value.(*entry)
+		c.lru.MoveToFront(elem)
+	} else {
+		e = &entry{key: key, shardID: shardID, lock: make(chan struct{}, 1)}
+		c.entries[key] = c.lru.PushFront(e)
+	}
+	e.refs++
+	c.mu.Unlock()
+
+	select {
+	case e.lock <- struct{}{}:
+	case <-ctx.Done():
+		c.unref(e)
+		return nil, ctx.Err()
+	}
+
+	c.mu.Lock()
+	if e.stale {
+		e.state = nil
+		e.stale = false
+	}
+	c.mu.Unlock()
+
+	return &Execution{cache: c, entry: e}, nil
+}
+
+// State returns the cached mutable state, or nil if it has to be loaded.
+func (x *Execution) State() *engine.MutableState {
+	return x.entry.state
+}
+
+// SetState caches the mutable state. The caller keeps using it; the cache
+// hands the same instance to the next Acquire.
+func (x *Execution) SetState(state *engine.MutableState) {
+	x.entry.state = state
+}
+
+// Release unlocks the execution. A non-nil err means the cached state may be
+// ahead of what was persisted, so it is dropped and reloaded next time.
+func (x *Execution) Release(err error) {
+	if x.released {
+		return
+	}
+	x.released = true
+
+	if err != nil {
+		x.entry.state = nil
+	}
+	<-x.entry.lock
+	x.cache.unref(x.entry)
+}
+
+// Invalidate drops the cached state of an execution.
+func (c *Cache) Invalidate(key types.ExecutionKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.invalidateLocked(elem)
+	}
+}
+
+// InvalidateShard drops every cached state of a shard. It is called when the
+// shard is lost, since another host may change its executions from then on.
+func (c *Cache) InvalidateShard(shardID int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, elem := range c.entries {
+		if elem.Value.(*entry).shardID == shardID {
+			c.invalidateLocked(elem)
+		}
+	}
+}
+
+// Len returns the number of cached executions.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *Cache) unref(e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e.refs--
+	c.evictLocked()
+}
+
+// invalidateLocked drops the state of an entry. An entry in use stays in the
+// cache, so its lock keeps serializing callers, and is marked stale instead:
+// whatever its holders store is dropped by the next Acquire, which loads the
+// state from the store.
+func (c *Cache) invalidateLocked(elem *list.Element) {
+	e := elem.Value.(*entry)
+	if e.refs > 0 {
+		e.stale = true
+		return
+	}
+	c.removeLocked(elem)
+}
+
+// removeLocked unlinks an entry that is not in use.
+func (c *Cache) removeLocked(elem *list.Element) {
+	e := elem.Value.(*entry)
+	if current, ok := c.entries[e.key]; ok && current == elem {
+		delete(c.entries, e.key)
+	}
+	c.lru.Remove(elem)
+}
+
+func (c *Cache) evictLocked() {
+	for elem := c.lru.Back(); elem != nil && c.lru.Len() > c.maxSize; {
+		prev := elem.Prev()
+		if elem.Value.(*entry).refs == 0 {
+			c.removeLocked(elem)
+		}
+		elem = prev
+	}
+}
@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+func testKey(workflowID string) types.ExecutionKey {
+	return types.ExecutionKey{NamespaceID: "default", WorkflowID: workflowID, RunID: "run-1"}
+}
+
+func put(t *testing.T, c *Cache, shardID int32, key types.ExecutionKey) {
+	t.Helper()
+
+	x, err := c.Acquire(context.Background(), shardID, key)
+	if err != nil {
+		t.Fatalf("Acquire(%s) error = %v", key.WorkflowID, err)
+	}
+	x.SetState(engine.NewMutableState(&types.ExecutionInfo{WorkflowID: key.WorkflowID}))
+	x.Release(nil)
+}
+
+func cached(t *testing.T, c *Cache, key types.ExecutionKey) bool {
+	t.Helper()
+
+	x, err := c.Acquire(context.Background(), 0, key)
+	if err != nil {
+		t.Fatalf("Acquire(%s) error = %v", key.WorkflowID, err)
+	}
+	defer x.Release(nil)
+	return x.State() != nil
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New(2)
+	put(t, c, 0, testKey("a"))
+	put(t, c, 0, testKey("b"))
+	put(t, c, 0, testKey("a"))
+	put(t, c, 0, testKey("c"))
+
+	tests := []struct {
+		workflowID string
+		want       bool
+	}{
+		{"c", true},
+		{"a", true},
+		{"b", false},
+	}
+	for _, tt := range tests {
+		if got := cached(t, c, testKey(tt.workflowID)); got != tt.want {
+			t.Errorf("cached(%s) = %v, want %v", tt.workflowID, got, tt.want)
+		}
+	}
+}
+
+func TestCacheReleaseWithErrorDropsState(t *testing.T) {
+	c := New(10)
+	key := testKey("a")
+	put(t, c, 0, key)
+
+	x, err := c.Acquire(context.Background(), 0, key)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	x.Release(types.ErrOptimisticLock)
+
+	if cached(t, c, key) {
+		t.Error("state still cached after a failed update")
+	}
+}
+
+func TestCacheInvalidateShard(t *testing.T) {
+	c := New(10)
+	put(t, c, 1, testKey("a"))
+	put(t, c, 2, testKey("b"))
+
+	c.InvalidateShard(1)
+
+	if cached(t, c, testKey("a")) {
+		t.Error("state of the lost shard still cached")
+	}
+	if !cached(t, c, testKey("b")) {
+		t.Error("state of another shard was dropped")
+	}
+}
+
+func TestCacheInvalidateInUse(t *testing.T) {
+	c := New(10)
+	key := testKey("a")
+
+	x, err := c.Acquire(context.Background(), 1, key)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	c.InvalidateShard(1)
+	x.SetState(engine.NewMutableState(&types.ExecutionInfo{WorkflowID: key.WorkflowID}))
+
+	// The entry is still locked by x, so nobody else gets it meanwhile.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Acquire(ctx, 1, key); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire() while locked error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	x.Release(nil)
+
+	if cached(t, c, key) {
+		t.Error("state stored after the invalidation is still cached")
+	}
+}
+
+func TestCacheSerializesExecution(t *testing.T) {
+	c := New(10)
+	key := testKey("a")
+
+	x, err := c.Acquire(context.Background(), 0, key)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Acquire(ctx, 0, key); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second Acquire() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		y, err := c.Acquire(context.Background(), 0, key)
+		if err == nil {
+			y.Release(nil)
+		}
+		close(acquired)
+	}()
+
+	x.Release(nil)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("waiter did not get the lock after Release")
+	}
+}
@@ -0,0 +1,110 @@
+package history
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+// RequestCancelWorkflowExecution asks a run to cancel. Unlike a terminate it
+// does not close the run: it records ExecutionCancelRequested, which wakes
+// the decider to run the workflow's cleanup and close the run as canceled.
+// Nodes that have not started are canceled right away; started ones are told
+// to stop through their heartbeats. A run that continued as new is followed
+// to the run it continued to; a run that already closed or was already asked
+// to cancel is left as it is.
+func (s *Service) RequestCancelWorkflowExecution(ctx context.Context, req *historyv1.RequestCancelWorkflowExecutionRequest) (*historyv1.RequestCancelWorkflowExecutionResponse, error) {
+	key := types.ExecutionKey{
+		NamespaceID: req.GetNamespace(),
+		WorkflowID:  req.GetWorkflowExecution().GetWorkflowId(),
+		RunID:       req.GetWorkflowExecution().GetRunId(),
+	}
+
+	for key.RunID != "" {
+		var newRunID string
+		err := s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+			if state.ExecutionInfo.Status == types.ExecutionStatusContinuedAsNew {
+				newRunID = state.ExecutionInfo.NewRunID
+			}
+			if !state.IsWorkflowExecutionRunning() || state.ExecutionInfo.CancelRequested {
+				return nil, nil
+			}
+			now := time.Now()
+			events := []*types.HistoryEvent{{
+				EventType: types.EventTypeExecutionCancelRequested,
+				Timestamp: now,
+				Attributes: &types.ExecutionCancelRequestedAttributes{
+					Reason:    req.GetReason(),
+					Identity:  req.GetIdentity(),
+					RequestID: req.GetRequestId(),
+				},
+			}}
+			return append(events, cancelPendingActivities(state, req.GetIdentity(), now)...), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		key.RunID = newRunID
+	}
+
+	return &historyv1.RequestCancelWorkflowExecutionResponse{}, nil
+}
+
+// cancelPendingActivities returns the NodeCanceled events of the pending
+// nodes no worker runs, in the order they were scheduled, and marks the
+// running ones so their next heartbeat tells the worker to stop.
+func cancelPendingActivities(state *engine.MutableState, identity string, now time.Time) []*types.HistoryEvent {
+	scheduledEventIDs := make([]int64, 0, len(state.PendingActivities))
+	for id := range state.PendingActivities {
+		scheduledEventIDs = append(scheduledEventIDs, id)
+	}
+	slices.Sort(scheduledEventIDs)
+
+	var events []*types.HistoryEvent
+	for _, id := range scheduledEventIDs {
+		ai := state.PendingActivities[id]
+		if ai.StartedEventID != 0 {
+			ai.CancelRequested = true
+			continue
+		}
+		events = append(events, &types.HistoryEvent{
+			EventType: types.EventTypeNodeCanceled,
+			Timestamp: now,
+			Attributes: &types.NodeCanceledAttributes{
+				ScheduledEventID: id,
+				Identity:         identity,
+			},
+		})
+	}
+	return events
+}
+
+// RespondActivityTaskCanceled records that a worker stopped a node whose
+// cancel was requested, which wakes the decider like any other close of the
+// node.
+func (s *Service) RespondActivityTaskCanceled(ctx context.Context, req *historyv1.RespondActivityTaskCanceledRequest) (*historyv1.RespondActivityTaskCanceledResponse, error) {
+	key := types.ExecutionKey{
+		NamespaceID: req.GetNamespace(),
+		WorkflowID:  req.GetWorkflowExecution().GetWorkflowId(),
+		RunID:       req.GetWorkflowExecution().GetRunId(),
+	}
+
+	event := &types.HistoryEvent{
+		EventType: types.EventTypeNodeCanceled,
+		Timestamp: time.Now(),
+		Attributes: &types.NodeCanceledAttributes{
+			ScheduledEventID: req.GetScheduledEventId(),
+			Details:          firstPayload(req.GetDetails()),
+			Identity:         req.GetIdentity(),
+		},
+	}
+
+	if err := s.processEvents(ctx, key, []*types.HistoryEvent{event}); err != nil {
+		return nil, err
+	}
+	return &historyv1.RespondActivityTaskCanceledResponse{}, nil
+}
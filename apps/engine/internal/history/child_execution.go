@@ -0,0 +1,272 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
+	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+// fillChildExecutionAttributes fills the fields a start-child command left
+// unset from the parent run. A child without a workflow ID is named after
+// its parent and node, and one without a policy is terminated with its
+// parent.
+func fillChildExecutionAttributes(attrs *types.ChildExecutionInitiatedAttributes, info *types.ExecutionInfo) {
+	if attrs.WorkflowID == "" {
+		attrs.WorkflowID = info.WorkflowID + "/" + attrs.NodeID
+	}
+	if attrs.WorkflowType == "" {
+		attrs.WorkflowType = info.WorkflowTypeName
+	}
+	if attrs.TaskQueue == "" {
+		attrs.TaskQueue = info.TaskQueue
+	}
+	if attrs.TaskTimeout == 0 {
+		attrs.TaskTimeout = info.TaskTimeout
+	}
+	if attrs.ParentClosePolicy == types.ParentClosePolicyUnspecified {
+		attrs.ParentClosePolicy = types.ParentClosePolicyTerminate
+	}
+}
+
+// ExecuteTransferTask carries out a transfer task that updates another
+// execution than the one that produced it. Each step checks the state it
+// acts on first, so a task delivered again does nothing twice.
+func (s *Service) ExecuteTransferTask(ctx context.Context, task *types.TransferTask) error {
+	key := types.ExecutionKey{
+		NamespaceID: task.NamespaceID,
+		WorkflowID:  task.WorkflowID,
+		RunID:       task.RunID,
+	}
+	switch task.TaskType {
+	case types.TransferTaskTypeStartChildExecution:
+		return s.startChildExecution(ctx, key, task.ScheduledEventID)
+	case types.TransferTaskTypeRecordChildCompletion:
+		return s.recordChildCompletion(ctx, key, task.ScheduledEventID)
+	case types.TransferTaskTypeApplyParentClosePolicy:
+		return s.applyParentClosePolicy(ctx, key, task.ScheduledEventID)
+	}
+	return nil
+}
+
+// getEvent reads a single event of a run.
+func (s *Service) getEvent(ctx context.Context, key types.ExecutionKey, eventID int64) (*types.HistoryEvent, error) {
+	events, err := s.eventStore.GetEvents(ctx, key, eventID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%w: event %d of run %s", ErrEventNotFound, eventID, key.RunID)
+	}
+	return events[0], nil
+}
+
+// readState runs read with the execution's current mutable state without
+// changing it.
+func (s *Service) readState(ctx context.Context, key types.ExecutionKey, read func(state *engine.MutableState)) error {
+	return s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+		read(state)
+		return nil, nil
+	})
+}
+
+// startChildExecution creates the child run the parent initiated at
+// initiatedEventID and records on the parent that it started. The run ID
+// was chosen when the child was initiated, so a retry finds the run it
+// created before. A parent that closed in the meantime gets no child.
+func (s *Service) startChildExecution(ctx context.Context, parentKey types.ExecutionKey, initiatedEventID int64) error {
+	var pending bool
+	err := s.readState(ctx, parentKey, func(state *engine.MutableState) {
+		child, ok := state.GetPendingChildExecution(initiatedEventID)
+		pending = ok && child.StartedEventID == 0 && state.IsWorkflowExecutionRunning()
+	})
+	if err != nil || !pending {
+		return err
+	}
+
+	initiated, err := s.getEvent(ctx, parentKey, initiatedEventID)
+	if err != nil {
+		return err
+	}
+	attrs, ok := initiated.Attributes.(*types.ChildExecutionInitiatedAttributes)
+	if !ok {
+		return fmt.Errorf("%w: event %d does not initiate a child", engine.ErrInvalidEvent, initiatedEventID)
+	}
+
+	childKey := types.ExecutionKey{
+		NamespaceID: parentKey.NamespaceID,
+		WorkflowID:  attrs.WorkflowID,
+		RunID:       attrs.RunID,
+	}
+	parent := parentKey
+	started := &types.ExecutionStartedAttributes{
+		WorkflowType:           attrs.WorkflowType,
+		TaskQueue:              attrs.TaskQueue,
+		Input:                  attrs.Input,
+		ExecutionTimeout:       attrs.ExecutionTimeout,
+		RunTimeout:             attrs.RunTimeout,
+		TaskTimeout:            attrs.TaskTimeout,
+		ParentExecution:        &parent,
+		ParentInitiatedEventID: initiatedEventID,
+		Initiator:              types.InitiatorParent,
+	}
+	s.applyNamespaceDefaults(ctx, childKey.NamespaceID, started)
+	err = s.updateWorkflow(ctx, childKey, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+		if state.ExecutionInfo.Status != types.ExecutionStatusUnspecified {
+			return nil, nil
+		}
+		return []*types.HistoryEvent{{
+			EventType:  types.EventTypeExecutionStarted,
+			Timestamp:  time.Now(),
+			Attributes: started,
+		}}, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start child %s: %w", childKey.WorkflowID, err)
+	}
+
+	return s.updateWorkflow(ctx, parentKey, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+		child, ok := state.GetPendingChildExecution(initiatedEventID)
+		if !state.IsWorkflowExecutionRunning() || !ok || child.StartedEventID != 0 {
+			return nil, nil
+		}
+		return []*types.HistoryEvent{{
+			EventType: types.EventTypeChildExecutionStarted,
+			Timestamp: time.Now(),
+			Attributes: &types.ChildExecutionStartedAttributes{
+				InitiatedEventID: initiatedEventID,
+				WorkflowID:       childKey.WorkflowID,
+				RunID:            childKey.RunID,
+				WorkflowType:     attrs.WorkflowType,
+			},
+		}}, nil
+	})
+}
+
+// recordChildCompletion reports the close event closeEventID of a child run
+// to its parent.
+func (s *Service) recordChildCompletion(ctx context.Context, childKey types.ExecutionKey, closeEventID int64) error {
+	var parent *types.ExecutionKey
+	var initiatedEventID int64
+	var status types.ExecutionStatus
+	err := s.readState(ctx, childKey, func(state *engine.MutableState) {
+		if state.ExecutionInfo.ParentExecution != nil {
+			p := *state.ExecutionInfo.ParentExecution
+			parent = &p
+		}
+		initiatedEventID = state.ExecutionInfo.ParentInitiatedEventID
+		status = state.ExecutionInfo.Status
+	})
+	if err != nil || parent == nil {
+		return err
+	}
+
+	closed, err := s.getEvent(ctx, childKey, closeEventID)
+	if err != nil {
+		return err
+	}
+	req := &historyv1.RecordChildExecutionCompletedRequest{
+		Namespace: parent.NamespaceID,
+		WorkflowExecution: &commonv1.WorkflowExecution{
+			WorkflowId: parent.WorkflowID,
+			RunId:      parent.RunID,
+		},
+		InitiatedEventId: initiatedEventID,
+		ChildExecution: &commonv1.WorkflowExecution{
+			WorkflowId: childKey.WorkflowID,
+			RunId:      childKey.RunID,
+		},
+		Status: executionStatusToProto(status),
+	}
+	switch attrs := closed.Attributes.(type) {
+	case *types.ExecutionCompletedAttributes:
+		req.Result = &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: attrs.Result}}}
+	case *types.ExecutionFailedAttributes:
+		req.Failure = &commonv1.Failure{Message: attrs.Reason, StackTrace: string(attrs.Details)}
+	case *types.ExecutionTerminatedAttributes:
+		req.Failure = &commonv1.Failure{Message: attrs.Reason}
+	case *types.ExecutionCanceledAttributes:
+		req.Failure = &commonv1.Failure{Message: "canceled", FailureType: commonv1.FailureType_FAILURE_TYPE_CANCELLED}
+	case *types.ExecutionTimedOutAttributes:
+		req.Failure = &commonv1.Failure{Message: "timed out", FailureType: commonv1.FailureType_FAILURE_TYPE_TIMEOUT}
+	}
+
+	_, err = s.RecordChildExecutionCompleted(ctx, req)
+	return err
+}
+
+// applyParentClosePolicy applies the parent close policy of the child a
+// closed run initiated at initiatedEventID: the child is either terminated or
+// asked to cancel, which lets it run its cleanup first.
+func (s *Service) applyParentClosePolicy(ctx context.Context, parentKey types.ExecutionKey, initiatedEventID int64) error {
+	var child *types.ChildExecutionInfo
+	err := s.readState(ctx, parentKey, func(state *engine.MutableState) {
+		if info, ok := state.GetPendingChildExecution(initiatedEventID); ok {
+			c := *info
+			child = &c
+		}
+	})
+	if err != nil || child == nil || child.ParentClosePolicy == types.ParentClosePolicyAbandon {
+		return err
+	}
+
+	execution := &commonv1.WorkflowExecution{
+		WorkflowId: child.WorkflowID,
+		RunId:      child.RunID,
+	}
+	reason := fmt.Sprintf("parent %s closed", parentKey.WorkflowID)
+	if child.ParentClosePolicy == types.ParentClosePolicyRequestCancel {
+		_, err = s.RequestCancelWorkflowExecution(ctx, &historyv1.RequestCancelWorkflowExecutionRequest{
+			Namespace:         parentKey.NamespaceID,
+			WorkflowExecution: execution,
+			Reason:            reason,
+			Identity:          "history-service",
+		})
+		return err
+	}
+	_, err = s.TerminateWorkflowExecution(ctx, &historyv1.TerminateWorkflowExecutionRequest{
+		Namespace:         parentKey.NamespaceID,
+		WorkflowExecution: execution,
+		Reason:            reason,
+		Identity:          "history-service",
+	})
+	return err
+}
+
+// generateCloseTransferTasks adds the tasks a closing run owes other
+// executions: its outcome for its parent, unless it continued as new and its
+// new run reports instead, and the parent close policy for each child that
+// has not closed.
+func (s *Service) generateCloseTransferTasks(key types.ExecutionKey, shardID int32, event *types.HistoryEvent, state *engine.MutableState) {
+	add := func(taskType types.TransferTaskType, eventID int64) {
+		state.AddTransferTask(&types.TransferTask{
+			ShardID:          shardID,
+			NamespaceID:      key.NamespaceID,
+			WorkflowID:       key.WorkflowID,
+			RunID:            key.RunID,
+			TaskType:         taskType,
+			ScheduledEventID: eventID,
+			VisibilityTime:   event.Timestamp,
+		})
+	}
+
+	if state.ExecutionInfo.ParentExecution != nil && event.EventType != types.EventTypeExecutionContinuedAsNew {
+		add(types.TransferTaskTypeRecordChildCompletion, event.EventID)
+	}
+
+	initiatedEventIDs := make([]int64, 0, len(state.PendingChildExecutions))
+	for id, child := range state.PendingChildExecutions {
+		if child.ParentClosePolicy != types.ParentClosePolicyAbandon {
+			initiatedEventIDs = append(initiatedEventIDs, id)
+		}
+	}
+	slices.Sort(initiatedEventIDs)
+	for _, id := range initiatedEventIDs {
+		add(types.TransferTaskTypeApplyParentClosePolicy, id)
+	}
+}
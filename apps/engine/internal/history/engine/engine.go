@@ -9,13 +9,19 @@ import (
 )
 
 var (
-	ErrInvalidEvent       = errors.New("invalid event")
-	ErrEventOutOfOrder    = errors.New("event out of order")
-	ErrDuplicateTimer     = errors.New("duplicate timer")
-	ErrTimerNotFound      = errors.New("timer not found")
-	ErrActivityNotFound   = errors.New("activity not found")
-	ErrWorkflowNotRunning = errors.New("workflow not running")
-	ErrInvalidEventType   = errors.New("invalid event type")
+	ErrInvalidEvent        = errors.New("invalid event")
+	ErrEventOutOfOrder     = errors.New("event out of order")
+	ErrDuplicateTimer      = errors.New("duplicate timer")
+	ErrTimerNotFound       = errors.New("timer not found")
+	ErrActivityNotFound    = errors.New("activity not found")
+	ErrActivityStarted     = errors.New("activity already started")
+	ErrWorkflowNotRunning  = errors.New("workflow not running")
+	ErrInvalidEventType    = errors.New("invalid event type")
+	ErrDuplicateSignal     = errors.New("duplicate signal")
+	ErrStaleWorkflowTask   = errors.New("stale workflow task")
+	ErrWorkflowTaskPending = errors.New("workflow task already pending")
+	ErrChildNotFound       = errors.New("child execution not found")
+	ErrCancelNotRequested  = errors.New("cancel not requested")
 )
 
 type Engine struct {
@@ -50,18 +56,37 @@ func (e *Engine) ValidateEvent(state *MutableState, event *types.HistoryEvent) e
 	switch event.EventType {
 	case types.EventTypeExecutionStarted:
 		return e.validateExecutionStarted(state, event)
-	case types.EventTypeExecutionCompleted, types.EventTypeExecutionFailed, types.EventTypeExecutionTerminated:
+	case types.EventTypeExecutionCompleted, types.EventTypeExecutionFailed, types.EventTypeExecutionTerminated,
+		types.EventTypeExecutionContinuedAsNew, types.EventTypeExecutionTimedOut:
 		return e.validateExecutionClose(state)
+	case types.EventTypeExecutionCancelRequested:
+		return e.validateExecutionClose(state)
+	case types.EventTypeExecutionCanceled:
+		return e.validateExecutionCanceled(state)
 	case types.EventTypeTimerStarted:
 		return e.validateTimerStarted(state, event)
 	case types.EventTypeTimerFired, types.EventTypeTimerCanceled:
 		return e.validateTimerOperation(state, event)
 	case types.EventTypeActivityScheduled:
 		return e.validateActivityScheduled(state)
-	case types.EventTypeActivityStarted:
+	case types.EventTypeSignalReceived:
+		return e.validateSignalReceived(state, event)
+	case types.EventTypeWorkflowTaskScheduled:
+		return e.validateWorkflowTaskScheduled(state)
+	case types.EventTypeWorkflowTaskStarted, types.EventTypeWorkflowTaskCompleted,
+		types.EventTypeWorkflowTaskFailed, types.EventTypeWorkflowTaskTimedOut:
+		return e.validateWorkflowTask(state, event)
+	case types.EventTypeActivityStarted, types.EventTypeNodeStarted:
 		return e.validateActivityStarted(state, event)
-	case types.EventTypeActivityCompleted, types.EventTypeActivityFailed, types.EventTypeActivityTimedOut:
+	case types.EventTypeActivityCompleted, types.EventTypeActivityFailed, types.EventTypeActivityTimedOut,
+		types.EventTypeNodeCompleted, types.EventTypeNodeFailed, types.EventTypeNodeTimedOut,
+		types.EventTypeNodeCanceled:
 		return e.validateActivityClose(state, event)
+	case types.EventTypeChildExecutionInitiated:
+		return e.validateActivityScheduled(state)
+	case types.EventTypeChildExecutionStarted, types.EventTypeChildExecutionCompleted,
+		types.EventTypeChildExecutionFailed:
+		return e.validateChildExecution(state, event)
 	}
 
 	return nil
@@ -81,6 +106,18 @@ func (e *Engine) validateExecutionClose(state *MutableState) error {
 	return nil
 }
 
+// validateExecutionCanceled only lets a run close as canceled once a cancel
+// was requested for it.
+func (e *Engine) validateExecutionCanceled(state *MutableState) error {
+	if err := e.validateExecutionClose(state); err != nil {
+		return err
+	}
+	if !state.ExecutionInfo.CancelRequested {
+		return ErrCancelNotRequested
+	}
+	return nil
+}
+
 func (e *Engine) validateTimerStarted(state *MutableState, event *types.HistoryEvent) error {
 	if !state.IsWorkflowExecutionRunning() {
 		return ErrWorkflowNotRunning
@@ -121,17 +158,81 @@ func (e *Engine) validateActivityScheduled(state *MutableState) error {
 	return nil
 }
 
-func (e *Engine) validateActivityStarted(state *MutableState, event *types.HistoryEvent) error {
+func (e *Engine) validateSignalReceived(state *MutableState, event *types.HistoryEvent) error {
 	if !state.IsWorkflowExecutionRunning() {
 		return ErrWorkflowNotRunning
 	}
-	attrs, ok := event.Attributes.(*types.ActivityStartedAttributes)
+	attrs, ok := event.Attributes.(*types.SignalReceivedAttributes)
 	if !ok {
 		return ErrInvalidEventType
 	}
-	if _, exists := state.PendingActivities[attrs.ScheduledEventID]; !exists {
+	if attrs.RequestID != "" && state.SignalRequestIDs[attrs.RequestID] {
+		return ErrDuplicateSignal
+	}
+	return nil
+}
+
+// validateWorkflowTaskScheduled allows one pending workflow task per run.
+func (e *Engine) validateWorkflowTaskScheduled(state *MutableState) error {
+	if !state.IsWorkflowExecutionRunning() {
+		return ErrWorkflowNotRunning
+	}
+	if state.WorkflowTask != nil {
+		return ErrWorkflowTaskPending
+	}
+	return nil
+}
+
+// validateWorkflowTask checks that an event refers to the pending workflow
+// task: starting it requires it not to be started yet, completing, failing or
+// timing it out requires it to be started. Anything else comes from a decider that lost a
+// race or ran too long and gets ErrStaleWorkflowTask.
+func (e *Engine) validateWorkflowTask(state *MutableState, event *types.HistoryEvent) error {
+	if !state.IsWorkflowExecutionRunning() {
+		return ErrWorkflowNotRunning
+	}
+	var scheduledEventID int64
+	wantStarted := true
+	switch attrs := event.Attributes.(type) {
+	case *types.WorkflowTaskStartedAttributes:
+		scheduledEventID = attrs.ScheduledEventID
+		wantStarted = false
+	case *types.WorkflowTaskCompletedAttributes:
+		scheduledEventID = attrs.ScheduledEventID
+	case *types.WorkflowTaskFailedAttributes:
+		scheduledEventID = attrs.ScheduledEventID
+	case *types.WorkflowTaskTimedOutAttributes:
+		scheduledEventID = attrs.ScheduledEventID
+	default:
+		return ErrInvalidEventType
+	}
+	task := state.WorkflowTask
+	if task == nil || task.ScheduledEventID != scheduledEventID || (task.StartedEventID != 0) != wantStarted {
+		return ErrStaleWorkflowTask
+	}
+	return nil
+}
+
+func (e *Engine) validateActivityStarted(state *MutableState, event *types.HistoryEvent) error {
+	if !state.IsWorkflowExecutionRunning() {
+		return ErrWorkflowNotRunning
+	}
+	var scheduledEventID int64
+	switch attrs := event.Attributes.(type) {
+	case *types.ActivityStartedAttributes:
+		scheduledEventID = attrs.ScheduledEventID
+	case *types.NodeStartedAttributes:
+		scheduledEventID = attrs.ScheduledEventID
+	default:
+		return ErrInvalidEventType
+	}
+	ai, exists := state.PendingActivities[scheduledEventID]
+	if !exists {
 		return ErrActivityNotFound
 	}
+	if ai.StartedEventID != 0 {
+		return ErrActivityStarted
+	}
 	return nil
 }
 
@@ -145,6 +246,14 @@ func (e *Engine) validateActivityClose(state *MutableState, event *types.History
 		scheduledEventID = attrs.ScheduledEventID
 	case *types.ActivityFailedAttributes:
 		scheduledEventID = attrs.ScheduledEventID
+	case *types.NodeCompletedAttributes:
+		scheduledEventID = attrs.ScheduledEventID
+	case *types.NodeFailedAttributes:
+		scheduledEventID = attrs.ScheduledEventID
+	case *types.NodeTimedOutAttributes:
+		scheduledEventID = attrs.ScheduledEventID
+	case *types.NodeCanceledAttributes:
+		scheduledEventID = attrs.ScheduledEventID
 	default:
 		return ErrInvalidEventType
 	}
@@ -154,6 +263,33 @@ func (e *Engine) validateActivityClose(state *MutableState, event *types.History
 	return nil
 }
 
+// validateChildExecution checks that an event reports on a child that is
+// still pending, so a duplicate delivery of its outcome is rejected.
+func (e *Engine) validateChildExecution(state *MutableState, event *types.HistoryEvent) error {
+	if !state.IsWorkflowExecutionRunning() {
+		return ErrWorkflowNotRunning
+	}
+	var initiatedEventID int64
+	switch attrs := event.Attributes.(type) {
+	case *types.ChildExecutionStartedAttributes:
+		initiatedEventID = attrs.InitiatedEventID
+	case *types.ChildExecutionCompletedAttributes:
+		initiatedEventID = attrs.InitiatedEventID
+	case *types.ChildExecutionFailedAttributes:
+		initiatedEventID = attrs.InitiatedEventID
+	default:
+		return ErrInvalidEventType
+	}
+	child, exists := state.PendingChildExecutions[initiatedEventID]
+	if !exists {
+		return ErrChildNotFound
+	}
+	if event.EventType == types.EventTypeChildExecutionStarted && child.StartedEventID != 0 {
+		return ErrChildNotFound
+	}
+	return nil
+}
+
 func (e *Engine) ScheduleNode(state *MutableState, nodeID, nodeType string, input []byte, taskQueue string) (*types.HistoryEvent, error) {
 	if !state.IsWorkflowExecutionRunning() {
 		return nil, ErrWorkflowNotRunning
@@ -14,6 +14,40 @@ type MutableState struct {
 	CompletedNodes    map[string]*types.NodeResult
 	BufferedEvents    []*types.HistoryEvent
 	DBVersion         int64
+
+	// PendingChildExecutions holds the child executions that have not
+	// closed yet by the ID of the event that initiated them.
+	PendingChildExecutions map[int64]*types.ChildExecutionInfo
+
+	// SignalCount is the number of signals received. SignalRequestIDs holds
+	// the request IDs of those signals, to drop retried deliveries.
+	SignalCount      int64
+	SignalRequestIDs map[string]bool
+
+	// HistorySize is the encoded size of the run's events in bytes.
+	// HistoryLimitWarned is set once the history crossed a soft limit, so
+	// the warning is recorded only once.
+	HistorySize        int64
+	HistoryLimitWarned bool
+
+	// WorkflowTask is the pending workflow task, nil if there is none.
+	// NeedsWorkflowTask is set by events the decider has not seen yet and
+	// cleared when a workflow task starts. WorkflowTaskFailures counts the
+	// workflow tasks that failed in a row.
+	WorkflowTask         *types.WorkflowTaskInfo
+	NeedsWorkflowTask    bool
+	WorkflowTaskFailures int32
+
+	// TransferTasks and TimerTasks hold the tasks generated by the update in
+	// progress. They are written together with the state and are not part of
+	// it, so they are neither serialized nor cloned.
+	TransferTasks []*types.TransferTask `json:"-"`
+	TimerTasks    []*types.TimerTask    `json:"-"`
+
+	// Modified marks a change of the update in progress that no event
+	// records, such as new heartbeat details, so the state is persisted even
+	// if the update adds neither events nor tasks.
+	Modified bool `json:"-"`
 }
 
 func NewMutableState(info *types.ExecutionInfo) *MutableState {
@@ -25,6 +59,9 @@ func NewMutableState(info *types.ExecutionInfo) *MutableState {
 		CompletedNodes:    make(map[string]*types.NodeResult),
 		BufferedEvents:    make([]*types.HistoryEvent, 0),
 		DBVersion:         0,
+		SignalRequestIDs:  make(map[string]bool),
+
+		PendingChildExecutions: make(map[int64]*types.ChildExecutionInfo),
 	}
 }
 
@@ -37,6 +74,20 @@ func (ms *MutableState) Clone() *MutableState {
 		CompletedNodes:    make(map[string]*types.NodeResult, len(ms.CompletedNodes)),
 		BufferedEvents:    make([]*types.HistoryEvent, len(ms.BufferedEvents)),
 		DBVersion:         ms.DBVersion,
+		SignalCount:       ms.SignalCount,
+		SignalRequestIDs:  make(map[string]bool, len(ms.SignalRequestIDs)),
+
+		HistorySize:        ms.HistorySize,
+		HistoryLimitWarned: ms.HistoryLimitWarned,
+
+		NeedsWorkflowTask:    ms.NeedsWorkflowTask,
+		WorkflowTaskFailures: ms.WorkflowTaskFailures,
+
+		PendingChildExecutions: make(map[int64]*types.ChildExecutionInfo, len(ms.PendingChildExecutions)),
+	}
+	if ms.WorkflowTask != nil {
+		task := *ms.WorkflowTask
+		clone.WorkflowTask = &task
 	}
 
 	for k, v := range ms.PendingActivities {
@@ -49,6 +100,13 @@ func (ms *MutableState) Clone() *MutableState {
 		clone.CompletedNodes[k] = ms.cloneNodeResult(v)
 	}
 	copy(clone.BufferedEvents, ms.BufferedEvents)
+	for k, v := range ms.SignalRequestIDs {
+		clone.SignalRequestIDs[k] = v
+	}
+	for k, v := range ms.PendingChildExecutions {
+		child := *v
+		clone.PendingChildExecutions[k] = &child
+	}
 
 	return clone
 }
@@ -62,6 +120,10 @@ func (ms *MutableState) cloneExecutionInfo() *types.ExecutionInfo {
 		info.Input = make([]byte, len(ms.ExecutionInfo.Input))
 		copy(info.Input, ms.ExecutionInfo.Input)
 	}
+	if ms.ExecutionInfo.ParentExecution != nil {
+		parent := *ms.ExecutionInfo.ParentExecution
+		info.ParentExecution = &parent
+	}
 	return &info
 }
 
@@ -78,6 +140,10 @@ func (ms *MutableState) cloneActivityInfo(ai *types.ActivityInfo) *types.Activit
 		clone.HeartbeatDetails = make([]byte, len(ai.HeartbeatDetails))
 		copy(clone.HeartbeatDetails, ai.HeartbeatDetails)
 	}
+	if ai.RetryPolicy != nil {
+		policy := *ai.RetryPolicy
+		clone.RetryPolicy = &policy
+	}
 	return &clone
 }
 
@@ -106,6 +172,34 @@ func (ms *MutableState) cloneNodeResult(nr *types.NodeResult) *types.NodeResult
 }
 
 func (ms *MutableState) ApplyEvent(event *types.HistoryEvent) error {
+	if err := ms.applyEvent(event); err != nil {
+		return err
+	}
+	if wakesDecider(event.EventType) {
+		ms.NeedsWorkflowTask = true
+	}
+	return nil
+}
+
+// wakesDecider reports whether the decider has to run again after an event.
+func wakesDecider(eventType types.EventType) bool {
+	switch eventType {
+	case types.EventTypeExecutionStarted,
+		types.EventTypeNodeCompleted,
+		types.EventTypeNodeFailed,
+		types.EventTypeNodeTimedOut,
+		types.EventTypeNodeCanceled,
+		types.EventTypeExecutionCancelRequested,
+		types.EventTypeSignalReceived,
+		types.EventTypeTimerFired,
+		types.EventTypeChildExecutionCompleted,
+		types.EventTypeChildExecutionFailed:
+		return true
+	}
+	return false
+}
+
+func (ms *MutableState) applyEvent(event *types.HistoryEvent) error {
 	switch event.EventType {
 	case types.EventTypeExecutionStarted:
 		return ms.applyExecutionStarted(event)
@@ -115,12 +209,26 @@ func (ms *MutableState) ApplyEvent(event *types.HistoryEvent) error {
 		return ms.applyExecutionFailed(event)
 	case types.EventTypeExecutionTerminated:
 		return ms.applyExecutionTerminated(event)
+	case types.EventTypeExecutionContinuedAsNew:
+		return ms.applyExecutionContinuedAsNew(event)
+	case types.EventTypeExecutionCancelRequested:
+		return ms.applyExecutionCancelRequested(event)
+	case types.EventTypeExecutionCanceled:
+		return ms.applyExecutionCanceled(event)
+	case types.EventTypeExecutionTimedOut:
+		return ms.applyExecutionTimedOut(event)
 	case types.EventTypeNodeScheduled:
 		return ms.applyNodeScheduled(event)
+	case types.EventTypeNodeStarted:
+		return ms.applyNodeStarted(event)
 	case types.EventTypeNodeCompleted:
 		return ms.applyNodeCompleted(event)
 	case types.EventTypeNodeFailed:
 		return ms.applyNodeFailed(event)
+	case types.EventTypeNodeTimedOut:
+		return ms.applyNodeTimedOut(event)
+	case types.EventTypeNodeCanceled:
+		return ms.applyNodeCanceled(event)
 	case types.EventTypeTimerStarted:
 		return ms.applyTimerStarted(event)
 	case types.EventTypeTimerFired:
@@ -135,6 +243,28 @@ func (ms *MutableState) ApplyEvent(event *types.HistoryEvent) error {
 		return ms.applyActivityCompleted(event)
 	case types.EventTypeActivityFailed:
 		return ms.applyActivityFailed(event)
+	case types.EventTypeSignalReceived:
+		return ms.applySignalReceived(event)
+	case types.EventTypeMarkerRecorded:
+		return ms.applyMarkerRecorded(event)
+	case types.EventTypeWorkflowTaskScheduled:
+		return ms.applyWorkflowTaskScheduled(event)
+	case types.EventTypeWorkflowTaskStarted:
+		return ms.applyWorkflowTaskStarted(event)
+	case types.EventTypeWorkflowTaskCompleted:
+		return ms.applyWorkflowTaskCompleted(event)
+	case types.EventTypeWorkflowTaskFailed:
+		return ms.applyWorkflowTaskFailed(event)
+	case types.EventTypeWorkflowTaskTimedOut:
+		return ms.applyWorkflowTaskTimedOut(event)
+	case types.EventTypeChildExecutionInitiated:
+		return ms.applyChildExecutionInitiated(event)
+	case types.EventTypeChildExecutionStarted:
+		return ms.applyChildExecutionStarted(event)
+	case types.EventTypeChildExecutionCompleted:
+		return ms.applyChildExecutionCompleted(event)
+	case types.EventTypeChildExecutionFailed:
+		return ms.applyChildExecutionFailed(event)
 	}
 
 	ms.NextEventID = event.EventID + 1
@@ -152,6 +282,18 @@ func (ms *MutableState) applyExecutionStarted(event *types.HistoryEvent) error {
 	ms.ExecutionInfo.ExecutionTimeout = attrs.ExecutionTimeout
 	ms.ExecutionInfo.RunTimeout = attrs.RunTimeout
 	ms.ExecutionInfo.TaskTimeout = attrs.TaskTimeout
+	ms.ExecutionInfo.ContinuedFromRunID = attrs.ContinuedFromRunID
+	ms.ExecutionInfo.FirstRunID = attrs.FirstRunID
+	if ms.ExecutionInfo.FirstRunID == "" {
+		ms.ExecutionInfo.FirstRunID = ms.ExecutionInfo.RunID
+	}
+	ms.ExecutionInfo.ParentExecution = attrs.ParentExecution
+	ms.ExecutionInfo.ParentInitiatedEventID = attrs.ParentInitiatedEventID
+	ms.ExecutionInfo.CreateRequestID = attrs.RequestID
+	ms.ExecutionInfo.ExecutionExpirationTime = attrs.ExpirationTime
+	if attrs.ExpirationTime.IsZero() && attrs.ExecutionTimeout > 0 {
+		ms.ExecutionInfo.ExecutionExpirationTime = event.Timestamp.Add(attrs.ExecutionTimeout)
+	}
 	ms.ExecutionInfo.Status = types.ExecutionStatusRunning
 	ms.ExecutionInfo.StartTime = event.Timestamp
 	ms.NextEventID = event.EventID + 1
@@ -179,16 +321,98 @@ func (ms *MutableState) applyExecutionTerminated(event *types.HistoryEvent) erro
 	return nil
 }
 
+func (ms *MutableState) applyExecutionCancelRequested(event *types.HistoryEvent) error {
+	ms.ExecutionInfo.CancelRequested = true
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyExecutionCanceled(event *types.HistoryEvent) error {
+	ms.ExecutionInfo.Status = types.ExecutionStatusCanceled
+	ms.ExecutionInfo.CloseTime = event.Timestamp
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyExecutionTimedOut(event *types.HistoryEvent) error {
+	ms.ExecutionInfo.Status = types.ExecutionStatusTimedOut
+	ms.ExecutionInfo.CloseTime = event.Timestamp
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyExecutionContinuedAsNew(event *types.HistoryEvent) error {
+	if attrs, ok := event.Attributes.(*types.ExecutionContinuedAsNewAttributes); ok {
+		ms.ExecutionInfo.NewRunID = attrs.NewRunID
+	}
+	ms.ExecutionInfo.Status = types.ExecutionStatusContinuedAsNew
+	ms.ExecutionInfo.CloseTime = event.Timestamp
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+// applyNodeScheduled tracks the node as a pending activity until it
+// completes, fails, times out or is canceled.
 func (ms *MutableState) applyNodeScheduled(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.NodeScheduledAttributes)
+	if !ok {
+		return nil
+	}
+	ms.PendingActivities[event.EventID] = &types.ActivityInfo{
+		ScheduledEventID: event.EventID,
+		ActivityID:       attrs.NodeID,
+		ActivityType:     attrs.NodeType,
+		TaskQueue:        attrs.TaskQueue,
+		ScheduledTime:    event.Timestamp,
+		HeartbeatTimeout: attrs.HeartbeatTimeout,
+		ScheduleTimeout:  attrs.ScheduleToStart,
+		StartToClose:     attrs.StartToClose,
+		Attempt:          1,
+		RetryPolicy:      attrs.RetryPolicy,
+	}
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyNodeStarted(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.NodeStartedAttributes)
+	if !ok {
+		return nil
+	}
+	if ai, exists := ms.PendingActivities[attrs.ScheduledEventID]; exists {
+		if attrs.NodeID == "" {
+			attrs.NodeID = ai.ActivityID
+		}
+		ai.StartedEventID = event.EventID
+		ai.StartedTime = event.Timestamp
+		ai.RequestID = attrs.RequestID
+	}
 	ms.NextEventID = event.EventID + 1
 	return nil
 }
 
+// closeNode removes the pending activity of a node that completed, failed,
+// timed out or was canceled and returns the node ID and started event ID it was recorded
+// with, so the close event can carry them.
+func (ms *MutableState) closeNode(scheduledEventID int64, nodeID string, startedEventID int64) (string, int64) {
+	if ai, exists := ms.PendingActivities[scheduledEventID]; exists {
+		if nodeID == "" {
+			nodeID = ai.ActivityID
+		}
+		if startedEventID == 0 {
+			startedEventID = ai.StartedEventID
+		}
+		delete(ms.PendingActivities, scheduledEventID)
+	}
+	return nodeID, startedEventID
+}
+
 func (ms *MutableState) applyNodeCompleted(event *types.HistoryEvent) error {
 	attrs, ok := event.Attributes.(*types.NodeCompletedAttributes)
 	if !ok {
 		return nil
 	}
+	attrs.NodeID, attrs.StartedEventID = ms.closeNode(attrs.ScheduledEventID, attrs.NodeID, attrs.StartedEventID)
 	ms.CompletedNodes[attrs.NodeID] = &types.NodeResult{
 		NodeID:        attrs.NodeID,
 		CompletedTime: event.Timestamp,
@@ -203,6 +427,7 @@ func (ms *MutableState) applyNodeFailed(event *types.HistoryEvent) error {
 	if !ok {
 		return nil
 	}
+	attrs.NodeID, attrs.StartedEventID = ms.closeNode(attrs.ScheduledEventID, attrs.NodeID, attrs.StartedEventID)
 	ms.CompletedNodes[attrs.NodeID] = &types.NodeResult{
 		NodeID:         attrs.NodeID,
 		CompletedTime:  event.Timestamp,
@@ -213,6 +438,36 @@ func (ms *MutableState) applyNodeFailed(event *types.HistoryEvent) error {
 	return nil
 }
 
+func (ms *MutableState) applyNodeTimedOut(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.NodeTimedOutAttributes)
+	if !ok {
+		return nil
+	}
+	attrs.NodeID, attrs.StartedEventID = ms.closeNode(attrs.ScheduledEventID, attrs.NodeID, attrs.StartedEventID)
+	ms.CompletedNodes[attrs.NodeID] = &types.NodeResult{
+		NodeID:        attrs.NodeID,
+		CompletedTime: event.Timestamp,
+		FailureReason: attrs.TimeoutType + " timeout",
+	}
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyNodeCanceled(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.NodeCanceledAttributes)
+	if !ok {
+		return nil
+	}
+	attrs.NodeID, attrs.StartedEventID = ms.closeNode(attrs.ScheduledEventID, attrs.NodeID, attrs.StartedEventID)
+	ms.CompletedNodes[attrs.NodeID] = &types.NodeResult{
+		NodeID:        attrs.NodeID,
+		CompletedTime: event.Timestamp,
+		FailureReason: "canceled",
+	}
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
 func (ms *MutableState) applyTimerStarted(event *types.HistoryEvent) error {
 	attrs, ok := event.Attributes.(*types.TimerStartedAttributes)
 	if !ok {
@@ -233,6 +488,11 @@ func (ms *MutableState) applyTimerFired(event *types.HistoryEvent) error {
 	if !ok {
 		return nil
 	}
+	// The timer service and the decider only know the timer ID; link the
+	// event to the TimerStarted event it resolves.
+	if ti, ok := ms.PendingTimers[attrs.TimerID]; ok && attrs.StartedEventID == 0 {
+		attrs.StartedEventID = ti.StartedEventID
+	}
 	delete(ms.PendingTimers, attrs.TimerID)
 	ms.NextEventID = event.EventID + 1
 	return nil
@@ -243,6 +503,9 @@ func (ms *MutableState) applyTimerCanceled(event *types.HistoryEvent) error {
 	if !ok {
 		return nil
 	}
+	if ti, ok := ms.PendingTimers[attrs.TimerID]; ok && attrs.StartedEventID == 0 {
+		attrs.StartedEventID = ti.StartedEventID
+	}
 	delete(ms.PendingTimers, attrs.TimerID)
 	ms.NextEventID = event.EventID + 1
 	return nil
@@ -302,6 +565,192 @@ func (ms *MutableState) applyActivityFailed(event *types.HistoryEvent) error {
 	return nil
 }
 
+func (ms *MutableState) applySignalReceived(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.SignalReceivedAttributes)
+	if !ok {
+		return nil
+	}
+	if attrs.RequestID != "" {
+		if ms.SignalRequestIDs == nil {
+			ms.SignalRequestIDs = make(map[string]bool)
+		}
+		ms.SignalRequestIDs[attrs.RequestID] = true
+	}
+	ms.SignalCount++
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyMarkerRecorded(event *types.HistoryEvent) error {
+	if attrs, ok := event.Attributes.(*types.MarkerRecordedAttributes); ok && attrs.MarkerName == types.MarkerNameHistoryLimitWarning {
+		ms.HistoryLimitWarned = true
+	}
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyWorkflowTaskScheduled(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.WorkflowTaskScheduledAttributes)
+	if !ok {
+		return nil
+	}
+	ms.WorkflowTask = &types.WorkflowTaskInfo{
+		ScheduledEventID: event.EventID,
+		Attempt:          attrs.Attempt,
+		TaskQueue:        attrs.TaskQueue,
+		StartToClose:     attrs.StartToClose,
+		ScheduledTime:    event.Timestamp,
+	}
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyWorkflowTaskStarted(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.WorkflowTaskStartedAttributes)
+	if !ok || ms.WorkflowTask == nil {
+		return nil
+	}
+	ms.WorkflowTask.StartedEventID = event.EventID
+	ms.WorkflowTask.StartedTime = event.Timestamp
+	ms.WorkflowTask.RequestID = attrs.RequestID
+	// The decider reads history up to here, so it sees every event so far.
+	ms.NeedsWorkflowTask = false
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyWorkflowTaskCompleted(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.WorkflowTaskCompletedAttributes)
+	if !ok {
+		return nil
+	}
+	if ms.WorkflowTask != nil && attrs.StartedEventID == 0 {
+		attrs.StartedEventID = ms.WorkflowTask.StartedEventID
+	}
+	ms.WorkflowTask = nil
+	ms.WorkflowTaskFailures = 0
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyWorkflowTaskFailed(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.WorkflowTaskFailedAttributes)
+	if !ok {
+		return nil
+	}
+	if ms.WorkflowTask != nil && attrs.StartedEventID == 0 {
+		attrs.StartedEventID = ms.WorkflowTask.StartedEventID
+	}
+	// The decision was lost; the decider has to run again.
+	ms.WorkflowTask = nil
+	ms.WorkflowTaskFailures++
+	ms.NeedsWorkflowTask = true
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyWorkflowTaskTimedOut(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.WorkflowTaskTimedOutAttributes)
+	if !ok {
+		return nil
+	}
+	if ms.WorkflowTask != nil && attrs.StartedEventID == 0 {
+		attrs.StartedEventID = ms.WorkflowTask.StartedEventID
+	}
+	// A timeout counts as a failure, so a decider that keeps running over
+	// its deadline backs off like one that keeps failing.
+	ms.WorkflowTask = nil
+	ms.WorkflowTaskFailures++
+	ms.NeedsWorkflowTask = true
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyChildExecutionInitiated(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.ChildExecutionInitiatedAttributes)
+	if !ok {
+		return nil
+	}
+	if ms.PendingChildExecutions == nil {
+		ms.PendingChildExecutions = make(map[int64]*types.ChildExecutionInfo)
+	}
+	ms.PendingChildExecutions[event.EventID] = &types.ChildExecutionInfo{
+		InitiatedEventID:  event.EventID,
+		NodeID:            attrs.NodeID,
+		WorkflowID:        attrs.WorkflowID,
+		RunID:             attrs.RunID,
+		WorkflowType:      attrs.WorkflowType,
+		ParentClosePolicy: attrs.ParentClosePolicy,
+	}
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyChildExecutionStarted(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.ChildExecutionStartedAttributes)
+	if !ok {
+		return nil
+	}
+	if child, exists := ms.PendingChildExecutions[attrs.InitiatedEventID]; exists {
+		child.StartedEventID = event.EventID
+	}
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+// closeChild removes a child that completed or failed and returns the node
+// it ran for and the started event ID it was recorded with.
+func (ms *MutableState) closeChild(initiatedEventID, startedEventID int64) (string, int64) {
+	child, exists := ms.PendingChildExecutions[initiatedEventID]
+	if !exists {
+		return "", startedEventID
+	}
+	if startedEventID == 0 {
+		startedEventID = child.StartedEventID
+	}
+	delete(ms.PendingChildExecutions, initiatedEventID)
+	return child.NodeID, startedEventID
+}
+
+// applyChildExecutionCompleted records the child's result as the result of
+// the node it ran for.
+func (ms *MutableState) applyChildExecutionCompleted(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.ChildExecutionCompletedAttributes)
+	if !ok {
+		return nil
+	}
+	var nodeID string
+	nodeID, attrs.StartedEventID = ms.closeChild(attrs.InitiatedEventID, attrs.StartedEventID)
+	if nodeID != "" {
+		ms.CompletedNodes[nodeID] = &types.NodeResult{
+			NodeID:        nodeID,
+			CompletedTime: event.Timestamp,
+			Output:        attrs.Result,
+		}
+	}
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
+func (ms *MutableState) applyChildExecutionFailed(event *types.HistoryEvent) error {
+	attrs, ok := event.Attributes.(*types.ChildExecutionFailedAttributes)
+	if !ok {
+		return nil
+	}
+	var nodeID string
+	nodeID, attrs.StartedEventID = ms.closeChild(attrs.InitiatedEventID, attrs.StartedEventID)
+	if nodeID != "" {
+		ms.CompletedNodes[nodeID] = &types.NodeResult{
+			NodeID:         nodeID,
+			CompletedTime:  event.Timestamp,
+			FailureReason:  attrs.Reason,
+			FailureDetails: attrs.Details,
+		}
+	}
+	ms.NextEventID = event.EventID + 1
+	return nil
+}
+
 func (ms *MutableState) AddPendingActivity(scheduledEventID int64, info *types.ActivityInfo) {
 	ms.PendingActivities[scheduledEventID] = info
 }
@@ -328,6 +777,11 @@ func (ms *MutableState) DeletePendingTimer(timerID string) {
 	delete(ms.PendingTimers, timerID)
 }
 
+func (ms *MutableState) GetPendingChildExecution(initiatedEventID int64) (*types.ChildExecutionInfo, bool) {
+	info, ok := ms.PendingChildExecutions[initiatedEventID]
+	return info, ok
+}
+
 func (ms *MutableState) AddCompletedNode(nodeID string, result *types.NodeResult) {
 	ms.CompletedNodes[nodeID] = result
 }
@@ -345,6 +799,22 @@ func (ms *MutableState) ClearBufferedEvents() {
 	ms.BufferedEvents = ms.BufferedEvents[:0]
 }
 
+func (ms *MutableState) AddTransferTask(task *types.TransferTask) {
+	ms.TransferTasks = append(ms.TransferTasks, task)
+}
+
+func (ms *MutableState) AddTimerTask(task *types.TimerTask) {
+	ms.TimerTasks = append(ms.TimerTasks, task)
+}
+
+// ClearTasks drops the tasks and the Modified mark of a previous update, so a
+// cached state starts the next update without them.
+func (ms *MutableState) ClearTasks() {
+	ms.TransferTasks = nil
+	ms.TimerTasks = nil
+	ms.Modified = false
+}
+
 func (ms *MutableState) GetNextEventID() int64 {
 	return ms.NextEventID
 }
@@ -355,6 +825,11 @@ func (ms *MutableState) IncrementNextEventID() int64 {
 	return id
 }
 
+// HistoryCount returns the number of events in the run's history.
+func (ms *MutableState) HistoryCount() int64 {
+	return ms.NextEventID - 1
+}
+
 func (ms *MutableState) IsWorkflowExecutionRunning() bool {
 	return ms.ExecutionInfo != nil && ms.ExecutionInfo.Status == types.ExecutionStatusRunning
 }
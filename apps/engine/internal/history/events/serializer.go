@@ -16,6 +16,7 @@ func init() {
 	gob.Register(&types.ExecutionCompletedAttributes{})
 	gob.Register(&types.ExecutionFailedAttributes{})
 	gob.Register(&types.ExecutionTerminatedAttributes{})
+	gob.Register(&types.ExecutionContinuedAsNewAttributes{})
 	gob.Register(&types.NodeScheduledAttributes{})
 	gob.Register(&types.NodeStartedAttributes{})
 	gob.Register(&types.NodeCompletedAttributes{})
@@ -29,6 +30,14 @@ func init() {
 	gob.Register(&types.ActivityFailedAttributes{})
 	gob.Register(&types.SignalReceivedAttributes{})
 	gob.Register(&types.MarkerRecordedAttributes{})
+	gob.Register(&types.ChildExecutionInitiatedAttributes{})
+	gob.Register(&types.ChildExecutionStartedAttributes{})
+	gob.Register(&types.ChildExecutionCompletedAttributes{})
+	gob.Register(&types.ChildExecutionFailedAttributes{})
+	gob.Register(&types.ExecutionCancelRequestedAttributes{})
+	gob.Register(&types.ExecutionCanceledAttributes{})
+	gob.Register(&types.NodeCanceledAttributes{})
+	gob.Register(&types.ExecutionTimedOutAttributes{})
 	gob.Register(&types.ExecutionKey{})
 	gob.Register(&types.RetryPolicy{})
 }
@@ -176,6 +185,8 @@ func (s *Serializer) deserializeAttributes(eventType types.EventType, attrMap ma
 		attrs = &types.ExecutionFailedAttributes{}
 	case types.EventTypeExecutionTerminated:
 		attrs = &types.ExecutionTerminatedAttributes{}
+	case types.EventTypeExecutionContinuedAsNew:
+		attrs = &types.ExecutionContinuedAsNewAttributes{}
 	case types.EventTypeNodeScheduled:
 		attrs = &types.NodeScheduledAttributes{}
 	case types.EventTypeNodeStarted:
@@ -184,6 +195,8 @@ func (s *Serializer) deserializeAttributes(eventType types.EventType, attrMap ma
 		attrs = &types.NodeCompletedAttributes{}
 	case types.EventTypeNodeFailed:
 		attrs = &types.NodeFailedAttributes{}
+	case types.EventTypeNodeTimedOut:
+		attrs = &types.NodeTimedOutAttributes{}
 	case types.EventTypeTimerStarted:
 		attrs = &types.TimerStartedAttributes{}
 	case types.EventTypeTimerFired:
@@ -202,6 +215,32 @@ func (s *Serializer) deserializeAttributes(eventType types.EventType, attrMap ma
 		attrs = &types.SignalReceivedAttributes{}
 	case types.EventTypeMarkerRecorded:
 		attrs = &types.MarkerRecordedAttributes{}
+	case types.EventTypeWorkflowTaskScheduled:
+		attrs = &types.WorkflowTaskScheduledAttributes{}
+	case types.EventTypeWorkflowTaskStarted:
+		attrs = &types.WorkflowTaskStartedAttributes{}
+	case types.EventTypeWorkflowTaskCompleted:
+		attrs = &types.WorkflowTaskCompletedAttributes{}
+	case types.EventTypeWorkflowTaskFailed:
+		attrs = &types.WorkflowTaskFailedAttributes{}
+	case types.EventTypeWorkflowTaskTimedOut:
+		attrs = &types.WorkflowTaskTimedOutAttributes{}
+	case types.EventTypeChildExecutionInitiated:
+		attrs = &types.ChildExecutionInitiatedAttributes{}
+	case types.EventTypeChildExecutionStarted:
+		attrs = &types.ChildExecutionStartedAttributes{}
+	case types.EventTypeChildExecutionCompleted:
+		attrs = &types.ChildExecutionCompletedAttributes{}
+	case types.EventTypeChildExecutionFailed:
+		attrs = &types.ChildExecutionFailedAttributes{}
+	case types.EventTypeExecutionCancelRequested:
+		attrs = &types.ExecutionCancelRequestedAttributes{}
+	case types.EventTypeExecutionCanceled:
+		attrs = &types.ExecutionCanceledAttributes{}
+	case types.EventTypeNodeCanceled:
+		attrs = &types.NodeCanceledAttributes{}
+	case types.EventTypeExecutionTimedOut:
+		attrs = &types.ExecutionTimedOutAttributes{}
 	default:
 		return attrMap, nil
 	}
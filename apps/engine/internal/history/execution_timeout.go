@@ -0,0 +1,99 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/linkflow/engine/internal/controlplane"
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+// applyNamespaceDefaults gives an execution started without an execution
+// timeout the workflow execution TTL of its namespace. A run continued as
+// new keeps the timeout of the execution it belongs to, even if there is
+// none. The namespace registry may have to ask the control plane, so the
+// defaults are applied before the execution is locked.
+func (s *Service) applyNamespaceDefaults(ctx context.Context, namespaceID string, attrs *types.ExecutionStartedAttributes) {
+	if s.namespaces == nil || attrs.ExecutionTimeout > 0 || attrs.Initiator == types.InitiatorContinueAsNew {
+		return
+	}
+	ns, err := s.namespaces.GetNamespace(ctx, namespaceID)
+	if err != nil {
+		// A namespace the registry does not know has no defaults.
+		if !errors.Is(err, controlplane.ErrNamespaceNotFound) {
+			s.logger.Warn("failed to get namespace defaults", "error", err, "namespace", namespaceID)
+		}
+		return
+	}
+	attrs.ExecutionTimeout = ns.WorkflowExecutionTTL
+}
+
+// timeoutExecution closes a run that ran past its execution or run timeout.
+// Its pending timers and nodes are canceled in the same update, which cancels
+// their durable timers as well; its children are left to their parent close
+// policies as on any other close. A run that already closed is left as it is.
+func (s *Service) timeoutExecution(ctx context.Context, key types.ExecutionKey, timeoutType string) error {
+	return s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+		if !state.IsWorkflowExecutionRunning() {
+			return nil, nil
+		}
+		now := time.Now()
+		events := cancelPendingTimers(state, now)
+		events = append(events, closePendingActivities(state, now)...)
+		return append(events, &types.HistoryEvent{
+			EventType: types.EventTypeExecutionTimedOut,
+			Timestamp: now,
+			Attributes: &types.ExecutionTimedOutAttributes{
+				TimeoutType: timeoutType,
+			},
+		}), nil
+	})
+}
+
+// cancelPendingTimers returns the TimerCanceled events of the decider's
+// pending timers, ordered by timer ID.
+func cancelPendingTimers(state *engine.MutableState, now time.Time) []*types.HistoryEvent {
+	timerIDs := make([]string, 0, len(state.PendingTimers))
+	for id := range state.PendingTimers {
+		timerIDs = append(timerIDs, id)
+	}
+	slices.Sort(timerIDs)
+
+	events := make([]*types.HistoryEvent, 0, len(timerIDs))
+	for _, id := range timerIDs {
+		events = append(events, &types.HistoryEvent{
+			EventType: types.EventTypeTimerCanceled,
+			Timestamp: now,
+			Attributes: &types.TimerCanceledAttributes{
+				TimerID: id,
+			},
+		})
+	}
+	return events
+}
+
+// closePendingActivities returns the NodeCanceled events of all pending
+// nodes, started or not, in the order they were scheduled. A worker still
+// running one of them finds it gone when it reports back.
+func closePendingActivities(state *engine.MutableState, now time.Time) []*types.HistoryEvent {
+	scheduledEventIDs := make([]int64, 0, len(state.PendingActivities))
+	for id := range state.PendingActivities {
+		scheduledEventIDs = append(scheduledEventIDs, id)
+	}
+	slices.Sort(scheduledEventIDs)
+
+	events := make([]*types.HistoryEvent, 0, len(scheduledEventIDs))
+	for _, id := range scheduledEventIDs {
+		events = append(events, &types.HistoryEvent{
+			EventType: types.EventTypeNodeCanceled,
+			Timestamp: now,
+			Attributes: &types.NodeCanceledAttributes{
+				ScheduledEventID: id,
+			},
+		})
+	}
+	return events
+}
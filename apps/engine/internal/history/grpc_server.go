@@ -3,14 +3,18 @@ package history
 import (
 	"context"
 	"errors"
+	"sort"
 	"time"
 
 	apiv1 "github.com/linkflow/engine/api/gen/linkflow/api/v1"
 	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
 	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/shard"
 	"github.com/linkflow/engine/internal/history/types"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -31,6 +35,9 @@ func (s *GRPCServer) RecordEvent(ctx context.Context, req *historyv1.RecordEvent
 	}
 
 	event := protoEventToInternal(req.GetEvent())
+	if attrs, ok := event.Attributes.(*types.ExecutionStartedAttributes); ok && attrs.ParentExecution != nil {
+		attrs.ParentExecution.NamespaceID = key.NamespaceID
+	}
 
 	if err := s.service.RecordEvent(ctx, key, event); err != nil {
 		return nil, s.toGRPCError(err)
@@ -76,17 +83,95 @@ func (s *GRPCServer) GetMutableState(ctx context.Context, req *historyv1.GetMuta
 	if err != nil {
 		return nil, s.toGRPCError(err)
 	}
+	limits := s.service.historyLimits(ctx, key.NamespaceID)
 
 	return &historyv1.GetMutableStateResponse{
 		WorkflowExecution: &commonv1.WorkflowExecution{
 			WorkflowId: key.WorkflowID,
 			RunId:      key.RunID,
 		},
-		NextEventId:    state.NextEventID,
-		WorkflowStatus: commonv1.ExecutionStatus(state.ExecutionInfo.Status),
+		NextEventId:     state.NextEventID,
+		WorkflowStatus:  executionStatusToProto(state.ExecutionInfo.Status),
+		PendingChildren: pendingChildrenToProto(state.PendingChildExecutions),
+		HistorySize:     state.HistorySize,
+		HistoryLength:   state.HistoryCount(),
+		HistoryLimits: &historyv1.HistoryLimits{
+			SizeWarnBytes:  limits.SizeWarn,
+			SizeLimitBytes: limits.SizeLimit,
+			CountWarn:      limits.CountWarn,
+			CountLimit:     limits.CountLimit,
+		},
 	}, nil
 }
 
+// pendingChildrenToProto lists the pending child executions in the order
+// they were initiated.
+func pendingChildrenToProto(children map[int64]*types.ChildExecutionInfo) []*historyv1.PendingChildExecutionInfo {
+	result := make([]*historyv1.PendingChildExecutionInfo, 0, len(children))
+	for _, child := range children {
+		result = append(result, &historyv1.PendingChildExecutionInfo{
+			InitiatedEventId: child.InitiatedEventID,
+			StartedEventId:   child.StartedEventID,
+			NodeId:           child.NodeID,
+			WorkflowExecution: &commonv1.WorkflowExecution{
+				WorkflowId: child.WorkflowID,
+				RunId:      child.RunID,
+			},
+			WorkflowType:      child.WorkflowType,
+			ParentClosePolicy: commonv1.ParentClosePolicy(child.ParentClosePolicy),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].InitiatedEventId < result[j].InitiatedEventId
+	})
+	return result
+}
+
+// executionStatusToProto maps the internal execution status, whose values
+// are persisted and do not line up with the API enum.
+func executionStatusToProto(status types.ExecutionStatus) commonv1.ExecutionStatus {
+	switch status {
+	case types.ExecutionStatusRunning:
+		return commonv1.ExecutionStatus_EXECUTION_STATUS_RUNNING
+	case types.ExecutionStatusCompleted:
+		return commonv1.ExecutionStatus_EXECUTION_STATUS_COMPLETED
+	case types.ExecutionStatusFailed:
+		return commonv1.ExecutionStatus_EXECUTION_STATUS_FAILED
+	case types.ExecutionStatusTerminated:
+		return commonv1.ExecutionStatus_EXECUTION_STATUS_TERMINATED
+	case types.ExecutionStatusTimedOut:
+		return commonv1.ExecutionStatus_EXECUTION_STATUS_TIMED_OUT
+	case types.ExecutionStatusContinuedAsNew:
+		return commonv1.ExecutionStatus_EXECUTION_STATUS_CONTINUED_AS_NEW
+	case types.ExecutionStatusCanceled:
+		return commonv1.ExecutionStatus_EXECUTION_STATUS_CANCELLED
+	default:
+		return commonv1.ExecutionStatus_EXECUTION_STATUS_UNSPECIFIED
+	}
+}
+
+// executionStatusFromProto is the inverse of executionStatusToProto.
+func executionStatusFromProto(status commonv1.ExecutionStatus) types.ExecutionStatus {
+	switch status {
+	case commonv1.ExecutionStatus_EXECUTION_STATUS_RUNNING:
+		return types.ExecutionStatusRunning
+	case commonv1.ExecutionStatus_EXECUTION_STATUS_COMPLETED:
+		return types.ExecutionStatusCompleted
+	case commonv1.ExecutionStatus_EXECUTION_STATUS_FAILED:
+		return types.ExecutionStatusFailed
+	case commonv1.ExecutionStatus_EXECUTION_STATUS_TERMINATED:
+		return types.ExecutionStatusTerminated
+	case commonv1.ExecutionStatus_EXECUTION_STATUS_TIMED_OUT:
+		return types.ExecutionStatusTimedOut
+	case commonv1.ExecutionStatus_EXECUTION_STATUS_CONTINUED_AS_NEW:
+		return types.ExecutionStatusContinuedAsNew
+	case commonv1.ExecutionStatus_EXECUTION_STATUS_CANCELLED:
+		return types.ExecutionStatusCanceled
+	default:
+		return types.ExecutionStatusUnspecified
+	}
+}
+
 func (s *GRPCServer) ResetExecution(ctx context.Context, req *historyv1.ResetExecutionRequest) (*historyv1.ResetExecutionResponse, error) {
 	key := types.ExecutionKey{
 		NamespaceID: req.GetNamespace(),
@@ -104,19 +189,148 @@ func (s *GRPCServer) ResetExecution(ctx context.Context, req *historyv1.ResetExe
 	}, nil
 }
 
+func (s *GRPCServer) SignalWorkflowExecution(ctx context.Context, req *historyv1.SignalWorkflowExecutionRequest) (*historyv1.SignalWorkflowExecutionResponse, error) {
+	resp, err := s.service.SignalWorkflowExecution(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) RecordTimerFired(ctx context.Context, req *historyv1.RecordTimerFiredRequest) (*historyv1.RecordTimerFiredResponse, error) {
+	resp, err := s.service.RecordTimerFired(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) RecordWorkflowTaskStarted(ctx context.Context, req *historyv1.RecordWorkflowTaskStartedRequest) (*historyv1.RecordWorkflowTaskStartedResponse, error) {
+	resp, err := s.service.RecordWorkflowTaskStarted(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) RecordActivityTaskStarted(ctx context.Context, req *historyv1.RecordActivityTaskStartedRequest) (*historyv1.RecordActivityTaskStartedResponse, error) {
+	resp, err := s.service.RecordActivityTaskStarted(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) RecordActivityTaskHeartbeat(ctx context.Context, req *historyv1.RecordActivityTaskHeartbeatRequest) (*historyv1.RecordActivityTaskHeartbeatResponse, error) {
+	resp, err := s.service.RecordActivityTaskHeartbeat(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) RespondWorkflowTaskCompleted(ctx context.Context, req *historyv1.RespondWorkflowTaskCompletedRequest) (*historyv1.RespondWorkflowTaskCompletedResponse, error) {
+	resp, err := s.service.RespondWorkflowTaskCompleted(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) RespondWorkflowTaskFailed(ctx context.Context, req *historyv1.RespondWorkflowTaskFailedRequest) (*historyv1.RespondWorkflowTaskFailedResponse, error) {
+	resp, err := s.service.RespondWorkflowTaskFailed(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) RespondActivityTaskCompleted(ctx context.Context, req *historyv1.RespondActivityTaskCompletedRequest) (*historyv1.RespondActivityTaskCompletedResponse, error) {
+	resp, err := s.service.RespondActivityTaskCompleted(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) RespondActivityTaskFailed(ctx context.Context, req *historyv1.RespondActivityTaskFailedRequest) (*historyv1.RespondActivityTaskFailedResponse, error) {
+	resp, err := s.service.RespondActivityTaskFailed(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) RespondActivityTaskCanceled(ctx context.Context, req *historyv1.RespondActivityTaskCanceledRequest) (*historyv1.RespondActivityTaskCanceledResponse, error) {
+	resp, err := s.service.RespondActivityTaskCanceled(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) RecordChildExecutionCompleted(ctx context.Context, req *historyv1.RecordChildExecutionCompletedRequest) (*historyv1.RecordChildExecutionCompletedResponse, error) {
+	resp, err := s.service.RecordChildExecutionCompleted(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) StartWorkflowExecution(ctx context.Context, req *historyv1.StartWorkflowExecutionRequest) (*historyv1.StartWorkflowExecutionResponse, error) {
+	resp, err := s.service.StartWorkflowExecution(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) TerminateWorkflowExecution(ctx context.Context, req *historyv1.TerminateWorkflowExecutionRequest) (*historyv1.TerminateWorkflowExecutionResponse, error) {
+	resp, err := s.service.TerminateWorkflowExecution(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) RequestCancelWorkflowExecution(ctx context.Context, req *historyv1.RequestCancelWorkflowExecutionRequest) (*historyv1.RequestCancelWorkflowExecutionResponse, error) {
+	resp, err := s.service.RequestCancelWorkflowExecution(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) QueryWorkflow(ctx context.Context, req *historyv1.QueryWorkflowRequest) (*historyv1.QueryWorkflowResponse, error) {
+	resp, err := s.service.QueryWorkflow(ctx, req)
+	if err != nil {
+		return nil, s.toGRPCError(err)
+	}
+	return resp, nil
+}
+
 func (s *GRPCServer) toGRPCError(err error) error {
 	if err == nil {
 		return nil
 	}
-	if errors.Is(err, types.ErrExecutionNotFound) || errors.Is(err, ErrEventNotFound) {
+	if errors.Is(err, types.ErrExecutionNotFound) || errors.Is(err, ErrEventNotFound) || errors.Is(err, engine.ErrStaleWorkflowTask) || errors.Is(err, engine.ErrActivityNotFound) || errors.Is(err, engine.ErrChildNotFound) {
 		return status.Error(codes.NotFound, err.Error())
 	}
-	if errors.Is(err, ErrServiceNotRunning) {
+	if errors.Is(err, engine.ErrActivityStarted) || errors.Is(err, ErrWorkflowAlreadyStarted) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	if errors.Is(err, ErrServiceNotRunning) || errors.Is(err, shard.ErrShardNotOwned) || errors.Is(err, types.ErrShardOwnershipLost) {
 		return status.Error(codes.Unavailable, err.Error())
 	}
+	if errors.Is(err, ErrReservedTimerID) || errors.Is(err, ErrUnknownQueryType) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 	if errors.Is(err, types.ErrOptimisticLock) {
 		return status.Error(codes.Aborted, err.Error())
 	}
+	if errors.Is(err, engine.ErrWorkflowNotRunning) || errors.Is(err, engine.ErrDuplicateTimer) || errors.Is(err, engine.ErrTimerNotFound) || errors.Is(err, engine.ErrCancelNotRequested) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
 	// Add other mappings as needed
 	return err
 }
@@ -143,20 +357,73 @@ func protoEventToInternal(pe *historyv1.HistoryEvent) *types.HistoryEvent {
 	case types.EventTypeExecutionStarted:
 		if attr := pe.GetExecutionStartedAttributes(); attr != nil {
 			internalAttr := &types.ExecutionStartedAttributes{
-				WorkflowType: attr.GetWorkflowType().GetName(),
-				TaskQueue:    attr.GetTaskQueue().GetName(),
+				WorkflowType:       attr.GetWorkflowType().GetName(),
+				TaskQueue:          attr.GetTaskQueue().GetName(),
+				ExecutionTimeout:   attr.GetExecutionTimeout().AsDuration(),
+				RunTimeout:         attr.GetRunTimeout().AsDuration(),
+				TaskTimeout:        attr.GetTaskTimeout().AsDuration(),
+				Initiator:          attr.GetInitiator(),
+				ContinuedFromRunID: attr.GetContinuedRunId(),
+				FirstRunID:         attr.GetFirstRunId(),
+				RequestID:          attr.GetRequestId(),
+			}
+			if attr.GetExpirationTime() != nil {
+				internalAttr.ExpirationTime = attr.GetExpirationTime().AsTime()
+			}
+			if attr.GetParentWorkflowId() != "" {
+				// A child runs in the namespace of its parent.
+				internalAttr.ParentExecution = &types.ExecutionKey{
+					WorkflowID: attr.GetParentWorkflowId(),
+					RunID:      attr.GetParentRunId(),
+				}
+				internalAttr.ParentInitiatedEventID = attr.GetParentInitiatedEventId()
 			}
 			if input := attr.GetInput(); input != nil && len(input.GetPayloads()) > 0 {
 				internalAttr.Input = input.GetPayloads()[0].GetData()
 			}
 			event.Attributes = internalAttr
 		}
+	case types.EventTypeExecutionContinuedAsNew:
+		if attr := pe.GetExecutionContinuedAsNewAttributes(); attr != nil {
+			event.Attributes = &types.ExecutionContinuedAsNewAttributes{
+				NewRunID:     attr.GetNewRunId(),
+				WorkflowType: attr.GetWorkflowType().GetName(),
+				TaskQueue:    attr.GetTaskQueue().GetName(),
+				Input:        firstPayload(attr.GetInput()),
+				RunTimeout:   attr.GetRunTimeout().AsDuration(),
+				TaskTimeout:  attr.GetTaskTimeout().AsDuration(),
+			}
+		}
+	case types.EventTypeExecutionCancelRequested:
+		if attr := pe.GetExecutionCancelRequestedAttributes(); attr != nil {
+			event.Attributes = &types.ExecutionCancelRequestedAttributes{
+				Reason:    attr.GetReason(),
+				Identity:  attr.GetIdentity(),
+				RequestID: attr.GetRequestId(),
+			}
+		}
+	case types.EventTypeExecutionCanceled:
+		if attr := pe.GetExecutionCancelledAttributes(); attr != nil {
+			event.Attributes = &types.ExecutionCanceledAttributes{
+				Details: firstPayload(attr.GetDetails()),
+			}
+		}
+	case types.EventTypeExecutionTimedOut:
+		if attr := pe.GetExecutionTimedOutAttributes(); attr != nil {
+			event.Attributes = &types.ExecutionTimedOutAttributes{
+				TimeoutType: attr.GetTimeoutType(),
+			}
+		}
 	case types.EventTypeNodeScheduled:
 		if attr := pe.GetNodeScheduledAttributes(); attr != nil {
 			internalAttr := &types.NodeScheduledAttributes{
-				NodeID:    attr.GetNodeId(),
-				NodeType:  attr.GetNodeType(),
-				TaskQueue: attr.GetTaskQueue().GetName(),
+				NodeID:           attr.GetNodeId(),
+				NodeType:         attr.GetNodeType(),
+				TaskQueue:        attr.GetTaskQueue().GetName(),
+				ScheduleToStart:  attr.GetScheduleToStartTimeout().AsDuration(),
+				StartToClose:     attr.GetStartToCloseTimeout().AsDuration(),
+				HeartbeatTimeout: attr.GetHeartbeatTimeout().AsDuration(),
+				RetryPolicy:      retryPolicyFromProto(attr.GetRetryPolicy()),
 			}
 			if input := attr.GetInput(); input != nil && len(input.GetPayloads()) > 0 {
 				internalAttr.Input = input.GetPayloads()[0].GetData()
@@ -168,6 +435,7 @@ func protoEventToInternal(pe *historyv1.HistoryEvent) *types.HistoryEvent {
 			event.Attributes = &types.NodeStartedAttributes{
 				ScheduledEventID: attr.GetScheduledEventId(),
 				Identity:         attr.GetIdentity(),
+				RequestID:        attr.GetRequestId(),
 			}
 		}
 	case types.EventTypeNodeCompleted:
@@ -197,7 +465,157 @@ func protoEventToInternal(pe *historyv1.HistoryEvent) *types.HistoryEvent {
 			}
 			event.Attributes = internalAttr
 		}
-		// TODO: Add Timer and Activity mappings if needed for future tasks
+	case types.EventTypeNodeTimedOut:
+		if attr := pe.GetNodeTimedOutAttributes(); attr != nil {
+			event.Attributes = &types.NodeTimedOutAttributes{
+				ScheduledEventID: attr.GetScheduledEventId(),
+				StartedEventID:   attr.GetStartedEventId(),
+				TimeoutType:      attr.GetTimeoutType(),
+			}
+		}
+	case types.EventTypeNodeCanceled:
+		if attr := pe.GetNodeCancelledAttributes(); attr != nil {
+			event.Attributes = &types.NodeCanceledAttributes{
+				ScheduledEventID: attr.GetScheduledEventId(),
+				StartedEventID:   attr.GetStartedEventId(),
+				Details:          firstPayload(attr.GetDetails()),
+				Identity:         attr.GetIdentity(),
+			}
+		}
+	case types.EventTypeSignalReceived:
+		if attr := pe.GetSignalReceivedAttributes(); attr != nil {
+			event.Attributes = &types.SignalReceivedAttributes{
+				SignalName: attr.GetSignalName(),
+				Input:      firstPayload(attr.GetInput()),
+				Identity:   attr.GetIdentity(),
+				RequestID:  attr.GetRequestId(),
+			}
+		}
+	case types.EventTypeMarkerRecorded:
+		if attr := pe.GetMarkerRecordedAttributes(); attr != nil {
+			details := make(map[string][]byte, len(attr.GetDetails()))
+			for name, payloads := range attr.GetDetails() {
+				details[name] = firstPayload(payloads)
+			}
+			event.Attributes = &types.MarkerRecordedAttributes{
+				MarkerName: attr.GetMarkerName(),
+				Details:    details,
+			}
+		}
+	case types.EventTypeTimerStarted:
+		if attr := pe.GetTimerStartedAttributes(); attr != nil {
+			event.Attributes = &types.TimerStartedAttributes{
+				TimerID:     attr.GetTimerId(),
+				StartToFire: attr.GetStartToFireTimeout().AsDuration(),
+			}
+		}
+	case types.EventTypeTimerFired:
+		if attr := pe.GetTimerFiredAttributes(); attr != nil {
+			event.Attributes = &types.TimerFiredAttributes{
+				TimerID:        attr.GetTimerId(),
+				StartedEventID: attr.GetStartedEventId(),
+			}
+		}
+	case types.EventTypeTimerCanceled:
+		if attr := pe.GetTimerCancelledAttributes(); attr != nil {
+			event.Attributes = &types.TimerCanceledAttributes{
+				TimerID:        attr.GetTimerId(),
+				StartedEventID: attr.GetStartedEventId(),
+				Identity:       attr.GetIdentity(),
+			}
+		}
+	case types.EventTypeWorkflowTaskScheduled:
+		if attr := pe.GetWorkflowTaskScheduledAttributes(); attr != nil {
+			event.Attributes = &types.WorkflowTaskScheduledAttributes{
+				TaskQueue:    attr.GetTaskQueue().GetName(),
+				StartToClose: attr.GetStartToCloseTimeout().AsDuration(),
+				Attempt:      attr.GetAttempt(),
+			}
+		}
+	case types.EventTypeWorkflowTaskStarted:
+		if attr := pe.GetWorkflowTaskStartedAttributes(); attr != nil {
+			event.Attributes = &types.WorkflowTaskStartedAttributes{
+				ScheduledEventID: attr.GetScheduledEventId(),
+				Identity:         attr.GetIdentity(),
+				RequestID:        attr.GetRequestId(),
+			}
+		}
+	case types.EventTypeWorkflowTaskCompleted:
+		if attr := pe.GetWorkflowTaskCompletedAttributes(); attr != nil {
+			event.Attributes = &types.WorkflowTaskCompletedAttributes{
+				ScheduledEventID: attr.GetScheduledEventId(),
+				StartedEventID:   attr.GetStartedEventId(),
+				Identity:         attr.GetIdentity(),
+				BinaryChecksum:   attr.GetBinaryChecksum(),
+			}
+		}
+	case types.EventTypeWorkflowTaskFailed:
+		if attr := pe.GetWorkflowTaskFailedAttributes(); attr != nil {
+			event.Attributes = &types.WorkflowTaskFailedAttributes{
+				ScheduledEventID: attr.GetScheduledEventId(),
+				StartedEventID:   attr.GetStartedEventId(),
+				Cause:            attr.GetCause(),
+				FailureReason:    attr.GetFailure().GetMessage(),
+				FailureDetails:   []byte(attr.GetFailure().GetStackTrace()),
+				Identity:         attr.GetIdentity(),
+				BinaryChecksum:   attr.GetBinaryChecksum(),
+			}
+		}
+	case types.EventTypeWorkflowTaskTimedOut:
+		if attr := pe.GetWorkflowTaskTimedOutAttributes(); attr != nil {
+			event.Attributes = &types.WorkflowTaskTimedOutAttributes{
+				ScheduledEventID: attr.GetScheduledEventId(),
+				StartedEventID:   attr.GetStartedEventId(),
+				TimeoutType:      attr.GetTimeoutType(),
+			}
+		}
+	case types.EventTypeChildExecutionInitiated:
+		if attr := pe.GetChildWorkflowExecutionInitiatedAttributes(); attr != nil {
+			event.Attributes = &types.ChildExecutionInitiatedAttributes{
+				NodeID:            attr.GetNodeId(),
+				WorkflowID:        attr.GetWorkflowId(),
+				RunID:             attr.GetRunId(),
+				WorkflowType:      attr.GetWorkflowType().GetName(),
+				TaskQueue:         attr.GetTaskQueue().GetName(),
+				Input:             firstPayload(attr.GetInput()),
+				ExecutionTimeout:  attr.GetExecutionTimeout().AsDuration(),
+				RunTimeout:        attr.GetRunTimeout().AsDuration(),
+				TaskTimeout:       attr.GetTaskTimeout().AsDuration(),
+				ParentClosePolicy: types.ParentClosePolicy(attr.GetParentClosePolicy()),
+			}
+		}
+	case types.EventTypeChildExecutionStarted:
+		if attr := pe.GetChildWorkflowExecutionStartedAttributes(); attr != nil {
+			event.Attributes = &types.ChildExecutionStartedAttributes{
+				InitiatedEventID: attr.GetInitiatedEventId(),
+				WorkflowID:       attr.GetWorkflowExecution().GetWorkflowId(),
+				RunID:            attr.GetWorkflowExecution().GetRunId(),
+				WorkflowType:     attr.GetWorkflowType().GetName(),
+			}
+		}
+	case types.EventTypeChildExecutionCompleted:
+		if attr := pe.GetChildWorkflowExecutionCompletedAttributes(); attr != nil {
+			event.Attributes = &types.ChildExecutionCompletedAttributes{
+				InitiatedEventID: attr.GetInitiatedEventId(),
+				StartedEventID:   attr.GetStartedEventId(),
+				WorkflowID:       attr.GetWorkflowExecution().GetWorkflowId(),
+				RunID:            attr.GetWorkflowExecution().GetRunId(),
+				Result:           firstPayload(attr.GetResult()),
+			}
+		}
+	case types.EventTypeChildExecutionFailed:
+		if attr := pe.GetChildWorkflowExecutionFailedAttributes(); attr != nil {
+			event.Attributes = &types.ChildExecutionFailedAttributes{
+				InitiatedEventID: attr.GetInitiatedEventId(),
+				StartedEventID:   attr.GetStartedEventId(),
+				WorkflowID:       attr.GetWorkflowExecution().GetWorkflowId(),
+				RunID:            attr.GetWorkflowExecution().GetRunId(),
+				Status:           executionStatusFromProto(attr.GetStatus()),
+				Reason:           attr.GetFailure().GetMessage(),
+				Details:          []byte(attr.GetFailure().GetStackTrace()),
+			}
+		}
+		// TODO: Add Activity mappings if needed for future tasks
 		// For now, Node events are critical for workflow progress.
 	}
 
@@ -214,6 +632,14 @@ func protoEventTypeToInternal(et commonv1.EventType) types.EventType {
 		return types.EventTypeExecutionFailed
 	case commonv1.EventType_EVENT_TYPE_EXECUTION_TERMINATED:
 		return types.EventTypeExecutionTerminated
+	case commonv1.EventType_EVENT_TYPE_EXECUTION_CONTINUED_AS_NEW:
+		return types.EventTypeExecutionContinuedAsNew
+	case commonv1.EventType_EVENT_TYPE_EXECUTION_CANCEL_REQUESTED:
+		return types.EventTypeExecutionCancelRequested
+	case commonv1.EventType_EVENT_TYPE_EXECUTION_CANCELLED:
+		return types.EventTypeExecutionCanceled
+	case commonv1.EventType_EVENT_TYPE_EXECUTION_TIMED_OUT:
+		return types.EventTypeExecutionTimedOut
 	case commonv1.EventType_EVENT_TYPE_NODE_SCHEDULED:
 		return types.EventTypeNodeScheduled
 	case commonv1.EventType_EVENT_TYPE_NODE_STARTED:
@@ -224,12 +650,36 @@ func protoEventTypeToInternal(et commonv1.EventType) types.EventType {
 		return types.EventTypeNodeFailed
 	case commonv1.EventType_EVENT_TYPE_NODE_TIMED_OUT:
 		return types.EventTypeNodeTimedOut
+	case commonv1.EventType_EVENT_TYPE_NODE_CANCELLED:
+		return types.EventTypeNodeCanceled
 	case commonv1.EventType_EVENT_TYPE_TIMER_STARTED:
 		return types.EventTypeTimerStarted
 	case commonv1.EventType_EVENT_TYPE_TIMER_FIRED:
 		return types.EventTypeTimerFired
 	case commonv1.EventType_EVENT_TYPE_TIMER_CANCELLED:
 		return types.EventTypeTimerCanceled
+	case commonv1.EventType_EVENT_TYPE_SIGNAL_RECEIVED:
+		return types.EventTypeSignalReceived
+	case commonv1.EventType_EVENT_TYPE_MARKER_RECORDED:
+		return types.EventTypeMarkerRecorded
+	case commonv1.EventType_EVENT_TYPE_WORKFLOW_TASK_SCHEDULED:
+		return types.EventTypeWorkflowTaskScheduled
+	case commonv1.EventType_EVENT_TYPE_WORKFLOW_TASK_STARTED:
+		return types.EventTypeWorkflowTaskStarted
+	case commonv1.EventType_EVENT_TYPE_WORKFLOW_TASK_COMPLETED:
+		return types.EventTypeWorkflowTaskCompleted
+	case commonv1.EventType_EVENT_TYPE_WORKFLOW_TASK_FAILED:
+		return types.EventTypeWorkflowTaskFailed
+	case commonv1.EventType_EVENT_TYPE_WORKFLOW_TASK_TIMED_OUT:
+		return types.EventTypeWorkflowTaskTimedOut
+	case commonv1.EventType_EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_INITIATED:
+		return types.EventTypeChildExecutionInitiated
+	case commonv1.EventType_EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_STARTED:
+		return types.EventTypeChildExecutionStarted
+	case commonv1.EventType_EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_COMPLETED:
+		return types.EventTypeChildExecutionCompleted
+	case commonv1.EventType_EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_FAILED:
+		return types.EventTypeChildExecutionFailed
 	default:
 		return types.EventTypeUnspecified
 	}
@@ -245,6 +695,14 @@ func internalEventTypeToProto(et types.EventType) commonv1.EventType {
 		return commonv1.EventType_EVENT_TYPE_EXECUTION_FAILED
 	case types.EventTypeExecutionTerminated:
 		return commonv1.EventType_EVENT_TYPE_EXECUTION_TERMINATED
+	case types.EventTypeExecutionContinuedAsNew:
+		return commonv1.EventType_EVENT_TYPE_EXECUTION_CONTINUED_AS_NEW
+	case types.EventTypeExecutionCancelRequested:
+		return commonv1.EventType_EVENT_TYPE_EXECUTION_CANCEL_REQUESTED
+	case types.EventTypeExecutionCanceled:
+		return commonv1.EventType_EVENT_TYPE_EXECUTION_CANCELLED
+	case types.EventTypeExecutionTimedOut:
+		return commonv1.EventType_EVENT_TYPE_EXECUTION_TIMED_OUT
 	case types.EventTypeNodeScheduled:
 		return commonv1.EventType_EVENT_TYPE_NODE_SCHEDULED
 	case types.EventTypeNodeStarted:
@@ -255,12 +713,36 @@ func internalEventTypeToProto(et types.EventType) commonv1.EventType {
 		return commonv1.EventType_EVENT_TYPE_NODE_FAILED
 	case types.EventTypeNodeTimedOut:
 		return commonv1.EventType_EVENT_TYPE_NODE_TIMED_OUT
+	case types.EventTypeNodeCanceled:
+		return commonv1.EventType_EVENT_TYPE_NODE_CANCELLED
 	case types.EventTypeTimerStarted:
 		return commonv1.EventType_EVENT_TYPE_TIMER_STARTED
 	case types.EventTypeTimerFired:
 		return commonv1.EventType_EVENT_TYPE_TIMER_FIRED
 	case types.EventTypeTimerCanceled:
 		return commonv1.EventType_EVENT_TYPE_TIMER_CANCELLED
+	case types.EventTypeSignalReceived:
+		return commonv1.EventType_EVENT_TYPE_SIGNAL_RECEIVED
+	case types.EventTypeMarkerRecorded:
+		return commonv1.EventType_EVENT_TYPE_MARKER_RECORDED
+	case types.EventTypeWorkflowTaskScheduled:
+		return commonv1.EventType_EVENT_TYPE_WORKFLOW_TASK_SCHEDULED
+	case types.EventTypeWorkflowTaskStarted:
+		return commonv1.EventType_EVENT_TYPE_WORKFLOW_TASK_STARTED
+	case types.EventTypeWorkflowTaskCompleted:
+		return commonv1.EventType_EVENT_TYPE_WORKFLOW_TASK_COMPLETED
+	case types.EventTypeWorkflowTaskFailed:
+		return commonv1.EventType_EVENT_TYPE_WORKFLOW_TASK_FAILED
+	case types.EventTypeWorkflowTaskTimedOut:
+		return commonv1.EventType_EVENT_TYPE_WORKFLOW_TASK_TIMED_OUT
+	case types.EventTypeChildExecutionInitiated:
+		return commonv1.EventType_EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_INITIATED
+	case types.EventTypeChildExecutionStarted:
+		return commonv1.EventType_EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_STARTED
+	case types.EventTypeChildExecutionCompleted:
+		return commonv1.EventType_EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_COMPLETED
+	case types.EventTypeChildExecutionFailed:
+		return commonv1.EventType_EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_FAILED
 	default:
 		return commonv1.EventType_EVENT_TYPE_UNSPECIFIED
 	}
@@ -284,9 +766,64 @@ func internalEventToProto(e *types.HistoryEvent) *historyv1.HistoryEvent {
 		if attr, ok := e.Attributes.(*types.ExecutionStartedAttributes); ok {
 			event.Attributes = &historyv1.HistoryEvent_ExecutionStartedAttributes{ // This one was correct
 				ExecutionStartedAttributes: &historyv1.ExecutionStartedEventAttributes{
+					WorkflowType:     &apiv1.WorkflowType{Name: attr.WorkflowType},
+					TaskQueue:        &apiv1.TaskQueue{Name: attr.TaskQueue},
+					Input:            &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: attr.Input}}},
+					ExecutionTimeout: durationpb.New(attr.ExecutionTimeout),
+					RunTimeout:       durationpb.New(attr.RunTimeout),
+					TaskTimeout:      durationpb.New(attr.TaskTimeout),
+					Initiator:        attr.Initiator,
+					ContinuedRunId:   attr.ContinuedFromRunID,
+					FirstRunId:       attr.FirstRunID,
+					RequestId:        attr.RequestID,
+				},
+			}
+			if !attr.ExpirationTime.IsZero() {
+				event.GetExecutionStartedAttributes().ExpirationTime = timestamppb.New(attr.ExpirationTime)
+			}
+			if parent := attr.ParentExecution; parent != nil {
+				started := event.GetExecutionStartedAttributes()
+				started.ParentWorkflowId = parent.WorkflowID
+				started.ParentRunId = parent.RunID
+				started.ParentInitiatedEventId = attr.ParentInitiatedEventID
+			}
+		}
+	case types.EventTypeExecutionContinuedAsNew:
+		if attr, ok := e.Attributes.(*types.ExecutionContinuedAsNewAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_ExecutionContinuedAsNewAttributes{
+				ExecutionContinuedAsNewAttributes: &historyv1.ExecutionContinuedAsNewEventAttributes{
+					NewRunId:     attr.NewRunID,
 					WorkflowType: &apiv1.WorkflowType{Name: attr.WorkflowType},
 					TaskQueue:    &apiv1.TaskQueue{Name: attr.TaskQueue},
 					Input:        &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: attr.Input}}},
+					RunTimeout:   durationpb.New(attr.RunTimeout),
+					TaskTimeout:  durationpb.New(attr.TaskTimeout),
+				},
+			}
+		}
+	case types.EventTypeExecutionCancelRequested:
+		if attr, ok := e.Attributes.(*types.ExecutionCancelRequestedAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_ExecutionCancelRequestedAttributes{
+				ExecutionCancelRequestedAttributes: &historyv1.ExecutionCancelRequestedEventAttributes{
+					Reason:    attr.Reason,
+					Identity:  attr.Identity,
+					RequestId: attr.RequestID,
+				},
+			}
+		}
+	case types.EventTypeExecutionCanceled:
+		if attr, ok := e.Attributes.(*types.ExecutionCanceledAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_ExecutionCancelledAttributes{
+				ExecutionCancelledAttributes: &historyv1.ExecutionCancelledEventAttributes{
+					Details: &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: attr.Details}}},
+				},
+			}
+		}
+	case types.EventTypeExecutionTimedOut:
+		if attr, ok := e.Attributes.(*types.ExecutionTimedOutAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_ExecutionTimedOutAttributes{
+				ExecutionTimedOutAttributes: &historyv1.ExecutionTimedOutEventAttributes{
+					TimeoutType: attr.TimeoutType,
 				},
 			}
 		}
@@ -294,10 +831,14 @@ func internalEventToProto(e *types.HistoryEvent) *historyv1.HistoryEvent {
 		if attr, ok := e.Attributes.(*types.NodeScheduledAttributes); ok {
 			event.Attributes = &historyv1.HistoryEvent_NodeScheduledAttributes{ // Wrapper name fixed
 				NodeScheduledAttributes: &historyv1.NodeScheduledEventAttributes{
-					NodeId:    attr.NodeID,
-					NodeType:  attr.NodeType,
-					Input:     &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: attr.Input}}},
-					TaskQueue: &apiv1.TaskQueue{Name: attr.TaskQueue},
+					NodeId:                 attr.NodeID,
+					NodeType:               attr.NodeType,
+					Input:                  &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: attr.Input}}},
+					TaskQueue:              &apiv1.TaskQueue{Name: attr.TaskQueue},
+					ScheduleToStartTimeout: durationpb.New(attr.ScheduleToStart),
+					StartToCloseTimeout:    durationpb.New(attr.StartToClose),
+					HeartbeatTimeout:       durationpb.New(attr.HeartbeatTimeout),
+					RetryPolicy:            retryPolicyToProto(attr.RetryPolicy),
 				},
 			}
 		}
@@ -307,6 +848,7 @@ func internalEventToProto(e *types.HistoryEvent) *historyv1.HistoryEvent {
 				NodeStartedAttributes: &historyv1.NodeStartedEventAttributes{
 					ScheduledEventId: attr.ScheduledEventID,
 					Identity:         attr.Identity,
+					RequestId:        attr.RequestID,
 				},
 			}
 		}
@@ -336,7 +878,211 @@ func internalEventToProto(e *types.HistoryEvent) *historyv1.HistoryEvent {
 				event.GetNodeFailedAttributes().Logs = &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: attr.Logs}}}
 			}
 		}
+	case types.EventTypeNodeTimedOut:
+		if attr, ok := e.Attributes.(*types.NodeTimedOutAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_NodeTimedOutAttributes{
+				NodeTimedOutAttributes: &historyv1.NodeTimedOutEventAttributes{
+					ScheduledEventId: attr.ScheduledEventID,
+					StartedEventId:   attr.StartedEventID,
+					Failure:          &commonv1.Failure{Message: attr.TimeoutType + " timeout"},
+					TimeoutType:      attr.TimeoutType,
+				},
+			}
+		}
+	case types.EventTypeNodeCanceled:
+		if attr, ok := e.Attributes.(*types.NodeCanceledAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_NodeCancelledAttributes{
+				NodeCancelledAttributes: &historyv1.NodeCancelledEventAttributes{
+					ScheduledEventId: attr.ScheduledEventID,
+					StartedEventId:   attr.StartedEventID,
+					Details:          &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: attr.Details}}},
+					Identity:         attr.Identity,
+				},
+			}
+		}
+	case types.EventTypeSignalReceived:
+		if attr, ok := e.Attributes.(*types.SignalReceivedAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_SignalReceivedAttributes{
+				SignalReceivedAttributes: &historyv1.SignalReceivedEventAttributes{
+					SignalName: attr.SignalName,
+					Input:      &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: attr.Input}}},
+					Identity:   attr.Identity,
+					RequestId:  attr.RequestID,
+				},
+			}
+		}
+	case types.EventTypeMarkerRecorded:
+		if attr, ok := e.Attributes.(*types.MarkerRecordedAttributes); ok {
+			details := make(map[string]*commonv1.Payloads, len(attr.Details))
+			for name, data := range attr.Details {
+				details[name] = &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: data}}}
+			}
+			event.Attributes = &historyv1.HistoryEvent_MarkerRecordedAttributes{
+				MarkerRecordedAttributes: &historyv1.MarkerRecordedEventAttributes{
+					MarkerName: attr.MarkerName,
+					Details:    details,
+				},
+			}
+		}
+	case types.EventTypeTimerStarted:
+		if attr, ok := e.Attributes.(*types.TimerStartedAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_TimerStartedAttributes{
+				TimerStartedAttributes: &historyv1.TimerStartedEventAttributes{
+					TimerId:            attr.TimerID,
+					StartToFireTimeout: durationpb.New(attr.StartToFire),
+				},
+			}
+		}
+	case types.EventTypeTimerFired:
+		if attr, ok := e.Attributes.(*types.TimerFiredAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_TimerFiredAttributes{
+				TimerFiredAttributes: &historyv1.TimerFiredEventAttributes{
+					TimerId:        attr.TimerID,
+					StartedEventId: attr.StartedEventID,
+				},
+			}
+		}
+	case types.EventTypeTimerCanceled:
+		if attr, ok := e.Attributes.(*types.TimerCanceledAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_TimerCancelledAttributes{
+				TimerCancelledAttributes: &historyv1.TimerCancelledEventAttributes{
+					TimerId:        attr.TimerID,
+					StartedEventId: attr.StartedEventID,
+					Identity:       attr.Identity,
+				},
+			}
+		}
+	case types.EventTypeWorkflowTaskScheduled:
+		if attr, ok := e.Attributes.(*types.WorkflowTaskScheduledAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_WorkflowTaskScheduledAttributes{
+				WorkflowTaskScheduledAttributes: &historyv1.WorkflowTaskScheduledEventAttributes{
+					TaskQueue:           &apiv1.TaskQueue{Name: attr.TaskQueue},
+					StartToCloseTimeout: durationpb.New(attr.StartToClose),
+					Attempt:             attr.Attempt,
+				},
+			}
+		}
+	case types.EventTypeWorkflowTaskStarted:
+		if attr, ok := e.Attributes.(*types.WorkflowTaskStartedAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_WorkflowTaskStartedAttributes{
+				WorkflowTaskStartedAttributes: &historyv1.WorkflowTaskStartedEventAttributes{
+					ScheduledEventId: attr.ScheduledEventID,
+					Identity:         attr.Identity,
+					RequestId:        attr.RequestID,
+				},
+			}
+		}
+	case types.EventTypeWorkflowTaskCompleted:
+		if attr, ok := e.Attributes.(*types.WorkflowTaskCompletedAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_WorkflowTaskCompletedAttributes{
+				WorkflowTaskCompletedAttributes: &historyv1.WorkflowTaskCompletedEventAttributes{
+					ScheduledEventId: attr.ScheduledEventID,
+					StartedEventId:   attr.StartedEventID,
+					Identity:         attr.Identity,
+					BinaryChecksum:   attr.BinaryChecksum,
+				},
+			}
+		}
+	case types.EventTypeWorkflowTaskFailed:
+		if attr, ok := e.Attributes.(*types.WorkflowTaskFailedAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_WorkflowTaskFailedAttributes{
+				WorkflowTaskFailedAttributes: &historyv1.WorkflowTaskFailedEventAttributes{
+					ScheduledEventId: attr.ScheduledEventID,
+					StartedEventId:   attr.StartedEventID,
+					Cause:            attr.Cause,
+					Failure:          &commonv1.Failure{Message: attr.FailureReason, StackTrace: string(attr.FailureDetails)},
+					Identity:         attr.Identity,
+					BinaryChecksum:   attr.BinaryChecksum,
+				},
+			}
+		}
+	case types.EventTypeWorkflowTaskTimedOut:
+		if attr, ok := e.Attributes.(*types.WorkflowTaskTimedOutAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_WorkflowTaskTimedOutAttributes{
+				WorkflowTaskTimedOutAttributes: &historyv1.WorkflowTaskTimedOutEventAttributes{
+					ScheduledEventId: attr.ScheduledEventID,
+					StartedEventId:   attr.StartedEventID,
+					TimeoutType:      attr.TimeoutType,
+				},
+			}
+		}
+	case types.EventTypeChildExecutionInitiated:
+		if attr, ok := e.Attributes.(*types.ChildExecutionInitiatedAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_ChildWorkflowExecutionInitiatedAttributes{
+				ChildWorkflowExecutionInitiatedAttributes: &historyv1.ChildWorkflowExecutionInitiatedEventAttributes{
+					NodeId:            attr.NodeID,
+					WorkflowId:        attr.WorkflowID,
+					RunId:             attr.RunID,
+					WorkflowType:      &apiv1.WorkflowType{Name: attr.WorkflowType},
+					TaskQueue:         &apiv1.TaskQueue{Name: attr.TaskQueue},
+					Input:             &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: attr.Input}}},
+					ExecutionTimeout:  durationpb.New(attr.ExecutionTimeout),
+					RunTimeout:        durationpb.New(attr.RunTimeout),
+					TaskTimeout:       durationpb.New(attr.TaskTimeout),
+					ParentClosePolicy: commonv1.ParentClosePolicy(attr.ParentClosePolicy),
+				},
+			}
+		}
+	case types.EventTypeChildExecutionStarted:
+		if attr, ok := e.Attributes.(*types.ChildExecutionStartedAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_ChildWorkflowExecutionStartedAttributes{
+				ChildWorkflowExecutionStartedAttributes: &historyv1.ChildWorkflowExecutionStartedEventAttributes{
+					InitiatedEventId:  attr.InitiatedEventID,
+					WorkflowExecution: &commonv1.WorkflowExecution{WorkflowId: attr.WorkflowID, RunId: attr.RunID},
+					WorkflowType:      &apiv1.WorkflowType{Name: attr.WorkflowType},
+				},
+			}
+		}
+	case types.EventTypeChildExecutionCompleted:
+		if attr, ok := e.Attributes.(*types.ChildExecutionCompletedAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_ChildWorkflowExecutionCompletedAttributes{
+				ChildWorkflowExecutionCompletedAttributes: &historyv1.ChildWorkflowExecutionCompletedEventAttributes{
+					InitiatedEventId:  attr.InitiatedEventID,
+					StartedEventId:    attr.StartedEventID,
+					WorkflowExecution: &commonv1.WorkflowExecution{WorkflowId: attr.WorkflowID, RunId: attr.RunID},
+					Result:            &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: attr.Result}}},
+				},
+			}
+		}
+	case types.EventTypeChildExecutionFailed:
+		if attr, ok := e.Attributes.(*types.ChildExecutionFailedAttributes); ok {
+			event.Attributes = &historyv1.HistoryEvent_ChildWorkflowExecutionFailedAttributes{
+				ChildWorkflowExecutionFailedAttributes: &historyv1.ChildWorkflowExecutionFailedEventAttributes{
+					InitiatedEventId:  attr.InitiatedEventID,
+					StartedEventId:    attr.StartedEventID,
+					WorkflowExecution: &commonv1.WorkflowExecution{WorkflowId: attr.WorkflowID, RunId: attr.RunID},
+					Failure:           &commonv1.Failure{Message: attr.Reason, StackTrace: string(attr.Details)},
+					Status:            executionStatusToProto(attr.Status),
+				},
+			}
+		}
 	}
 
 	return event
 }
+
+func retryPolicyFromProto(policy *commonv1.RetryPolicy) *types.RetryPolicy {
+	if policy == nil {
+		return nil
+	}
+	return &types.RetryPolicy{
+		InitialInterval:    policy.GetInitialInterval().AsDuration(),
+		BackoffCoefficient: policy.GetBackoffCoefficient(),
+		MaxInterval:        policy.GetMaxInterval().AsDuration(),
+		MaxAttempts:        policy.GetMaxAttempts(),
+		NonRetryableErrors: policy.GetNonRetryableErrors(),
+	}
+}
+
+func retryPolicyToProto(policy *types.RetryPolicy) *commonv1.RetryPolicy {
+	if policy == nil {
+		return nil
+	}
+	return &commonv1.RetryPolicy{
+		InitialInterval:    durationpb.New(policy.InitialInterval),
+		BackoffCoefficient: policy.BackoffCoefficient,
+		MaxInterval:        durationpb.New(policy.MaxInterval),
+		MaxAttempts:        policy.MaxAttempts,
+		NonRetryableErrors: policy.NonRetryableErrors,
+	}
+}
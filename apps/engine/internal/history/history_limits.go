@@ -0,0 +1,121 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/events"
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+// HistoryLimits bound the history of a run by its encoded size in bytes and
+// its number of events. Crossing a warn limit records a HistoryLimitWarning
+// marker once; reaching a hard limit fails the run.
+type HistoryLimits struct {
+	SizeWarn   int64
+	SizeLimit  int64
+	CountWarn  int64
+	CountLimit int64
+}
+
+// DefaultHistoryLimits are the limits of namespaces that do not set their
+// own.
+var DefaultHistoryLimits = HistoryLimits{
+	SizeWarn:   10 << 20,
+	SizeLimit:  50 << 20,
+	CountWarn:  10_000,
+	CountLimit: 50_000,
+}
+
+// historySizeSerializer encodes events the way the persistent event store
+// does, so the tracked size matches what is written.
+var historySizeSerializer = events.NewJSONSerializer()
+
+// addHistorySize adds the encoded size of event to the run's history size.
+func addHistorySize(state *engine.MutableState, event *types.HistoryEvent) {
+	data, err := historySizeSerializer.Serialize(event)
+	if err != nil {
+		return
+	}
+	state.HistorySize += int64(len(data))
+}
+
+// historyLimits returns the history limits of a namespace: the service's
+// limits, overridden by those the namespace sets. A warn limit that is not
+// below its hard limit is moved below it, so the warning still comes first.
+func (s *Service) historyLimits(ctx context.Context, namespaceID string) HistoryLimits {
+	limits := s.historyLimitDefaults
+	if s.namespaces != nil {
+		// A namespace that cannot be read keeps the service's limits; the
+		// update must not fail because of it.
+		if ns, err := s.namespaces.GetNamespace(ctx, namespaceID); err == nil {
+			if ns.HistorySizeWarnMB > 0 {
+				limits.SizeWarn = int64(ns.HistorySizeWarnMB) << 20
+			}
+			if ns.HistorySizeLimitMB > 0 {
+				limits.SizeLimit = int64(ns.HistorySizeLimitMB) << 20
+			}
+			if ns.HistoryCountWarn > 0 {
+				limits.CountWarn = int64(ns.HistoryCountWarn)
+			}
+			if ns.HistoryCountLimit > 0 {
+				limits.CountLimit = int64(ns.HistoryCountLimit)
+			}
+		}
+	}
+	if limits.SizeWarn >= limits.SizeLimit {
+		limits.SizeWarn = limits.SizeLimit * 4 / 5
+	}
+	if limits.CountWarn >= limits.CountLimit {
+		limits.CountWarn = limits.CountLimit * 4 / 5
+	}
+	return limits
+}
+
+// historyLimitEvents returns the events a running run's history limits call
+// for after an update: the events that fail it once a hard limit is reached,
+// or the warning marker the first time a warn limit is crossed.
+func (s *Service) historyLimitEvents(key types.ExecutionKey, state *engine.MutableState, limits HistoryLimits) []*types.HistoryEvent {
+	if !state.IsWorkflowExecutionRunning() {
+		return nil
+	}
+	size, count := state.HistorySize, state.HistoryCount()
+	now := time.Now()
+
+	if size >= limits.SizeLimit || count >= limits.CountLimit {
+		s.logger.Warn("history limit exceeded, failing execution",
+			"workflow_id", key.WorkflowID,
+			"run_id", key.RunID,
+			"history_size", size,
+			"history_count", count,
+		)
+		events := cancelPendingTimers(state, now)
+		events = append(events, closePendingActivities(state, now)...)
+		return append(events, &types.HistoryEvent{
+			EventType: types.EventTypeExecutionFailed,
+			Timestamp: now,
+			Attributes: &types.ExecutionFailedAttributes{
+				Reason: fmt.Sprintf("history limit exceeded: %d events of %d allowed, %d bytes of %d allowed",
+					count, limits.CountLimit, size, limits.SizeLimit),
+			},
+		})
+	}
+
+	if !state.HistoryLimitWarned && (size >= limits.SizeWarn || count >= limits.CountWarn) {
+		return []*types.HistoryEvent{{
+			EventType: types.EventTypeMarkerRecorded,
+			Timestamp: now,
+			Attributes: &types.MarkerRecordedAttributes{
+				MarkerName: types.MarkerNameHistoryLimitWarning,
+				Details: map[string][]byte{
+					"history_size":  []byte(strconv.FormatInt(size, 10)),
+					"history_count": []byte(strconv.FormatInt(count, 10)),
+				},
+			},
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package history
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
+	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
+	matchingv1 "github.com/linkflow/engine/api/gen/linkflow/matching/v1"
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+// Built-in queries are answered by history from the mutable state, without
+// involving a worker. Their types use the reserved prefix so they cannot
+// shadow a custom query.
+const (
+	QueryTypeNodeStates    = "__node_states"
+	QueryTypeOutputs       = "__outputs"
+	QueryTypePendingTimers = "__pending_timers"
+	QueryTypeSignals       = "__signals"
+)
+
+// defaultQueryTimeout bounds the wait for a worker to answer a custom query
+// that did not set a timeout.
+const defaultQueryTimeout = 10 * time.Second
+
+// Node states reported by the __node_states query.
+const (
+	nodeStateScheduled = "scheduled"
+	nodeStateRunning   = "running"
+	nodeStateCompleted = "completed"
+	nodeStateFailed    = "failed"
+)
+
+// queryNodeState is the state of one node in the answer to __node_states.
+type queryNodeState struct {
+	State   string `json:"state"`
+	Attempt int32  `json:"attempt,omitempty"`
+	Failure string `json:"failure,omitempty"`
+}
+
+// queryTimer is a pending timer in the answer to __pending_timers.
+type queryTimer struct {
+	TimerID  string    `json:"timer_id"`
+	FireTime time.Time `json:"fire_time"`
+}
+
+// querySignal is a received signal in the answer to __signals.
+type querySignal struct {
+	Name       string          `json:"name"`
+	Input      json.RawMessage `json:"input,omitempty"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+// QueryWorkflow answers a read-only query about a run. Built-in queries are
+// answered from the run's mutable state and history. Any other query type is
+// handed to a worker polling the run's task queue, and the call waits for
+// its answer until the query timeout.
+func (s *Service) QueryWorkflow(ctx context.Context, req *historyv1.QueryWorkflowRequest) (*historyv1.QueryWorkflowResponse, error) {
+	key := types.ExecutionKey{
+		NamespaceID: req.GetNamespace(),
+		WorkflowID:  req.GetWorkflowExecution().GetWorkflowId(),
+		RunID:       req.GetWorkflowExecution().GetRunId(),
+	}
+	if key.RunID == "" {
+		runID, err := s.stateStore.GetCurrentRunID(ctx, key.NamespaceID, key.WorkflowID)
+		if err != nil {
+			return nil, err
+		}
+		key.RunID = runID
+	}
+
+	var state *engine.MutableState
+	err := s.readState(ctx, key, func(current *engine.MutableState) {
+		state = current.Clone()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if state.ExecutionInfo.Status == types.ExecutionStatusUnspecified {
+		return nil, fmt.Errorf("%w: run %s of workflow %s", types.ErrExecutionNotFound, key.RunID, key.WorkflowID)
+	}
+
+	var answer any
+	switch req.GetQueryType() {
+	case QueryTypeNodeStates:
+		answer = queryNodeStates(state)
+	case QueryTypeOutputs:
+		answer = queryOutputs(state)
+	case QueryTypePendingTimers:
+		answer = queryPendingTimers(state)
+	case QueryTypeSignals:
+		answer, err = s.querySignals(ctx, key, state)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return s.queryWorker(ctx, key, state, req)
+	}
+
+	result, err := json.Marshal(answer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode query result: %w", err)
+	}
+	return &historyv1.QueryWorkflowResponse{
+		QueryResult: &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: result}}},
+	}, nil
+}
+
+// queryWorker routes a custom query through matching to a worker polling the
+// run's task queue.
+func (s *Service) queryWorker(ctx context.Context, key types.ExecutionKey, state *engine.MutableState, req *historyv1.QueryWorkflowRequest) (*historyv1.QueryWorkflowResponse, error) {
+	if s.matchingClient == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownQueryType, req.GetQueryType())
+	}
+
+	timeout := req.GetTimeout().AsDuration()
+	if timeout <= 0 {
+		timeout = defaultQueryTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := s.matchingClient.QueryWorkflow(ctx, &matchingv1.MatchingServiceQueryWorkflowRequest{
+		Namespace: key.NamespaceID,
+		TaskQueue: &matchingv1.TaskQueue{Name: state.ExecutionInfo.TaskQueue},
+		WorkflowExecution: &commonv1.WorkflowExecution{
+			WorkflowId: key.WorkflowID,
+			RunId:      key.RunID,
+		},
+		Query: &matchingv1.QueryInput{
+			QueryType: req.GetQueryType(),
+			QueryArgs: req.GetQueryArgs(),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &historyv1.QueryWorkflowResponse{QueryResult: resp.GetQueryResult()}, nil
+}
+
+// queryNodeStates returns the state of every node that was scheduled, by
+// node ID. A node that is pending again, e.g. for a retry, reports its
+// pending state.
+func queryNodeStates(state *engine.MutableState) map[string]queryNodeState {
+	nodes := make(map[string]queryNodeState, len(state.CompletedNodes)+len(state.PendingActivities))
+	for nodeID, result := range state.CompletedNodes {
+		node := queryNodeState{State: nodeStateCompleted}
+		if result.FailureReason != "" {
+			node = queryNodeState{State: nodeStateFailed, Failure: result.FailureReason}
+		}
+		nodes[nodeID] = node
+	}
+	for _, ai := range state.PendingActivities {
+		node := queryNodeState{State: nodeStateScheduled, Attempt: ai.Attempt}
+		if ai.StartedEventID != 0 {
+			node.State = nodeStateRunning
+		}
+		nodes[ai.ActivityID] = node
+	}
+	for _, child := range state.PendingChildExecutions {
+		node := queryNodeState{State: nodeStateScheduled}
+		if child.StartedEventID != 0 {
+			node.State = nodeStateRunning
+		}
+		nodes[child.NodeID] = node
+	}
+	return nodes
+}
+
+// queryOutputs returns the outputs of the nodes that completed so far, by
+// node ID. Outputs that are not JSON are returned as strings.
+func queryOutputs(state *engine.MutableState) map[string]any {
+	outputs := make(map[string]any, len(state.CompletedNodes))
+	for nodeID, result := range state.CompletedNodes {
+		if result.FailureReason != "" || result.Output == nil {
+			continue
+		}
+		if json.Valid(result.Output) {
+			outputs[nodeID] = json.RawMessage(result.Output)
+		} else {
+			outputs[nodeID] = string(result.Output)
+		}
+	}
+	return outputs
+}
+
+// queryPendingTimers returns the decider's pending timers in the order they
+// fire. The history service's own timers are left out.
+func queryPendingTimers(state *engine.MutableState) []queryTimer {
+	timers := make([]queryTimer, 0, len(state.PendingTimers))
+	for id, timer := range state.PendingTimers {
+		if isReservedTimerID(id) {
+			continue
+		}
+		timers = append(timers, queryTimer{TimerID: id, FireTime: timer.FireTime})
+	}
+	slices.SortFunc(timers, func(a, b queryTimer) int {
+		if c := a.FireTime.Compare(b.FireTime); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.TimerID, b.TimerID)
+	})
+	return timers
+}
+
+// querySignals returns the signals the run received, oldest first. The
+// mutable state only counts signals, so they are read from history.
+func (s *Service) querySignals(ctx context.Context, key types.ExecutionKey, state *engine.MutableState) ([]querySignal, error) {
+	signals := make([]querySignal, 0, state.SignalCount)
+	if state.SignalCount == 0 {
+		return signals, nil
+	}
+	events, err := s.eventStore.GetEvents(ctx, key, 1, state.NextEventID-1)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		attrs, ok := event.Attributes.(*types.SignalReceivedAttributes)
+		if !ok {
+			continue
+		}
+		signal := querySignal{Name: attrs.SignalName, ReceivedAt: event.Timestamp}
+		if json.Valid(attrs.Input) {
+			signal.Input = attrs.Input
+		} else if len(attrs.Input) > 0 {
+			signal.Input, _ = json.Marshal(string(attrs.Input))
+		}
+		signals = append(signals, signal)
+	}
+	return signals, nil
+}
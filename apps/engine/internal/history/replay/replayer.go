@@ -241,7 +241,9 @@ func (r *Replayer) ValidateHistoryIntegrity(ctx context.Context, key types.Execu
 		switch lastEvent.EventType {
 		case types.EventTypeExecutionCompleted,
 			types.EventTypeExecutionFailed,
-			types.EventTypeExecutionTerminated:
+			types.EventTypeExecutionTerminated,
+			types.EventTypeExecutionCanceled,
+			types.EventTypeExecutionTimedOut:
 			// Valid terminal state
 		default:
 			// Execution still in progress - validate no terminal state in middle
@@ -249,7 +251,9 @@ func (r *Replayer) ValidateHistoryIntegrity(ctx context.Context, key types.Execu
 				switch events[i].EventType {
 				case types.EventTypeExecutionCompleted,
 					types.EventTypeExecutionFailed,
-					types.EventTypeExecutionTerminated:
+					types.EventTypeExecutionTerminated,
+					types.EventTypeExecutionCanceled,
+					types.EventTypeExecutionTimedOut:
 					return fmt.Errorf("terminal event found at position %d, not at end", i)
 				}
 			}
@@ -1,9 +1,14 @@
 package history
 
 import (
+	"cmp"
 	"context"
+	"crypto/rand"
 	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
@@ -11,17 +16,25 @@ import (
 	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
 	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
 	matchingv1 "github.com/linkflow/engine/api/gen/linkflow/matching/v1"
+	"github.com/linkflow/engine/internal/controlplane"
+	"github.com/linkflow/engine/internal/history/cache"
 	"github.com/linkflow/engine/internal/history/engine"
 	"github.com/linkflow/engine/internal/history/shard"
+	"github.com/linkflow/engine/internal/history/transfer"
 	"github.com/linkflow/engine/internal/history/types"
 	"github.com/linkflow/engine/internal/history/visibility"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var (
-	ErrServiceNotRunning     = errors.New("history service is not running")
-	ErrServiceAlreadyRunning = errors.New("history service is already running")
-	ErrEventNotFound         = errors.New("event not found")
+	ErrServiceNotRunning      = errors.New("history service is not running")
+	ErrServiceAlreadyRunning  = errors.New("history service is already running")
+	ErrEventNotFound          = errors.New("event not found")
+	ErrInvalidResetEventID    = errors.New("invalid reset event id")
+	ErrReservedTimerID        = errors.New("timer id is reserved")
+	ErrWorkflowAlreadyStarted = errors.New("workflow execution already started")
+	ErrUnknownQueryType       = errors.New("unknown query type")
 )
 
 // EventStore defines the interface for storing and retrieving history events.
@@ -31,9 +44,20 @@ type EventStore interface {
 }
 
 // MutableStateStore defines the interface for storing workflow mutable state.
+// Writing the first state of a run makes it the current run of its workflow
+// ID.
 type MutableStateStore interface {
 	GetMutableState(ctx context.Context, key types.ExecutionKey) (*engine.MutableState, error)
 	UpdateMutableState(ctx context.Context, key types.ExecutionKey, state *engine.MutableState, expectedVersion int64) error
+	GetCurrentRunID(ctx context.Context, namespaceID, workflowID string) (string, error)
+}
+
+// ExecutionStore commits new events together with the updated mutable state
+// and the tasks it carries in a single atomic write. A run that continues as
+// new is closed in the same write that creates its new run.
+type ExecutionStore interface {
+	UpdateWorkflowExecution(ctx context.Context, key types.ExecutionKey, newEvents []*types.HistoryEvent, state *engine.MutableState, expectedVersion int64) error
+	UpdateWorkflowExecutionWithNewRun(ctx context.Context, key types.ExecutionKey, newEvents []*types.HistoryEvent, state *engine.MutableState, expectedVersion int64, newRunKey types.ExecutionKey, newRunEvents []*types.HistoryEvent, newRunState *engine.MutableState) error
 }
 
 // ShardController manages shard ownership and distribution.
@@ -41,9 +65,16 @@ type ShardController interface {
 	Start() error
 	GetShardForExecution(key types.ExecutionKey) (shard.Shard, error)
 	GetShardIDForExecution(key types.ExecutionKey) int32
+	AddListener(l shard.Listener)
 	Stop()
 }
 
+// NamespaceRegistry provides the configuration of namespaces, which supplies
+// defaults for the executions started in them.
+type NamespaceRegistry interface {
+	GetNamespace(ctx context.Context, name string) (*controlplane.NamespaceConfig, error)
+}
+
 // Metrics provides hooks for observability.
 type Metrics interface {
 	RecordEventRecorded(eventType types.EventType)
@@ -63,12 +94,20 @@ type Service struct {
 	shardController ShardController
 	eventStore      EventStore
 	stateStore      MutableStateStore
+	executionStore  ExecutionStore
 	visibilityStore visibility.Store // Added visibility store
 	matchingClient  matchingv1.MatchingServiceClient
+	namespaces      NamespaceRegistry
+	transferQueue   *transfer.Processor
+	stateCache      *cache.Cache
 	historyEngine   *engine.Engine
 	metrics         Metrics
 	logger          *slog.Logger
 
+	// historyLimitDefaults are the history limits of namespaces that set
+	// none.
+	historyLimitDefaults HistoryLimits
+
 	running bool
 	mu      sync.RWMutex
 }
@@ -82,6 +121,25 @@ type Config struct {
 	MatchingClient  matchingv1.MatchingServiceClient
 	Logger          *slog.Logger
 	Metrics         Metrics
+
+	// ExecutionStore, when set, writes events and mutable state atomically.
+	// Otherwise they are written separately through EventStore and StateStore.
+	ExecutionStore ExecutionStore
+
+	// TransferTaskStore is the outbox that StateStore writes transfer tasks
+	// into. Together with MatchingClient it enables the transfer queue.
+	TransferTaskStore transfer.Store
+
+	// StateCacheSize is the number of mutable states kept in memory.
+	StateCacheSize int
+
+	// Namespaces, when set, supplies the execution timeout of executions
+	// started without one and overrides HistoryLimits per namespace.
+	Namespaces NamespaceRegistry
+
+	// HistoryLimits are the history limits of namespaces that set none.
+	// Limits left zero are taken from DefaultHistoryLimits.
+	HistoryLimits HistoryLimits
 }
 
 // NewService creates a new history service with default config.
@@ -93,14 +151,23 @@ func NewService(
 	matchingClient matchingv1.MatchingServiceClient,
 	logger *slog.Logger,
 ) *Service {
-	return NewServiceWithConfig(Config{
+	cfg := Config{
 		ShardController: shardController,
 		EventStore:      eventStore,
 		StateStore:      stateStore,
 		VisibilityStore: visibilityStore,
 		MatchingClient:  matchingClient,
 		Logger:          logger,
-	})
+	}
+	// State stores that can write atomically or persist transfer tasks are
+	// used for that as well.
+	if executionStore, ok := stateStore.(ExecutionStore); ok {
+		cfg.ExecutionStore = executionStore
+	}
+	if transferStore, ok := stateStore.(transfer.Store); ok {
+		cfg.TransferTaskStore = transferStore
+	}
+	return NewServiceWithConfig(cfg)
 }
 
 // NewServiceWithConfig creates a new history service with full configuration.
@@ -112,18 +179,69 @@ func NewServiceWithConfig(cfg Config) *Service {
 	if metrics == nil {
 		metrics = noopMetrics1{}
 	}
-	return &Service{
+	historyLimits := cfg.HistoryLimits
+	if historyLimits.SizeWarn <= 0 {
+		historyLimits.SizeWarn = DefaultHistoryLimits.SizeWarn
+	}
+	if historyLimits.SizeLimit <= 0 {
+		historyLimits.SizeLimit = DefaultHistoryLimits.SizeLimit
+	}
+	if historyLimits.CountWarn <= 0 {
+		historyLimits.CountWarn = DefaultHistoryLimits.CountWarn
+	}
+	if historyLimits.CountLimit <= 0 {
+		historyLimits.CountLimit = DefaultHistoryLimits.CountLimit
+	}
+	s := &Service{
 		shardController: cfg.ShardController,
 		eventStore:      cfg.EventStore,
 		stateStore:      cfg.StateStore,
+		executionStore:  cfg.ExecutionStore,
 		visibilityStore: cfg.VisibilityStore,
+		matchingClient:  cfg.MatchingClient,
+		namespaces:      cfg.Namespaces,
+		stateCache:      cache.New(cfg.StateCacheSize),
 		historyEngine:   engine.NewEngine(cfg.Logger),
 		metrics:         metrics,
 		logger:          cfg.Logger,
 		running:         false,
+
+		historyLimitDefaults: historyLimits,
+	}
+	if cfg.MatchingClient != nil && cfg.TransferTaskStore != nil {
+		s.transferQueue = transfer.NewProcessor(transfer.Config{
+			Store:          cfg.TransferTaskStore,
+			MatchingClient: cfg.MatchingClient,
+			Executor:       s,
+			Logger:         cfg.Logger,
+		})
+	}
+	if cfg.ShardController != nil {
+		cfg.ShardController.AddListener(shardListener{s})
+	}
+	return s
+}
+
+// shardListener starts and stops per-shard processing as the shard controller
+// acquires and loses shards.
+type shardListener struct {
+	s *Service
+}
+
+func (l shardListener) ShardAcquired(shardID int32) {
+	if l.s.transferQueue != nil {
+		l.s.transferQueue.AddShard(shardID)
 	}
 }
 
+func (l shardListener) ShardLost(shardID int32) {
+	if l.s.transferQueue != nil {
+		l.s.transferQueue.RemoveShard(shardID)
+	}
+	// Another host may update the shard's executions from now on.
+	l.s.stateCache.InvalidateShard(shardID)
+}
+
 func (s *Service) Start(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -134,8 +252,17 @@ func (s *Service) Start(ctx context.Context) error {
 
 	s.logger.Info("starting history service")
 
+	// The transfer queue starts first so it picks up the shards the
+	// controller acquires.
+	if s.transferQueue != nil {
+		s.transferQueue.Start()
+	}
+
 	if s.shardController != nil {
 		if err := s.shardController.Start(); err != nil {
+			if s.transferQueue != nil {
+				s.transferQueue.Stop()
+			}
 			return err
 		}
 	}
@@ -154,6 +281,10 @@ func (s *Service) Stop(ctx context.Context) error {
 
 	s.logger.Info("stopping history service")
 
+	if s.transferQueue != nil {
+		s.transferQueue.Stop()
+	}
+
 	if s.shardController != nil {
 		s.shardController.Stop()
 	}
@@ -170,12 +301,41 @@ func (s *Service) IsRunning() bool {
 
 // RecordEvent is legacy/direct event recording. Kept for backward compatibility or direct calls.
 func (s *Service) RecordEvent(ctx context.Context, key types.ExecutionKey, event *types.HistoryEvent) error {
+	if attrs, ok := event.Attributes.(*types.ExecutionStartedAttributes); ok {
+		s.applyNamespaceDefaults(ctx, key.NamespaceID, attrs)
+	}
 	// Re-route to standard event processing which includes task dispatching
 	return s.processEvents(ctx, key, []*types.HistoryEvent{event})
 }
 
 // processEvents is the core event processing loop that persists events and dispatches tasks
 func (s *Service) processEvents(ctx context.Context, key types.ExecutionKey, events []*types.HistoryEvent) error {
+	return s.updateWorkflow(ctx, key, func(*engine.MutableState) ([]*types.HistoryEvent, error) {
+		return events, nil
+	})
+}
+
+// updateWorkflow records the events build returns for the execution's current
+// mutable state. build runs with the execution locked, so the events it
+// derives from the state cannot be invalidated by a concurrent update. When
+// it returns no events nothing is written.
+func (s *Service) updateWorkflow(ctx context.Context, key types.ExecutionKey, build func(state *engine.MutableState) ([]*types.HistoryEvent, error)) error {
+	return s.updateWorkflowWithNewRun(ctx, key, nil, build)
+}
+
+// updateWorkflowWithNewRun is updateWorkflow for an update that also creates
+// newRun. Both runs are written in the same transaction, even when build
+// returns no events.
+func (s *Service) updateWorkflowWithNewRun(ctx context.Context, key types.ExecutionKey, newRun *continuedRun, build func(state *engine.MutableState) ([]*types.HistoryEvent, error)) error {
+	// The namespace's history limits may have to be read from the control
+	// plane, so they are resolved before the execution is locked.
+	return s.updateWorkflowWithLimits(ctx, key, s.historyLimits(ctx, key.NamespaceID), newRun, build)
+}
+
+// updateWorkflowWithLimits is updateWorkflowWithNewRun with the history
+// limits of the execution's namespace already resolved, for a caller that
+// holds a lock of its own while it updates.
+func (s *Service) updateWorkflowWithLimits(ctx context.Context, key types.ExecutionKey, limits HistoryLimits, newRun *continuedRun, build func(state *engine.MutableState) ([]*types.HistoryEvent, error)) error {
 	start := time.Now()
 	defer func() {
 		s.metrics.RecordServiceLatency("ProcessEvents", time.Since(start))
@@ -189,49 +349,137 @@ func (s *Service) processEvents(ctx context.Context, key types.ExecutionKey, eve
 		return ErrServiceNotRunning
 	}
 
-	_, err := s.shardController.GetShardForExecution(key)
+	executionShard, err := s.shardController.GetShardForExecution(key)
+	if err != nil {
+		return err
+	}
+	shardID := executionShard.GetID()
+
+	// Updates to one execution are serialized in-process, so concurrent
+	// callers queue up here instead of failing on the optimistic lock.
+	execution, err := s.stateCache.Acquire(ctx, shardID, key)
 	if err != nil {
 		return err
 	}
+	err = s.updateExecution(ctx, key, shardID, execution, limits, newRun, build)
+	execution.Release(err)
+	return err
+}
+
+// updateCachedState runs update on the execution's mutable state with the
+// execution locked, like updateWorkflow, but nothing is written: the change
+// stays in the cached state until the execution's next update persists it.
+// It is for bookkeeping that is too frequent to write each time and that is
+// safe to lose with the cache entry.
+func (s *Service) updateCachedState(ctx context.Context, key types.ExecutionKey, update func(state *engine.MutableState) error) error {
+	s.mu.RLock()
+	running := s.running
+	s.mu.RUnlock()
+
+	if !running {
+		return ErrServiceNotRunning
+	}
 
-	state, err := s.stateStore.GetMutableState(ctx, key)
+	executionShard, err := s.shardController.GetShardForExecution(key)
+	if err != nil {
+		return err
+	}
+	execution, err := s.stateCache.Acquire(ctx, executionShard.GetID(), key)
 	if err != nil {
-		if errors.Is(err, types.ErrExecutionNotFound) {
-			// Create new mutable state if it doesn't exist
-			state = engine.NewMutableState(&types.ExecutionInfo{
-				NamespaceID: key.NamespaceID,
-				WorkflowID:  key.WorkflowID,
-				RunID:       key.RunID,
-			})
-		} else {
+		return err
+	}
+	// The cached state is left as it is whatever update returns, so a
+	// rejected call does not drop changes of earlier ones.
+	defer execution.Release(nil)
+
+	state := execution.State()
+	if state == nil {
+		if state, err = s.stateStore.GetMutableState(ctx, key); err != nil {
 			return err
 		}
+		execution.SetState(state)
+	}
+	return update(state)
+}
+
+// updateExecution applies the built events to the execution's mutable state
+// and persists both, together with newRun if it is set. It runs with the
+// execution locked.
+func (s *Service) updateExecution(ctx context.Context, key types.ExecutionKey, shardID int32, execution *cache.Execution, limits HistoryLimits, newRun *continuedRun, build func(state *engine.MutableState) ([]*types.HistoryEvent, error)) error {
+	state := execution.State()
+	if state == nil {
+		var err error
+		state, err = s.stateStore.GetMutableState(ctx, key)
+		if err != nil {
+			if errors.Is(err, types.ErrExecutionNotFound) {
+				// Create new mutable state if it doesn't exist
+				state = engine.NewMutableState(&types.ExecutionInfo{
+					NamespaceID: key.NamespaceID,
+					WorkflowID:  key.WorkflowID,
+					RunID:       key.RunID,
+				})
+			} else {
+				return err
+			}
+		}
+	}
+	state.ClearTasks()
+
+	events, err := build(state)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 && len(state.TransferTasks) == 0 && len(state.TimerTasks) == 0 && !state.Modified && newRun == nil {
+		return nil
 	}
 
 	expectedVersion := state.DBVersion
 
-	// Apply all events to state and assign IDs
 	for _, event := range events {
-		if event.EventID == 0 {
-			event.EventID = state.NextEventID
+		if err := s.applyEvent(key, shardID, state, event); err != nil {
+			return err
+		}
+	}
+
+	// The history limits are checked once the update's own events are in.
+	// Reaching a hard limit closes the run before it schedules more work.
+	if len(events) > 0 {
+		for _, event := range s.historyLimitEvents(key, state, limits) {
+			if err := s.applyEvent(key, shardID, state, event); err != nil {
+				return err
+			}
+			events = append(events, event)
 		}
-		if err := s.historyEngine.ProcessEvent(state, event); err != nil {
+	}
+
+	// Hand whatever the decider has not seen yet to a new workflow task,
+	// unless one is already pending and will pick it up.
+	if scheduled := workflowTaskScheduledEvent(state); scheduled != nil {
+		if err := s.applyEvent(key, shardID, state, scheduled); err != nil {
 			return err
 		}
+		events = append(events, scheduled)
 	}
 
-	// Persist events
-	if err := s.eventStore.AppendEvents(ctx, key, events, expectedVersion); err != nil {
-		return err
+	// A run that continued as new is replaced by its new run in the same
+	// write, so the workflow is never left without a running run.
+	continuedAsNew := false
+	for _, event := range events {
+		if event.EventType == types.EventTypeExecutionContinuedAsNew {
+			continuedAsNew = true
+			if newRun, err = s.newContinuedRun(key, shardID, state, event); err != nil {
+				return err
+			}
+		}
 	}
 
 	state.DBVersion++
 
-	// Update mutable state
-	if err := s.stateStore.UpdateMutableState(ctx, key, state, expectedVersion); err != nil {
+	if err := s.persistExecution(ctx, key, events, state, expectedVersion, newRun); err != nil {
 		s.logger.Warn("failed to update mutable state", "error", err, "workflow_id", key.WorkflowID)
 		return err
 	}
+	execution.SetState(state)
 
 	// Metrics
 	for _, event := range events {
@@ -245,31 +493,193 @@ func (s *Service) processEvents(ctx context.Context, key types.ExecutionKey, eve
 		}
 	}
 
-	// Dispatch tasks to Matching Service based on new state/events
-	if s.matchingClient != nil {
-		// We dispatch tasks for the LAST event usually, or iterate all
-		for _, event := range events {
-			if err := s.dispatchTasks(ctx, key, event, state); err != nil {
-				s.logger.Error("failed to dispatch tasks to matching", "error", err)
+	hasTransferTasks := len(state.TransferTasks) > 0
+	if newRun != nil {
+		for _, event := range newRun.events {
+			s.metrics.RecordEventRecorded(event.EventType)
+			if s.visibilityStore != nil {
+				s.recordVisibility(ctx, newRun.key, event, newRun.state)
 			}
 		}
+		hasTransferTasks = hasTransferTasks || len(newRun.state.TransferTasks) > 0
+	}
+	if continuedAsNew {
+		s.logger.Info("execution continued as new",
+			"workflow_id", key.WorkflowID,
+			"run_id", key.RunID,
+			"new_run_id", newRun.key.RunID,
+		)
+	}
+
+	// The tasks are durable now; wake up the transfer queue to deliver them.
+	if s.transferQueue != nil && hasTransferTasks {
+		s.transferQueue.Notify(shardID)
 	}
 
 	return nil
 }
 
+// applyEvent assigns the event its ID, applies it to the state and generates
+// the tasks that are committed together with it.
+func (s *Service) applyEvent(key types.ExecutionKey, shardID int32, state *engine.MutableState, event *types.HistoryEvent) error {
+	if event.EventID == 0 {
+		event.EventID = state.NextEventID
+	}
+	if err := s.historyEngine.ProcessEvent(state, event); err != nil {
+		return err
+	}
+	addHistorySize(state, event)
+	s.generateTransferTasks(key, shardID, event, state)
+	s.generateTimerTasks(key, shardID, event, state)
+	return nil
+}
+
+// continuedRun is the run a continue-as-new starts. It is written in the same
+// transaction that closes the previous run.
+type continuedRun struct {
+	key    types.ExecutionKey
+	events []*types.HistoryEvent
+	state  *engine.MutableState
+}
+
+// newContinuedRun builds the run that the run of state continues as new to:
+// its started event, which carries the input over and links the runs, and
+// its first workflow task. Both runs share the workflow ID and so the shard.
+func (s *Service) newContinuedRun(key types.ExecutionKey, shardID int32, state *engine.MutableState, event *types.HistoryEvent) (*continuedRun, error) {
+	attrs, ok := event.Attributes.(*types.ExecutionContinuedAsNewAttributes)
+	if !ok || attrs.NewRunID == "" {
+		return nil, fmt.Errorf("%w: continue-as-new without a new run id", engine.ErrInvalidEvent)
+	}
+	firstRunID := state.ExecutionInfo.FirstRunID
+	if firstRunID == "" {
+		firstRunID = key.RunID
+	}
+
+	run := &continuedRun{
+		key: types.ExecutionKey{
+			NamespaceID: key.NamespaceID,
+			WorkflowID:  key.WorkflowID,
+			RunID:       attrs.NewRunID,
+		},
+	}
+	run.state = engine.NewMutableState(&types.ExecutionInfo{
+		NamespaceID: run.key.NamespaceID,
+		WorkflowID:  run.key.WorkflowID,
+		RunID:       run.key.RunID,
+	})
+	started := &types.HistoryEvent{
+		EventType: types.EventTypeExecutionStarted,
+		Timestamp: event.Timestamp,
+		Attributes: &types.ExecutionStartedAttributes{
+			WorkflowType:       attrs.WorkflowType,
+			TaskQueue:          attrs.TaskQueue,
+			Input:              attrs.Input,
+			ExecutionTimeout:   state.ExecutionInfo.ExecutionTimeout,
+			RunTimeout:         attrs.RunTimeout,
+			TaskTimeout:        attrs.TaskTimeout,
+			Initiator:          types.InitiatorContinueAsNew,
+			ContinuedFromRunID: key.RunID,
+			FirstRunID:         firstRunID,
+
+			ParentExecution:        state.ExecutionInfo.ParentExecution,
+			ParentInitiatedEventID: state.ExecutionInfo.ParentInitiatedEventID,
+			ExpirationTime:         state.ExecutionInfo.ExecutionExpirationTime,
+		},
+	}
+	if err := s.applyEvent(run.key, shardID, run.state, started); err != nil {
+		return nil, err
+	}
+	run.events = append(run.events, started)
+	if scheduled := workflowTaskScheduledEvent(run.state); scheduled != nil {
+		if err := s.applyEvent(run.key, shardID, run.state, scheduled); err != nil {
+			return nil, err
+		}
+		run.events = append(run.events, scheduled)
+	}
+	run.state.DBVersion++
+	return run, nil
+}
+
+// fillContinueAsNewAttributes fills the fields a continue-as-new command left
+// unset from the closing run.
+func fillContinueAsNewAttributes(attrs *types.ExecutionContinuedAsNewAttributes, info *types.ExecutionInfo) {
+	if attrs.WorkflowType == "" {
+		attrs.WorkflowType = info.WorkflowTypeName
+	}
+	if attrs.TaskQueue == "" {
+		attrs.TaskQueue = info.TaskQueue
+	}
+	if attrs.Input == nil {
+		attrs.Input = info.Input
+	}
+	if attrs.RunTimeout == 0 {
+		attrs.RunTimeout = info.RunTimeout
+	}
+	if attrs.TaskTimeout == 0 {
+		attrs.TaskTimeout = info.TaskTimeout
+	}
+}
+
+// workflowTaskScheduledEvent returns the event scheduling a workflow task if
+// the decider has to run and no workflow task is pending, and nil otherwise.
+func workflowTaskScheduledEvent(state *engine.MutableState) *types.HistoryEvent {
+	if !state.IsWorkflowExecutionRunning() || state.WorkflowTask != nil || !state.NeedsWorkflowTask {
+		return nil
+	}
+	return &types.HistoryEvent{
+		EventType: types.EventTypeWorkflowTaskScheduled,
+		Timestamp: time.Now(),
+		Attributes: &types.WorkflowTaskScheduledAttributes{
+			TaskQueue:    state.ExecutionInfo.TaskQueue,
+			StartToClose: workflowTaskStartToClose(state.ExecutionInfo),
+			Attempt:      state.WorkflowTaskFailures + 1,
+		},
+	}
+}
+
+// persistExecution writes new events and the mutable state they produced,
+// and creates newRun if it is set. With an ExecutionStore all of it is
+// committed in one transaction; otherwise a failure between the writes leaves
+// history ahead of the mutable state, or a run closed without its new run.
+func (s *Service) persistExecution(ctx context.Context, key types.ExecutionKey, events []*types.HistoryEvent, state *engine.MutableState, expectedVersion int64, newRun *continuedRun) error {
+	if s.executionStore != nil {
+		if newRun != nil {
+			return s.executionStore.UpdateWorkflowExecutionWithNewRun(ctx, key, events, state, expectedVersion, newRun.key, newRun.events, newRun.state)
+		}
+		return s.executionStore.UpdateWorkflowExecution(ctx, key, events, state, expectedVersion)
+	}
+
+	if err := s.eventStore.AppendEvents(ctx, key, events, expectedVersion); err != nil {
+		return err
+	}
+	if err := s.stateStore.UpdateMutableState(ctx, key, state, expectedVersion); err != nil {
+		return err
+	}
+	if newRun == nil {
+		return nil
+	}
+	if err := s.eventStore.AppendEvents(ctx, newRun.key, newRun.events, 0); err != nil {
+		return err
+	}
+	return s.stateStore.UpdateMutableState(ctx, newRun.key, newRun.state, 0)
+}
+
 func (s *Service) recordVisibility(ctx context.Context, key types.ExecutionKey, event *types.HistoryEvent, state *engine.MutableState) {
 	switch event.EventType {
 	case types.EventTypeExecutionStarted:
-		attr := event.Attributes.(*historyv1.HistoryEvent_ExecutionStartedAttributes)
-		s.visibilityStore.RecordWorkflowExecutionStarted(ctx, &visibility.RecordWorkflowExecutionStartedRequest{
+		req := &visibility.RecordWorkflowExecutionStartedRequest{
 			NamespaceID:  key.NamespaceID,
 			Execution:    &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID},
 			WorkflowType: &apiv1.WorkflowType{Name: state.ExecutionInfo.WorkflowTypeName}, // Simplified
 			StartTime:    event.Timestamp,
 			Status:       commonv1.ExecutionStatus_EXECUTION_STATUS_RUNNING,
-			Memo:         attr.ExecutionStartedAttributes.Memo,
-		})
+
+			ContinuedFromRunID: state.ExecutionInfo.ContinuedFromRunID,
+		}
+		if attr, ok := event.Attributes.(*historyv1.HistoryEvent_ExecutionStartedAttributes); ok {
+			req.Memo = attr.ExecutionStartedAttributes.Memo
+		}
+		s.visibilityStore.RecordWorkflowExecutionStarted(ctx, req)
 
 	case types.EventTypeExecutionCompleted:
 		s.visibilityStore.RecordWorkflowExecutionClosed(ctx, &visibility.RecordWorkflowExecutionClosedRequest{
@@ -288,7 +698,88 @@ func (s *Service) recordVisibility(ctx context.Context, key types.ExecutionKey,
 			CloseTime:    event.Timestamp,
 			Status:       commonv1.ExecutionStatus_EXECUTION_STATUS_FAILED,
 		})
+
+	case types.EventTypeExecutionTerminated:
+		s.visibilityStore.RecordWorkflowExecutionClosed(ctx, &visibility.RecordWorkflowExecutionClosedRequest{
+			NamespaceID:  key.NamespaceID,
+			Execution:    &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID},
+			WorkflowType: &apiv1.WorkflowType{Name: state.ExecutionInfo.WorkflowTypeName},
+			CloseTime:    event.Timestamp,
+			Status:       commonv1.ExecutionStatus_EXECUTION_STATUS_TERMINATED,
+		})
+
+	case types.EventTypeExecutionCanceled:
+		s.visibilityStore.RecordWorkflowExecutionClosed(ctx, &visibility.RecordWorkflowExecutionClosedRequest{
+			NamespaceID:  key.NamespaceID,
+			Execution:    &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID},
+			WorkflowType: &apiv1.WorkflowType{Name: state.ExecutionInfo.WorkflowTypeName},
+			CloseTime:    event.Timestamp,
+			Status:       commonv1.ExecutionStatus_EXECUTION_STATUS_CANCELLED,
+		})
+
+	case types.EventTypeExecutionTimedOut:
+		s.visibilityStore.RecordWorkflowExecutionClosed(ctx, &visibility.RecordWorkflowExecutionClosedRequest{
+			NamespaceID:  key.NamespaceID,
+			Execution:    &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID},
+			WorkflowType: &apiv1.WorkflowType{Name: state.ExecutionInfo.WorkflowTypeName},
+			CloseTime:    event.Timestamp,
+			Status:       commonv1.ExecutionStatus_EXECUTION_STATUS_TIMED_OUT,
+		})
+
+	case types.EventTypeExecutionContinuedAsNew:
+		s.visibilityStore.RecordWorkflowExecutionClosed(ctx, &visibility.RecordWorkflowExecutionClosedRequest{
+			NamespaceID:  key.NamespaceID,
+			Execution:    &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID},
+			WorkflowType: &apiv1.WorkflowType{Name: state.ExecutionInfo.WorkflowTypeName},
+			CloseTime:    event.Timestamp,
+			Status:       commonv1.ExecutionStatus_EXECUTION_STATUS_CONTINUED_AS_NEW,
+			NewRunID:     state.ExecutionInfo.NewRunID,
+		})
+	}
+}
+
+// RecordWorkflowTaskStarted marks the pending workflow task as picked up by a
+// worker. Only one worker gets to start a task; others get
+// ErrStaleWorkflowTask. A retry with the request ID of the recorded start
+// gets the same answer again.
+func (s *Service) RecordWorkflowTaskStarted(ctx context.Context, req *historyv1.RecordWorkflowTaskStartedRequest) (*historyv1.RecordWorkflowTaskStartedResponse, error) {
+	key := types.ExecutionKey{
+		NamespaceID: req.GetNamespace(),
+		WorkflowID:  req.GetWorkflowExecution().GetWorkflowId(),
+		RunID:       req.GetWorkflowExecution().GetRunId(),
+	}
+
+	resp := &historyv1.RecordWorkflowTaskStartedResponse{}
+	err := s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+		task := state.WorkflowTask
+		if task == nil || task.ScheduledEventID != req.GetScheduledEventId() {
+			return nil, engine.ErrStaleWorkflowTask
+		}
+		resp.Attempt = task.Attempt
+		if task.StartedEventID != 0 {
+			if req.GetRequestId() == "" || task.RequestID != req.GetRequestId() {
+				return nil, engine.ErrStaleWorkflowTask
+			}
+			resp.StartedEventId = task.StartedEventID
+			return nil, nil
+		}
+
+		resp.StartedEventId = state.NextEventID
+		return []*types.HistoryEvent{{
+			EventID:   state.NextEventID,
+			EventType: types.EventTypeWorkflowTaskStarted,
+			Timestamp: time.Now(),
+			Attributes: &types.WorkflowTaskStartedAttributes{
+				ScheduledEventID: task.ScheduledEventID,
+				Identity:         req.GetIdentity(),
+				RequestID:        req.GetRequestId(),
+			},
+		}}, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return resp, nil
 }
 
 // RespondWorkflowTaskCompleted processes decisions from the workflow worker
@@ -299,15 +790,15 @@ func (s *Service) RespondWorkflowTaskCompleted(ctx context.Context, req *history
 		RunID:       req.WorkflowExecution.RunId,
 	}
 
-	// 1. Validate WorkflowTaskCompleted
-	// In a real system, we'd check if the task_token (scheduledEventID) matches the current pending workflow task.
-	// For now, we assume it's valid.
-
+	// The engine rejects the completion with ErrStaleWorkflowTask unless the
+	// task token names the started workflow task, so the commands of a
+	// decider that lost a race are dropped as a whole.
 	newEvents := []*types.HistoryEvent{}
 
 	// Event: WorkflowTaskCompleted
 	completedEvent := &types.HistoryEvent{
 		EventType: types.EventTypeWorkflowTaskCompleted,
+		Timestamp: time.Now(),
 		Attributes: &types.WorkflowTaskCompletedAttributes{
 			ScheduledEventID: req.TaskToken,
 			Identity:         req.Identity,
@@ -321,29 +812,61 @@ func (s *Service) RespondWorkflowTaskCompleted(ctx context.Context, req *history
 		switch cmd.CommandType {
 		case historyv1.CommandType_COMMAND_TYPE_SCHEDULE_ACTIVITY_TASK:
 			attr := cmd.GetScheduleActivityTaskAttributes()
+			startToClose := attr.GetStartToCloseTimeout().AsDuration()
+			if startToClose <= 0 {
+				startToClose = defaultActivityStartToClose
+			}
 
 			scheduledEvent := &types.HistoryEvent{
-				EventType: types.EventType(commonv1.EventType_EVENT_TYPE_NODE_SCHEDULED),
-				Attributes: &historyv1.HistoryEvent_NodeScheduledAttributes{
-					NodeScheduledAttributes: &historyv1.NodeScheduledEventAttributes{
-						NodeId:    attr.NodeId,
-						NodeType:  attr.NodeType,
-						Name:      attr.Name,
-						TaskQueue: &apiv1.TaskQueue{Name: attr.TaskQueue, Kind: commonv1.TaskQueueKind_TASK_QUEUE_KIND_NORMAL},
-						Input:     attr.Input,
-					},
+				EventType: types.EventTypeNodeScheduled,
+				Timestamp: time.Now(),
+				Attributes: &types.NodeScheduledAttributes{
+					NodeID:           attr.NodeId,
+					NodeType:         attr.NodeType,
+					Input:            firstPayload(attr.Input),
+					TaskQueue:        attr.TaskQueue,
+					ScheduleToStart:  attr.GetScheduleToStartTimeout().AsDuration(),
+					StartToClose:     startToClose,
+					HeartbeatTimeout: attr.GetHeartbeatTimeout().AsDuration(),
+					RetryPolicy:      retryPolicyFromProto(attr.GetRetryPolicy()),
 				},
 			}
 			newEvents = append(newEvents, scheduledEvent)
 
+		case historyv1.CommandType_COMMAND_TYPE_START_TIMER:
+			attr := cmd.GetStartTimerAttributes()
+			if isReservedTimerID(attr.GetTimerId()) {
+				return nil, fmt.Errorf("%w: %s", ErrReservedTimerID, attr.GetTimerId())
+			}
+			timerEvent := &types.HistoryEvent{
+				EventType: types.EventTypeTimerStarted,
+				Timestamp: time.Now(),
+				Attributes: &types.TimerStartedAttributes{
+					TimerID:     attr.GetTimerId(),
+					StartToFire: attr.GetStartToFireTimeout().AsDuration(),
+				},
+			}
+			newEvents = append(newEvents, timerEvent)
+
+		case historyv1.CommandType_COMMAND_TYPE_CANCEL_TIMER:
+			attr := cmd.GetCancelTimerAttributes()
+			cancelEvent := &types.HistoryEvent{
+				EventType: types.EventTypeTimerCanceled,
+				Timestamp: time.Now(),
+				Attributes: &types.TimerCanceledAttributes{
+					TimerID:  attr.GetTimerId(),
+					Identity: req.Identity,
+				},
+			}
+			newEvents = append(newEvents, cancelEvent)
+
 		case historyv1.CommandType_COMMAND_TYPE_COMPLETE_WORKFLOW_EXECUTION:
 			attr := cmd.GetCompleteWorkflowExecutionAttributes()
 			completeEvent := &types.HistoryEvent{
-				EventType: types.EventType(commonv1.EventType_EVENT_TYPE_EXECUTION_COMPLETED),
-				Attributes: &historyv1.HistoryEvent_ExecutionCompletedAttributes{
-					ExecutionCompletedAttributes: &historyv1.ExecutionCompletedEventAttributes{
-						Result: attr.Result,
-					},
+				EventType: types.EventTypeExecutionCompleted,
+				Timestamp: time.Now(),
+				Attributes: &types.ExecutionCompletedAttributes{
+					Result: firstPayload(attr.Result),
 				},
 			}
 			newEvents = append(newEvents, completeEvent)
@@ -351,18 +874,76 @@ func (s *Service) RespondWorkflowTaskCompleted(ctx context.Context, req *history
 		case historyv1.CommandType_COMMAND_TYPE_FAIL_WORKFLOW_EXECUTION:
 			attr := cmd.GetFailWorkflowExecutionAttributes()
 			failEvent := &types.HistoryEvent{
-				EventType: types.EventType(commonv1.EventType_EVENT_TYPE_EXECUTION_FAILED),
-				Attributes: &historyv1.HistoryEvent_ExecutionFailedAttributes{
-					ExecutionFailedAttributes: &historyv1.ExecutionFailedEventAttributes{
-						Failure: attr.Failure,
-					},
+				EventType: types.EventTypeExecutionFailed,
+				Timestamp: time.Now(),
+				Attributes: &types.ExecutionFailedAttributes{
+					Reason:  attr.Failure.GetMessage(),
+					Details: []byte(attr.Failure.GetStackTrace()),
 				},
 			}
 			newEvents = append(newEvents, failEvent)
+
+		case historyv1.CommandType_COMMAND_TYPE_CANCEL_WORKFLOW_EXECUTION:
+			attr := cmd.GetCancelWorkflowExecutionAttributes()
+			cancelEvent := &types.HistoryEvent{
+				EventType: types.EventTypeExecutionCanceled,
+				Timestamp: time.Now(),
+				Attributes: &types.ExecutionCanceledAttributes{
+					Details: firstPayload(attr.GetDetails()),
+				},
+			}
+			newEvents = append(newEvents, cancelEvent)
+
+		case historyv1.CommandType_COMMAND_TYPE_CONTINUE_AS_NEW_WORKFLOW_EXECUTION:
+			attr := cmd.GetContinueAsNewWorkflowExecutionAttributes()
+			continuedEvent := &types.HistoryEvent{
+				EventType: types.EventTypeExecutionContinuedAsNew,
+				Timestamp: time.Now(),
+				Attributes: &types.ExecutionContinuedAsNewAttributes{
+					NewRunID:     generateRunID(),
+					WorkflowType: attr.GetWorkflowType().GetName(),
+					TaskQueue:    attr.GetTaskQueue(),
+					Input:        firstPayload(attr.GetInput()),
+					RunTimeout:   attr.GetRunTimeout().AsDuration(),
+					TaskTimeout:  attr.GetTaskTimeout().AsDuration(),
+				},
+			}
+			newEvents = append(newEvents, continuedEvent)
+
+		case historyv1.CommandType_COMMAND_TYPE_START_CHILD_WORKFLOW_EXECUTION:
+			attr := cmd.GetStartChildWorkflowExecutionAttributes()
+			initiatedEvent := &types.HistoryEvent{
+				EventType: types.EventTypeChildExecutionInitiated,
+				Timestamp: time.Now(),
+				Attributes: &types.ChildExecutionInitiatedAttributes{
+					NodeID:            attr.GetNodeId(),
+					WorkflowID:        attr.GetWorkflowId(),
+					RunID:             generateRunID(),
+					WorkflowType:      attr.GetWorkflowType().GetName(),
+					TaskQueue:         attr.GetTaskQueue(),
+					Input:             firstPayload(attr.GetInput()),
+					ExecutionTimeout:  attr.GetExecutionTimeout().AsDuration(),
+					RunTimeout:        attr.GetRunTimeout().AsDuration(),
+					TaskTimeout:       attr.GetTaskTimeout().AsDuration(),
+					ParentClosePolicy: types.ParentClosePolicy(attr.GetParentClosePolicy()),
+				},
+			}
+			newEvents = append(newEvents, initiatedEvent)
 		}
 	}
 
-	if err := s.processEvents(ctx, key, newEvents); err != nil {
+	err := s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+		for _, event := range newEvents {
+			switch attrs := event.Attributes.(type) {
+			case *types.ExecutionContinuedAsNewAttributes:
+				fillContinueAsNewAttributes(attrs, state.ExecutionInfo)
+			case *types.ChildExecutionInitiatedAttributes:
+				fillChildExecutionAttributes(attrs, state.ExecutionInfo)
+			}
+		}
+		return newEvents, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -378,6 +959,7 @@ func (s *Service) RespondWorkflowTaskFailed(ctx context.Context, req *historyv1.
 
 	event := &types.HistoryEvent{
 		EventType: types.EventTypeWorkflowTaskFailed,
+		Timestamp: time.Now(),
 		Attributes: &types.WorkflowTaskFailedAttributes{
 			ScheduledEventID: req.TaskToken,
 			Identity:         req.Identity,
@@ -391,6 +973,95 @@ func (s *Service) RespondWorkflowTaskFailed(ctx context.Context, req *historyv1.
 	return &historyv1.RespondWorkflowTaskFailedResponse{}, nil
 }
 
+// RecordActivityTaskStarted marks a scheduled node as picked up by a worker,
+// which arms its start-to-close and heartbeat timeouts. Like
+// RecordWorkflowTaskStarted it is idempotent for the request ID of the
+// recorded start; any other start of a started node gets ErrActivityStarted.
+func (s *Service) RecordActivityTaskStarted(ctx context.Context, req *historyv1.RecordActivityTaskStartedRequest) (*historyv1.RecordActivityTaskStartedResponse, error) {
+	key := types.ExecutionKey{
+		NamespaceID: req.GetNamespace(),
+		WorkflowID:  req.GetWorkflowExecution().GetWorkflowId(),
+		RunID:       req.GetWorkflowExecution().GetRunId(),
+	}
+
+	resp := &historyv1.RecordActivityTaskStartedResponse{}
+	err := s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+		ai, ok := state.GetPendingActivity(req.GetScheduledEventId())
+		if !ok {
+			return nil, engine.ErrActivityNotFound
+		}
+		resp.Attempt = ai.Attempt
+		resp.StartToCloseTimeout = durationpb.New(ai.StartToClose)
+		resp.HeartbeatTimeout = durationpb.New(ai.HeartbeatTimeout)
+		if len(ai.HeartbeatDetails) > 0 {
+			resp.HeartbeatDetails = &commonv1.Payloads{
+				Payloads: []*commonv1.Payload{{Data: ai.HeartbeatDetails}},
+			}
+		}
+		if ai.StartedEventID != 0 {
+			if req.GetRequestId() == "" || ai.RequestID != req.GetRequestId() {
+				return nil, engine.ErrActivityStarted
+			}
+			resp.StartedEventId = ai.StartedEventID
+			return nil, nil
+		}
+		resp.StartedEventId = state.NextEventID
+		return []*types.HistoryEvent{{
+			EventType: types.EventTypeNodeStarted,
+			Timestamp: time.Now(),
+			Attributes: &types.NodeStartedAttributes{
+				ScheduledEventID: req.GetScheduledEventId(),
+				Identity:         req.GetIdentity(),
+				RequestID:        req.GetRequestId(),
+			},
+		}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RecordActivityTaskHeartbeat records that a started node is still making
+// progress, which pushes its heartbeat timeout back. The details reported with
+// the heartbeat are kept, so a later attempt of the node can resume from them.
+// The response tells the worker to stop once a cancel of the run was
+// requested.
+//
+// Heartbeats only update the cached mutable state. They reach the store with
+// the execution's next update, at the latest when the heartbeat timeout timer
+// fires and is re-armed from the last heartbeat. A heartbeat lost with its
+// cache entry can at worst time the attempt out early, which the node's retry
+// policy covers.
+func (s *Service) RecordActivityTaskHeartbeat(ctx context.Context, req *historyv1.RecordActivityTaskHeartbeatRequest) (*historyv1.RecordActivityTaskHeartbeatResponse, error) {
+	key := types.ExecutionKey{
+		NamespaceID: req.GetNamespace(),
+		WorkflowID:  req.GetWorkflowExecution().GetWorkflowId(),
+		RunID:       req.GetWorkflowExecution().GetRunId(),
+	}
+
+	resp := &historyv1.RecordActivityTaskHeartbeatResponse{}
+	err := s.updateCachedState(ctx, key, func(state *engine.MutableState) error {
+		if !state.IsWorkflowExecutionRunning() {
+			return engine.ErrWorkflowNotRunning
+		}
+		ai, ok := state.GetPendingActivity(req.GetScheduledEventId())
+		if !ok || ai.StartedEventID == 0 {
+			return engine.ErrActivityNotFound
+		}
+		resp.CancelRequested = ai.CancelRequested
+		ai.LastHeartbeat = time.Now()
+		if details := firstPayload(req.GetDetails()); details != nil {
+			ai.HeartbeatDetails = details
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 func (s *Service) RespondActivityTaskCompleted(ctx context.Context, req *historyv1.RespondActivityTaskCompletedRequest) (*historyv1.RespondActivityTaskCompletedResponse, error) {
 	key := types.ExecutionKey{
 		NamespaceID: req.Namespace,
@@ -398,24 +1069,17 @@ func (s *Service) RespondActivityTaskCompleted(ctx context.Context, req *history
 		RunID:       req.WorkflowExecution.RunId,
 	}
 
-	// Event: ActivityTaskCompleted (NodeCompleted)
+	// Event: ActivityTaskCompleted (NodeCompleted). processEvents generates
+	// the workflow task that wakes up the decider.
 	event := &types.HistoryEvent{
-		EventType: types.EventType(commonv1.EventType_EVENT_TYPE_NODE_COMPLETED),
-		Attributes: &historyv1.HistoryEvent_NodeCompletedAttributes{
-			NodeCompletedAttributes: &historyv1.NodeCompletedEventAttributes{
-				ScheduledEventId: req.ScheduledEventId,
-				Result:           req.Result,
-				Identity:         req.Identity,
-			},
+		EventType: types.EventTypeNodeCompleted,
+		Timestamp: time.Now(),
+		Attributes: &types.NodeCompletedAttributes{
+			ScheduledEventID: req.ScheduledEventId,
+			Result:           firstPayload(req.Result),
 		},
 	}
 
-	// Also Schedule a new WorkflowTask to wake up the decider
-	// We need to know the workflow's task queue. We can get it from MutableState in processEvents
-	// But we need to create the event here.
-	// Actually, processEvents should handle the "auto-scheduling" of WorkflowTask when a Node completes.
-	// Let's rely on dispatchTasks logic for that.
-
 	if err := s.processEvents(ctx, key, []*types.HistoryEvent{event}); err != nil {
 		return nil, err
 	}
@@ -423,6 +1087,11 @@ func (s *Service) RespondActivityTaskCompleted(ctx context.Context, req *history
 	return &historyv1.RespondActivityTaskCompletedResponse{}, nil
 }
 
+// RespondActivityTaskFailed records the failure of a node's current attempt.
+// If the node's retry policy allows another attempt, no event is recorded;
+// the attempt is re-dispatched when its backoff timer fires, and only the
+// failure of the last attempt reaches the decider. A node whose cancel was
+// requested is not retried.
 func (s *Service) RespondActivityTaskFailed(ctx context.Context, req *historyv1.RespondActivityTaskFailedRequest) (*historyv1.RespondActivityTaskFailedResponse, error) {
 	key := types.ExecutionKey{
 		NamespaceID: req.Namespace,
@@ -430,94 +1099,512 @@ func (s *Service) RespondActivityTaskFailed(ctx context.Context, req *historyv1.
 		RunID:       req.WorkflowExecution.RunId,
 	}
 
+	err := s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+		retryState := types.RetryStateRetryPolicyNotSet
+		// Failures of activities that are not running are rejected by the
+		// engine when it applies the event.
+		if ai, ok := state.GetPendingActivity(req.ScheduledEventId); ok && ai.StartedEventID != 0 && !ai.CancelRequested && state.IsWorkflowExecutionRunning() {
+			var delay time.Duration
+			delay, retryState = activityRetryDelay(ai, req.Failure.GetErrorType(), req.Failure.GetMessage())
+			if retryState == types.RetryStateInProgress {
+				s.retryActivity(key, state, ai, time.Now().Add(delay))
+				return nil, nil
+			}
+		}
+
+		return []*types.HistoryEvent{{
+			EventType: types.EventTypeNodeFailed,
+			Timestamp: time.Now(),
+			Attributes: &types.NodeFailedAttributes{
+				ScheduledEventID: req.ScheduledEventId,
+				Reason:           req.Failure.GetMessage(),
+				Details:          []byte(req.Failure.GetStackTrace()),
+				RetryState:       retryState,
+			},
+		}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &historyv1.RespondActivityTaskFailedResponse{}, nil
+}
+
+// retryActivity resets the failed attempt of a started activity and arms the
+// timer that dispatches its next attempt at retryTime. The timers of the
+// failed attempt are canceled; its heartbeat details are kept for the next
+// attempt to resume from.
+func (s *Service) retryActivity(key types.ExecutionKey, state *engine.MutableState, ai *types.ActivityInfo, retryTime time.Time) {
+	shardID := s.GetShardIDForExecution(key)
+	for _, timeoutType := range []string{types.TimeoutTypeStartToClose, types.TimeoutTypeHeartbeat} {
+		state.AddTimerTask(&types.TimerTask{
+			ShardID:     shardID,
+			NamespaceID: key.NamespaceID,
+			WorkflowID:  key.WorkflowID,
+			RunID:       key.RunID,
+			TimerID:     activityTimeoutTimerID(ai.ScheduledEventID, timeoutType),
+			Canceled:    true,
+		})
+	}
+
+	ai.Attempt++
+	ai.StartedEventID = 0
+	ai.StartedTime = time.Time{}
+	ai.LastHeartbeat = time.Time{}
+	ai.RequestID = ""
+	// The schedule-to-start timeout of the next attempt runs from its
+	// dispatch.
+	ai.ScheduledTime = retryTime
+	state.Modified = true
+
+	state.AddTimerTask(&types.TimerTask{
+		ShardID:     shardID,
+		NamespaceID: key.NamespaceID,
+		WorkflowID:  key.WorkflowID,
+		RunID:       key.RunID,
+		TimerID:     activityRetryTimerID(ai.ScheduledEventID),
+		FireTime:    retryTime,
+	})
+}
+
+// dispatchActivityTask adds the transfer task of the next attempt of a
+// retried activity once its backoff has passed, and arms the attempt's
+// schedule-to-start timeout. It does nothing if the activity was closed or
+// already started in the meantime.
+func (s *Service) dispatchActivityTask(key types.ExecutionKey, state *engine.MutableState, scheduledEventID int64) {
+	ai, ok := state.GetPendingActivity(scheduledEventID)
+	if !state.IsWorkflowExecutionRunning() || !ok || ai.StartedEventID != 0 {
+		return
+	}
+	shardID := s.GetShardIDForExecution(key)
+	state.AddTransferTask(&types.TransferTask{
+		ShardID:          shardID,
+		NamespaceID:      key.NamespaceID,
+		WorkflowID:       key.WorkflowID,
+		RunID:            key.RunID,
+		TaskType:         types.TransferTaskTypeActivityTask,
+		TaskQueue:        ai.TaskQueue,
+		ScheduledEventID: scheduledEventID,
+		VisibilityTime:   time.Now(),
+	})
+	if deadline, ok := activityTimeoutDeadline(ai, types.TimeoutTypeScheduleToStart); ok {
+		state.AddTimerTask(&types.TimerTask{
+			ShardID:     shardID,
+			NamespaceID: key.NamespaceID,
+			WorkflowID:  key.WorkflowID,
+			RunID:       key.RunID,
+			TimerID:     activityTimeoutTimerID(scheduledEventID, types.TimeoutTypeScheduleToStart),
+			FireTime:    deadline,
+		})
+	}
+}
+
+// SignalWorkflowExecution records a SignalReceived event, which schedules a
+// workflow task so the decider sees the signal. A signal whose request ID was
+// already recorded is acknowledged without being recorded again.
+func (s *Service) SignalWorkflowExecution(ctx context.Context, req *historyv1.SignalWorkflowExecutionRequest) (*historyv1.SignalWorkflowExecutionResponse, error) {
+	key := types.ExecutionKey{
+		NamespaceID: req.GetNamespace(),
+		WorkflowID:  req.GetWorkflowExecution().GetWorkflowId(),
+		RunID:       req.GetWorkflowExecution().GetRunId(),
+	}
+
 	event := &types.HistoryEvent{
-		EventType: types.EventType(commonv1.EventType_EVENT_TYPE_NODE_FAILED),
-		Attributes: &historyv1.HistoryEvent_NodeFailedAttributes{
-			NodeFailedAttributes: &historyv1.NodeFailedEventAttributes{
-				ScheduledEventId: req.ScheduledEventId,
-				Failure:          req.Failure,
-				Identity:         req.Identity,
+		EventType: types.EventTypeSignalReceived,
+		Timestamp: time.Now(),
+		Attributes: &types.SignalReceivedAttributes{
+			SignalName: req.GetSignalName(),
+			Input:      firstPayload(req.GetInput()),
+			Identity:   req.GetIdentity(),
+			RequestID:  req.GetRequestId(),
+		},
+	}
+
+	if err := s.processEvents(ctx, key, []*types.HistoryEvent{event}); err != nil {
+		if errors.Is(err, engine.ErrDuplicateSignal) {
+			return &historyv1.SignalWorkflowExecutionResponse{}, nil
+		}
+		return nil, err
+	}
+
+	return &historyv1.SignalWorkflowExecutionResponse{}, nil
+}
+
+// RecordChildExecutionCompleted records the outcome of a child run on its
+// parent, which schedules a workflow task so the decider sees it. A parent
+// that already closed or no longer waits for the child acknowledges the
+// report without recording anything, so a repeated report is harmless.
+func (s *Service) RecordChildExecutionCompleted(ctx context.Context, req *historyv1.RecordChildExecutionCompletedRequest) (*historyv1.RecordChildExecutionCompletedResponse, error) {
+	key := types.ExecutionKey{
+		NamespaceID: req.GetNamespace(),
+		WorkflowID:  req.GetWorkflowExecution().GetWorkflowId(),
+		RunID:       req.GetWorkflowExecution().GetRunId(),
+	}
+	childWorkflowID := req.GetChildExecution().GetWorkflowId()
+	childRunID := req.GetChildExecution().GetRunId()
+
+	err := s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+		child, ok := state.GetPendingChildExecution(req.GetInitiatedEventId())
+		if !state.IsWorkflowExecutionRunning() || !ok || child.WorkflowID != childWorkflowID {
+			return nil, nil
+		}
+
+		if req.GetStatus() == commonv1.ExecutionStatus_EXECUTION_STATUS_COMPLETED {
+			return []*types.HistoryEvent{{
+				EventType: types.EventTypeChildExecutionCompleted,
+				Timestamp: time.Now(),
+				Attributes: &types.ChildExecutionCompletedAttributes{
+					InitiatedEventID: child.InitiatedEventID,
+					StartedEventID:   child.StartedEventID,
+					WorkflowID:       childWorkflowID,
+					RunID:            childRunID,
+					Result:           firstPayload(req.GetResult()),
+				},
+			}}, nil
+		}
+		return []*types.HistoryEvent{{
+			EventType: types.EventTypeChildExecutionFailed,
+			Timestamp: time.Now(),
+			Attributes: &types.ChildExecutionFailedAttributes{
+				InitiatedEventID: child.InitiatedEventID,
+				StartedEventID:   child.StartedEventID,
+				WorkflowID:       childWorkflowID,
+				RunID:            childRunID,
+				Status:           executionStatusFromProto(req.GetStatus()),
+				Reason:           req.GetFailure().GetMessage(),
+				Details:          []byte(req.GetFailure().GetStackTrace()),
 			},
+		}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &historyv1.RecordChildExecutionCompletedResponse{}, nil
+}
+
+// TerminateWorkflowExecution closes a run as terminated without involving
+// the decider. A run that continued as new is followed to the run it
+// continued to; a run that already closed is left as it is.
+func (s *Service) TerminateWorkflowExecution(ctx context.Context, req *historyv1.TerminateWorkflowExecutionRequest) (*historyv1.TerminateWorkflowExecutionResponse, error) {
+	key := types.ExecutionKey{
+		NamespaceID: req.GetNamespace(),
+		WorkflowID:  req.GetWorkflowExecution().GetWorkflowId(),
+		RunID:       req.GetWorkflowExecution().GetRunId(),
+	}
+
+	for key.RunID != "" {
+		var newRunID string
+		err := s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+			if state.ExecutionInfo.Status == types.ExecutionStatusContinuedAsNew {
+				newRunID = state.ExecutionInfo.NewRunID
+			}
+			if !state.IsWorkflowExecutionRunning() {
+				return nil, nil
+			}
+			return []*types.HistoryEvent{{
+				EventType: types.EventTypeExecutionTerminated,
+				Timestamp: time.Now(),
+				Attributes: &types.ExecutionTerminatedAttributes{
+					Reason:   req.GetReason(),
+					Identity: req.GetIdentity(),
+				},
+			}}, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		key.RunID = newRunID
+	}
+
+	return &historyv1.TerminateWorkflowExecutionResponse{}, nil
+}
+
+// RecordTimerFired records a TimerFired event for a durable timer, which
+// schedules a workflow task so the decider sees it. A timer that is no longer
+// pending, because it was canceled, already fired or its workflow has closed,
+// is acknowledged without recording anything. Workflow task timers time out
+// or dispatch the workflow task they belong to instead, activity timeout
+// timers time out their node, and execution and run timeout timers time out
+// the run.
+func (s *Service) RecordTimerFired(ctx context.Context, req *historyv1.RecordTimerFiredRequest) (*historyv1.RecordTimerFiredResponse, error) {
+	key := types.ExecutionKey{
+		NamespaceID: req.GetNamespace(),
+		WorkflowID:  req.GetWorkflowExecution().GetWorkflowId(),
+		RunID:       req.GetWorkflowExecution().GetRunId(),
+	}
+
+	if timeoutType, ok := executionTimeoutType(req.GetTimerId()); ok {
+		if err := s.timeoutExecution(ctx, key, timeoutType); err != nil {
+			return nil, err
+		}
+		return &historyv1.RecordTimerFiredResponse{}, nil
+	}
+	if scheduledEventID, ok := parseEventTimerID(req.GetTimerId(), workflowTaskTimeoutTimerPrefix); ok {
+		// The new attempt is scheduled along with the timeout.
+		err := s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+			if timedOut := workflowTaskTimedOutEvent(state, scheduledEventID); timedOut != nil {
+				return []*types.HistoryEvent{timedOut}, nil
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &historyv1.RecordTimerFiredResponse{}, nil
+	}
+	if scheduledEventID, timeoutType, ok := parseActivityTimeoutTimerID(req.GetTimerId()); ok {
+		err := s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+			timedOut, deadline := activityTimedOutEvent(state, scheduledEventID, timeoutType, time.Now())
+			if timedOut != nil {
+				return []*types.HistoryEvent{timedOut}, nil
+			}
+			if !deadline.IsZero() {
+				// A heartbeat moved the deadline since the timer was armed.
+				state.AddTimerTask(&types.TimerTask{
+					ShardID:     s.GetShardIDForExecution(key),
+					NamespaceID: key.NamespaceID,
+					WorkflowID:  key.WorkflowID,
+					RunID:       key.RunID,
+					TimerID:     req.GetTimerId(),
+					FireTime:    deadline,
+				})
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &historyv1.RecordTimerFiredResponse{}, nil
+	}
+	if scheduledEventID, ok := parseEventTimerID(req.GetTimerId(), activityRetryTimerPrefix); ok {
+		err := s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+			s.dispatchActivityTask(key, state, scheduledEventID)
+			return nil, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &historyv1.RecordTimerFiredResponse{}, nil
+	}
+	if scheduledEventID, ok := parseEventTimerID(req.GetTimerId(), workflowTaskBackoffTimerPrefix); ok {
+		err := s.updateWorkflow(ctx, key, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+			s.dispatchWorkflowTask(key, state, scheduledEventID)
+			return nil, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &historyv1.RecordTimerFiredResponse{}, nil
+	}
+
+	event := &types.HistoryEvent{
+		EventType: types.EventTypeTimerFired,
+		Timestamp: time.Now(),
+		Attributes: &types.TimerFiredAttributes{
+			TimerID: req.GetTimerId(),
 		},
 	}
 
 	if err := s.processEvents(ctx, key, []*types.HistoryEvent{event}); err != nil {
+		if errors.Is(err, engine.ErrTimerNotFound) || errors.Is(err, engine.ErrWorkflowNotRunning) {
+			return &historyv1.RecordTimerFiredResponse{}, nil
+		}
 		return nil, err
 	}
 
-	return &historyv1.RespondActivityTaskFailedResponse{}, nil
+	return &historyv1.RecordTimerFiredResponse{}, nil
 }
 
-func (s *Service) dispatchTasks(ctx context.Context, key types.ExecutionKey, event *types.HistoryEvent, state *engine.MutableState) error {
-	var taskType commonv1.TaskType
-	var taskQueue string
+// dispatchWorkflowTask adds the transfer task of a backed off workflow task
+// once its backoff has passed, unless the task was already started or
+// replaced.
+func (s *Service) dispatchWorkflowTask(key types.ExecutionKey, state *engine.MutableState, scheduledEventID int64) {
+	task := state.WorkflowTask
+	if !state.IsWorkflowExecutionRunning() || task == nil ||
+		task.ScheduledEventID != scheduledEventID || task.StartedEventID != 0 {
+		return
+	}
+	state.AddTransferTask(&types.TransferTask{
+		ShardID:          s.GetShardIDForExecution(key),
+		NamespaceID:      key.NamespaceID,
+		WorkflowID:       key.WorkflowID,
+		RunID:            key.RunID,
+		TaskType:         types.TransferTaskTypeWorkflowTask,
+		TaskQueue:        task.TaskQueue,
+		ScheduledEventID: task.ScheduledEventID,
+		VisibilityTime:   time.Now(),
+	})
+}
+
+// generateTransferTasks adds the matching task an event calls for to the
+// mutable state, so that it is written in the same transaction as the event.
+func (s *Service) generateTransferTasks(key types.ExecutionKey, shardID int32, event *types.HistoryEvent, state *engine.MutableState) {
+	task := &types.TransferTask{
+		ShardID:          shardID,
+		NamespaceID:      key.NamespaceID,
+		WorkflowID:       key.WorkflowID,
+		RunID:            key.RunID,
+		ScheduledEventID: event.EventID,
+		VisibilityTime:   event.Timestamp,
+	}
 
 	switch event.EventType {
-	case types.EventTypeExecutionStarted:
-		attrs, ok := event.Attributes.(*historyv1.HistoryEvent_ExecutionStartedAttributes)
+	case types.EventTypeNodeScheduled:
+		// When a node is scheduled, we dispatch an Activity Task
+		attrs, ok := event.Attributes.(*types.NodeScheduledAttributes)
 		if !ok {
-			return nil
+			return
 		}
-		taskType = commonv1.TaskType_TASK_TYPE_WORKFLOW_TASK
-		taskQueue = attrs.ExecutionStartedAttributes.TaskQueue.Name
+		task.TaskType = types.TransferTaskTypeActivityTask
+		task.TaskQueue = attrs.TaskQueue
 
-	case types.EventTypeNodeScheduled:
-		// When a node is scheduled, we dispatch an Activity Task
-		attrs, ok := event.Attributes.(*historyv1.HistoryEvent_NodeScheduledAttributes)
+	case types.EventTypeWorkflowTaskScheduled:
+		attrs, ok := event.Attributes.(*types.WorkflowTaskScheduledAttributes)
 		if !ok {
-			return nil
+			return
+		}
+		// A backed off attempt is dispatched when its backoff timer fires.
+		if workflowTaskBackoff(attrs.Attempt) > 0 {
+			return
 		}
-		taskType = commonv1.TaskType_TASK_TYPE_ACTIVITY_TASK
-		taskQueue = attrs.NodeScheduledAttributes.TaskQueue.Name
+		task.TaskType = types.TransferTaskTypeWorkflowTask
+		task.TaskQueue = attrs.TaskQueue
+
+	case types.EventTypeChildExecutionInitiated:
+		task.TaskType = types.TransferTaskTypeStartChildExecution
 
-		// We need to include the "Config" in the task.
-		// In a real system, we'd pass this through attributes.
-		// The generic task struct in Matching service has a 'Config' field.
-		// We should extract it from Input or attributes.
+	case types.EventTypeExecutionCompleted, types.EventTypeExecutionFailed,
+		types.EventTypeExecutionTerminated, types.EventTypeExecutionContinuedAsNew,
+		types.EventTypeExecutionCanceled, types.EventTypeExecutionTimedOut:
+		s.generateCloseTransferTasks(key, shardID, event, state)
+		return
 
-	case types.EventTypeNodeCompleted, types.EventTypeNodeFailed:
-		// When a node completes/fails, we dispatch a Workflow Task to wake up the decider
-		taskType = commonv1.TaskType_TASK_TYPE_WORKFLOW_TASK
-		if state.ExecutionInfo != nil {
-			taskQueue = state.ExecutionInfo.TaskQueue
-		} else {
-			return nil
+	default:
+		return
+	}
+
+	state.AddTransferTask(task)
+}
+
+// generateTimerTasks adds the durable timers an event starts or cancels to
+// the mutable state, so the timers table changes in the same transaction as
+// the event.
+func (s *Service) generateTimerTasks(key types.ExecutionKey, shardID int32, event *types.HistoryEvent, state *engine.MutableState) {
+	add := func(timerID string, fireTime time.Time, canceled bool) {
+		state.AddTimerTask(&types.TimerTask{
+			ShardID:     shardID,
+			NamespaceID: key.NamespaceID,
+			WorkflowID:  key.WorkflowID,
+			RunID:       key.RunID,
+			TimerID:     timerID,
+			FireTime:    fireTime,
+			Canceled:    canceled,
+		})
+	}
+	// armActivityTimeout starts the timer of a node timeout if the node has
+	// it configured.
+	armActivityTimeout := func(scheduledEventID int64, timeoutType string) {
+		ai, ok := state.GetPendingActivity(scheduledEventID)
+		if !ok {
+			return
 		}
+		if deadline, ok := activityTimeoutDeadline(ai, timeoutType); ok {
+			add(activityTimeoutTimerID(scheduledEventID, timeoutType), deadline, false)
+		}
+	}
+	// cancelActivityTimeouts cancels the timers a node closing at the given
+	// stage may still have pending.
+	cancelActivityTimeouts := func(scheduledEventID, startedEventID int64) {
+		if startedEventID == 0 {
+			add(activityTimeoutTimerID(scheduledEventID, types.TimeoutTypeScheduleToStart), time.Time{}, true)
+			return
+		}
+		add(activityTimeoutTimerID(scheduledEventID, types.TimeoutTypeStartToClose), time.Time{}, true)
+		add(activityTimeoutTimerID(scheduledEventID, types.TimeoutTypeHeartbeat), time.Time{}, true)
+	}
 
-		// Optimization: If a workflow task is already scheduled/started, don't schedule another one?
-		// For simplicity, we schedule. Matching service handles deduplication.
+	switch attrs := event.Attributes.(type) {
+	case *types.ExecutionStartedAttributes:
+		if expiration := state.ExecutionInfo.ExecutionExpirationTime; !expiration.IsZero() {
+			add(executionTimeoutTimerID, expiration, false)
+		}
+		if attrs.RunTimeout > 0 {
+			add(runTimeoutTimerID, event.Timestamp.Add(attrs.RunTimeout), false)
+		}
 
-	case types.EventTypeWorkflowTaskScheduled:
-		// Already handled by the creator of this event?
-		// No, if we write this event, we must create the task.
-		attrs, ok := event.Attributes.(*historyv1.HistoryEvent_WorkflowTaskScheduledAttributes)
+	case *types.TimerStartedAttributes:
+		timer, ok := state.GetPendingTimer(attrs.TimerID)
 		if !ok {
-			return nil
+			return
 		}
-		taskType = commonv1.TaskType_TASK_TYPE_WORKFLOW_TASK
-		taskQueue = attrs.WorkflowTaskScheduledAttributes.TaskQueue.Name
+		add(attrs.TimerID, timer.FireTime, false)
 
-	default:
-		return nil
+	case *types.TimerCanceledAttributes:
+		add(attrs.TimerID, time.Time{}, true)
+
+	case *types.NodeScheduledAttributes:
+		armActivityTimeout(event.EventID, types.TimeoutTypeScheduleToStart)
+
+	case *types.NodeStartedAttributes:
+		if ai, ok := state.GetPendingActivity(attrs.ScheduledEventID); ok && ai.ScheduleTimeout > 0 {
+			add(activityTimeoutTimerID(attrs.ScheduledEventID, types.TimeoutTypeScheduleToStart), time.Time{}, true)
+		}
+		armActivityTimeout(attrs.ScheduledEventID, types.TimeoutTypeStartToClose)
+		armActivityTimeout(attrs.ScheduledEventID, types.TimeoutTypeHeartbeat)
+
+	case *types.NodeCompletedAttributes:
+		cancelActivityTimeouts(attrs.ScheduledEventID, attrs.StartedEventID)
+
+	case *types.NodeFailedAttributes:
+		cancelActivityTimeouts(attrs.ScheduledEventID, attrs.StartedEventID)
+
+	case *types.NodeTimedOutAttributes:
+		cancelActivityTimeouts(attrs.ScheduledEventID, attrs.StartedEventID)
+
+	case *types.NodeCanceledAttributes:
+		cancelActivityTimeouts(attrs.ScheduledEventID, attrs.StartedEventID)
+
+	case *types.WorkflowTaskScheduledAttributes:
+		if backoff := workflowTaskBackoff(attrs.Attempt); backoff > 0 {
+			add(workflowTaskBackoffTimerID(event.EventID), event.Timestamp.Add(backoff), false)
+		}
+
+	case *types.WorkflowTaskStartedAttributes:
+		startToClose := workflowTaskStartToClose(state.ExecutionInfo)
+		if state.WorkflowTask != nil && state.WorkflowTask.StartToClose > 0 {
+			startToClose = state.WorkflowTask.StartToClose
+		}
+		add(workflowTaskTimeoutTimerID(attrs.ScheduledEventID), event.Timestamp.Add(startToClose), false)
+
+	case *types.WorkflowTaskCompletedAttributes:
+		add(workflowTaskTimeoutTimerID(attrs.ScheduledEventID), time.Time{}, true)
+
+	case *types.WorkflowTaskFailedAttributes:
+		add(workflowTaskTimeoutTimerID(attrs.ScheduledEventID), time.Time{}, true)
 	}
 
-	// Create task request
-	req := &matchingv1.AddTaskRequest{
-		Namespace: key.NamespaceID,
-		TaskQueue: &matchingv1.TaskQueue{
-			Name: taskQueue,
-			Kind: commonv1.TaskQueueKind_TASK_QUEUE_KIND_NORMAL,
-		},
-		TaskType: taskType,
-		WorkflowExecution: &commonv1.WorkflowExecution{
-			WorkflowId: key.WorkflowID,
-			RunId:      key.RunID,
-		},
-		ScheduledEventId: event.EventID,
+	// A run that closes no longer times out.
+	switch event.EventType {
+	case types.EventTypeExecutionCompleted, types.EventTypeExecutionFailed,
+		types.EventTypeExecutionTerminated, types.EventTypeExecutionContinuedAsNew,
+		types.EventTypeExecutionCanceled, types.EventTypeExecutionTimedOut:
+		if !state.ExecutionInfo.ExecutionExpirationTime.IsZero() {
+			add(executionTimeoutTimerID, time.Time{}, true)
+		}
+		if state.ExecutionInfo.RunTimeout > 0 {
+			add(runTimeoutTimerID, time.Time{}, true)
+		}
 	}
+}
 
-	_, err := s.matchingClient.AddTask(ctx, req)
-	return err
+// firstPayload returns the data of the first payload, which is where the
+// engine keeps node inputs and results.
+func firstPayload(payloads *commonv1.Payloads) []byte {
+	if payloads == nil || len(payloads.GetPayloads()) == 0 {
+		return nil
+	}
+	return payloads.GetPayloads()[0].GetData()
 }
 
 // GetHistory, GetMutableState, etc. remain unchanged...
@@ -537,8 +1624,167 @@ func (s *Service) GetShardIDForExecution(key types.ExecutionKey) int32 {
 	return s.shardController.GetShardIDForExecution(key)
 }
 
+// ResetExecution forks a new run from the history of an existing one. Every
+// event before resetEventID is copied into the new run and replayed to rebuild
+// its mutable state, so nodes that already completed keep their results and are
+// not executed again. The old run is terminated if it is still running, and a
+// fresh workflow task is scheduled on the new run so the decider resumes from
+// the reset point. It returns the new RunID.
 func (s *Service) ResetExecution(ctx context.Context, key types.ExecutionKey, reason string, resetEventID int64) (string, error) {
-	return "", errors.New("reset execution not implemented")
+	if !s.IsRunning() {
+		return "", ErrServiceNotRunning
+	}
+
+	baseState, err := s.stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	// The started event must survive the reset, and the reset point has to be
+	// an event that was actually written.
+	if resetEventID <= 1 || resetEventID >= baseState.NextEventID {
+		return "", fmt.Errorf("%w: %d is outside of [2, %d)", ErrInvalidResetEventID, resetEventID, baseState.NextEventID)
+	}
+
+	baseEvents, err := s.eventStore.GetEvents(ctx, key, 1, resetEventID-1)
+	if err != nil {
+		return "", err
+	}
+	if int64(len(baseEvents)) != resetEventID-1 {
+		return "", fmt.Errorf("%w: history of run %s is incomplete before event %d", ErrEventNotFound, key.RunID, resetEventID)
+	}
+
+	newKey := types.ExecutionKey{
+		NamespaceID: key.NamespaceID,
+		WorkflowID:  key.WorkflowID,
+		RunID:       generateRunID(),
+	}
+
+	// Rebuild the new run's mutable state by replaying the copied events.
+	newState := engine.NewMutableState(&types.ExecutionInfo{
+		NamespaceID: newKey.NamespaceID,
+		WorkflowID:  newKey.WorkflowID,
+		RunID:       newKey.RunID,
+	})
+	newEvents := make([]*types.HistoryEvent, 0, len(baseEvents))
+	for _, event := range baseEvents {
+		copied := *event
+		if err := s.historyEngine.ProcessEvent(newState, &copied); err != nil {
+			return "", fmt.Errorf("failed to replay event %d: %w", event.EventID, err)
+		}
+		addHistorySize(newState, &copied)
+		newEvents = append(newEvents, &copied)
+	}
+	if !newState.IsWorkflowExecutionRunning() {
+		return "", fmt.Errorf("%w: run is already closed at event %d", ErrInvalidResetEventID, resetEventID)
+	}
+	// A workflow task copied from the base run was never completed there;
+	// the new run gets a fresh one below.
+	newState.WorkflowTask = nil
+	newState.WorkflowTaskFailures = 0
+	newState.NeedsWorkflowTask = true
+
+	// The replay only rebuilds the state. The work that was still pending at
+	// the reset point needs its tasks and timers in the new run.
+	shardID := s.GetShardIDForExecution(newKey)
+	s.rearmResetRun(newKey, shardID, newState, time.Now())
+	if scheduled := workflowTaskScheduledEvent(newState); scheduled != nil {
+		if err := s.applyEvent(newKey, shardID, newState, scheduled); err != nil {
+			return "", err
+		}
+		newEvents = append(newEvents, scheduled)
+	}
+	newState.DBVersion++
+	newRun := &continuedRun{key: newKey, events: newEvents, state: newState}
+
+	// The old run is terminated in the same write that creates the new run,
+	// so two runs of the workflow are never running at once and the workflow
+	// is never left without one. A run that already closed is left as it is.
+	terminate := func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+		if !state.IsWorkflowExecutionRunning() {
+			return nil, nil
+		}
+		return []*types.HistoryEvent{{
+			EventType: types.EventTypeExecutionTerminated,
+			Timestamp: time.Now(),
+			Attributes: &types.ExecutionTerminatedAttributes{
+				Reason:   fmt.Sprintf("reset to event %d as run %s: %s", resetEventID, newKey.RunID, reason),
+				Identity: "history-service",
+			},
+		}}, nil
+	}
+	if err := s.updateWorkflowWithNewRun(ctx, key, newRun, terminate); err != nil {
+		return "", fmt.Errorf("failed to reset run %s: %w", key.RunID, err)
+	}
+
+	s.logger.Info("execution reset",
+		"workflow_id", key.WorkflowID,
+		"base_run_id", key.RunID,
+		"new_run_id", newKey.RunID,
+		"reset_event_id", resetEventID,
+	)
+
+	return newKey.RunID, nil
+}
+
+// rearmResetRun adds the tasks and timers of the work a reset run replayed
+// as pending: its activities are dispatched again from scratch, its decider
+// timers and child starts are re-created, and its execution and run timeouts
+// are armed as for a new run.
+func (s *Service) rearmResetRun(key types.ExecutionKey, shardID int32, state *engine.MutableState, now time.Time) {
+	addTimer := func(timerID string, fireTime time.Time) {
+		state.AddTimerTask(&types.TimerTask{
+			ShardID:     shardID,
+			NamespaceID: key.NamespaceID,
+			WorkflowID:  key.WorkflowID,
+			RunID:       key.RunID,
+			TimerID:     timerID,
+			FireTime:    fireTime,
+		})
+	}
+
+	// Maps are walked in event order so the tasks are created in the order
+	// the base run created them.
+	activities := slices.Sorted(maps.Keys(state.PendingActivities))
+	for _, scheduledEventID := range activities {
+		ai := state.PendingActivities[scheduledEventID]
+		ai.StartedEventID = 0
+		ai.StartedTime = time.Time{}
+		ai.LastHeartbeat = time.Time{}
+		ai.RequestID = ""
+		ai.ScheduledTime = now
+		s.dispatchActivityTask(key, state, scheduledEventID)
+	}
+
+	timers := slices.SortedFunc(maps.Values(state.PendingTimers), func(a, b *types.TimerInfo) int {
+		return cmp.Compare(a.StartedEventID, b.StartedEventID)
+	})
+	for _, timer := range timers {
+		addTimer(timer.TimerID, timer.FireTime)
+	}
+
+	children := slices.Sorted(maps.Keys(state.PendingChildExecutions))
+	for _, initiatedEventID := range children {
+		if state.PendingChildExecutions[initiatedEventID].StartedEventID != 0 {
+			continue
+		}
+		state.AddTransferTask(&types.TransferTask{
+			ShardID:          shardID,
+			NamespaceID:      key.NamespaceID,
+			WorkflowID:       key.WorkflowID,
+			RunID:            key.RunID,
+			TaskType:         types.TransferTaskTypeStartChildExecution,
+			ScheduledEventID: initiatedEventID,
+			VisibilityTime:   now,
+		})
+	}
+
+	if expiration := state.ExecutionInfo.ExecutionExpirationTime; !expiration.IsZero() {
+		addTimer(executionTimeoutTimerID, expiration)
+	}
+	if runTimeout := state.ExecutionInfo.RunTimeout; runTimeout > 0 {
+		addTimer(runTimeoutTimerID, now.Add(runTimeout))
+	}
 }
 
 func (s *Service) ListWorkflowExecutions(ctx context.Context, req *historyv1.ListWorkflowExecutionsRequest) (*historyv1.ListWorkflowExecutionsResponse, error) {
@@ -571,6 +1817,9 @@ func (s *Service) ListWorkflowExecutions(ctx context.Context, req *historyv1.Lis
 			Status:        exec.Status,
 			HistoryLength: exec.HistoryLength,
 			Memo:          exec.Memo,
+
+			ContinuedFromRunId: exec.ContinuedFromRunID,
+			NewRunId:           exec.NewRunID,
 		}
 	}
 
@@ -579,3 +1828,15 @@ func (s *Service) ListWorkflowExecutions(ctx context.Context, req *historyv1.Lis
 		NextPageToken: resp.NextPageToken,
 	}, nil
 }
+
+// generateRunID returns a random version 4 UUID, the format the run_id
+// columns are declared with.
+func generateRunID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("history: failed to generate run id: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
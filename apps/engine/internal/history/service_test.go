@@ -0,0 +1,2032 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/linkflow/engine/api/gen/linkflow/api/v1"
+	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
+	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
+	"github.com/linkflow/engine/internal/controlplane"
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/shard"
+	"github.com/linkflow/engine/internal/history/store"
+	"github.com/linkflow/engine/internal/history/types"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func newTestService(t *testing.T) (*Service, *store.MemoryExecutionStore, *store.MemoryExecutionStore) {
+	t.Helper()
+
+	executionStore := store.NewMemoryExecutionStore()
+	svc := NewServiceWithConfig(Config{
+		ShardController: shard.NewController(4),
+		EventStore:      executionStore,
+		StateStore:      executionStore,
+		ExecutionStore:  executionStore,
+	})
+	if err := svc.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { _ = svc.Stop(context.Background()) })
+
+	return svc, executionStore, executionStore
+}
+
+func recordTestEvents(t *testing.T, svc *Service, key types.ExecutionKey, events ...*types.HistoryEvent) {
+	t.Helper()
+
+	for _, event := range events {
+		event.Timestamp = time.Now()
+		if err := svc.RecordEvent(context.Background(), key, event); err != nil {
+			t.Fatalf("RecordEvent(%s) error = %v", event.EventType, err)
+		}
+	}
+}
+
+// runWorkflowTask starts the pending workflow task and completes it with the
+// given commands, the way a worker running the decider does.
+func runWorkflowTask(t *testing.T, svc *Service, key types.ExecutionKey, commands ...*historyv1.Command) {
+	t.Helper()
+	ctx := context.Background()
+
+	state, err := svc.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if state.WorkflowTask == nil {
+		t.Fatal("no workflow task pending")
+	}
+	execution := &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID}
+
+	_, err = svc.RecordWorkflowTaskStarted(ctx, &historyv1.RecordWorkflowTaskStartedRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		ScheduledEventId:  state.WorkflowTask.ScheduledEventID,
+		RequestId:         "test-worker",
+	})
+	if err != nil {
+		t.Fatalf("RecordWorkflowTaskStarted() error = %v", err)
+	}
+	_, err = svc.RespondWorkflowTaskCompleted(ctx, &historyv1.RespondWorkflowTaskCompletedRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		TaskToken:         state.WorkflowTask.ScheduledEventID,
+		Commands:          commands,
+	})
+	if err != nil {
+		t.Fatalf("RespondWorkflowTaskCompleted() error = %v", err)
+	}
+}
+
+func scheduleActivityCommand(nodeID, taskQueue string) *historyv1.Command {
+	return &historyv1.Command{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_SCHEDULE_ACTIVITY_TASK,
+		Attributes: &historyv1.Command_ScheduleActivityTaskAttributes{ScheduleActivityTaskAttributes: &historyv1.ScheduleActivityTaskCommandAttributes{
+			NodeId:    nodeID,
+			NodeType:  "http",
+			TaskQueue: taskQueue,
+		}},
+	}
+}
+
+func startedEvent() *types.HistoryEvent {
+	return &types.HistoryEvent{
+		EventType: types.EventTypeExecutionStarted,
+		Attributes: &types.ExecutionStartedAttributes{
+			WorkflowType: "order-sync",
+			TaskQueue:    "default",
+			TaskTimeout:  10 * time.Second,
+		},
+	}
+}
+
+func TestResetExecution(t *testing.T) {
+	ctx := context.Background()
+	svc, eventStore, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-1", RunID: "run-1"}
+
+	// Event 2 is the first workflow task, which is still pending when the
+	// later events arrive.
+	recordTestEvents(t, svc, key,
+		startedEvent(),
+		&types.HistoryEvent{
+			EventType:  types.EventTypeNodeScheduled,
+			Attributes: &types.NodeScheduledAttributes{NodeID: "fetch", NodeType: "http", TaskQueue: "default"},
+		},
+		&types.HistoryEvent{
+			EventType:  types.EventTypeNodeCompleted,
+			Attributes: &types.NodeCompletedAttributes{NodeID: "fetch", ScheduledEventID: 3, Result: []byte(`{"ok":true}`)},
+		},
+		&types.HistoryEvent{
+			EventType:  types.EventTypeNodeScheduled,
+			Attributes: &types.NodeScheduledAttributes{NodeID: "notify", NodeType: "slack", TaskQueue: "default"},
+		},
+		&types.HistoryEvent{
+			EventType:  types.EventTypeNodeFailed,
+			Attributes: &types.NodeFailedAttributes{NodeID: "notify", ScheduledEventID: 5, Reason: "boom"},
+		},
+	)
+
+	newRunID, err := svc.ResetExecution(ctx, key, "retry notify", 5)
+	if err != nil {
+		t.Fatalf("ResetExecution() error = %v", err)
+	}
+	if newRunID == "" || newRunID == key.RunID {
+		t.Fatalf("ResetExecution() run id = %q, want a new run id", newRunID)
+	}
+
+	oldState, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState(old) error = %v", err)
+	}
+	if oldState.ExecutionInfo.Status != types.ExecutionStatusTerminated {
+		t.Errorf("old run status = %v, want %v", oldState.ExecutionInfo.Status, types.ExecutionStatusTerminated)
+	}
+
+	newKey := types.ExecutionKey{NamespaceID: key.NamespaceID, WorkflowID: key.WorkflowID, RunID: newRunID}
+	newState, err := stateStore.GetMutableState(ctx, newKey)
+	if err != nil {
+		t.Fatalf("GetMutableState(new) error = %v", err)
+	}
+	if !newState.IsWorkflowExecutionRunning() {
+		t.Errorf("new run status = %v, want running", newState.ExecutionInfo.Status)
+	}
+	if newState.ExecutionInfo.RunID != newRunID {
+		t.Errorf("new run ExecutionInfo.RunID = %q, want %q", newState.ExecutionInfo.RunID, newRunID)
+	}
+	if _, ok := newState.CompletedNodes["fetch"]; !ok {
+		t.Errorf("new run lost completed node %q", "fetch")
+	}
+	if _, ok := newState.CompletedNodes["notify"]; ok {
+		t.Errorf("new run kept node %q from after the reset point", "notify")
+	}
+
+	events, err := eventStore.GetEvents(ctx, newKey, 1, newState.NextEventID)
+	if err != nil {
+		t.Fatalf("GetEvents(new) error = %v", err)
+	}
+	wantTypes := []types.EventType{
+		types.EventTypeExecutionStarted,
+		types.EventTypeWorkflowTaskScheduled,
+		types.EventTypeNodeScheduled,
+		types.EventTypeNodeCompleted,
+		types.EventTypeWorkflowTaskScheduled,
+	}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("new run has %d events, want %d", len(events), len(wantTypes))
+	}
+	for i, want := range wantTypes {
+		if events[i].EventType != want {
+			t.Errorf("event %d type = %s, want %s", i+1, events[i].EventType, want)
+		}
+		if events[i].EventID != int64(i+1) {
+			t.Errorf("event %d id = %d, want %d", i+1, events[i].EventID, i+1)
+		}
+	}
+}
+
+func TestResetExecutionClosedRun(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-2", RunID: "run-1"}
+
+	recordTestEvents(t, svc, key,
+		startedEvent(),
+		&types.HistoryEvent{
+			EventType:  types.EventTypeExecutionFailed,
+			Attributes: &types.ExecutionFailedAttributes{Reason: "boom"},
+		},
+	)
+
+	if _, err := svc.ResetExecution(ctx, key, "retry", 2); err != nil {
+		t.Fatalf("ResetExecution() error = %v", err)
+	}
+
+	oldState, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState(old) error = %v", err)
+	}
+	if oldState.ExecutionInfo.Status != types.ExecutionStatusFailed {
+		t.Errorf("old run status = %v, want %v", oldState.ExecutionInfo.Status, types.ExecutionStatusFailed)
+	}
+}
+
+func TestResetExecutionPendingNode(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-5", RunID: "run-1"}
+
+	// 1 started, 2 workflow task scheduled, 3 started, 4 completed,
+	// 5 node scheduled, 6 node completed. Resetting at 6 leaves the node
+	// pending in the new run.
+	recordTestEvents(t, svc, key, startedEvent())
+	runWorkflowTask(t, svc, key, scheduleActivityCommand("fetch", "http-workers"))
+	recordTestEvents(t, svc, key, &types.HistoryEvent{
+		EventType:  types.EventTypeNodeCompleted,
+		Attributes: &types.NodeCompletedAttributes{NodeID: "fetch", ScheduledEventID: 5},
+	})
+
+	newRunID, err := svc.ResetExecution(ctx, key, "retry fetch", 6)
+	if err != nil {
+		t.Fatalf("ResetExecution() error = %v", err)
+	}
+	newKey := types.ExecutionKey{NamespaceID: key.NamespaceID, WorkflowID: key.WorkflowID, RunID: newRunID}
+
+	newState, err := stateStore.GetMutableState(ctx, newKey)
+	if err != nil {
+		t.Fatalf("GetMutableState(new) error = %v", err)
+	}
+	if _, ok := newState.GetPendingActivity(5); !ok {
+		t.Fatalf("new run has no pending activity at event 5")
+	}
+	if newState.WorkflowTask == nil || newState.WorkflowTask.ScheduledEventID != 6 {
+		t.Errorf("new run workflow task = %+v, want one scheduled at event 6", newState.WorkflowTask)
+	}
+
+	tasks, err := stateStore.GetTransferTasks(ctx, svc.GetShardIDForExecution(newKey), 0, 100)
+	if err != nil {
+		t.Fatalf("GetTransferTasks() error = %v", err)
+	}
+	var newRunTasks []*types.TransferTask
+	for _, task := range tasks {
+		if task.RunID == newRunID {
+			newRunTasks = append(newRunTasks, task)
+		}
+	}
+	want := []struct {
+		taskType         types.TransferTaskType
+		taskQueue        string
+		scheduledEventID int64
+	}{
+		{types.TransferTaskTypeActivityTask, "http-workers", 5},
+		{types.TransferTaskTypeWorkflowTask, "default", 6},
+	}
+	if len(newRunTasks) != len(want) {
+		t.Fatalf("got %d transfer tasks for the new run, want %d", len(newRunTasks), len(want))
+	}
+	for i, w := range want {
+		task := newRunTasks[i]
+		if task.TaskType != w.taskType || task.TaskQueue != w.taskQueue || task.ScheduledEventID != w.scheduledEventID {
+			t.Errorf("task %d = {%s %s %d}, want {%s %s %d}", i,
+				task.TaskType, task.TaskQueue, task.ScheduledEventID,
+				w.taskType, w.taskQueue, w.scheduledEventID)
+		}
+	}
+}
+
+func TestResetExecutionInvalidEventID(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-3", RunID: "run-1"}
+
+	recordTestEvents(t, svc, key, startedEvent())
+
+	// The started event and the first workflow task are events 1 and 2.
+	for _, resetEventID := range []int64{0, 1, 3, 10} {
+		_, err := svc.ResetExecution(context.Background(), key, "retry", resetEventID)
+		if !errors.Is(err, ErrInvalidResetEventID) {
+			t.Errorf("ResetExecution(%d) error = %v, want %v", resetEventID, err, ErrInvalidResetEventID)
+		}
+	}
+}
+
+func TestProcessEventsGeneratesTransferTasks(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-4", RunID: "run-1"}
+
+	// 1 started, 2 workflow task scheduled, 3 started, 4 completed,
+	// 5 node scheduled, 6 node completed, 7 workflow task scheduled.
+	recordTestEvents(t, svc, key, startedEvent())
+	runWorkflowTask(t, svc, key, scheduleActivityCommand("fetch", "http-workers"))
+	recordTestEvents(t, svc, key, &types.HistoryEvent{
+		EventType:  types.EventTypeNodeCompleted,
+		Attributes: &types.NodeCompletedAttributes{NodeID: "fetch", ScheduledEventID: 5},
+	})
+
+	tasks, err := stateStore.GetTransferTasks(ctx, svc.GetShardIDForExecution(key), 0, 10)
+	if err != nil {
+		t.Fatalf("GetTransferTasks() error = %v", err)
+	}
+
+	want := []struct {
+		taskType         types.TransferTaskType
+		taskQueue        string
+		scheduledEventID int64
+	}{
+		{types.TransferTaskTypeWorkflowTask, "default", 2},
+		{types.TransferTaskTypeActivityTask, "http-workers", 5},
+		{types.TransferTaskTypeWorkflowTask, "default", 7},
+	}
+	if len(tasks) != len(want) {
+		t.Fatalf("got %d transfer tasks, want %d", len(tasks), len(want))
+	}
+	for i, w := range want {
+		if tasks[i].TaskType != w.taskType || tasks[i].TaskQueue != w.taskQueue || tasks[i].ScheduledEventID != w.scheduledEventID {
+			t.Errorf("task %d = {%s %s %d}, want {%s %s %d}", i,
+				tasks[i].TaskType, tasks[i].TaskQueue, tasks[i].ScheduledEventID,
+				w.taskType, w.taskQueue, w.scheduledEventID)
+		}
+	}
+}
+
+func continueAsNewCommand(input string) *historyv1.Command {
+	attrs := &historyv1.ContinueAsNewWorkflowExecutionCommandAttributes{}
+	if input != "" {
+		attrs.Input = &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: []byte(input)}}}
+	}
+	return &historyv1.Command{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_CONTINUE_AS_NEW_WORKFLOW_EXECUTION,
+		Attributes: &historyv1.Command_ContinueAsNewWorkflowExecutionAttributes{
+			ContinueAsNewWorkflowExecutionAttributes: attrs,
+		},
+	}
+}
+
+func TestContinueAsNew(t *testing.T) {
+	ctx := context.Background()
+	svc, eventStore, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-poll", RunID: "run-1"}
+
+	recordTestEvents(t, svc, key, startedEvent())
+	runWorkflowTask(t, svc, key, continueAsNewCommand(`{"cursor":2}`))
+
+	first, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if first.ExecutionInfo.Status != types.ExecutionStatusContinuedAsNew {
+		t.Errorf("first run status = %v, want %v", first.ExecutionInfo.Status, types.ExecutionStatusContinuedAsNew)
+	}
+	if first.WorkflowTask != nil {
+		t.Errorf("first run has workflow task %+v pending, want none", first.WorkflowTask)
+	}
+	events, err := eventStore.GetEvents(ctx, key, 1, first.NextEventID-1)
+	if err != nil {
+		t.Fatalf("GetEvents() error = %v", err)
+	}
+	last := events[len(events)-1]
+	continued, ok := last.Attributes.(*types.ExecutionContinuedAsNewAttributes)
+	if last.EventType != types.EventTypeExecutionContinuedAsNew || !ok {
+		t.Fatalf("last event = %s, want ExecutionContinuedAsNew", last.EventType)
+	}
+	if continued.NewRunID == "" || continued.NewRunID != first.ExecutionInfo.NewRunID {
+		t.Errorf("NewRunID = %q, execution info NewRunID = %q", continued.NewRunID, first.ExecutionInfo.NewRunID)
+	}
+
+	secondKey := types.ExecutionKey{NamespaceID: key.NamespaceID, WorkflowID: key.WorkflowID, RunID: continued.NewRunID}
+	second, err := stateStore.GetMutableState(ctx, secondKey)
+	if err != nil {
+		t.Fatalf("GetMutableState(new run) error = %v", err)
+	}
+	info := second.ExecutionInfo
+	if info.Status != types.ExecutionStatusRunning {
+		t.Errorf("new run status = %v, want %v", info.Status, types.ExecutionStatusRunning)
+	}
+	if info.ContinuedFromRunID != key.RunID || info.FirstRunID != key.RunID {
+		t.Errorf("new run chain = {from %q, first %q}, want {from %q, first %q}", info.ContinuedFromRunID, info.FirstRunID, key.RunID, key.RunID)
+	}
+	if string(info.Input) != `{"cursor":2}` {
+		t.Errorf("new run input = %s, want %s", info.Input, `{"cursor":2}`)
+	}
+	if info.WorkflowTypeName != "order-sync" || info.TaskQueue != "default" || info.TaskTimeout != 10*time.Second {
+		t.Errorf("new run = {%s %s %v}, want the settings of the first run", info.WorkflowTypeName, info.TaskQueue, info.TaskTimeout)
+	}
+	if second.WorkflowTask == nil || second.WorkflowTask.ScheduledEventID != 2 {
+		t.Fatalf("new run workflow task = %+v, want one scheduled at event 2", second.WorkflowTask)
+	}
+
+	tasks, err := stateStore.GetTransferTasks(ctx, svc.GetShardIDForExecution(key), 0, 10)
+	if err != nil {
+		t.Fatalf("GetTransferTasks() error = %v", err)
+	}
+	if got := tasks[len(tasks)-1]; got.RunID != secondKey.RunID || got.TaskType != types.TransferTaskTypeWorkflowTask {
+		t.Errorf("last transfer task = {%s %s}, want the workflow task of run %s", got.RunID, got.TaskType, secondKey.RunID)
+	}
+
+	// A run continued without input carries its own input over, and the
+	// chain keeps pointing at the first run.
+	runWorkflowTask(t, svc, secondKey, continueAsNewCommand(""))
+	second, err = stateStore.GetMutableState(ctx, secondKey)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	thirdKey := types.ExecutionKey{NamespaceID: key.NamespaceID, WorkflowID: key.WorkflowID, RunID: second.ExecutionInfo.NewRunID}
+	third, err := stateStore.GetMutableState(ctx, thirdKey)
+	if err != nil {
+		t.Fatalf("GetMutableState(third run) error = %v", err)
+	}
+	if third.ExecutionInfo.FirstRunID != key.RunID || third.ExecutionInfo.ContinuedFromRunID != secondKey.RunID {
+		t.Errorf("third run chain = {from %q, first %q}, want {from %q, first %q}",
+			third.ExecutionInfo.ContinuedFromRunID, third.ExecutionInfo.FirstRunID, secondKey.RunID, key.RunID)
+	}
+	if string(third.ExecutionInfo.Input) != `{"cursor":2}` {
+		t.Errorf("third run input = %s, want %s", third.ExecutionInfo.Input, `{"cursor":2}`)
+	}
+}
+
+func TestProcessEventsSerializesConcurrentUpdates(t *testing.T) {
+	svc, _, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-5", RunID: "run-1"}
+
+	recordTestEvents(t, svc, key, startedEvent())
+
+	const updates = 8
+	errs := make(chan error, updates)
+	for i := 0; i < updates; i++ {
+		go func() {
+			errs <- svc.RecordEvent(context.Background(), key, &types.HistoryEvent{
+				EventType:  types.EventTypeNodeScheduled,
+				Timestamp:  time.Now(),
+				Attributes: &types.NodeScheduledAttributes{NodeID: "fetch", NodeType: "http", TaskQueue: "default"},
+			})
+		}()
+	}
+	for i := 0; i < updates; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("RecordEvent() error = %v", err)
+		}
+	}
+
+	state, err := stateStore.GetMutableState(context.Background(), key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	// The started event and its workflow task come before the updates.
+	if state.NextEventID != updates+3 {
+		t.Errorf("NextEventID = %d, want %d", state.NextEventID, updates+3)
+	}
+}
+
+func TestSignalWorkflowExecution(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-6", RunID: "run-1"}
+
+	recordTestEvents(t, svc, key, startedEvent())
+	runWorkflowTask(t, svc, key)
+
+	req := &historyv1.SignalWorkflowExecutionRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID},
+		SignalName:        "approved",
+		Input:             &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: []byte(`{"by":"ops"}`)}}},
+		RequestId:         "req-1",
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := svc.SignalWorkflowExecution(ctx, req); err != nil {
+			t.Fatalf("SignalWorkflowExecution() attempt %d error = %v", i+1, err)
+		}
+	}
+
+	state, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if state.SignalCount != 1 {
+		t.Errorf("SignalCount = %d, want 1", state.SignalCount)
+	}
+
+	events, err := svc.GetHistory(ctx, key, 1, state.NextEventID)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+	signalEvent := events[len(events)-2]
+	signal, ok := signalEvent.Attributes.(*types.SignalReceivedAttributes)
+	if !ok || signal.SignalName != "approved" || string(signal.Input) != `{"by":"ops"}` {
+		t.Errorf("event %d = %s %+v, want the approved signal", signalEvent.EventID, signalEvent.EventType, signalEvent.Attributes)
+	}
+
+	tasks, err := stateStore.GetTransferTasks(ctx, svc.GetShardIDForExecution(key), 0, 10)
+	if err != nil {
+		t.Fatalf("GetTransferTasks() error = %v", err)
+	}
+	last := tasks[len(tasks)-1]
+	if last.TaskType != types.TransferTaskTypeWorkflowTask || last.ScheduledEventID != signalEvent.EventID+1 {
+		t.Errorf("last transfer task = {%s %d}, want a workflow task scheduled after the signal", last.TaskType, last.ScheduledEventID)
+	}
+}
+
+func TestTimerCommands(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-7", RunID: "run-1"}
+	execution := &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID}
+	fire := func(timerID string) {
+		t.Helper()
+		_, err := svc.RecordTimerFired(ctx, &historyv1.RecordTimerFiredRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			TimerId:           timerID,
+		})
+		if err != nil {
+			t.Fatalf("RecordTimerFired(%s) error = %v", timerID, err)
+		}
+	}
+
+	recordTestEvents(t, svc, key, startedEvent())
+	runWorkflowTask(t, svc, key,
+		&historyv1.Command{
+			CommandType: historyv1.CommandType_COMMAND_TYPE_START_TIMER,
+			Attributes: &historyv1.Command_StartTimerAttributes{StartTimerAttributes: &historyv1.StartTimerCommandAttributes{
+				TimerId:            "sleep",
+				StartToFireTimeout: durationpb.New(time.Minute),
+			}},
+		},
+		&historyv1.Command{
+			CommandType: historyv1.CommandType_COMMAND_TYPE_START_TIMER,
+			Attributes: &historyv1.Command_StartTimerAttributes{StartTimerAttributes: &historyv1.StartTimerCommandAttributes{
+				TimerId:            "deadline",
+				StartToFireTimeout: durationpb.New(time.Hour),
+			}},
+		},
+	)
+
+	// The fired timer wakes the decider, which cancels the other one.
+	fire("sleep")
+	runWorkflowTask(t, svc, key, &historyv1.Command{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_CANCEL_TIMER,
+		Attributes: &historyv1.Command_CancelTimerAttributes{CancelTimerAttributes: &historyv1.CancelTimerCommandAttributes{
+			TimerId: "deadline",
+		}},
+	})
+
+	allTimerTasks, err := stateStore.GetTimerTasks(ctx, key)
+	if err != nil {
+		t.Fatalf("GetTimerTasks() error = %v", err)
+	}
+	// Timers the service arms for itself are covered by their own tests.
+	var timerTasks []*types.TimerTask
+	for _, task := range allTimerTasks {
+		if !isReservedTimerID(task.TimerID) {
+			timerTasks = append(timerTasks, task)
+		}
+	}
+	wantTasks := []struct {
+		timerID  string
+		canceled bool
+	}{
+		{"sleep", false},
+		{"deadline", false},
+		{"deadline", true},
+	}
+	if len(timerTasks) != len(wantTasks) {
+		t.Fatalf("got %d timer tasks, want %d", len(timerTasks), len(wantTasks))
+	}
+	for i, want := range wantTasks {
+		if timerTasks[i].TimerID != want.timerID || timerTasks[i].Canceled != want.canceled {
+			t.Errorf("timer task %d = {%s %v}, want {%s %v}", i, timerTasks[i].TimerID, timerTasks[i].Canceled, want.timerID, want.canceled)
+		}
+	}
+
+	// Timers that are no longer pending fire as no-ops.
+	fire("deadline")
+	fire("sleep")
+
+	state, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if len(state.PendingTimers) != 0 {
+		t.Errorf("PendingTimers = %v, want none", state.PendingTimers)
+	}
+
+	events, err := svc.GetHistory(ctx, key, 1, state.NextEventID)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+	var fired *types.HistoryEvent
+	var startedEventID int64
+	for _, event := range events {
+		switch attrs := event.Attributes.(type) {
+		case *types.TimerStartedAttributes:
+			if attrs.TimerID == "sleep" {
+				startedEventID = event.EventID
+			}
+		case *types.TimerFiredAttributes:
+			if fired != nil {
+				t.Errorf("timer %s fired twice", attrs.TimerID)
+			}
+			fired = event
+		}
+	}
+	if fired == nil {
+		t.Fatal("no TimerFired event recorded")
+	}
+	if got := fired.Attributes.(*types.TimerFiredAttributes).StartedEventID; got != startedEventID {
+		t.Errorf("TimerFired StartedEventID = %d, want %d", got, startedEventID)
+	}
+
+	tasks, err := stateStore.GetTransferTasks(ctx, svc.GetShardIDForExecution(key), 0, 10)
+	if err != nil {
+		t.Fatalf("GetTransferTasks() error = %v", err)
+	}
+	last := tasks[len(tasks)-1]
+	if last.TaskType != types.TransferTaskTypeWorkflowTask || last.ScheduledEventID != fired.EventID+1 {
+		t.Errorf("last transfer task = {%s %d}, want a workflow task scheduled after the fired timer", last.TaskType, last.ScheduledEventID)
+	}
+}
+
+func TestWorkflowTaskRejectsStaleDecisions(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-9", RunID: "run-1"}
+	execution := &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID}
+
+	recordTestEvents(t, svc, key, startedEvent())
+	const scheduledEventID = 2
+
+	start := func(requestID string) (int64, error) {
+		resp, err := svc.RecordWorkflowTaskStarted(ctx, &historyv1.RecordWorkflowTaskStartedRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			ScheduledEventId:  scheduledEventID,
+			RequestId:         requestID,
+		})
+		return resp.GetStartedEventId(), err
+	}
+	complete := func() error {
+		_, err := svc.RespondWorkflowTaskCompleted(ctx, &historyv1.RespondWorkflowTaskCompletedRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			TaskToken:         scheduledEventID,
+			Commands:          []*historyv1.Command{scheduleActivityCommand("notify", "default")},
+		})
+		return err
+	}
+
+	if err := complete(); !errors.Is(err, engine.ErrStaleWorkflowTask) {
+		t.Errorf("completing a task that was not started: error = %v, want %v", err, engine.ErrStaleWorkflowTask)
+	}
+
+	startedEventID, err := start("worker-a")
+	if err != nil {
+		t.Fatalf("RecordWorkflowTaskStarted(worker-a) error = %v", err)
+	}
+	if retried, err := start("worker-a"); err != nil || retried != startedEventID {
+		t.Errorf("retried start = %d, %v, want %d, nil", retried, err, startedEventID)
+	}
+	if _, err := start("worker-b"); !errors.Is(err, engine.ErrStaleWorkflowTask) {
+		t.Errorf("second worker start error = %v, want %v", err, engine.ErrStaleWorkflowTask)
+	}
+
+	if err := complete(); err != nil {
+		t.Fatalf("RespondWorkflowTaskCompleted() error = %v", err)
+	}
+	if err := complete(); !errors.Is(err, engine.ErrStaleWorkflowTask) {
+		t.Errorf("duplicate completion error = %v, want %v", err, engine.ErrStaleWorkflowTask)
+	}
+
+	state, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	events, err := svc.GetHistory(ctx, key, 1, state.NextEventID)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+	scheduled := 0
+	for _, event := range events {
+		if event.EventType == types.EventTypeNodeScheduled {
+			scheduled++
+		}
+	}
+	if scheduled != 1 {
+		t.Errorf("node scheduled %d times, want 1", scheduled)
+	}
+	if state.WorkflowTask != nil {
+		t.Errorf("WorkflowTask = %+v, want none pending", state.WorkflowTask)
+	}
+}
+
+func TestWorkflowTaskTimeout(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-10", RunID: "run-1"}
+	execution := &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID}
+
+	start := func(scheduledEventID int64) {
+		t.Helper()
+		_, err := svc.RecordWorkflowTaskStarted(ctx, &historyv1.RecordWorkflowTaskStartedRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			ScheduledEventId:  scheduledEventID,
+			RequestId:         "worker",
+		})
+		if err != nil {
+			t.Fatalf("RecordWorkflowTaskStarted(%d) error = %v", scheduledEventID, err)
+		}
+	}
+	fire := func(timerID string) {
+		t.Helper()
+		_, err := svc.RecordTimerFired(ctx, &historyv1.RecordTimerFiredRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			TimerId:           timerID,
+		})
+		if err != nil {
+			t.Fatalf("RecordTimerFired(%s) error = %v", timerID, err)
+		}
+	}
+	pendingTask := func() *types.WorkflowTaskInfo {
+		t.Helper()
+		state, err := stateStore.GetMutableState(ctx, key)
+		if err != nil {
+			t.Fatalf("GetMutableState() error = %v", err)
+		}
+		if state.WorkflowTask == nil {
+			t.Fatal("no workflow task pending")
+		}
+		return state.WorkflowTask
+	}
+	dispatched := func(scheduledEventID int64) bool {
+		t.Helper()
+		tasks, err := stateStore.GetTransferTasks(ctx, svc.GetShardIDForExecution(key), 0, 100)
+		if err != nil {
+			t.Fatalf("GetTransferTasks() error = %v", err)
+		}
+		for _, task := range tasks {
+			if task.TaskType == types.TransferTaskTypeWorkflowTask && task.ScheduledEventID == scheduledEventID {
+				return true
+			}
+		}
+		return false
+	}
+	timer := func(timerID string) *types.TimerTask {
+		t.Helper()
+		tasks, err := stateStore.GetTimerTasks(ctx, key)
+		if err != nil {
+			t.Fatalf("GetTimerTasks() error = %v", err)
+		}
+		var last *types.TimerTask
+		for _, task := range tasks {
+			if task.TimerID == timerID {
+				last = task
+			}
+		}
+		return last
+	}
+
+	recordTestEvents(t, svc, key, startedEvent())
+	start(2)
+	timeout := timer(workflowTaskTimeoutTimerID(2))
+	if timeout == nil || timeout.Canceled {
+		t.Fatalf("timeout timer = %+v, want a pending one", timeout)
+	}
+
+	// The timeout schedules the next attempt right away.
+	fire(workflowTaskTimeoutTimerID(2))
+	fire(workflowTaskTimeoutTimerID(2))
+	if task := pendingTask(); task.ScheduledEventID != 5 || task.Attempt != 2 {
+		t.Errorf("pending task = {%d attempt %d}, want {5 attempt 2}", task.ScheduledEventID, task.Attempt)
+	}
+	if !dispatched(5) {
+		t.Error("second attempt was not dispatched")
+	}
+	_, err := svc.RespondWorkflowTaskCompleted(ctx, &historyv1.RespondWorkflowTaskCompletedRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		TaskToken:         2,
+	})
+	if !errors.Is(err, engine.ErrStaleWorkflowTask) {
+		t.Errorf("completion after timeout error = %v, want %v", err, engine.ErrStaleWorkflowTask)
+	}
+
+	// The third attempt waits for its backoff timer.
+	start(5)
+	_, err = svc.RespondWorkflowTaskFailed(ctx, &historyv1.RespondWorkflowTaskFailedRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		TaskToken:         5,
+	})
+	if err != nil {
+		t.Fatalf("RespondWorkflowTaskFailed() error = %v", err)
+	}
+	if timeout := timer(workflowTaskTimeoutTimerID(5)); timeout == nil || !timeout.Canceled {
+		t.Errorf("timeout timer of failed task = %+v, want canceled", timeout)
+	}
+	if task := pendingTask(); task.ScheduledEventID != 8 || task.Attempt != 3 {
+		t.Errorf("pending task = {%d attempt %d}, want {8 attempt 3}", task.ScheduledEventID, task.Attempt)
+	}
+	if dispatched(8) {
+		t.Error("third attempt was dispatched before its backoff")
+	}
+	if backoff := timer(workflowTaskBackoffTimerID(8)); backoff == nil {
+		t.Fatal("no backoff timer for the third attempt")
+	}
+	fire(workflowTaskBackoffTimerID(8))
+	if !dispatched(8) {
+		t.Error("third attempt was not dispatched after its backoff")
+	}
+}
+
+func TestWorkflowTaskBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int32
+		want    time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{6, 8 * time.Second},
+		{100, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := workflowTaskBackoff(tt.attempt); got != tt.want {
+			t.Errorf("workflowTaskBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestActivityTimeouts(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-11", RunID: "run-1"}
+	execution := &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID}
+
+	fire := func(timerID string) {
+		t.Helper()
+		_, err := svc.RecordTimerFired(ctx, &historyv1.RecordTimerFiredRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			TimerId:           timerID,
+		})
+		if err != nil {
+			t.Fatalf("RecordTimerFired(%s) error = %v", timerID, err)
+		}
+	}
+	start := func(scheduledEventID int64, requestID string) (int64, error) {
+		resp, err := svc.RecordActivityTaskStarted(ctx, &historyv1.RecordActivityTaskStartedRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			ScheduledEventId:  scheduledEventID,
+			RequestId:         requestID,
+		})
+		return resp.GetStartedEventId(), err
+	}
+	timer := func(timerID string) *types.TimerTask {
+		t.Helper()
+		tasks, err := stateStore.GetTimerTasks(ctx, key)
+		if err != nil {
+			t.Fatalf("GetTimerTasks() error = %v", err)
+		}
+		var last *types.TimerTask
+		for _, task := range tasks {
+			if task.TimerID == timerID {
+				last = task
+			}
+		}
+		return last
+	}
+
+	// 5 schedules "fetch", which heartbeats, and 6 schedules "hang", which no
+	// worker picks up in time.
+	fetch := scheduleActivityCommand("fetch", "default")
+	fetch.GetScheduleActivityTaskAttributes().HeartbeatTimeout = durationpb.New(time.Minute)
+	hang := scheduleActivityCommand("hang", "default")
+	hang.GetScheduleActivityTaskAttributes().ScheduleToStartTimeout = durationpb.New(time.Millisecond)
+	recordTestEvents(t, svc, key, startedEvent())
+	runWorkflowTask(t, svc, key, fetch, hang)
+
+	startedEventID, err := start(5, "worker-a")
+	if err != nil {
+		t.Fatalf("RecordActivityTaskStarted() error = %v", err)
+	}
+	if retried, err := start(5, "worker-a"); err != nil || retried != startedEventID {
+		t.Errorf("retried start = %d, %v, want %d, nil", retried, err, startedEventID)
+	}
+	if _, err := start(5, "worker-b"); !errors.Is(err, engine.ErrActivityStarted) {
+		t.Errorf("second worker start error = %v, want %v", err, engine.ErrActivityStarted)
+	}
+	for _, timeoutType := range []string{types.TimeoutTypeStartToClose, types.TimeoutTypeHeartbeat} {
+		if task := timer(activityTimeoutTimerID(5, timeoutType)); task == nil || task.Canceled {
+			t.Errorf("%s timer = %+v, want a pending one", timeoutType, task)
+		}
+	}
+
+	// A heartbeat leaves the timer where it is. When the timer fires before
+	// the deadline the heartbeat moved, it is re-armed instead of timing the
+	// node out.
+	armed := timer(activityTimeoutTimerID(5, types.TimeoutTypeHeartbeat)).FireTime
+	_, err = svc.RecordActivityTaskHeartbeat(ctx, &historyv1.RecordActivityTaskHeartbeatRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		ScheduledEventId:  5,
+	})
+	if err != nil {
+		t.Fatalf("RecordActivityTaskHeartbeat() error = %v", err)
+	}
+	if task := timer(activityTimeoutTimerID(5, types.TimeoutTypeHeartbeat)); !task.FireTime.Equal(armed) {
+		t.Errorf("heartbeat timer fires at %v after the heartbeat, want %v", task.FireTime, armed)
+	}
+	fire(activityTimeoutTimerID(5, types.TimeoutTypeHeartbeat))
+	if task := timer(activityTimeoutTimerID(5, types.TimeoutTypeHeartbeat)); task.Canceled || task.FireTime.Before(armed) {
+		t.Errorf("heartbeat timer = %+v, want re-armed after %v", task, armed)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	fire(activityTimeoutTimerID(6, types.TimeoutTypeScheduleToStart))
+	if _, err := start(6, "worker-c"); !errors.Is(err, engine.ErrActivityNotFound) {
+		t.Errorf("start after timeout error = %v, want %v", err, engine.ErrActivityNotFound)
+	}
+
+	state, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if _, ok := state.PendingActivities[5]; !ok {
+		t.Error("fetch is no longer pending")
+	}
+	if result := state.CompletedNodes["hang"]; result == nil || result.FailureReason == "" {
+		t.Errorf("hang result = %+v, want a timeout failure", result)
+	}
+	if state.WorkflowTask == nil {
+		t.Error("the timeout did not schedule a workflow task")
+	}
+
+	events, err := svc.GetHistory(ctx, key, 1, state.NextEventID)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+	var timedOut []*types.NodeTimedOutAttributes
+	for _, event := range events {
+		if attrs, ok := event.Attributes.(*types.NodeTimedOutAttributes); ok {
+			timedOut = append(timedOut, attrs)
+		}
+	}
+	if len(timedOut) != 1 || timedOut[0].NodeID != "hang" || timedOut[0].TimeoutType != types.TimeoutTypeScheduleToStart {
+		t.Errorf("timed out nodes = %+v, want hang after %s", timedOut, types.TimeoutTypeScheduleToStart)
+	}
+}
+
+func TestActivityHeartbeatDetails(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-12", RunID: "run-1"}
+	execution := &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID}
+
+	// "copy" has no heartbeat timeout; its details are kept all the same.
+	recordTestEvents(t, svc, key, startedEvent())
+	runWorkflowTask(t, svc, key, scheduleActivityCommand("copy", "default"))
+
+	startReq := &historyv1.RecordActivityTaskStartedRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		ScheduledEventId:  5,
+		RequestId:         "worker-a",
+	}
+	if _, err := svc.RecordActivityTaskStarted(ctx, startReq); err != nil {
+		t.Fatalf("RecordActivityTaskStarted() error = %v", err)
+	}
+	persisted := func() *types.ActivityInfo {
+		t.Helper()
+		state, err := stateStore.GetMutableState(ctx, key)
+		if err != nil {
+			t.Fatalf("GetMutableState() error = %v", err)
+		}
+		return state.PendingActivities[5]
+	}
+	_, err := svc.RecordActivityTaskHeartbeat(ctx, &historyv1.RecordActivityTaskHeartbeatRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		ScheduledEventId:  5,
+		Details:           &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: []byte(`{"processed":3}`)}}},
+	})
+	if err != nil {
+		t.Fatalf("RecordActivityTaskHeartbeat() error = %v", err)
+	}
+
+	// The heartbeat writes nothing, but a retried start already sees its
+	// details.
+	if ai := persisted(); ai == nil || len(ai.HeartbeatDetails) != 0 {
+		t.Errorf("persisted activity = %+v, want no heartbeat details yet", ai)
+	}
+	resp, err := svc.RecordActivityTaskStarted(ctx, startReq)
+	if err != nil {
+		t.Fatalf("retried RecordActivityTaskStarted() error = %v", err)
+	}
+	if got := string(firstPayload(resp.GetHeartbeatDetails())); got != `{"processed":3}` {
+		t.Errorf("HeartbeatDetails = %q, want %q", got, `{"processed":3}`)
+	}
+
+	// The next update of the execution persists them.
+	_, err = svc.SignalWorkflowExecution(ctx, &historyv1.SignalWorkflowExecutionRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		SignalName:        "progress",
+	})
+	if err != nil {
+		t.Fatalf("SignalWorkflowExecution() error = %v", err)
+	}
+	if ai := persisted(); ai == nil || string(ai.HeartbeatDetails) != `{"processed":3}` || ai.LastHeartbeat.IsZero() {
+		t.Errorf("persisted activity = %+v, want the heartbeat", ai)
+	}
+
+	_, err = svc.RecordActivityTaskHeartbeat(ctx, &historyv1.RecordActivityTaskHeartbeatRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		ScheduledEventId:  6,
+	})
+	if !errors.Is(err, engine.ErrActivityNotFound) {
+		t.Errorf("heartbeat of unknown activity error = %v, want %v", err, engine.ErrActivityNotFound)
+	}
+}
+
+func TestActivityRetry(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-13", RunID: "run-1"}
+	execution := &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID}
+
+	start := func(scheduledEventID int64, requestID string) *historyv1.RecordActivityTaskStartedResponse {
+		t.Helper()
+		resp, err := svc.RecordActivityTaskStarted(ctx, &historyv1.RecordActivityTaskStartedRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			ScheduledEventId:  scheduledEventID,
+			RequestId:         requestID,
+		})
+		if err != nil {
+			t.Fatalf("RecordActivityTaskStarted(%d) error = %v", scheduledEventID, err)
+		}
+		return resp
+	}
+	fail := func(scheduledEventID int64, errorType string) {
+		t.Helper()
+		_, err := svc.RespondActivityTaskFailed(ctx, &historyv1.RespondActivityTaskFailedRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			ScheduledEventId:  scheduledEventID,
+			Failure:           &commonv1.Failure{Message: "boom", ErrorType: errorType},
+		})
+		if err != nil {
+			t.Fatalf("RespondActivityTaskFailed(%d) error = %v", scheduledEventID, err)
+		}
+	}
+	failures := func() map[string]int32 {
+		t.Helper()
+		state, err := stateStore.GetMutableState(ctx, key)
+		if err != nil {
+			t.Fatalf("GetMutableState() error = %v", err)
+		}
+		events, err := svc.GetHistory(ctx, key, 1, state.NextEventID)
+		if err != nil {
+			t.Fatalf("GetHistory() error = %v", err)
+		}
+		got := make(map[string]int32)
+		for _, event := range events {
+			if attrs, ok := event.Attributes.(*types.NodeFailedAttributes); ok {
+				got[attrs.NodeID] = attrs.RetryState
+			}
+		}
+		return got
+	}
+
+	// 5 schedules "flaky", which gets two attempts, and 6 schedules "strict",
+	// which fails for good on its first non-retryable error.
+	flaky := scheduleActivityCommand("flaky", "default")
+	flaky.GetScheduleActivityTaskAttributes().RetryPolicy = &commonv1.RetryPolicy{
+		InitialInterval: durationpb.New(time.Millisecond),
+		MaxAttempts:     2,
+	}
+	strict := scheduleActivityCommand("strict", "default")
+	strict.GetScheduleActivityTaskAttributes().RetryPolicy = &commonv1.RetryPolicy{MaxAttempts: 5}
+	recordTestEvents(t, svc, key, startedEvent())
+	runWorkflowTask(t, svc, key, flaky, strict)
+
+	if attempt := start(5, "worker-a").GetAttempt(); attempt != 1 {
+		t.Errorf("first attempt = %d, want 1", attempt)
+	}
+	start(6, "worker-a")
+	fail(5, "RETRYABLE")
+	fail(6, "NON_RETRYABLE")
+
+	if got := failures(); len(got) != 1 || got["strict"] != types.RetryStateNonRetryableFailure {
+		t.Errorf("failed nodes = %v, want only strict as non-retryable", got)
+	}
+	state, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if ai := state.PendingActivities[5]; ai == nil || ai.Attempt != 2 || ai.StartedEventID != 0 {
+		t.Fatalf("flaky = %+v, want a second attempt that has not started", ai)
+	}
+
+	// The next attempt goes out when its backoff timer fires.
+	transferTasks := func() int {
+		t.Helper()
+		tasks, err := stateStore.GetTransferTasks(ctx, svc.GetShardIDForExecution(key), 0, 100)
+		if err != nil {
+			t.Fatalf("GetTransferTasks() error = %v", err)
+		}
+		n := 0
+		for _, task := range tasks {
+			if task.TaskType == types.TransferTaskTypeActivityTask && task.ScheduledEventID == 5 {
+				n++
+			}
+		}
+		return n
+	}
+	if n := transferTasks(); n != 1 {
+		t.Errorf("activity tasks before the retry = %d, want 1", n)
+	}
+	_, err = svc.RecordTimerFired(ctx, &historyv1.RecordTimerFiredRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		TimerId:           activityRetryTimerID(5),
+	})
+	if err != nil {
+		t.Fatalf("RecordTimerFired() error = %v", err)
+	}
+	if n := transferTasks(); n != 2 {
+		t.Errorf("activity tasks after the retry = %d, want 2", n)
+	}
+
+	if attempt := start(5, "worker-b").GetAttempt(); attempt != 2 {
+		t.Errorf("second attempt = %d, want 2", attempt)
+	}
+	fail(5, "RETRYABLE")
+	if got := failures(); got["flaky"] != types.RetryStateMaximumAttemptsReached {
+		t.Errorf("failed nodes = %v, want flaky out of attempts", got)
+	}
+}
+
+func TestActivityRetryDelay(t *testing.T) {
+	policy := &types.RetryPolicy{
+		InitialInterval:    time.Second,
+		BackoffCoefficient: 2,
+		MaxInterval:        5 * time.Second,
+		MaxAttempts:        10,
+		NonRetryableErrors: []string{"bad credentials"},
+	}
+
+	tests := []struct {
+		name      string
+		policy    *types.RetryPolicy
+		attempt   int32
+		errorType string
+		message   string
+		// wantDelay is the delay before jitter, which is within 20% of it.
+		wantDelay time.Duration
+		wantState int32
+	}{
+		{"no policy", nil, 1, "RETRYABLE", "", 0, types.RetryStateRetryPolicyNotSet},
+		{"first retry", policy, 1, "RETRYABLE", "", time.Second, types.RetryStateInProgress},
+		{"unclassified", policy, 2, "", "", 2 * time.Second, types.RetryStateInProgress},
+		{"capped", policy, 5, "RETRYABLE", "", 5 * time.Second, types.RetryStateInProgress},
+		{"non-retryable type", policy, 1, "NON_RETRYABLE", "", 0, types.RetryStateNonRetryableFailure},
+		{"timeout", policy, 1, "TIMEOUT", "", 0, types.RetryStateNonRetryableFailure},
+		{"non-retryable message", policy, 1, "RETRYABLE", "bad credentials", 0, types.RetryStateNonRetryableFailure},
+		{"out of attempts", &types.RetryPolicy{MaxAttempts: 3}, 3, "RETRYABLE", "", 0, types.RetryStateMaximumAttemptsReached},
+		{"defaults", &types.RetryPolicy{}, 2, "RETRYABLE", "", 2 * time.Second, types.RetryStateInProgress},
+		{"default maximum attempts", &types.RetryPolicy{}, 3, "RETRYABLE", "", 0, types.RetryStateMaximumAttemptsReached},
+		{"more attempts", &types.RetryPolicy{MaxAttempts: 10}, 5, "RETRYABLE", "", 16 * time.Second, types.RetryStateInProgress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ai := &types.ActivityInfo{Attempt: tt.attempt, RetryPolicy: tt.policy}
+			delay, state := activityRetryDelay(ai, tt.errorType, tt.message)
+			minDelay, maxDelay := tt.wantDelay*8/10, tt.wantDelay*12/10
+			if state != tt.wantState || delay < minDelay || delay > maxDelay {
+				t.Errorf("activityRetryDelay() = %v, %d, want %v±20%%, %d", delay, state, tt.wantDelay, tt.wantState)
+			}
+		})
+	}
+}
+
+func startChildCommand(nodeID string, policy commonv1.ParentClosePolicy) *historyv1.Command {
+	return &historyv1.Command{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_START_CHILD_WORKFLOW_EXECUTION,
+		Attributes: &historyv1.Command_StartChildWorkflowExecutionAttributes{
+			StartChildWorkflowExecutionAttributes: &historyv1.StartChildWorkflowExecutionCommandAttributes{
+				NodeId:            nodeID,
+				Input:             &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: []byte(`{"child":true}`)}}},
+				ParentClosePolicy: policy,
+			},
+		},
+	}
+}
+
+func completeWorkflowCommand(result string) *historyv1.Command {
+	return &historyv1.Command{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_COMPLETE_WORKFLOW_EXECUTION,
+		Attributes: &historyv1.Command_CompleteWorkflowExecutionAttributes{
+			CompleteWorkflowExecutionAttributes: &historyv1.CompleteWorkflowExecutionCommandAttributes{
+				Result: &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: []byte(result)}}},
+			},
+		},
+	}
+}
+
+// executeTransferTasks runs the transfer tasks of the given type that the run
+// of key produced, the way the transfer queue does, and returns how many
+// there were.
+func executeTransferTasks(t *testing.T, svc *Service, stateStore *store.MemoryExecutionStore, key types.ExecutionKey, taskType types.TransferTaskType) int {
+	t.Helper()
+	ctx := context.Background()
+
+	tasks, err := stateStore.GetTransferTasks(ctx, svc.GetShardIDForExecution(key), 0, 100)
+	if err != nil {
+		t.Fatalf("GetTransferTasks() error = %v", err)
+	}
+	n := 0
+	for _, task := range tasks {
+		if task.RunID != key.RunID || task.TaskType != taskType {
+			continue
+		}
+		if err := svc.ExecuteTransferTask(ctx, task); err != nil {
+			t.Fatalf("ExecuteTransferTask(%s) error = %v", task.TaskType, err)
+		}
+		n++
+	}
+	return n
+}
+
+func TestChildExecution(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	parentKey := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-parent", RunID: "run-1"}
+
+	// 1 started, 2 workflow task scheduled, 3 started, 4 completed,
+	// 5 child initiated.
+	recordTestEvents(t, svc, parentKey, startedEvent())
+	runWorkflowTask(t, svc, parentKey, startChildCommand("sub", commonv1.ParentClosePolicy_PARENT_CLOSE_POLICY_UNSPECIFIED))
+
+	parent, err := stateStore.GetMutableState(ctx, parentKey)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	child, ok := parent.GetPendingChildExecution(5)
+	if !ok {
+		t.Fatal("child initiated at event 5 is not pending")
+	}
+	if child.WorkflowID != "wf-parent/sub" || child.RunID == "" || child.ParentClosePolicy != types.ParentClosePolicyTerminate {
+		t.Errorf("pending child = %+v, want wf-parent/sub with a run ID and the terminate policy", child)
+	}
+	childKey := types.ExecutionKey{NamespaceID: "default", WorkflowID: child.WorkflowID, RunID: child.RunID}
+
+	// Starting the child twice creates it once.
+	for i := 0; i < 2; i++ {
+		if n := executeTransferTasks(t, svc, stateStore, parentKey, types.TransferTaskTypeStartChildExecution); n != 1 {
+			t.Fatalf("got %d start child tasks, want 1", n)
+		}
+	}
+	started, err := stateStore.GetMutableState(ctx, childKey)
+	if err != nil {
+		t.Fatalf("GetMutableState(child) error = %v", err)
+	}
+	info := started.ExecutionInfo
+	if info.Status != types.ExecutionStatusRunning || info.ParentExecution == nil || *info.ParentExecution != parentKey || info.ParentInitiatedEventID != 5 {
+		t.Errorf("child = {%v parent %v initiated %d}, want running child of %v initiated at 5",
+			info.Status, info.ParentExecution, info.ParentInitiatedEventID, parentKey)
+	}
+	if info.WorkflowTypeName != "order-sync" || info.TaskQueue != "default" || string(info.Input) != `{"child":true}` {
+		t.Errorf("child = {%s %s %s}, want the parent's type and queue and the command input", info.WorkflowTypeName, info.TaskQueue, info.Input)
+	}
+	if started.NextEventID != 3 {
+		t.Errorf("child NextEventID = %d, want 3", started.NextEventID)
+	}
+	parent, err = stateStore.GetMutableState(ctx, parentKey)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if child, _ := parent.GetPendingChildExecution(5); child.StartedEventID != 6 || parent.NextEventID != 7 {
+		t.Errorf("parent = {child started %d, next %d}, want the child started at event 6", child.StartedEventID, parent.NextEventID)
+	}
+
+	// The child's result is delivered to the parent's decider as the node
+	// result; a repeated report is dropped.
+	runWorkflowTask(t, svc, childKey, completeWorkflowCommand(`{"ok":true}`))
+	for i := 0; i < 2; i++ {
+		if n := executeTransferTasks(t, svc, stateStore, childKey, types.TransferTaskTypeRecordChildCompletion); n != 1 {
+			t.Fatalf("got %d record child completion tasks, want 1", n)
+		}
+	}
+	parent, err = stateStore.GetMutableState(ctx, parentKey)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if len(parent.PendingChildExecutions) != 0 {
+		t.Errorf("parent has %d pending children, want none", len(parent.PendingChildExecutions))
+	}
+	result, ok := parent.GetCompletedNode("sub")
+	if !ok || string(result.Output) != `{"ok":true}` {
+		t.Errorf("node result = %+v, want the child's result", result)
+	}
+	if parent.NextEventID != 9 || parent.WorkflowTask == nil || parent.WorkflowTask.ScheduledEventID != 8 {
+		t.Errorf("parent = {next %d, workflow task %+v}, want the completion at 7 and a workflow task at 8", parent.NextEventID, parent.WorkflowTask)
+	}
+}
+
+func TestParentClosePolicy(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	parentKey := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-parent", RunID: "run-1"}
+
+	// The children are initiated at events 5, 6 and 7.
+	recordTestEvents(t, svc, parentKey, startedEvent())
+	runWorkflowTask(t, svc, parentKey,
+		startChildCommand("terminated", commonv1.ParentClosePolicy_PARENT_CLOSE_POLICY_TERMINATE),
+		startChildCommand("abandoned", commonv1.ParentClosePolicy_PARENT_CLOSE_POLICY_ABANDON),
+		startChildCommand("canceled", commonv1.ParentClosePolicy_PARENT_CLOSE_POLICY_REQUEST_CANCEL),
+	)
+	executeTransferTasks(t, svc, stateStore, parentKey, types.TransferTaskTypeStartChildExecution)
+
+	parent, err := stateStore.GetMutableState(ctx, parentKey)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	terminated, _ := parent.GetPendingChildExecution(5)
+	abandoned, _ := parent.GetPendingChildExecution(6)
+	canceled, _ := parent.GetPendingChildExecution(7)
+	terminatedKey := types.ExecutionKey{NamespaceID: "default", WorkflowID: terminated.WorkflowID, RunID: terminated.RunID}
+	abandonedKey := types.ExecutionKey{NamespaceID: "default", WorkflowID: abandoned.WorkflowID, RunID: abandoned.RunID}
+	canceledKey := types.ExecutionKey{NamespaceID: "default", WorkflowID: canceled.WorkflowID, RunID: canceled.RunID}
+
+	_, err = svc.TerminateWorkflowExecution(ctx, &historyv1.TerminateWorkflowExecutionRequest{
+		Namespace:         parentKey.NamespaceID,
+		WorkflowExecution: &commonv1.WorkflowExecution{WorkflowId: parentKey.WorkflowID, RunId: parentKey.RunID},
+		Reason:            "test",
+	})
+	if err != nil {
+		t.Fatalf("TerminateWorkflowExecution() error = %v", err)
+	}
+	if n := executeTransferTasks(t, svc, stateStore, parentKey, types.TransferTaskTypeApplyParentClosePolicy); n != 2 {
+		t.Fatalf("got %d parent close policy tasks, want 2", n)
+	}
+
+	// The child asked to cancel keeps running until its decider closes it.
+	for _, tc := range []struct {
+		key             types.ExecutionKey
+		want            types.ExecutionStatus
+		cancelRequested bool
+	}{
+		{terminatedKey, types.ExecutionStatusTerminated, false},
+		{abandonedKey, types.ExecutionStatusRunning, false},
+		{canceledKey, types.ExecutionStatusRunning, true},
+	} {
+		state, err := stateStore.GetMutableState(ctx, tc.key)
+		if err != nil {
+			t.Fatalf("GetMutableState(%s) error = %v", tc.key.WorkflowID, err)
+		}
+		if state.ExecutionInfo.Status != tc.want {
+			t.Errorf("%s status = %v, want %v", tc.key.WorkflowID, state.ExecutionInfo.Status, tc.want)
+		}
+		if state.ExecutionInfo.CancelRequested != tc.cancelRequested {
+			t.Errorf("%s CancelRequested = %v, want %v", tc.key.WorkflowID, state.ExecutionInfo.CancelRequested, tc.cancelRequested)
+		}
+	}
+
+	// The terminated child reports to its closed parent, which ignores it.
+	if n := executeTransferTasks(t, svc, stateStore, terminatedKey, types.TransferTaskTypeRecordChildCompletion); n != 1 {
+		t.Fatalf("got %d record child completion tasks, want 1", n)
+	}
+	closed, err := stateStore.GetMutableState(ctx, parentKey)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if closed.NextEventID != parent.NextEventID+1 {
+		t.Errorf("closed parent NextEventID = %d, want %d", closed.NextEventID, parent.NextEventID+1)
+	}
+}
+
+func cancelWorkflowCommand() *historyv1.Command {
+	return &historyv1.Command{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_CANCEL_WORKFLOW_EXECUTION,
+		Attributes: &historyv1.Command_CancelWorkflowExecutionAttributes{
+			CancelWorkflowExecutionAttributes: &historyv1.CancelWorkflowExecutionCommandAttributes{},
+		},
+	}
+}
+
+func TestRequestCancelWorkflowExecution(t *testing.T) {
+	ctx := context.Background()
+	svc, eventStore, stateStore := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-cancel", RunID: "run-1"}
+	execution := &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID}
+
+	// "running" (event 5) is picked up by a worker, "queued" (event 6) is not.
+	recordTestEvents(t, svc, key, startedEvent())
+	runWorkflowTask(t, svc, key, scheduleActivityCommand("running", "default"), scheduleActivityCommand("queued", "default"))
+	_, err := svc.RecordActivityTaskStarted(ctx, &historyv1.RecordActivityTaskStartedRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		ScheduledEventId:  5,
+		RequestId:         "worker-a",
+	})
+	if err != nil {
+		t.Fatalf("RecordActivityTaskStarted() error = %v", err)
+	}
+	heartbeat := &historyv1.RecordActivityTaskHeartbeatRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		ScheduledEventId:  5,
+	}
+	resp, err := svc.RecordActivityTaskHeartbeat(ctx, heartbeat)
+	if err != nil || resp.GetCancelRequested() {
+		t.Fatalf("RecordActivityTaskHeartbeat() = %v, %v; want no cancel", resp, err)
+	}
+
+	cancelReq := &historyv1.RequestCancelWorkflowExecutionRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		Reason:            "user",
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := svc.RequestCancelWorkflowExecution(ctx, cancelReq); err != nil {
+			t.Fatalf("RequestCancelWorkflowExecution() error = %v", err)
+		}
+	}
+
+	events, err := eventStore.GetEvents(ctx, key, 8, 100)
+	if err != nil {
+		t.Fatalf("GetEvents() error = %v", err)
+	}
+	wantTypes := []types.EventType{types.EventTypeExecutionCancelRequested, types.EventTypeNodeCanceled, types.EventTypeWorkflowTaskScheduled}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("got %d events after the cancel request, want %d", len(events), len(wantTypes))
+	}
+	for i, want := range wantTypes {
+		if events[i].EventType != want {
+			t.Errorf("event %d = %s, want %s", events[i].EventID, events[i].EventType, want)
+		}
+	}
+	if attrs, ok := events[1].Attributes.(*types.NodeCanceledAttributes); !ok || attrs.ScheduledEventID != 6 || attrs.NodeID != "queued" {
+		t.Errorf("canceled node = %+v, want the queued node", events[1].Attributes)
+	}
+
+	resp, err = svc.RecordActivityTaskHeartbeat(ctx, heartbeat)
+	if err != nil || !resp.GetCancelRequested() {
+		t.Fatalf("RecordActivityTaskHeartbeat() = %v, %v; want cancel requested", resp, err)
+	}
+	_, err = svc.RespondActivityTaskCanceled(ctx, &historyv1.RespondActivityTaskCanceledRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		ScheduledEventId:  5,
+	})
+	if err != nil {
+		t.Fatalf("RespondActivityTaskCanceled() error = %v", err)
+	}
+
+	// The decider runs the cleanup before it closes the run.
+	runWorkflowTask(t, svc, key, scheduleActivityCommand("cleanup", "default"))
+	state, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if state.ExecutionInfo.Status != types.ExecutionStatusRunning || len(state.PendingActivities) != 1 {
+		t.Fatalf("status = %v with %d pending activities, want running cleanup", state.ExecutionInfo.Status, len(state.PendingActivities))
+	}
+	for id := range state.PendingActivities {
+		_, err := svc.RespondActivityTaskCompleted(ctx, &historyv1.RespondActivityTaskCompletedRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			ScheduledEventId:  id,
+		})
+		if err != nil {
+			t.Fatalf("RespondActivityTaskCompleted() error = %v", err)
+		}
+	}
+	runWorkflowTask(t, svc, key, cancelWorkflowCommand())
+
+	state, err = stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if state.ExecutionInfo.Status != types.ExecutionStatusCanceled {
+		t.Errorf("status = %v, want %v", state.ExecutionInfo.Status, types.ExecutionStatusCanceled)
+	}
+}
+
+func TestExecutionTimeout(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	namespaces := controlplane.NewService(controlplane.Config{})
+	if err := namespaces.CreateNamespace(ctx, &controlplane.NamespaceConfig{Name: "default", WorkflowExecutionTTL: time.Hour}); err != nil {
+		t.Fatalf("CreateNamespace() error = %v", err)
+	}
+	svc.namespaces = namespaces
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-ttl", RunID: "run-1"}
+	execution := &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID}
+	fire := func(timerID string) {
+		t.Helper()
+		_, err := svc.RecordTimerFired(ctx, &historyv1.RecordTimerFiredRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			TimerId:           timerID,
+		})
+		if err != nil {
+			t.Fatalf("RecordTimerFired(%s) error = %v", timerID, err)
+		}
+	}
+
+	// The run has a run timeout of its own and gets the namespace's TTL as
+	// its execution timeout.
+	started := startedEvent()
+	started.Attributes.(*types.ExecutionStartedAttributes).RunTimeout = 10 * time.Minute
+	recordTestEvents(t, svc, key, started)
+	state, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	info := state.ExecutionInfo
+	if info.ExecutionTimeout != time.Hour || !info.ExecutionExpirationTime.Equal(info.StartTime.Add(time.Hour)) {
+		t.Errorf("execution timeout = {%v %v}, want an hour from %v", info.ExecutionTimeout, info.ExecutionExpirationTime, info.StartTime)
+	}
+	timerTasks, err := stateStore.GetTimerTasks(ctx, key)
+	if err != nil {
+		t.Fatalf("GetTimerTasks() error = %v", err)
+	}
+	armed := make(map[string]time.Time)
+	for _, task := range timerTasks {
+		armed[task.TimerID] = task.FireTime
+	}
+	if got := armed[executionTimeoutTimerID]; !got.Equal(info.ExecutionExpirationTime) {
+		t.Errorf("execution timeout timer fires at %v, want %v", got, info.ExecutionExpirationTime)
+	}
+	if got := armed[runTimeoutTimerID]; !got.Equal(info.StartTime.Add(10 * time.Minute)) {
+		t.Errorf("run timeout timer fires at %v, want %v", got, info.StartTime.Add(10*time.Minute))
+	}
+
+	runWorkflowTask(t, svc, key,
+		scheduleActivityCommand("fetch", "default"),
+		&historyv1.Command{
+			CommandType: historyv1.CommandType_COMMAND_TYPE_START_TIMER,
+			Attributes: &historyv1.Command_StartTimerAttributes{StartTimerAttributes: &historyv1.StartTimerCommandAttributes{
+				TimerId:            "sleep",
+				StartToFireTimeout: durationpb.New(time.Hour),
+			}},
+		},
+	)
+	state, err = stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	firstEventID := state.NextEventID
+
+	// The run timer closes the run, canceling what is still pending.
+	fire(runTimeoutTimerID)
+	fire(runTimeoutTimerID)
+	state, err = stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if state.ExecutionInfo.Status != types.ExecutionStatusTimedOut {
+		t.Errorf("status = %v, want %v", state.ExecutionInfo.Status, types.ExecutionStatusTimedOut)
+	}
+	if len(state.PendingActivities) != 0 || len(state.PendingTimers) != 0 || state.WorkflowTask != nil {
+		t.Errorf("pending = {%d activities, %d timers, workflow task %+v}, want none", len(state.PendingActivities), len(state.PendingTimers), state.WorkflowTask)
+	}
+	events, err := svc.GetHistory(ctx, key, firstEventID, state.NextEventID-1)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+	wantTypes := []types.EventType{types.EventTypeTimerCanceled, types.EventTypeNodeCanceled, types.EventTypeExecutionTimedOut}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("got %d events after the timeout, want %d", len(events), len(wantTypes))
+	}
+	for i, want := range wantTypes {
+		if events[i].EventType != want {
+			t.Errorf("event %d = %s, want %s", events[i].EventID, events[i].EventType, want)
+		}
+	}
+	if got := events[2].Attributes.(*types.ExecutionTimedOutAttributes).TimeoutType; got != types.TimeoutTypeRun {
+		t.Errorf("TimeoutType = %q, want %q", got, types.TimeoutTypeRun)
+	}
+
+	timerTasks, err = stateStore.GetTimerTasks(ctx, key)
+	if err != nil {
+		t.Fatalf("GetTimerTasks() error = %v", err)
+	}
+	canceled := make(map[string]bool)
+	for _, task := range timerTasks {
+		if task.Canceled {
+			canceled[task.TimerID] = true
+		}
+	}
+	for _, timerID := range []string{"sleep", executionTimeoutTimerID} {
+		if !canceled[timerID] {
+			t.Errorf("timer %s was not canceled", timerID)
+		}
+	}
+
+	// A run continued as new keeps the expiration time of its execution.
+	key = types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-ttl-continued", RunID: "run-1"}
+	recordTestEvents(t, svc, key, startedEvent())
+	runWorkflowTask(t, svc, key, continueAsNewCommand(""))
+	first, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	second, err := stateStore.GetMutableState(ctx, types.ExecutionKey{NamespaceID: key.NamespaceID, WorkflowID: key.WorkflowID, RunID: first.ExecutionInfo.NewRunID})
+	if err != nil {
+		t.Fatalf("GetMutableState(new run) error = %v", err)
+	}
+	if want := first.ExecutionInfo.ExecutionExpirationTime; want.IsZero() || !second.ExecutionInfo.ExecutionExpirationTime.Equal(want) {
+		t.Errorf("new run expiration time = %v, want %v", second.ExecutionInfo.ExecutionExpirationTime, want)
+	}
+}
+
+func TestStartWorkflowExecution(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	start := func(requestID string, policy commonv1.WorkflowIdReusePolicy) (*historyv1.StartWorkflowExecutionResponse, error) {
+		return svc.StartWorkflowExecution(ctx, &historyv1.StartWorkflowExecutionRequest{
+			Namespace:             "default",
+			WorkflowId:            "wf-start",
+			WorkflowType:          &apiv1.WorkflowType{Name: "order-sync"},
+			TaskQueue:             &apiv1.TaskQueue{Name: "default"},
+			TaskTimeout:           durationpb.New(10 * time.Second),
+			RequestId:             requestID,
+			WorkflowIdReusePolicy: policy,
+		})
+	}
+	status := func(runID string) types.ExecutionStatus {
+		t.Helper()
+		state, err := stateStore.GetMutableState(ctx, types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-start", RunID: runID})
+		if err != nil {
+			t.Fatalf("GetMutableState(%s) error = %v", runID, err)
+		}
+		return state.ExecutionInfo.Status
+	}
+
+	first, err := start("req-1", commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_UNSPECIFIED)
+	if err != nil || !first.GetStarted() {
+		t.Fatalf("StartWorkflowExecution() = %v, %v; want a started run", first, err)
+	}
+	retry, err := start("req-1", commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_UNSPECIFIED)
+	if err != nil || retry.GetStarted() || retry.GetRunId() != first.GetRunId() {
+		t.Fatalf("retried StartWorkflowExecution() = %v, %v; want run %s again", retry, err, first.GetRunId())
+	}
+	if _, err := start("req-2", commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE); !errors.Is(err, ErrWorkflowAlreadyStarted) {
+		t.Fatalf("start next to a running run error = %v, want %v", err, ErrWorkflowAlreadyStarted)
+	}
+
+	firstKey := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-start", RunID: first.GetRunId()}
+	runWorkflowTask(t, svc, firstKey, completeWorkflowCommand("done"))
+	if _, err := start("req-2", commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE_FAILED_ONLY); !errors.Is(err, ErrWorkflowAlreadyStarted) {
+		t.Fatalf("failed-only start after a completed run error = %v, want %v", err, ErrWorkflowAlreadyStarted)
+	}
+	second, err := start("req-2", commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE)
+	if err != nil || !second.GetStarted() || second.GetRunId() == first.GetRunId() {
+		t.Fatalf("StartWorkflowExecution() = %v, %v; want a new run", second, err)
+	}
+
+	third, err := start("req-3", commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_TERMINATE_IF_RUNNING)
+	if err != nil || !third.GetStarted() {
+		t.Fatalf("StartWorkflowExecution() = %v, %v; want a new run", third, err)
+	}
+	if got := status(second.GetRunId()); got != types.ExecutionStatusTerminated {
+		t.Errorf("replaced run status = %v, want %v", got, types.ExecutionStatusTerminated)
+	}
+	if got := status(third.GetRunId()); got != types.ExecutionStatusRunning {
+		t.Errorf("new run status = %v, want %v", got, types.ExecutionStatusRunning)
+	}
+
+	_, err = svc.TerminateWorkflowExecution(ctx, &historyv1.TerminateWorkflowExecutionRequest{
+		Namespace:         "default",
+		WorkflowExecution: &commonv1.WorkflowExecution{WorkflowId: "wf-start", RunId: third.GetRunId()},
+	})
+	if err != nil {
+		t.Fatalf("TerminateWorkflowExecution() error = %v", err)
+	}
+	if _, err := start("req-4", commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE); !errors.Is(err, ErrWorkflowAlreadyStarted) {
+		t.Fatalf("reject-duplicate start error = %v, want %v", err, ErrWorkflowAlreadyStarted)
+	}
+	fourth, err := start("req-4", commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE_FAILED_ONLY)
+	if err != nil || !fourth.GetStarted() {
+		t.Fatalf("failed-only start after a terminated run = %v, %v; want a new run", fourth, err)
+	}
+
+	current, err := stateStore.GetCurrentRunID(ctx, "default", "wf-start")
+	if err != nil || current != fourth.GetRunId() {
+		t.Errorf("GetCurrentRunID() = %q, %v; want %q", current, err, fourth.GetRunId())
+	}
+}
+
+func TestQueryWorkflow(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	started, err := svc.StartWorkflowExecution(ctx, &historyv1.StartWorkflowExecutionRequest{
+		Namespace:    "default",
+		WorkflowId:   "wf-query",
+		WorkflowType: &apiv1.WorkflowType{Name: "order-sync"},
+		TaskQueue:    &apiv1.TaskQueue{Name: "default"},
+		TaskTimeout:  durationpb.New(10 * time.Second),
+	})
+	if err != nil {
+		t.Fatalf("StartWorkflowExecution() error = %v", err)
+	}
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-query", RunID: started.GetRunId()}
+	execution := &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID}
+
+	runWorkflowTask(t, svc, key,
+		scheduleActivityCommand("fetch", "default"),
+		scheduleActivityCommand("notify", "default"),
+		&historyv1.Command{
+			CommandType: historyv1.CommandType_COMMAND_TYPE_START_TIMER,
+			Attributes: &historyv1.Command_StartTimerAttributes{StartTimerAttributes: &historyv1.StartTimerCommandAttributes{
+				TimerId:            "sleep",
+				StartToFireTimeout: durationpb.New(time.Minute),
+			}},
+		},
+	)
+	state, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	for id, ai := range state.PendingActivities {
+		if ai.ActivityID == "fetch" {
+			_, err = svc.RespondActivityTaskCompleted(ctx, &historyv1.RespondActivityTaskCompletedRequest{
+				Namespace:         key.NamespaceID,
+				WorkflowExecution: execution,
+				ScheduledEventId:  id,
+				Result:            &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: []byte(`{"orders":3}`)}}},
+			})
+		} else {
+			_, err = svc.RecordActivityTaskStarted(ctx, &historyv1.RecordActivityTaskStartedRequest{
+				Namespace:         key.NamespaceID,
+				WorkflowExecution: execution,
+				ScheduledEventId:  id,
+				RequestId:         "worker-a",
+			})
+		}
+		if err != nil {
+			t.Fatalf("updating node %s: %v", ai.ActivityID, err)
+		}
+	}
+	_, err = svc.SignalWorkflowExecution(ctx, &historyv1.SignalWorkflowExecutionRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+		SignalName:        "approved",
+		Input:             &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: []byte(`{"by":"ops"}`)}}},
+	})
+	if err != nil {
+		t.Fatalf("SignalWorkflowExecution() error = %v", err)
+	}
+
+	// Queries without a run ID go to the current run.
+	query := func(queryType string) (string, error) {
+		resp, err := svc.QueryWorkflow(ctx, &historyv1.QueryWorkflowRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID},
+			QueryType:         queryType,
+		})
+		if err != nil {
+			return "", err
+		}
+		return string(firstPayload(resp.GetQueryResult())), nil
+	}
+	tests := []struct {
+		queryType string
+		want      string
+	}{
+		{QueryTypeNodeStates, `{"fetch":{"state":"completed"},"notify":{"state":"running","attempt":1}}`},
+		{QueryTypeOutputs, `{"fetch":{"orders":3}}`},
+	}
+	for _, tt := range tests {
+		got, err := query(tt.queryType)
+		if err != nil || got != tt.want {
+			t.Errorf("QueryWorkflow(%s) = %s, %v; want %s", tt.queryType, got, err, tt.want)
+		}
+	}
+
+	var timers []queryTimer
+	got, err := query(QueryTypePendingTimers)
+	if err == nil {
+		err = json.Unmarshal([]byte(got), &timers)
+	}
+	if err != nil || len(timers) != 1 || timers[0].TimerID != "sleep" {
+		t.Errorf("QueryWorkflow(%s) = %s, %v; want the sleep timer", QueryTypePendingTimers, got, err)
+	}
+	var signals []querySignal
+	got, err = query(QueryTypeSignals)
+	if err == nil {
+		err = json.Unmarshal([]byte(got), &signals)
+	}
+	if err != nil || len(signals) != 1 || signals[0].Name != "approved" || string(signals[0].Input) != `{"by":"ops"}` {
+		t.Errorf("QueryWorkflow(%s) = %s, %v; want the approved signal", QueryTypeSignals, got, err)
+	}
+
+	// Without matching there is no worker to answer a custom query.
+	if _, err := query("progress"); !errors.Is(err, ErrUnknownQueryType) {
+		t.Errorf("custom query error = %v, want %v", err, ErrUnknownQueryType)
+	}
+}
+
+func TestHistoryLimits(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	namespaces := controlplane.NewService(controlplane.Config{})
+	err := namespaces.CreateNamespace(ctx, &controlplane.NamespaceConfig{Name: "default", HistoryCountWarn: 5, HistoryCountLimit: 8})
+	if err != nil {
+		t.Fatalf("CreateNamespace() error = %v", err)
+	}
+	svc.namespaces = namespaces
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-limits", RunID: "run-1"}
+	execution := &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID}
+
+	recordTestEvents(t, svc, key, startedEvent())
+	signals := 0
+	for ; signals < 20; signals++ {
+		_, err := svc.SignalWorkflowExecution(ctx, &historyv1.SignalWorkflowExecutionRequest{
+			Namespace:         key.NamespaceID,
+			WorkflowExecution: execution,
+			SignalName:        "tick",
+		})
+		if err != nil {
+			break
+		}
+	}
+
+	state, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if state.ExecutionInfo.Status != types.ExecutionStatusFailed {
+		t.Fatalf("status after %d signals = %v, want %v", signals, state.ExecutionInfo.Status, types.ExecutionStatusFailed)
+	}
+	if state.HistorySize <= 0 {
+		t.Errorf("HistorySize = %d, want the size of %d events", state.HistorySize, state.HistoryCount())
+	}
+
+	events, err := svc.GetHistory(ctx, key, 1, state.NextEventID)
+	if err != nil {
+		t.Fatalf("GetHistory() error = %v", err)
+	}
+	var size int64
+	markers := 0
+	for _, event := range events {
+		data, err := historySizeSerializer.Serialize(event)
+		if err != nil {
+			t.Fatalf("Serialize(%d) error = %v", event.EventID, err)
+		}
+		size += int64(len(data))
+		if attrs, ok := event.Attributes.(*types.MarkerRecordedAttributes); ok && attrs.MarkerName == types.MarkerNameHistoryLimitWarning {
+			markers++
+			if event.EventID > 6 {
+				t.Errorf("warning recorded as event %d, want it once the history reached 5 events", event.EventID)
+			}
+		}
+	}
+	if markers != 1 {
+		t.Errorf("recorded %d history limit warnings, want 1", markers)
+	}
+	if size != state.HistorySize {
+		t.Errorf("HistorySize = %d, want %d", state.HistorySize, size)
+	}
+	closed := events[len(events)-1]
+	failed, ok := closed.Attributes.(*types.ExecutionFailedAttributes)
+	if !ok || !strings.Contains(failed.Reason, "history limit exceeded") {
+		t.Errorf("last event = %s %+v, want the run failed for its history limit", closed.EventType, closed.Attributes)
+	}
+
+	resp, err := NewGRPCServer(svc).GetMutableState(ctx, &historyv1.GetMutableStateRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: execution,
+	})
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	limits := resp.GetHistoryLimits()
+	if resp.GetHistoryLength() != int64(len(events)) || limits.GetCountWarn() != 5 || limits.GetCountLimit() != 8 ||
+		limits.GetSizeLimitBytes() != DefaultHistoryLimits.SizeLimit {
+		t.Errorf("GetMutableState() history = %d events, limits %v; want %d events and the namespace's limits", resp.GetHistoryLength(), limits, len(events))
+	}
+}
+
+// fakeNamespaces is a NamespaceRegistry serving fixed namespaces; err, when
+// set, fails every lookup.
+type fakeNamespaces struct {
+	namespaces map[string]*controlplane.NamespaceConfig
+	err        error
+}
+
+func (f *fakeNamespaces) GetNamespace(ctx context.Context, name string) (*controlplane.NamespaceConfig, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	ns, ok := f.namespaces[name]
+	if !ok {
+		return nil, controlplane.ErrNamespaceNotFound
+	}
+	return ns, nil
+}
+
+func TestHistoryLimitsFromNamespaceRegistry(t *testing.T) {
+	registry := &fakeNamespaces{namespaces: map[string]*controlplane.NamespaceConfig{
+		"orders": {Name: "orders", HistorySizeWarnMB: 1, HistorySizeLimitMB: 2, HistoryCountWarn: 100, HistoryCountLimit: 200},
+		// The default warn limit is above this size limit.
+		"small": {Name: "small", HistorySizeLimitMB: 5},
+	}}
+	defaults := HistoryLimits{SizeWarn: 10 << 20, SizeLimit: 50 << 20, CountWarn: 1000, CountLimit: 5000}
+	svc := NewServiceWithConfig(Config{
+		ShardController: shard.NewController(4),
+		Namespaces:      registry,
+		HistoryLimits:   defaults,
+	})
+
+	tests := []struct {
+		namespace string
+		err       error
+		want      HistoryLimits
+	}{
+		{"orders", nil, HistoryLimits{SizeWarn: 1 << 20, SizeLimit: 2 << 20, CountWarn: 100, CountLimit: 200}},
+		{"small", nil, HistoryLimits{SizeWarn: 4 << 20, SizeLimit: 5 << 20, CountWarn: 1000, CountLimit: 5000}},
+		{"unknown", nil, defaults},
+		{"orders", errors.New("control plane unavailable"), defaults},
+	}
+	for _, tt := range tests {
+		registry.err = tt.err
+		if got := svc.historyLimits(context.Background(), tt.namespace); got != tt.want {
+			t.Errorf("historyLimits(%s) with error %v = %+v, want %+v", tt.namespace, tt.err, got, tt.want)
+		}
+	}
+}
+
+// lockCheckingNamespaces is a NamespaceRegistry that records whether key was
+// locked while it was asked for a namespace.
+type lockCheckingNamespaces struct {
+	fakeNamespaces
+	svc     *Service
+	key     types.ExecutionKey
+	lookups int
+	locked  bool
+}
+
+func (f *lockCheckingNamespaces) GetNamespace(ctx context.Context, name string) (*controlplane.NamespaceConfig, error) {
+	f.lookups++
+	lockCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	execution, err := f.svc.stateCache.Acquire(lockCtx, f.svc.GetShardIDForExecution(f.key), f.key)
+	if err != nil {
+		f.locked = true
+	} else {
+		execution.Release(nil)
+	}
+	return f.fakeNamespaces.GetNamespace(ctx, name)
+}
+
+func TestHistoryLimitsResolvedUnlocked(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _ := newTestService(t)
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-limits-unlocked", RunID: "run-1"}
+	recordTestEvents(t, svc, key, startedEvent())
+
+	registry := &lockCheckingNamespaces{svc: svc, key: key}
+	svc.namespaces = registry
+	_, err := svc.SignalWorkflowExecution(ctx, &historyv1.SignalWorkflowExecutionRequest{
+		Namespace:         key.NamespaceID,
+		WorkflowExecution: &commonv1.WorkflowExecution{WorkflowId: key.WorkflowID, RunId: key.RunID},
+		SignalName:        "approved",
+	})
+	if err != nil {
+		t.Fatalf("SignalWorkflowExecution() error = %v", err)
+	}
+	if registry.lookups == 0 || registry.locked {
+		t.Errorf("namespace looked up %d times, locked %v; want it looked up with the execution unlocked", registry.lookups, registry.locked)
+	}
+}
+
+func TestNamespaceDefaultsResolvedUnlocked(t *testing.T) {
+	ctx := context.Background()
+	svc, _, stateStore := newTestService(t)
+	workflowKey := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-defaults"}
+	registry := &lockCheckingNamespaces{
+		fakeNamespaces: fakeNamespaces{namespaces: map[string]*controlplane.NamespaceConfig{
+			"default": {Name: "default", WorkflowExecutionTTL: time.Hour},
+		}},
+		svc: svc,
+		key: workflowKey,
+	}
+	svc.namespaces = registry
+
+	started, err := svc.StartWorkflowExecution(ctx, &historyv1.StartWorkflowExecutionRequest{
+		Namespace:    workflowKey.NamespaceID,
+		WorkflowId:   workflowKey.WorkflowID,
+		WorkflowType: &apiv1.WorkflowType{Name: "order-sync"},
+		TaskQueue:    &apiv1.TaskQueue{Name: "default"},
+	})
+	if err != nil {
+		t.Fatalf("StartWorkflowExecution() error = %v", err)
+	}
+	if registry.lookups == 0 || registry.locked {
+		t.Errorf("namespace looked up %d times, locked %v; want it looked up with the workflow ID unlocked", registry.lookups, registry.locked)
+	}
+
+	key := workflowKey
+	key.RunID = started.GetRunId()
+	state, err := stateStore.GetMutableState(ctx, key)
+	if err != nil {
+		t.Fatalf("GetMutableState() error = %v", err)
+	}
+	if got := state.ExecutionInfo.ExecutionTimeout; got != time.Hour {
+		t.Errorf("execution timeout = %v, want the namespace's TTL", got)
+	}
+}
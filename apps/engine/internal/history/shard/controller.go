@@ -1,8 +1,13 @@
 package shard
 
 import (
+	"context"
 	"errors"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/linkflow/engine/internal/history/types"
 )
@@ -14,22 +19,68 @@ var (
 
 type Shard interface {
 	GetID() int32
+	GetRangeID() int64
 }
 
 type ShardImpl struct {
-	id int32
-	// Add other shard-specific fields here, e.g., locking, status
+	id      int32
+	rangeID int64
+	// renewedAt is when the lease was last confirmed. Only the controller's
+	// loop touches it.
+	renewedAt time.Time
 }
 
 func (s *ShardImpl) GetID() int32 {
 	return s.id
 }
 
+// GetRangeID returns the range ID the shard was acquired with. Writes are
+// fenced by it.
+func (s *ShardImpl) GetRangeID() int64 {
+	return s.rangeID
+}
+
+// Listener is notified when the controller gains or loses a shard. Callbacks
+// run on the controller's goroutine and must not block.
+type Listener interface {
+	ShardAcquired(shardID int32)
+	ShardLost(shardID int32)
+}
+
+// Config holds configuration for a lease-based shard controller.
+type Config struct {
+	NumShards int32
+	// HostID identifies this history host in membership and shard leases.
+	HostID  string
+	Address string
+	Port    int
+
+	LeaseStore    LeaseStore
+	LeaseDuration time.Duration
+	RenewInterval time.Duration
+	// MembershipTTL is how long a host stays live without a heartbeat.
+	MembershipTTL time.Duration
+	Logger        *slog.Logger
+}
+
 type Controller struct {
 	numShards int32
-	shards    map[int32]Shard
+	shards    map[int32]*ShardImpl
+	listeners []Listener
 	mu        sync.RWMutex
 	status    int32 // 0: stopped, 1: starting, 2: running, 3: stopping
+
+	// Lease mode. Without a lease store the controller owns every shard.
+	hostID        string
+	address       string
+	port          int
+	leaseStore    LeaseStore
+	leaseDuration time.Duration
+	renewInterval time.Duration
+	membershipTTL time.Duration
+	logger        *slog.Logger
+	stopCh        chan struct{}
+	wg            sync.WaitGroup
 }
 
 const (
@@ -39,44 +90,140 @@ const (
 	statusStopping = 3
 )
 
+// NewController creates a controller that statically owns every shard. It is
+// only safe with a single history host.
 func NewController(numShards int32) *Controller {
-	if numShards <= 0 {
-		numShards = 16 // Default
+	return NewControllerWithConfig(Config{NumShards: numShards})
+}
+
+// NewControllerWithConfig creates a shard controller. With a LeaseStore the
+// shards are spread over the live history hosts and owned through leases.
+func NewControllerWithConfig(cfg Config) *Controller {
+	if cfg.NumShards <= 0 {
+		cfg.NumShards = 16 // Default
+	}
+	if cfg.LeaseDuration <= 0 {
+		cfg.LeaseDuration = 30 * time.Second
+	}
+	if cfg.RenewInterval <= 0 {
+		cfg.RenewInterval = cfg.LeaseDuration / 3
+	}
+	if cfg.MembershipTTL <= 0 {
+		cfg.MembershipTTL = 3 * cfg.RenewInterval
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
 	}
 	return &Controller{
-		numShards: numShards,
-		shards:    make(map[int32]Shard),
-		status:    statusStopped,
+		numShards:     cfg.NumShards,
+		shards:        make(map[int32]*ShardImpl),
+		status:        statusStopped,
+		hostID:        cfg.HostID,
+		address:       cfg.Address,
+		port:          cfg.Port,
+		leaseStore:    cfg.LeaseStore,
+		leaseDuration: cfg.LeaseDuration,
+		renewInterval: cfg.RenewInterval,
+		membershipTTL: cfg.MembershipTTL,
+		logger:        cfg.Logger,
 	}
 }
 
-func (c *Controller) Start() error {
+// AddListener registers a listener for shard ownership changes. Listeners
+// must be added before Start.
+func (c *Controller) AddListener(l Listener) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, l)
+}
 
+func (c *Controller) Start() error {
+	c.mu.Lock()
 	if c.status == statusRunning {
+		c.mu.Unlock()
 		return nil
 	}
-
 	c.status = statusStarting
-	// Initialize shards
-	for i := int32(0); i < c.numShards; i++ {
-		c.shards[i] = &ShardImpl{id: i}
+
+	if c.leaseStore == nil {
+		// Initialize shards
+		var acquired []int32
+		for i := int32(0); i < c.numShards; i++ {
+			c.shards[i] = &ShardImpl{id: i}
+			acquired = append(acquired, i)
+		}
+		c.status = statusRunning
+		c.mu.Unlock()
+
+		for _, shardID := range acquired {
+			c.notifyAcquired(shardID)
+		}
+		return nil
+	}
+	c.mu.Unlock()
+
+	ctx := context.Background()
+	if err := c.leaseStore.RegisterHost(ctx, c.hostID, c.address, c.port); err != nil {
+		c.mu.Lock()
+		c.status = statusStopped
+		c.mu.Unlock()
+		return err
 	}
+	c.rebalance(ctx)
+
+	c.mu.Lock()
+	c.stopCh = make(chan struct{})
 	c.status = statusRunning
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go c.leaseLoop()
+
+	c.logger.Info("shard controller started",
+		slog.String("host_id", c.hostID),
+		slog.Int("owned_shards", len(c.GetOwnedShardIDs())),
+	)
 	return nil
 }
 
 func (c *Controller) Stop() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if c.status == statusStopped {
+		c.mu.Unlock()
 		return
 	}
 	c.status = statusStopping
-	// Cleanup logic
+	stopCh := c.stopCh
+	c.mu.Unlock()
+
+	if stopCh != nil {
+		close(stopCh)
+		c.wg.Wait()
+	}
+
+	// Hand the shards back so other hosts can take them without waiting for
+	// the leases to expire.
+	ctx := context.Background()
+	for _, s := range c.removeShards(c.GetOwnedShardIDs()) {
+		c.notifyLost(s.id)
+		if c.leaseStore != nil {
+			if err := c.leaseStore.ReleaseShard(ctx, s.id, c.hostID, s.rangeID); err != nil {
+				c.logger.Warn("failed to release shard",
+					slog.Int("shard_id", int(s.id)),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+	}
+	if c.leaseStore != nil {
+		if err := c.leaseStore.UnregisterHost(ctx, c.hostID); err != nil {
+			c.logger.Warn("failed to unregister host", slog.String("error", err.Error()))
+		}
+	}
+
+	c.mu.Lock()
 	c.status = statusStopped
+	c.mu.Unlock()
 }
 
 func (c *Controller) GetShardForExecution(key types.ExecutionKey) (Shard, error) {
@@ -87,9 +234,7 @@ func (c *Controller) GetShardForExecution(key types.ExecutionKey) (Shard, error)
 	c.mu.RUnlock()
 
 	if !ok {
-		// In a real system, we might try to acquire ownership here.
-		// For now, assuming static assignment or initialization in Start()
-		return nil, ErrShardNotFound
+		return nil, ErrShardNotOwned
 	}
 
 	return shard, nil
@@ -105,9 +250,220 @@ func (c *Controller) GetShardIDForExecution(key types.ExecutionKey) int32 {
 	return int32(hash % uint32(c.numShards))
 }
 
+// GetShardRangeID returns the range ID this host holds the shard with, for
+// fencing writes.
+func (c *Controller) GetShardRangeID(shardID int32) (int64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	shard, ok := c.shards[shardID]
+	if !ok {
+		return 0, ErrShardNotOwned
+	}
+	return shard.rangeID, nil
+}
+
+// GetOwnedShardIDs returns the IDs of the shards owned by this host.
+func (c *Controller) GetOwnedShardIDs() []int32 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := make([]int32, 0, len(c.shards))
+	for id := range c.shards {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
 func (c *Controller) isShardOwned(shardID int32) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	_, ok := c.shards[shardID]
 	return ok
 }
+
+func (c *Controller) leaseLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+			ctx := context.Background()
+			if err := c.leaseStore.RegisterHost(ctx, c.hostID, c.address, c.port); err != nil {
+				c.logger.Warn("failed to heartbeat host", slog.String("error", err.Error()))
+			}
+			c.renewLeases(ctx)
+			c.rebalance(ctx)
+		}
+	}
+}
+
+// renewLeases extends the lease of every owned shard. A shard is dropped when
+// another host took it, or when it could not be renewed before its lease ran
+// out, since the host can no longer prove it owns it.
+func (c *Controller) renewLeases(ctx context.Context) {
+	c.mu.RLock()
+	owned := make([]*ShardImpl, 0, len(c.shards))
+	for _, s := range c.shards {
+		owned = append(owned, s)
+	}
+	c.mu.RUnlock()
+
+	var lost []int32
+	for _, s := range owned {
+		err := c.leaseStore.RenewShard(ctx, s.id, c.hostID, s.rangeID, c.leaseDuration)
+		if err == nil {
+			s.renewedAt = time.Now()
+			continue
+		}
+		if errors.Is(err, types.ErrShardOwnershipLost) || time.Since(s.renewedAt) >= c.leaseDuration {
+			c.logger.Warn("lost shard",
+				slog.Int("shard_id", int(s.id)),
+				slog.Int64("range_id", s.rangeID),
+				slog.String("error", err.Error()),
+			)
+			lost = append(lost, s.id)
+			continue
+		}
+		c.logger.Warn("failed to renew shard lease",
+			slog.Int("shard_id", int(s.id)),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	for _, s := range c.removeShards(lost) {
+		c.notifyLost(s.id)
+	}
+}
+
+// rebalance acquires the shards assigned to this host and releases the ones
+// assigned to another live host. A shard still leased by its previous owner is
+// picked up once that host hands it over or its lease expires.
+func (c *Controller) rebalance(ctx context.Context) {
+	hosts, err := c.leaseStore.GetLiveHosts(ctx, c.membershipTTL)
+	if err != nil {
+		c.logger.Warn("failed to read membership", slog.String("error", err.Error()))
+		return
+	}
+
+	var released []int32
+	for shardID := int32(0); shardID < c.numShards; shardID++ {
+		target := assignShard(shardID, hosts, c.hostID)
+		owned := c.isShardOwned(shardID)
+
+		switch {
+		case target == c.hostID && !owned:
+			rangeID, err := c.leaseStore.AcquireShard(ctx, shardID, c.hostID, c.leaseDuration)
+			if err != nil {
+				if !errors.Is(err, ErrShardOwnedByOther) {
+					c.logger.Warn("failed to acquire shard",
+						slog.Int("shard_id", int(shardID)),
+						slog.String("error", err.Error()),
+					)
+				}
+				continue
+			}
+			c.mu.Lock()
+			c.shards[shardID] = &ShardImpl{id: shardID, rangeID: rangeID, renewedAt: time.Now()}
+			c.mu.Unlock()
+
+			c.logger.Info("acquired shard",
+				slog.Int("shard_id", int(shardID)),
+				slog.Int64("range_id", rangeID),
+			)
+			c.notifyAcquired(shardID)
+
+		case target != c.hostID && owned:
+			released = append(released, shardID)
+		}
+	}
+
+	// Stop using a shard before giving up its lease.
+	for _, s := range c.removeShards(released) {
+		c.notifyLost(s.id)
+		if err := c.leaseStore.ReleaseShard(ctx, s.id, c.hostID, s.rangeID); err != nil {
+			c.logger.Warn("failed to release shard",
+				slog.Int("shard_id", int(s.id)),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		c.logger.Info("released shard", slog.Int("shard_id", int(s.id)))
+	}
+}
+
+func (c *Controller) removeShards(shardIDs []int32) []*ShardImpl {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := make([]*ShardImpl, 0, len(shardIDs))
+	for _, shardID := range shardIDs {
+		if s, ok := c.shards[shardID]; ok {
+			delete(c.shards, shardID)
+			removed = append(removed, s)
+		}
+	}
+	return removed
+}
+
+func (c *Controller) notifyAcquired(shardID int32) {
+	c.mu.RLock()
+	listeners := c.listeners
+	c.mu.RUnlock()
+
+	for _, l := range listeners {
+		l.ShardAcquired(shardID)
+	}
+}
+
+func (c *Controller) notifyLost(shardID int32) {
+	c.mu.RLock()
+	listeners := c.listeners
+	c.mu.RUnlock()
+
+	for _, l := range listeners {
+		l.ShardLost(shardID)
+	}
+}
+
+// assignShard picks the host a shard belongs to with rendezvous hashing, so a
+// membership change only moves the shards of the hosts that joined or left.
+// The local host is always a candidate, even if its own heartbeat is late.
+func assignShard(shardID int32, hosts []string, self string) string {
+	var (
+		best      string
+		bestScore uint64
+	)
+	consider := func(hostID string) {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(hostID))
+		_, _ = h.Write([]byte{'/'})
+		_, _ = h.Write([]byte(strconv.Itoa(int(shardID))))
+		score := mix64(h.Sum64())
+		if best == "" || score > bestScore || (score == bestScore && hostID < best) {
+			best, bestScore = hostID, score
+		}
+	}
+
+	consider(self)
+	for _, hostID := range hosts {
+		consider(hostID)
+	}
+	return best
+}
+
+// mix64 is the splitmix64 finalizer. FNV alone scores host IDs that differ in
+// a single character too similarly to spread shards evenly.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,138 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+type recordingListener struct {
+	mu       sync.Mutex
+	acquired []int32
+	lost     []int32
+}
+
+func (l *recordingListener) ShardAcquired(shardID int32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.acquired = append(l.acquired, shardID)
+}
+
+func (l *recordingListener) ShardLost(shardID int32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lost = append(l.lost, shardID)
+}
+
+func newLeaseController(t *testing.T, leases LeaseStore, hostID string) (*Controller, *recordingListener) {
+	t.Helper()
+
+	c := NewControllerWithConfig(Config{
+		NumShards:     8,
+		HostID:        hostID,
+		LeaseStore:    leases,
+		LeaseDuration: 30 * time.Second,
+		// The tests drive renewal and rebalancing by hand.
+		RenewInterval: time.Hour,
+		MembershipTTL: time.Minute,
+	})
+	listener := &recordingListener{}
+	c.AddListener(listener)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start(%s) error = %v", hostID, err)
+	}
+	t.Cleanup(c.Stop)
+	return c, listener
+}
+
+func TestControllerStaticOwnsAllShards(t *testing.T) {
+	c := NewController(4)
+	listener := &recordingListener{}
+	c.AddListener(listener)
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer c.Stop()
+
+	if got := len(c.GetOwnedShardIDs()); got != 4 {
+		t.Errorf("owned %d shards, want 4", got)
+	}
+	if got := len(listener.acquired); got != 4 {
+		t.Errorf("listener saw %d acquisitions, want 4", got)
+	}
+}
+
+func TestControllerRebalancesAcrossHosts(t *testing.T) {
+	ctx := context.Background()
+	leases := NewMemoryLeaseStore()
+	now := time.Now()
+	leases.now = func() time.Time { return now }
+
+	c1, l1 := newLeaseController(t, leases, "host-a")
+	if got := len(c1.GetOwnedShardIDs()); got != 8 {
+		t.Fatalf("single host owns %d shards, want 8", got)
+	}
+
+	// The second host cannot take shards that are still leased to the first.
+	c2, _ := newLeaseController(t, leases, "host-b")
+	if got := len(c2.GetOwnedShardIDs()); got != 0 {
+		t.Fatalf("new host owns %d shards before handoff, want 0", got)
+	}
+
+	c1.rebalance(ctx)
+	c2.rebalance(ctx)
+
+	hosts := []string{"host-a", "host-b"}
+	for shardID := int32(0); shardID < 8; shardID++ {
+		want := assignShard(shardID, hosts, "host-a")
+		if c1.isShardOwned(shardID) == c2.isShardOwned(shardID) {
+			t.Errorf("shard %d owned by both or neither host", shardID)
+		}
+		if owner := map[bool]string{true: "host-a", false: "host-b"}[c1.isShardOwned(shardID)]; owner != want {
+			t.Errorf("shard %d owner = %s, want %s", shardID, owner, want)
+		}
+	}
+	if len(l1.lost) != len(c2.GetOwnedShardIDs()) {
+		t.Errorf("first host lost %d shards, second host owns %d", len(l1.lost), len(c2.GetOwnedShardIDs()))
+	}
+
+	// host-b stops heartbeating; once its leases and membership expire the
+	// first host takes everything back with a new range ID.
+	moved := c2.GetOwnedShardIDs()
+	if len(moved) == 0 {
+		t.Fatal("no shards moved to the second host")
+	}
+	oldRangeID, _ := c2.GetShardRangeID(moved[0])
+
+	now = now.Add(2 * time.Minute)
+	if err := leases.RegisterHost(ctx, "host-a", "", 0); err != nil {
+		t.Fatalf("RegisterHost() error = %v", err)
+	}
+	c1.renewLeases(ctx)
+	c1.rebalance(ctx)
+
+	if got := len(c1.GetOwnedShardIDs()); got != 8 {
+		t.Errorf("surviving host owns %d shards, want 8", got)
+	}
+	newRangeID, err := c1.GetShardRangeID(moved[0])
+	if err != nil {
+		t.Fatalf("GetShardRangeID() error = %v", err)
+	}
+	if newRangeID <= oldRangeID {
+		t.Errorf("range id after failover = %d, want > %d", newRangeID, oldRangeID)
+	}
+
+	// The stale host finds out at its next renewal.
+	err = leases.RenewShard(ctx, moved[0], "host-b", oldRangeID, time.Minute)
+	if !errors.Is(err, types.ErrShardOwnershipLost) {
+		t.Errorf("RenewShard(stale) error = %v, want %v", err, types.ErrShardOwnershipLost)
+	}
+	c2.renewLeases(ctx)
+	if got := len(c2.GetOwnedShardIDs()); got != 0 {
+		t.Errorf("stale host owns %d shards after renewal, want 0", got)
+	}
+}
@@ -0,0 +1,142 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+// ErrShardOwnedByOther is returned when a shard is leased to another live host.
+var ErrShardOwnedByOther = errors.New("shard owned by another host")
+
+// LeaseStore persists history host membership and shard leases.
+//
+// Every successful AcquireShard bumps the shard's range ID. Renewals and
+// releases are conditioned on the range ID they were granted, and execution
+// writes are fenced by it, so a host that lost a shard can neither extend the
+// lease nor commit to it.
+type LeaseStore interface {
+	RegisterHost(ctx context.Context, hostID, address string, port int) error
+	UnregisterHost(ctx context.Context, hostID string) error
+	GetLiveHosts(ctx context.Context, ttl time.Duration) ([]string, error)
+
+	// AcquireShard takes the shard if it is free, already ours, or its lease
+	// has expired, and returns the new range ID.
+	AcquireShard(ctx context.Context, shardID int32, hostID string, leaseDuration time.Duration) (int64, error)
+	// RenewShard extends the lease. It returns types.ErrShardOwnershipLost
+	// when the shard was acquired by someone else in the meantime.
+	RenewShard(ctx context.Context, shardID int32, hostID string, rangeID int64, leaseDuration time.Duration) error
+	ReleaseShard(ctx context.Context, shardID int32, hostID string, rangeID int64) error
+}
+
+type memoryLease struct {
+	owner     string
+	rangeID   int64
+	expiresAt time.Time
+}
+
+// MemoryLeaseStore is an in-memory LeaseStore for testing.
+type MemoryLeaseStore struct {
+	mu     sync.Mutex
+	hosts  map[string]time.Time
+	leases map[int32]*memoryLease
+	now    func() time.Time
+}
+
+// NewMemoryLeaseStore creates a new in-memory lease store.
+func NewMemoryLeaseStore() *MemoryLeaseStore {
+	return &MemoryLeaseStore{
+		hosts:  make(map[string]time.Time),
+		leases: make(map[int32]*memoryLease),
+		now:    time.Now,
+	}
+}
+
+func (s *MemoryLeaseStore) RegisterHost(ctx context.Context, hostID, address string, port int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts[hostID] = s.now()
+	return nil
+}
+
+func (s *MemoryLeaseStore) UnregisterHost(ctx context.Context, hostID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.hosts, hostID)
+	return nil
+}
+
+func (s *MemoryLeaseStore) GetLiveHosts(ctx context.Context, ttl time.Duration) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := s.now().Add(-ttl)
+	var hosts []string
+	for hostID, lastSeen := range s.hosts {
+		if lastSeen.After(cutoff) {
+			hosts = append(hosts, hostID)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+func (s *MemoryLeaseStore) AcquireShard(ctx context.Context, shardID int32, hostID string, leaseDuration time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	lease, ok := s.leases[shardID]
+	if !ok {
+		lease = &memoryLease{}
+		s.leases[shardID] = lease
+	}
+	if lease.owner != "" && lease.owner != hostID && now.Before(lease.expiresAt) {
+		return 0, ErrShardOwnedByOther
+	}
+
+	lease.owner = hostID
+	lease.rangeID++
+	lease.expiresAt = now.Add(leaseDuration)
+	return lease.rangeID, nil
+}
+
+func (s *MemoryLeaseStore) RenewShard(ctx context.Context, shardID int32, hostID string, rangeID int64, leaseDuration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.leases[shardID]
+	if !ok || lease.owner != hostID || lease.rangeID != rangeID {
+		return types.ErrShardOwnershipLost
+	}
+	lease.expiresAt = s.now().Add(leaseDuration)
+	return nil
+}
+
+func (s *MemoryLeaseStore) ReleaseShard(ctx context.Context, shardID int32, hostID string, rangeID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.leases[shardID]
+	if !ok || lease.owner != hostID || lease.rangeID != rangeID {
+		return nil
+	}
+	lease.owner = ""
+	lease.expiresAt = time.Time{}
+	return nil
+}
+
+// GetRangeID returns the current range ID of a shard.
+func (s *MemoryLeaseStore) GetRangeID(shardID int32) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lease, ok := s.leases[shardID]; ok {
+		return lease.rangeID
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+const (
+	historyServiceName = "history"
+	hostHealthServing  = 1
+)
+
+// PostgresLeaseStore implements LeaseStore using PostgreSQL. Membership is
+// kept in service_instances and leases in the shards table.
+type PostgresLeaseStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresLeaseStore creates a new PostgreSQL-backed lease store.
+func NewPostgresLeaseStore(pool *pgxpool.Pool) *PostgresLeaseStore {
+	return &PostgresLeaseStore{pool: pool}
+}
+
+func (s *PostgresLeaseStore) RegisterHost(ctx context.Context, hostID, address string, port int) error {
+	query := `
+		INSERT INTO service_instances (id, service, address, port, health, last_check)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (id) DO UPDATE SET
+			address = EXCLUDED.address,
+			port = EXCLUDED.port,
+			health = EXCLUDED.health,
+			last_check = NOW(),
+			updated_at = NOW()
+	`
+	if _, err := s.pool.Exec(ctx, query, hostID, historyServiceName, address, port, hostHealthServing); err != nil {
+		return fmt.Errorf("failed to register host: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresLeaseStore) UnregisterHost(ctx context.Context, hostID string) error {
+	query := `DELETE FROM service_instances WHERE id = $1 AND service = $2`
+	if _, err := s.pool.Exec(ctx, query, hostID, historyServiceName); err != nil {
+		return fmt.Errorf("failed to unregister host: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresLeaseStore) GetLiveHosts(ctx context.Context, ttl time.Duration) ([]string, error) {
+	query := `
+		SELECT id FROM service_instances
+		WHERE service = $1 AND health = $2 AND last_check > NOW() - $3::bigint * INTERVAL '1 millisecond'
+		ORDER BY id
+	`
+	rows, err := s.pool.Query(ctx, query, historyServiceName, hostHealthServing, ttl.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hosts: %w", err)
+	}
+	defer rows.Close()
+
+	var hosts []string
+	for rows.Next() {
+		var hostID string
+		if err := rows.Scan(&hostID); err != nil {
+			return nil, fmt.Errorf("failed to scan host: %w", err)
+		}
+		hosts = append(hosts, hostID)
+	}
+	return hosts, rows.Err()
+}
+
+func (s *PostgresLeaseStore) AcquireShard(ctx context.Context, shardID int32, hostID string, leaseDuration time.Duration) (int64, error) {
+	if _, err := s.pool.Exec(ctx, `INSERT INTO shards (shard_id) VALUES ($1) ON CONFLICT (shard_id) DO NOTHING`, shardID); err != nil {
+		return 0, fmt.Errorf("failed to create shard: %w", err)
+	}
+
+	query := `
+		UPDATE shards SET
+			owner = $2,
+			range_id = range_id + 1,
+			lease_expires_at = NOW() + $3::bigint * INTERVAL '1 millisecond',
+			updated_at = NOW()
+		WHERE shard_id = $1 AND (owner IS NULL OR owner = $2 OR lease_expires_at < NOW())
+		RETURNING range_id
+	`
+	var rangeID int64
+	err := s.pool.QueryRow(ctx, query, shardID, hostID, leaseDuration.Milliseconds()).Scan(&rangeID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrShardOwnedByOther
+		}
+		return 0, fmt.Errorf("failed to acquire shard: %w", err)
+	}
+	return rangeID, nil
+}
+
+func (s *PostgresLeaseStore) RenewShard(ctx context.Context, shardID int32, hostID string, rangeID int64, leaseDuration time.Duration) error {
+	query := `
+		UPDATE shards SET
+			lease_expires_at = NOW() + $4::bigint * INTERVAL '1 millisecond',
+			updated_at = NOW()
+		WHERE shard_id = $1 AND owner = $2 AND range_id = $3
+	`
+	result, err := s.pool.Exec(ctx, query, shardID, hostID, rangeID, leaseDuration.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to renew shard: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return types.ErrShardOwnershipLost
+	}
+	return nil
+}
+
+func (s *PostgresLeaseStore) ReleaseShard(ctx context.Context, shardID int32, hostID string, rangeID int64) error {
+	query := `
+		UPDATE shards SET owner = NULL, lease_expires_at = NULL, updated_at = NOW()
+		WHERE shard_id = $1 AND owner = $2 AND range_id = $3
+	`
+	if _, err := s.pool.Exec(ctx, query, shardID, hostID, rangeID); err != nil {
+		return fmt.Errorf("failed to release shard: %w", err)
+	}
+	return nil
+}
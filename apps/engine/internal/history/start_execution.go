@@ -0,0 +1,137 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
+	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+// StartWorkflowExecution starts a new run of a workflow ID. The run the
+// workflow ID currently points at decides whether it may: a running one
+// rejects the start unless the reuse policy terminates it, and a closed one
+// is reused according to the policy. A request with the request ID of the
+// current run is a retry and gets that run back without starting another.
+func (s *Service) StartWorkflowExecution(ctx context.Context, req *historyv1.StartWorkflowExecutionRequest) (*historyv1.StartWorkflowExecutionResponse, error) {
+	workflowKey := types.ExecutionKey{
+		NamespaceID: req.GetNamespace(),
+		WorkflowID:  req.GetWorkflowId(),
+	}
+	// The workflow ID stays locked for the update of the new run, so the
+	// namespace's defaults and history limits are resolved before.
+	started := &types.ExecutionStartedAttributes{
+		WorkflowType:     req.GetWorkflowType().GetName(),
+		TaskQueue:        req.GetTaskQueue().GetName(),
+		Input:            firstPayload(req.GetInput()),
+		ExecutionTimeout: req.GetExecutionTimeout().AsDuration(),
+		RunTimeout:       req.GetRunTimeout().AsDuration(),
+		TaskTimeout:      req.GetTaskTimeout().AsDuration(),
+		RequestID:        req.GetRequestId(),
+	}
+	s.applyNamespaceDefaults(ctx, workflowKey.NamespaceID, started)
+	limits := s.historyLimits(ctx, workflowKey.NamespaceID)
+
+	// Starts of one workflow ID are serialized on the workflow ID itself, so
+	// two concurrent starts cannot both find no current run.
+	executionShard, err := s.shardController.GetShardForExecution(workflowKey)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := s.stateCache.Acquire(ctx, executionShard.GetID(), workflowKey)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release(nil)
+
+	current, err := s.currentRun(ctx, workflowKey)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		info := current.ExecutionInfo
+		if req.GetRequestId() != "" && info.CreateRequestID == req.GetRequestId() {
+			return &historyv1.StartWorkflowExecutionResponse{RunId: info.RunID}, nil
+		}
+		if err := s.checkWorkflowIDReuse(ctx, req, info); err != nil {
+			return nil, err
+		}
+	}
+
+	key := workflowKey
+	key.RunID = generateRunID()
+	err = s.updateWorkflowWithLimits(ctx, key, limits, nil, func(state *engine.MutableState) ([]*types.HistoryEvent, error) {
+		return []*types.HistoryEvent{{
+			EventType:  types.EventTypeExecutionStarted,
+			Timestamp:  time.Now(),
+			Attributes: started,
+		}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &historyv1.StartWorkflowExecutionResponse{
+		RunId:   key.RunID,
+		Started: true,
+	}, nil
+}
+
+// currentRun returns the state of the run a workflow ID currently points at,
+// or nil if the workflow ID was never started.
+func (s *Service) currentRun(ctx context.Context, workflowKey types.ExecutionKey) (*engine.MutableState, error) {
+	runID, err := s.stateStore.GetCurrentRunID(ctx, workflowKey.NamespaceID, workflowKey.WorkflowID)
+	if err != nil {
+		if errors.Is(err, types.ErrExecutionNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	key := workflowKey
+	key.RunID = runID
+	var current *engine.MutableState
+	err = s.readState(ctx, key, func(state *engine.MutableState) {
+		current = state.Clone()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// checkWorkflowIDReuse reports whether the reuse policy of req allows a new
+// run next to the current run info. Under TERMINATE_IF_RUNNING a running
+// current run is terminated first.
+func (s *Service) checkWorkflowIDReuse(ctx context.Context, req *historyv1.StartWorkflowExecutionRequest, info *types.ExecutionInfo) error {
+	policy := req.GetWorkflowIdReusePolicy()
+	if info.Status == types.ExecutionStatusRunning {
+		if policy != commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_TERMINATE_IF_RUNNING {
+			return fmt.Errorf("%w: run %s of workflow %s is running", ErrWorkflowAlreadyStarted, info.RunID, info.WorkflowID)
+		}
+		_, err := s.TerminateWorkflowExecution(ctx, &historyv1.TerminateWorkflowExecutionRequest{
+			Namespace: req.GetNamespace(),
+			WorkflowExecution: &commonv1.WorkflowExecution{
+				WorkflowId: info.WorkflowID,
+				RunId:      info.RunID,
+			},
+			Reason:   "terminated by a new start of the workflow ID",
+			Identity: req.GetIdentity(),
+		})
+		return err
+	}
+
+	switch policy {
+	case commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE:
+		return fmt.Errorf("%w: workflow %s was already run as %s", ErrWorkflowAlreadyStarted, info.WorkflowID, info.RunID)
+	case commonv1.WorkflowIdReusePolicy_WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE_FAILED_ONLY:
+		if info.Status == types.ExecutionStatusCompleted {
+			return fmt.Errorf("%w: run %s of workflow %s completed", ErrWorkflowAlreadyStarted, info.RunID, info.WorkflowID)
+		}
+	}
+	return nil
+}
@@ -12,7 +12,33 @@ type EventStore interface {
 	GetEvents(ctx context.Context, key types.ExecutionKey, firstEventID, lastEventID int64) ([]*types.HistoryEvent, error)
 }
 
+// MutableStateStore stores the mutable state of runs. Writing the first state
+// of a run also makes it the current run of its workflow ID, which
+// GetCurrentRunID returns.
 type MutableStateStore interface {
 	GetMutableState(ctx context.Context, key types.ExecutionKey) (*engine.MutableState, error)
 	UpdateMutableState(ctx context.Context, key types.ExecutionKey, state *engine.MutableState, expectedVersion int64) error
+	GetCurrentRunID(ctx context.Context, namespaceID, workflowID string) (string, error)
+}
+
+// ExecutionStore writes the new events of an execution, the mutable state they
+// produced and the tasks that state carries as one atomic update. With a new
+// run, the first events and state of that run are part of the same update.
+type ExecutionStore interface {
+	UpdateWorkflowExecution(ctx context.Context, key types.ExecutionKey, newEvents []*types.HistoryEvent, state *engine.MutableState, expectedVersion int64) error
+	UpdateWorkflowExecutionWithNewRun(ctx context.Context, key types.ExecutionKey, newEvents []*types.HistoryEvent, state *engine.MutableState, expectedVersion int64, newRunKey types.ExecutionKey, newRunEvents []*types.HistoryEvent, newRunState *engine.MutableState) error
+}
+
+// TransferTaskStore is the outbox that history writes transfer tasks into and
+// the transfer queue processor drains.
+type TransferTaskStore interface {
+	GetTransferTasks(ctx context.Context, shardID int32, minTaskID int64, batchSize int) ([]*types.TransferTask, error)
+	GetTransferAckLevel(ctx context.Context, shardID int32) (int64, error)
+	CompleteTransferTasks(ctx context.Context, shardID int32, ackLevel int64) error
+}
+
+// RangeIDProvider returns the range ID this host holds a shard with. Stores
+// use it to fence writes against hosts that lost the shard.
+type RangeIDProvider interface {
+	GetShardRangeID(shardID int32) (int64, error)
 }
@@ -30,11 +30,30 @@ func (s *MemoryEventStore) AppendEvents(ctx context.Context, key types.Execution
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	k := keyToString(key)
-	s.events[k] = append(s.events[k], events...)
+	s.appendLocked(keyToString(key), events)
 	return nil
 }
 
+// appendLocked appends the events whose IDs are not stored yet and returns how
+// many were appended. The caller must hold s.mu.
+func (s *MemoryEventStore) appendLocked(k executionKeyString, events []*types.HistoryEvent) int {
+	existing := make(map[int64]bool, len(s.events[k]))
+	for _, e := range s.events[k] {
+		existing[e.EventID] = true
+	}
+
+	appended := 0
+	for _, e := range events {
+		if existing[e.EventID] {
+			continue
+		}
+		s.events[k] = append(s.events[k], e)
+		existing[e.EventID] = true
+		appended++
+	}
+	return appended
+}
+
 func (s *MemoryEventStore) GetEvents(ctx context.Context, key types.ExecutionKey, firstEventID, lastEventID int64) ([]*types.HistoryEvent, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -55,11 +74,24 @@ func (s *MemoryEventStore) GetEvents(ctx context.Context, key types.ExecutionKey
 type MemoryMutableStateStore struct {
 	mu     sync.RWMutex
 	states map[executionKeyString]*engine.MutableState
+
+	transferTasks     map[int32][]*types.TransferTask
+	transferAckLevels map[int32]int64
+	nextTaskID        int64
+	timerTasks        map[executionKeyString][]*types.TimerTask
+
+	// currentRuns holds the current run ID of each workflow ID.
+	currentRuns map[string]string
 }
 
 func NewMemoryMutableStateStore() *MemoryMutableStateStore {
 	return &MemoryMutableStateStore{
-		states: make(map[executionKeyString]*engine.MutableState),
+		states:            make(map[executionKeyString]*engine.MutableState),
+		transferTasks:     make(map[int32][]*types.TransferTask),
+		transferAckLevels: make(map[int32]int64),
+		nextTaskID:        1,
+		timerTasks:        make(map[executionKeyString][]*types.TimerTask),
+		currentRuns:       make(map[string]string),
 	}
 }
 
@@ -70,10 +102,7 @@ func (s *MemoryMutableStateStore) GetMutableState(ctx context.Context, key types
 	k := keyToString(key)
 	state, ok := s.states[k]
 	if !ok {
-		// Return specific error if desired, or let caller handle it.
-		// Service expects ErrExecutionNotFound or similar if implementing proper handling.
-		// For now returning error is enough.
-		return nil, fmt.Errorf("execution not found")
+		return nil, types.ErrExecutionNotFound
 	}
 	return state.Clone(), nil
 }
@@ -83,6 +112,184 @@ func (s *MemoryMutableStateStore) UpdateMutableState(ctx context.Context, key ty
 	defer s.mu.Unlock()
 
 	k := keyToString(key)
+	if err := s.checkVersionLocked(k, expectedVersion); err != nil {
+		return err
+	}
+	s.putLocked(key, state)
+	return nil
+}
+
+// GetCurrentRunID returns the ID of the run last created for a workflow ID.
+func (s *MemoryMutableStateStore) GetCurrentRunID(ctx context.Context, namespaceID, workflowID string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runID, ok := s.currentRuns[namespaceID+"/"+workflowID]
+	if !ok {
+		return "", types.ErrExecutionNotFound
+	}
+	return runID, nil
+}
+
+// checkVersionLocked applies the same optimistic lock as the Postgres store.
+// The caller must hold s.mu.
+func (s *MemoryMutableStateStore) checkVersionLocked(k executionKeyString, expectedVersion int64) error {
+	current, ok := s.states[k]
+	if !ok {
+		if expectedVersion != 0 {
+			return types.ErrOptimisticLock
+		}
+		return nil
+	}
+	if current.DBVersion != expectedVersion {
+		return types.ErrOptimisticLock
+	}
+	return nil
+}
+
+// putLocked stores the state and the tasks it carries. A new run becomes the
+// current run of its workflow ID. The caller must hold s.mu.
+func (s *MemoryMutableStateStore) putLocked(key types.ExecutionKey, state *engine.MutableState) {
+	k := keyToString(key)
+	if _, ok := s.states[k]; !ok {
+		s.currentRuns[key.NamespaceID+"/"+key.WorkflowID] = key.RunID
+	}
 	s.states[k] = state.Clone()
+
+	for _, task := range state.TransferTasks {
+		task.TaskID = s.nextTaskID
+		s.nextTaskID++
+		stored := *task
+		s.transferTasks[stored.ShardID] = append(s.transferTasks[stored.ShardID], &stored)
+	}
+	for _, task := range state.TimerTasks {
+		stored := *task
+		s.timerTasks[k] = append(s.timerTasks[k], &stored)
+	}
+}
+
+// GetTimerTasks returns the timer tasks written for an execution.
+func (s *MemoryMutableStateStore) GetTimerTasks(ctx context.Context, key types.ExecutionKey) ([]*types.TimerTask, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := s.timerTasks[keyToString(key)]
+	result := make([]*types.TimerTask, 0, len(tasks))
+	for _, task := range tasks {
+		copied := *task
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+func (s *MemoryMutableStateStore) GetTransferTasks(ctx context.Context, shardID int32, minTaskID int64, batchSize int) ([]*types.TransferTask, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []*types.TransferTask
+	for _, task := range s.transferTasks[shardID] {
+		if task.TaskID <= minTaskID {
+			continue
+		}
+		copied := *task
+		result = append(result, &copied)
+		if batchSize > 0 && len(result) == batchSize {
+			break
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryMutableStateStore) GetTransferAckLevel(ctx context.Context, shardID int32) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.transferAckLevels[shardID], nil
+}
+
+func (s *MemoryMutableStateStore) CompleteTransferTasks(ctx context.Context, shardID int32, ackLevel int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	remaining := s.transferTasks[shardID][:0]
+	for _, task := range s.transferTasks[shardID] {
+		if task.TaskID > ackLevel {
+			remaining = append(remaining, task)
+		}
+	}
+	s.transferTasks[shardID] = remaining
+	if ackLevel > s.transferAckLevels[shardID] {
+		s.transferAckLevels[shardID] = ackLevel
+	}
+	return nil
+}
+
+// MemoryExecutionStore implements ExecutionStore in memory, for tests. It
+// embeds the in-memory event and mutable state stores.
+type MemoryExecutionStore struct {
+	*MemoryEventStore
+	*MemoryMutableStateStore
+}
+
+func NewMemoryExecutionStore() *MemoryExecutionStore {
+	return &MemoryExecutionStore{
+		MemoryEventStore:        NewMemoryEventStore(),
+		MemoryMutableStateStore: NewMemoryMutableStateStore(),
+	}
+}
+
+func (s *MemoryExecutionStore) UpdateWorkflowExecution(ctx context.Context, key types.ExecutionKey, newEvents []*types.HistoryEvent, state *engine.MutableState, expectedVersion int64) error {
+	s.MemoryMutableStateStore.mu.Lock()
+	defer s.MemoryMutableStateStore.mu.Unlock()
+	s.MemoryEventStore.mu.Lock()
+	defer s.MemoryEventStore.mu.Unlock()
+
+	k := keyToString(key)
+	if err := s.checkLocked(k, newEvents, expectedVersion); err != nil {
+		return err
+	}
+
+	s.MemoryEventStore.appendLocked(k, newEvents)
+	s.MemoryMutableStateStore.putLocked(key, state)
+	return nil
+}
+
+// UpdateWorkflowExecutionWithNewRun is UpdateWorkflowExecution that also
+// creates a new run, with the same all-or-nothing semantics as the Postgres
+// store.
+func (s *MemoryExecutionStore) UpdateWorkflowExecutionWithNewRun(ctx context.Context, key types.ExecutionKey, newEvents []*types.HistoryEvent, state *engine.MutableState, expectedVersion int64, newRunKey types.ExecutionKey, newRunEvents []*types.HistoryEvent, newRunState *engine.MutableState) error {
+	s.MemoryMutableStateStore.mu.Lock()
+	defer s.MemoryMutableStateStore.mu.Unlock()
+	s.MemoryEventStore.mu.Lock()
+	defer s.MemoryEventStore.mu.Unlock()
+
+	k, newK := keyToString(key), keyToString(newRunKey)
+	if err := s.checkLocked(k, newEvents, expectedVersion); err != nil {
+		return err
+	}
+	if err := s.checkLocked(newK, newRunEvents, 0); err != nil {
+		return err
+	}
+
+	s.MemoryEventStore.appendLocked(k, newEvents)
+	s.MemoryMutableStateStore.putLocked(key, state)
+	s.MemoryEventStore.appendLocked(newK, newRunEvents)
+	s.MemoryMutableStateStore.putLocked(newRunKey, newRunState)
+	return nil
+}
+
+// checkLocked applies the optimistic lock and rejects events that were
+// already written. The caller must hold both locks.
+func (s *MemoryExecutionStore) checkLocked(k executionKeyString, newEvents []*types.HistoryEvent, expectedVersion int64) error {
+	if err := s.MemoryMutableStateStore.checkVersionLocked(k, expectedVersion); err != nil {
+		return err
+	}
+	for _, e := range s.MemoryEventStore.events[k] {
+		for _, newEvent := range newEvents {
+			if e.EventID == newEvent.EventID {
+				return types.ErrOptimisticLock
+			}
+		}
+	}
 	return nil
 }
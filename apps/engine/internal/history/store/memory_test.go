@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+func TestMemoryExecutionStoreUpdateWorkflowExecution(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryExecutionStore()
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-1", RunID: "run-1"}
+
+	state := engine.NewMutableState(&types.ExecutionInfo{})
+	state.DBVersion = 1
+	state.AddTransferTask(&types.TransferTask{ShardID: 2, TaskType: types.TransferTaskTypeWorkflowTask})
+	state.AddTimerTask(&types.TimerTask{TimerID: "t1"})
+	first := []*types.HistoryEvent{{EventID: 1, EventType: types.EventTypeExecutionStarted}}
+
+	if err := s.UpdateWorkflowExecution(ctx, key, first, state, 0); err != nil {
+		t.Fatalf("UpdateWorkflowExecution() error = %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		events          []*types.HistoryEvent
+		expectedVersion int64
+		wantErr         error
+	}{
+		{
+			name:            "stale version",
+			events:          []*types.HistoryEvent{{EventID: 2}},
+			expectedVersion: 0,
+			wantErr:         types.ErrOptimisticLock,
+		},
+		{
+			name:            "duplicate event",
+			events:          []*types.HistoryEvent{{EventID: 1}},
+			expectedVersion: 1,
+			wantErr:         types.ErrOptimisticLock,
+		},
+		{
+			name:            "next update",
+			events:          []*types.HistoryEvent{{EventID: 2}},
+			expectedVersion: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := engine.NewMutableState(&types.ExecutionInfo{})
+			next.DBVersion = 2
+			err := s.UpdateWorkflowExecution(ctx, key, tt.events, next, tt.expectedVersion)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UpdateWorkflowExecution() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	events, _ := s.GetEvents(ctx, key, 1, 10)
+	if len(events) != 2 {
+		t.Errorf("stored %d events, want 2", len(events))
+	}
+	transferTasks, _ := s.GetTransferTasks(ctx, 2, 0, 10)
+	if len(transferTasks) != 1 {
+		t.Errorf("stored %d transfer tasks, want 1", len(transferTasks))
+	}
+	timerTasks, _ := s.GetTimerTasks(ctx, key)
+	if len(timerTasks) != 1 {
+		t.Errorf("stored %d timer tasks, want 1", len(timerTasks))
+	}
+}
@@ -49,35 +49,43 @@ func (s *PostgresEventStore) AppendEvents(
 	}
 	defer tx.Rollback(ctx)
 
-	// Check current version if expected version is specified
-	if expectedVersion >= 0 {
-		var currentMaxEventID int64
-		err := tx.QueryRow(ctx, `
-			SELECT COALESCE(MAX(event_id), 0)
-			FROM history_events
-			WHERE namespace_id = $1 AND workflow_id = $2 AND run_id = $3
-		`, key.NamespaceID, key.WorkflowID, key.RunID).Scan(&currentMaxEventID)
+	// Events that already exist are skipped, which makes retried appends
+	// idempotent.
+	shardID := getShardIDForExecution(key, s.shardCount)
+	if _, err := appendEventsTx(ctx, tx, s.serializer, shardID, key, evts); err != nil {
+		return err
+	}
 
-		if err != nil {
-			return fmt.Errorf("failed to check current version: %w", err)
-		}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	// Get shard ID for this execution
-	shardID := getShardIDForExecution(key, s.shardCount)
+	return nil
+}
 
-	// Insert events
+// appendEventsTx inserts events inside tx and returns how many were actually
+// written; events whose ID already exists are left untouched.
+func appendEventsTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	serializer *events.Serializer,
+	shardID int32,
+	key types.ExecutionKey,
+	evts []*types.HistoryEvent,
+) (int, error) {
+	inserted := 0
 	for _, event := range evts {
-		data, err := s.serializer.Serialize(event)
+		data, err := serializer.Serialize(event)
 		if err != nil {
-			return fmt.Errorf("failed to serialize event: %w", err)
+			return inserted, fmt.Errorf("failed to serialize event: %w", err)
 		}
 
-		_, err = tx.Exec(ctx, `
+		tag, err := tx.Exec(ctx, `
 			INSERT INTO history_events (
 				shard_id, namespace_id, workflow_id, run_id,
 				event_id, event_type, version, timestamp, data
 			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT DO NOTHING
 		`,
 			shardID,
 			key.NamespaceID,
@@ -90,23 +98,11 @@ func (s *PostgresEventStore) AppendEvents(
 			data,
 		)
 		if err != nil {
-			var pgErr *pgconn.PgError
-			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-				// Unique violation means event already exists.
-				// This makes the operation idempotent.
-				// We should verify if the existing event matches regarding crucial data,
-				// but for now we assume it's the same event from a retried request.
-				continue
-			}
-			return fmt.Errorf("failed to insert event %d: %w", event.EventID, err)
+			return inserted, fmt.Errorf("failed to insert event %d: %w", event.EventID, err)
 		}
+		inserted += int(tag.RowsAffected())
 	}
-
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	return nil
+	return inserted, nil
 }
 
 // GetEvents retrieves events for an execution within the specified range.
@@ -217,6 +213,9 @@ func (s *mutableStateSerializer) Deserialize(data []byte) (*engine.MutableState,
 	if state.BufferedEvents == nil {
 		state.BufferedEvents = make([]*types.HistoryEvent, 0)
 	}
+	if state.PendingChildExecutions == nil {
+		state.PendingChildExecutions = make(map[int64]*types.ChildExecutionInfo)
+	}
 	return &state, nil
 }
 
@@ -269,20 +268,68 @@ func (s *PostgresMutableStateStore) UpdateMutableState(
 	state *engine.MutableState,
 	expectedVersion int64,
 ) error {
-	data, err := s.serializer.Serialize(state)
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to serialize mutable state: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
 	shardID := getShardIDForExecution(key, s.shardCount)
-	checksum := calculateChecksum(data)
-	newVersion := state.DBVersion + 1
+	if err := updateMutableStateTx(ctx, tx, s.serializer, shardID, key, state, expectedVersion); err != nil {
+		return err
+	}
 
-	tx, err := s.pool.Begin(ctx)
+	if err := insertTransferTasks(ctx, tx, state.TransferTasks); err != nil {
+		return err
+	}
+
+	if err := insertTimerTasks(ctx, tx, state.TimerTasks); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetCurrentRunID returns the ID of the run last created for a workflow ID.
+func (s *PostgresMutableStateStore) GetCurrentRunID(ctx context.Context, namespaceID, workflowID string) (string, error) {
+	var runID string
+	err := s.pool.QueryRow(ctx, `
+		SELECT run_id
+		FROM current_executions
+		WHERE namespace_id = $1 AND workflow_id = $2
+	`, namespaceID, workflowID).Scan(&runID)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", types.ErrExecutionNotFound
+		}
+		return "", fmt.Errorf("failed to get current execution: %w", err)
 	}
-	defer tx.Rollback(ctx)
+	return runID, nil
+}
+
+// updateMutableStateTx writes the mutable state inside tx, guarded by the
+// optimistic lock on db_version. A state with expectedVersion 0 is inserted
+// and becomes the current run of its workflow ID.
+func updateMutableStateTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	serializer *mutableStateSerializer,
+	shardID int32,
+	key types.ExecutionKey,
+	state *engine.MutableState,
+	expectedVersion int64,
+) error {
+	data, err := serializer.Serialize(state)
+	if err != nil {
+		return fmt.Errorf("failed to serialize mutable state: %w", err)
+	}
+
+	checksum := calculateChecksum(data)
+	newVersion := state.DBVersion + 1
 
 	// Try to update existing row
 	tag, err := tx.Exec(ctx, `
@@ -303,30 +350,254 @@ func (s *PostgresMutableStateStore) UpdateMutableState(
 		return fmt.Errorf("failed to update mutable state: %w", err)
 	}
 
-	if tag.RowsAffected() == 0 {
-		// Row doesn't exist or version mismatch - try insert if expectedVersion is 0
-		if expectedVersion == 0 {
-			_, err = tx.Exec(ctx, `
-				INSERT INTO mutable_state (
-					shard_id, namespace_id, workflow_id, run_id,
-					state, next_event_id, db_version, checksum
-				) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-			`,
-				shardID,
-				key.NamespaceID,
-				key.WorkflowID,
-				key.RunID,
-				data,
-				state.NextEventID,
-				newVersion,
-				checksum,
-			)
-			if err != nil {
-				return fmt.Errorf("failed to insert mutable state: %w", err)
-			}
-		} else {
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	// Row doesn't exist or version mismatch - try insert if expectedVersion is 0
+	if expectedVersion != 0 {
+		return types.ErrOptimisticLock
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO mutable_state (
+			shard_id, namespace_id, workflow_id, run_id,
+			state, next_event_id, db_version, checksum
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`,
+		shardID,
+		key.NamespaceID,
+		key.WorkflowID,
+		key.RunID,
+		data,
+		state.NextEventID,
+		newVersion,
+		checksum,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			// Another writer created the execution first.
 			return types.ErrOptimisticLock
 		}
+		return fmt.Errorf("failed to insert mutable state: %w", err)
+	}
+
+	// The new run becomes the current run of its workflow ID.
+	_, err = tx.Exec(ctx, `
+		INSERT INTO current_executions (shard_id, namespace_id, workflow_id, run_id, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (namespace_id, workflow_id) DO UPDATE
+		SET run_id = EXCLUDED.run_id, updated_at = NOW()
+	`,
+		shardID,
+		key.NamespaceID,
+		key.WorkflowID,
+		key.RunID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update current execution: %w", err)
+	}
+
+	return nil
+}
+
+// insertTimerTasks writes the timer tasks of an update inside its transaction
+// into the timers table scanned by the timer service. Re-arming an existing
+// timer resets it to pending with the new fire time; a canceled task marks a
+// pending timer canceled so the timer service never fires it.
+func insertTimerTasks(ctx context.Context, tx pgx.Tx, tasks []*types.TimerTask) error {
+	for _, task := range tasks {
+		if task.Canceled {
+			if err := cancelTimerTask(ctx, tx, task); err != nil {
+				return err
+			}
+			continue
+		}
+		_, err := tx.Exec(ctx, `
+			INSERT INTO timers (
+				shard_id, namespace_id, workflow_id, run_id, timer_id,
+				fire_time, status, version, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, 0, 1, NOW())
+			ON CONFLICT (shard_id, namespace_id, workflow_id, run_id, timer_id) DO UPDATE
+			SET fire_time = EXCLUDED.fire_time, status = 0, fired_at = NULL,
+			    version = timers.version + 1
+		`,
+			task.ShardID,
+			task.NamespaceID,
+			task.WorkflowID,
+			task.RunID,
+			task.TimerID,
+			task.FireTime,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert timer task %s: %w", task.TimerID, err)
+		}
+	}
+	return nil
+}
+
+func cancelTimerTask(ctx context.Context, tx pgx.Tx, task *types.TimerTask) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE timers SET status = 2, version = version + 1
+		WHERE shard_id = $1 AND namespace_id = $2 AND workflow_id = $3 AND run_id = $4
+		  AND timer_id = $5 AND status = 0
+	`,
+		task.ShardID,
+		task.NamespaceID,
+		task.WorkflowID,
+		task.RunID,
+		task.TimerID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cancel timer %s: %w", task.TimerID, err)
+	}
+	return nil
+}
+
+// insertTransferTasks writes the transfer tasks of an update inside its
+// transaction. Task IDs are allocated from the shard's row in the shards
+// table, and that row stays locked until the transaction commits, so the tasks
+// of a shard become visible in task ID order and the queue processor never
+// acks past a task that has not been committed yet.
+func insertTransferTasks(ctx context.Context, tx pgx.Tx, tasks []*types.TransferTask) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	// All tasks of one update belong to the same execution, hence one shard.
+	shardID := tasks[0].ShardID
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO shards (shard_id) VALUES ($1)
+		ON CONFLICT (shard_id) DO NOTHING
+	`, shardID); err != nil {
+		return fmt.Errorf("failed to create shard %d: %w", shardID, err)
+	}
+
+	var firstTaskID int64
+	err := tx.QueryRow(ctx, `
+		UPDATE shards
+		SET next_task_id = next_task_id + $2, updated_at = NOW()
+		WHERE shard_id = $1
+		RETURNING next_task_id - $2
+	`, shardID, int64(len(tasks))).Scan(&firstTaskID)
+	if err != nil {
+		return fmt.Errorf("failed to allocate transfer task ids: %w", err)
+	}
+
+	for i, task := range tasks {
+		task.TaskID = firstTaskID + int64(i)
+		_, err := tx.Exec(ctx, `
+			INSERT INTO transfer_tasks (
+				shard_id, task_id, task_type, namespace_id, workflow_id, run_id,
+				task_queue, scheduled_event_id, visibility_time
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`,
+			shardID,
+			task.TaskID,
+			int16(task.TaskType),
+			task.NamespaceID,
+			task.WorkflowID,
+			task.RunID,
+			task.TaskQueue,
+			task.ScheduledEventID,
+			task.VisibilityTime,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert transfer task: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetTransferTasks returns up to batchSize transfer tasks of a shard with an ID
+// greater than minTaskID, in task ID order.
+func (s *PostgresMutableStateStore) GetTransferTasks(
+	ctx context.Context,
+	shardID int32,
+	minTaskID int64,
+	batchSize int,
+) ([]*types.TransferTask, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT task_id, task_type, namespace_id, workflow_id, run_id,
+		       task_queue, scheduled_event_id, visibility_time
+		FROM transfer_tasks
+		WHERE shard_id = $1 AND task_id > $2
+		ORDER BY task_id ASC
+		LIMIT $3
+	`, shardID, minTaskID, batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transfer tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []*types.TransferTask
+	for rows.Next() {
+		task := &types.TransferTask{ShardID: shardID}
+		var taskType int16
+		if err := rows.Scan(
+			&task.TaskID,
+			&taskType,
+			&task.NamespaceID,
+			&task.WorkflowID,
+			&task.RunID,
+			&task.TaskQueue,
+			&task.ScheduledEventID,
+			&task.VisibilityTime,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan transfer task: %w", err)
+		}
+		task.TaskType = types.TransferTaskType(taskType)
+		tasks = append(tasks, task)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating transfer tasks: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// GetTransferAckLevel returns the highest task ID below which every transfer
+// task of the shard has been delivered.
+func (s *PostgresMutableStateStore) GetTransferAckLevel(ctx context.Context, shardID int32) (int64, error) {
+	var ackLevel int64
+	err := s.pool.QueryRow(ctx, `
+		SELECT transfer_ack_level FROM shards WHERE shard_id = $1
+	`, shardID).Scan(&ackLevel)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get transfer ack level: %w", err)
+	}
+	return ackLevel, nil
+}
+
+// CompleteTransferTasks moves the shard's ack level forward and deletes every
+// transfer task at or below it.
+func (s *PostgresMutableStateStore) CompleteTransferTasks(ctx context.Context, shardID int32, ackLevel int64) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM transfer_tasks WHERE shard_id = $1 AND task_id <= $2
+	`, shardID, ackLevel); err != nil {
+		return fmt.Errorf("failed to delete transfer tasks: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO shards (shard_id, transfer_ack_level) VALUES ($1, $2)
+		ON CONFLICT (shard_id) DO UPDATE
+		SET transfer_ack_level = GREATEST(shards.transfer_ack_level, EXCLUDED.transfer_ack_level),
+		    updated_at = NOW()
+	`, shardID, ackLevel); err != nil {
+		return fmt.Errorf("failed to update transfer ack level: %w", err)
 	}
 
 	if err := tx.Commit(ctx); err != nil {
@@ -348,6 +619,136 @@ func (s *PostgresMutableStateStore) DeleteMutableState(ctx context.Context, key
 	return nil
 }
 
+// PostgresExecutionStore implements ExecutionStore using PostgreSQL. It embeds
+// the event and mutable state stores, so it also serves reads and the transfer
+// queue.
+type PostgresExecutionStore struct {
+	*PostgresEventStore
+	*PostgresMutableStateStore
+	rangeIDs RangeIDProvider
+}
+
+// NewPostgresExecutionStore creates a new PostgreSQL-backed execution store.
+// When rangeIDs is set, every write is fenced by the shard's range ID.
+func NewPostgresExecutionStore(pool *pgxpool.Pool, shardCount int32, rangeIDs RangeIDProvider) *PostgresExecutionStore {
+	return &PostgresExecutionStore{
+		PostgresEventStore:        NewPostgresEventStore(pool, shardCount),
+		PostgresMutableStateStore: NewPostgresMutableStateStore(pool, shardCount),
+		rangeIDs:                  rangeIDs,
+	}
+}
+
+// UpdateWorkflowExecution commits new events, the mutable state and the
+// transfer and timer tasks it carries in one transaction. The shard's range ID
+// is checked first, then the optimistic lock on the mutable state; an event ID
+// that already exists means another writer got there first and is reported as
+// ErrOptimisticLock as well.
+func (s *PostgresExecutionStore) UpdateWorkflowExecution(
+	ctx context.Context,
+	key types.ExecutionKey,
+	newEvents []*types.HistoryEvent,
+	state *engine.MutableState,
+	expectedVersion int64,
+) error {
+	return s.writeExecutions(ctx, executionWrite{key, newEvents, state, expectedVersion})
+}
+
+// UpdateWorkflowExecutionWithNewRun commits the update of a run together with
+// the first events and mutable state of a new run of the same workflow, as
+// for continue-as-new. Both runs live on the same shard, so either both are
+// written or neither is.
+func (s *PostgresExecutionStore) UpdateWorkflowExecutionWithNewRun(
+	ctx context.Context,
+	key types.ExecutionKey,
+	newEvents []*types.HistoryEvent,
+	state *engine.MutableState,
+	expectedVersion int64,
+	newRunKey types.ExecutionKey,
+	newRunEvents []*types.HistoryEvent,
+	newRunState *engine.MutableState,
+) error {
+	return s.writeExecutions(ctx,
+		executionWrite{key, newEvents, state, expectedVersion},
+		executionWrite{newRunKey, newRunEvents, newRunState, 0},
+	)
+}
+
+// executionWrite is the update of one run within a transaction.
+type executionWrite struct {
+	key             types.ExecutionKey
+	events          []*types.HistoryEvent
+	state           *engine.MutableState
+	expectedVersion int64
+}
+
+// writeExecutions commits the updates of runs of the same workflow, and so of
+// the same shard, in one fenced transaction.
+func (s *PostgresExecutionStore) writeExecutions(ctx context.Context, writes ...executionWrite) error {
+	tx, err := s.PostgresMutableStateStore.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	shardID := getShardIDForExecution(writes[0].key, s.PostgresMutableStateStore.shardCount)
+
+	if s.rangeIDs != nil {
+		rangeID, err := s.rangeIDs.GetShardRangeID(shardID)
+		if err != nil {
+			return err
+		}
+		if err := fenceShardTx(ctx, tx, shardID, rangeID); err != nil {
+			return err
+		}
+	}
+
+	for _, w := range writes {
+		if err := updateMutableStateTx(ctx, tx, s.PostgresMutableStateStore.serializer, shardID, w.key, w.state, w.expectedVersion); err != nil {
+			return err
+		}
+
+		inserted, err := appendEventsTx(ctx, tx, s.PostgresEventStore.serializer, shardID, w.key, w.events)
+		if err != nil {
+			return err
+		}
+		if inserted != len(w.events) {
+			return types.ErrOptimisticLock
+		}
+
+		if err := insertTransferTasks(ctx, tx, w.state.TransferTasks); err != nil {
+			return err
+		}
+
+		if err := insertTimerTasks(ctx, tx, w.state.TimerTasks); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// fenceShardTx checks that the shard still has the range ID this host acquired
+// it with. It locks the shard row for the rest of the transaction, so a host
+// that acquires the shard concurrently waits for the commit, and every later
+// write by the old owner fails.
+func fenceShardTx(ctx context.Context, tx pgx.Tx, shardID int32, rangeID int64) error {
+	result, err := tx.Exec(ctx,
+		`UPDATE shards SET updated_at = NOW() WHERE shard_id = $1 AND range_id = $2`,
+		shardID, rangeID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to check shard range id: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return types.ErrShardOwnershipLost
+	}
+	return nil
+}
+
 // Helper functions
 
 // Uses consistent hashing to distribute executions across shards.
@@ -0,0 +1,94 @@
+package history
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+// Timers the history service arms for itself share the timers table with the
+// decider's timers, whose IDs are node IDs. They use IDs under a reserved
+// prefix, which START_TIMER commands may not use.
+const (
+	reservedTimerIDPrefix = "__"
+
+	workflowTaskTimeoutTimerPrefix = reservedTimerIDPrefix + "workflow_task_timeout/"
+	workflowTaskBackoffTimerPrefix = reservedTimerIDPrefix + "workflow_task_backoff/"
+	activityTimeoutTimerPrefix     = reservedTimerIDPrefix + "activity_timeout/"
+	activityRetryTimerPrefix       = reservedTimerIDPrefix + "activity_retry/"
+
+	// executionTimeoutTimerID and runTimeoutTimerID enforce the execution
+	// and run timeouts; a run has at most one of each.
+	executionTimeoutTimerID = reservedTimerIDPrefix + "execution_timeout"
+	runTimeoutTimerID       = reservedTimerIDPrefix + "run_timeout"
+)
+
+// isReservedTimerID reports whether a timer ID is reserved for the history
+// service's own timers.
+func isReservedTimerID(timerID string) bool {
+	return strings.HasPrefix(timerID, reservedTimerIDPrefix)
+}
+
+func workflowTaskTimeoutTimerID(scheduledEventID int64) string {
+	return workflowTaskTimeoutTimerPrefix + strconv.FormatInt(scheduledEventID, 10)
+}
+
+func workflowTaskBackoffTimerID(scheduledEventID int64) string {
+	return workflowTaskBackoffTimerPrefix + strconv.FormatInt(scheduledEventID, 10)
+}
+
+// executionTimeoutType returns the timeout type a run times out with when the
+// timer timerID fires, if it is one of the execution-level timers.
+func executionTimeoutType(timerID string) (string, bool) {
+	switch timerID {
+	case executionTimeoutTimerID:
+		return types.TimeoutTypeExecution, true
+	case runTimeoutTimerID:
+		return types.TimeoutTypeRun, true
+	}
+	return "", false
+}
+
+// activityRetryTimerID returns the ID of the timer that dispatches the next
+// attempt of the activity scheduled at scheduledEventID.
+func activityRetryTimerID(scheduledEventID int64) string {
+	return activityRetryTimerPrefix + strconv.FormatInt(scheduledEventID, 10)
+}
+
+// parseEventTimerID returns the scheduled event ID of the workflow task or
+// activity a reserved timer ID under prefix belongs to.
+func parseEventTimerID(timerID, prefix string) (int64, bool) {
+	rest, ok := strings.CutPrefix(timerID, prefix)
+	if !ok {
+		return 0, false
+	}
+	scheduledEventID, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return scheduledEventID, true
+}
+
+// activityTimeoutTimerID returns the ID of the timer enforcing one timeout of
+// the activity scheduled at scheduledEventID.
+func activityTimeoutTimerID(scheduledEventID int64, timeoutType string) string {
+	return activityTimeoutTimerPrefix + strconv.FormatInt(scheduledEventID, 10) + "/" + timeoutType
+}
+
+// parseActivityTimeoutTimerID is the inverse of activityTimeoutTimerID.
+func parseActivityTimeoutTimerID(timerID string) (int64, string, bool) {
+	rest, ok := strings.CutPrefix(timerID, activityTimeoutTimerPrefix)
+	if !ok {
+		return 0, "", false
+	}
+	id, timeoutType, ok := strings.Cut(rest, "/")
+	if !ok {
+		return 0, "", false
+	}
+	scheduledEventID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return scheduledEventID, timeoutType, true
+}
@@ -0,0 +1,442 @@
+package transfer
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
+	matchingv1 "github.com/linkflow/engine/api/gen/linkflow/matching/v1"
+	"github.com/linkflow/engine/internal/history/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Store is the outbox the processor drains. History writes transfer tasks into
+// it in the same transaction as the events that produced them.
+type Store interface {
+	GetTransferTasks(ctx context.Context, shardID int32, minTaskID int64, batchSize int) ([]*types.TransferTask, error)
+	GetTransferAckLevel(ctx context.Context, shardID int32) (int64, error)
+	CompleteTransferTasks(ctx context.Context, shardID int32, ackLevel int64) error
+}
+
+// Executor carries out the transfer tasks that update another execution
+// instead of going to matching, such as starting a child workflow. It has to
+// be idempotent, since delivery is at least once.
+type Executor interface {
+	ExecuteTransferTask(ctx context.Context, task *types.TransferTask) error
+}
+
+// Config holds configuration for the transfer queue processor.
+type Config struct {
+	Store                Store
+	MatchingClient       matchingv1.MatchingServiceClient
+	Executor             Executor
+	Logger               *slog.Logger
+	BatchSize            int
+	PollInterval         time.Duration
+	DispatchTimeout      time.Duration
+	RetryInitialInterval time.Duration
+	RetryMaxInterval     time.Duration
+	// MaxOutstandingTasks caps the tasks a shard keeps in memory above its
+	// ack level. Once a failing task holds back that many, no more tasks
+	// are read until it is delivered.
+	MaxOutstandingTasks int
+}
+
+// Processor delivers transfer tasks to matching, or to the Executor for tasks
+// that update another execution. Each owned shard gets its own goroutine that
+// reads tasks in task ID order, dispatches them, and moves the ack level
+// forward over the contiguous prefix of delivered tasks. A task that fails is
+// retried with backoff while the tasks after it keep flowing; one that fails
+// with an error retrying cannot fix is dropped. Delivery is at least once;
+// matching deduplicates tasks by their deterministic IDs.
+type Processor struct {
+	cfg    Config
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	shards  map[int32]*shardQueue
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running bool
+}
+
+// NewProcessor creates a new transfer queue processor.
+func NewProcessor(cfg Config) *Processor {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.DispatchTimeout <= 0 {
+		cfg.DispatchTimeout = 5 * time.Second
+	}
+	if cfg.RetryInitialInterval <= 0 {
+		cfg.RetryInitialInterval = 100 * time.Millisecond
+	}
+	if cfg.RetryMaxInterval <= 0 {
+		cfg.RetryMaxInterval = time.Minute
+	}
+	if cfg.MaxOutstandingTasks <= 0 {
+		cfg.MaxOutstandingTasks = 10 * cfg.BatchSize
+	}
+
+	return &Processor{
+		cfg:    cfg,
+		logger: cfg.Logger,
+		shards: make(map[int32]*shardQueue),
+	}
+}
+
+// Start starts the processor. Shards are added with AddShard.
+func (p *Processor) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running {
+		return
+	}
+
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.running = true
+	p.logger.Info("transfer queue processor started")
+}
+
+// Stop stops processing on every shard and waits for the shard goroutines.
+func (p *Processor) Stop() {
+	p.mu.Lock()
+	if !p.running {
+		p.mu.Unlock()
+		return
+	}
+	p.running = false
+	p.cancel()
+	p.shards = make(map[int32]*shardQueue)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	p.logger.Info("transfer queue processor stopped")
+}
+
+// AddShard starts processing the transfer queue of a shard.
+func (p *Processor) AddShard(shardID int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.running {
+		return
+	}
+	if _, exists := p.shards[shardID]; exists {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	q := &shardQueue{
+		processor: p,
+		shardID:   shardID,
+		notifyCh:  make(chan struct{}, 1),
+		cancel:    cancel,
+		delivered: make(map[int64]bool),
+		pending:   make(map[int64]*pendingTask),
+	}
+	p.shards[shardID] = q
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		q.run(ctx)
+	}()
+}
+
+// RemoveShard stops processing the transfer queue of a shard.
+func (p *Processor) RemoveShard(shardID int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if q, exists := p.shards[shardID]; exists {
+		q.cancel()
+		delete(p.shards, shardID)
+	}
+}
+
+// Notify wakes up the shard's processing loop after new tasks were committed,
+// so they are delivered without waiting for the next poll.
+func (p *Processor) Notify(shardID int32) {
+	p.mu.Lock()
+	q, exists := p.shards[shardID]
+	p.mu.Unlock()
+
+	if !exists {
+		return
+	}
+	select {
+	case q.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// pendingTask is a task that was read but failed to be delivered, and is
+// retried once its backoff has passed.
+type pendingTask struct {
+	task        *types.TransferTask
+	attempt     int
+	nextAttempt time.Time
+}
+
+type shardQueue struct {
+	processor *Processor
+	shardID   int32
+	notifyCh  chan struct{}
+	cancel    context.CancelFunc
+
+	// Only the shard's goroutine touches the fields below. Every task read
+	// above the ack level is either delivered or pending; readLevel is the
+	// highest task ID read.
+	ackLevel  int64
+	readLevel int64
+	delivered map[int64]bool
+	pending   map[int64]*pendingTask
+}
+
+func (q *shardQueue) run(ctx context.Context) {
+	p := q.processor
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		ackLevel, err := p.cfg.Store.GetTransferAckLevel(ctx, q.shardID)
+		if err == nil {
+			q.ackLevel = ackLevel
+			q.readLevel = ackLevel
+			break
+		}
+		p.logger.Error("failed to load transfer ack level",
+			slog.Int("shard_id", int(q.shardID)),
+			slog.String("error", err.Error()),
+		)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+
+	for {
+		for q.processBatch(ctx) {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.notifyCh:
+		}
+	}
+}
+
+// processBatch retries the pending tasks that are due, delivers the next
+// batch of tasks and reports whether another batch should be read right away.
+func (q *shardQueue) processBatch(ctx context.Context) bool {
+	p := q.processor
+
+	now := time.Now()
+	for _, taskID := range slices.Sorted(maps.Keys(q.pending)) {
+		pending := q.pending[taskID]
+		if now.Before(pending.nextAttempt) {
+			continue
+		}
+		if !q.dispatch(ctx, pending.task, now) {
+			return false
+		}
+	}
+
+	// Tasks are read past the ones still pending, so a failing task does not
+	// hold back delivery of the tasks after it.
+	var tasks []*types.TransferTask
+	if len(q.delivered)+len(q.pending) < p.cfg.MaxOutstandingTasks {
+		var err error
+		tasks, err = p.cfg.Store.GetTransferTasks(ctx, q.shardID, q.readLevel, p.cfg.BatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.logger.Error("failed to read transfer tasks",
+					slog.Int("shard_id", int(q.shardID)),
+					slog.String("error", err.Error()),
+				)
+			}
+			return false
+		}
+	}
+	for _, task := range tasks {
+		q.readLevel = task.TaskID
+		if !q.dispatch(ctx, task, now) {
+			return false
+		}
+	}
+
+	// The ack level only moves over the contiguous prefix of delivered tasks,
+	// so a pending task holds back deletion of everything after it.
+	newAckLevel := q.ackLevel
+	if len(q.pending) == 0 {
+		newAckLevel = q.readLevel
+	} else {
+		firstPending := slices.Min(slices.Collect(maps.Keys(q.pending)))
+		for _, taskID := range slices.Sorted(maps.Keys(q.delivered)) {
+			if taskID > firstPending {
+				break
+			}
+			newAckLevel = taskID
+		}
+	}
+	if newAckLevel != q.ackLevel {
+		if err := p.cfg.Store.CompleteTransferTasks(ctx, q.shardID, newAckLevel); err != nil {
+			if ctx.Err() == nil {
+				p.logger.Error("failed to update transfer ack level",
+					slog.Int("shard_id", int(q.shardID)),
+					slog.Int64("ack_level", newAckLevel),
+					slog.String("error", err.Error()),
+				)
+			}
+			return false
+		}
+
+		q.ackLevel = newAckLevel
+		for taskID := range q.delivered {
+			if taskID <= newAckLevel {
+				delete(q.delivered, taskID)
+			}
+		}
+	}
+
+	return len(tasks) == p.cfg.BatchSize
+}
+
+// dispatch delivers a task and records whether it was delivered or has to be
+// retried. A task that fails permanently is dropped. It reports false if the
+// shard is being stopped.
+func (q *shardQueue) dispatch(ctx context.Context, task *types.TransferTask, now time.Time) bool {
+	p := q.processor
+
+	err := q.deliver(ctx, task)
+	if err != nil && ctx.Err() != nil {
+		return false
+	}
+	if status.Code(err) == codes.AlreadyExists {
+		// The task was delivered before.
+		err = nil
+	}
+	if err != nil && !isPermanentError(err) {
+		pending, ok := q.pending[task.TaskID]
+		if !ok {
+			pending = &pendingTask{task: task}
+			q.pending[task.TaskID] = pending
+		}
+		pending.attempt++
+		pending.nextAttempt = now.Add(p.retryBackoff(pending.attempt))
+		p.logger.Warn("failed to dispatch transfer task, will retry",
+			slog.Int("shard_id", int(q.shardID)),
+			slog.Int64("task_id", task.TaskID),
+			slog.String("task_type", task.TaskType.String()),
+			slog.String("workflow_id", task.WorkflowID),
+			slog.Int("attempt", pending.attempt),
+			slog.String("error", err.Error()),
+		)
+		return true
+	}
+	if err != nil {
+		p.logger.Error("dropping transfer task that cannot be delivered",
+			slog.Int("shard_id", int(q.shardID)),
+			slog.Int64("task_id", task.TaskID),
+			slog.String("task_type", task.TaskType.String()),
+			slog.String("workflow_id", task.WorkflowID),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	q.delivered[task.TaskID] = true
+	delete(q.pending, task.TaskID)
+	return true
+}
+
+// isPermanentError reports whether a delivery failed in a way that retrying
+// the task cannot fix.
+func isPermanentError(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound, codes.FailedPrecondition,
+		codes.PermissionDenied, codes.OutOfRange, codes.Unimplemented:
+		return true
+	}
+	return false
+}
+
+func (q *shardQueue) deliver(ctx context.Context, task *types.TransferTask) error {
+	p := q.processor
+
+	var taskType commonv1.TaskType
+	switch task.TaskType {
+	case types.TransferTaskTypeWorkflowTask:
+		taskType = commonv1.TaskType_TASK_TYPE_WORKFLOW_TASK
+	case types.TransferTaskTypeActivityTask:
+		taskType = commonv1.TaskType_TASK_TYPE_ACTIVITY_TASK
+	case types.TransferTaskTypeStartChildExecution, types.TransferTaskTypeRecordChildCompletion,
+		types.TransferTaskTypeApplyParentClosePolicy:
+		if p.cfg.Executor == nil {
+			p.logger.Warn("dropping transfer task without an executor",
+				slog.Int("shard_id", int(q.shardID)),
+				slog.Int64("task_id", task.TaskID),
+				slog.String("task_type", task.TaskType.String()),
+			)
+			return nil
+		}
+		execCtx, cancel := context.WithTimeout(ctx, p.cfg.DispatchTimeout)
+		defer cancel()
+		return p.cfg.Executor.ExecuteTransferTask(execCtx, task)
+	default:
+		// Nothing to deliver; let the ack level move past it.
+		p.logger.Warn("dropping transfer task with unknown type",
+			slog.Int("shard_id", int(q.shardID)),
+			slog.Int64("task_id", task.TaskID),
+		)
+		return nil
+	}
+
+	dispatchCtx, cancel := context.WithTimeout(ctx, p.cfg.DispatchTimeout)
+	defer cancel()
+
+	_, err := p.cfg.MatchingClient.AddTask(dispatchCtx, &matchingv1.AddTaskRequest{
+		Namespace: task.NamespaceID,
+		TaskQueue: &matchingv1.TaskQueue{
+			Name: task.TaskQueue,
+			Kind: commonv1.TaskQueueKind_TASK_QUEUE_KIND_NORMAL,
+		},
+		TaskType: taskType,
+		WorkflowExecution: &commonv1.WorkflowExecution{
+			WorkflowId: task.WorkflowID,
+			RunId:      task.RunID,
+		},
+		ScheduledEventId: task.ScheduledEventID,
+	})
+	return err
+}
+
+func (p *Processor) retryBackoff(attempt int) time.Duration {
+	backoff := p.cfg.RetryInitialInterval
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= p.cfg.RetryMaxInterval {
+			return p.cfg.RetryMaxInterval
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,272 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	matchingv1 "github.com/linkflow/engine/api/gen/linkflow/matching/v1"
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/store"
+	"github.com/linkflow/engine/internal/history/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeMatchingClient struct {
+	matchingv1.MatchingServiceClient
+
+	mu       sync.Mutex
+	failures int
+	// errs fails every attempt to add the task of a scheduled event ID.
+	errs  map[int64]error
+	added []int64
+}
+
+func (c *fakeMatchingClient) AddTask(ctx context.Context, req *matchingv1.AddTaskRequest, opts ...grpc.CallOption) (*matchingv1.AddTaskResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failures > 0 {
+		c.failures--
+		return nil, errors.New("matching unavailable")
+	}
+	if err := c.errs[req.GetScheduledEventId()]; err != nil {
+		return nil, err
+	}
+	c.added = append(c.added, req.GetScheduledEventId())
+	return &matchingv1.AddTaskResponse{}, nil
+}
+
+func (c *fakeMatchingClient) addedCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.added)
+}
+
+func writeTasks(t *testing.T, stateStore *store.MemoryMutableStateStore, shardID int32, scheduledEventIDs ...int64) {
+	t.Helper()
+
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-1", RunID: "run-1"}
+	state := engine.NewMutableState(&types.ExecutionInfo{})
+	for _, id := range scheduledEventIDs {
+		state.AddTransferTask(&types.TransferTask{
+			ShardID:          shardID,
+			TaskType:         types.TransferTaskTypeActivityTask,
+			NamespaceID:      key.NamespaceID,
+			WorkflowID:       key.WorkflowID,
+			RunID:            key.RunID,
+			TaskQueue:        "default",
+			ScheduledEventID: id,
+		})
+	}
+	if err := stateStore.UpdateMutableState(context.Background(), key, state, 0); err != nil {
+		t.Fatalf("UpdateMutableState() error = %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestProcessorDeliversAndAcksTasks(t *testing.T) {
+	ctx := context.Background()
+	stateStore := store.NewMemoryMutableStateStore()
+	matching := &fakeMatchingClient{failures: 2}
+
+	p := NewProcessor(Config{
+		Store:                stateStore,
+		MatchingClient:       matching,
+		PollInterval:         10 * time.Millisecond,
+		RetryInitialInterval: time.Millisecond,
+	})
+	p.Start()
+	defer p.Stop()
+
+	writeTasks(t, stateStore, 3, 2, 3, 4)
+	p.AddShard(3)
+
+	waitFor(t, func() bool {
+		ackLevel, _ := stateStore.GetTransferAckLevel(ctx, 3)
+		return ackLevel == 3
+	})
+
+	if got := matching.addedCount(); got != 3 {
+		t.Errorf("delivered %d tasks, want 3", got)
+	}
+	remaining, err := stateStore.GetTransferTasks(ctx, 3, 0, 10)
+	if err != nil {
+		t.Fatalf("GetTransferTasks() error = %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("%d tasks left in the outbox, want 0", len(remaining))
+	}
+}
+
+func TestProcessorDeliversPastFailingTask(t *testing.T) {
+	ctx := context.Background()
+	stateStore := store.NewMemoryMutableStateStore()
+	matching := &fakeMatchingClient{errs: map[int64]error{
+		2: status.Error(codes.Unavailable, "matching unavailable"),
+		3: status.Error(codes.InvalidArgument, "bad task queue"),
+	}}
+
+	p := NewProcessor(Config{
+		Store:                stateStore,
+		MatchingClient:       matching,
+		BatchSize:            1,
+		PollInterval:         10 * time.Millisecond,
+		RetryInitialInterval: time.Millisecond,
+	})
+	p.Start()
+	defer p.Stop()
+
+	// Task 2 keeps failing and task 3 fails permanently and is dropped; the
+	// tasks after them are delivered all the same.
+	writeTasks(t, stateStore, 5, 1, 2, 3, 4, 5)
+	p.AddShard(5)
+
+	waitFor(t, func() bool { return matching.addedCount() == 3 })
+
+	// The ack level stays behind the task that is still being retried.
+	ackLevel, err := stateStore.GetTransferAckLevel(ctx, 5)
+	if err != nil {
+		t.Fatalf("GetTransferAckLevel() error = %v", err)
+	}
+	if ackLevel != 1 {
+		t.Errorf("ack level = %d, want 1", ackLevel)
+	}
+
+	matching.mu.Lock()
+	delete(matching.errs, 2)
+	matching.mu.Unlock()
+	waitFor(t, func() bool {
+		ackLevel, _ := stateStore.GetTransferAckLevel(ctx, 5)
+		return ackLevel == 5
+	})
+	if got := matching.addedCount(); got != 4 {
+		t.Errorf("delivered %d tasks, want 4", got)
+	}
+}
+
+func TestProcessorNotify(t *testing.T) {
+	ctx := context.Background()
+	stateStore := store.NewMemoryMutableStateStore()
+	matching := &fakeMatchingClient{}
+
+	p := NewProcessor(Config{
+		Store:          stateStore,
+		MatchingClient: matching,
+		PollInterval:   time.Hour,
+	})
+	p.Start()
+	defer p.Stop()
+
+	p.AddShard(1)
+	writeTasks(t, stateStore, 1, 7)
+	p.Notify(1)
+
+	waitFor(t, func() bool {
+		ackLevel, _ := stateStore.GetTransferAckLevel(ctx, 1)
+		return ackLevel == 1
+	})
+}
+
+type fakeExecutor struct {
+	mu       sync.Mutex
+	executed []types.TransferTaskType
+}
+
+func (e *fakeExecutor) ExecuteTransferTask(ctx context.Context, task *types.TransferTask) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.executed = append(e.executed, task.TaskType)
+	return nil
+}
+
+func TestProcessorRunsExecutorTasks(t *testing.T) {
+	ctx := context.Background()
+	stateStore := store.NewMemoryMutableStateStore()
+	matching := &fakeMatchingClient{}
+	executor := &fakeExecutor{}
+
+	p := NewProcessor(Config{
+		Store:          stateStore,
+		MatchingClient: matching,
+		Executor:       executor,
+		PollInterval:   10 * time.Millisecond,
+	})
+	p.Start()
+	defer p.Stop()
+
+	key := types.ExecutionKey{NamespaceID: "default", WorkflowID: "wf-1", RunID: "run-1"}
+	state := engine.NewMutableState(&types.ExecutionInfo{})
+	for _, taskType := range []types.TransferTaskType{
+		types.TransferTaskTypeStartChildExecution,
+		types.TransferTaskTypeActivityTask,
+		types.TransferTaskTypeRecordChildCompletion,
+	} {
+		state.AddTransferTask(&types.TransferTask{
+			ShardID:     2,
+			TaskType:    taskType,
+			NamespaceID: key.NamespaceID,
+			WorkflowID:  key.WorkflowID,
+			RunID:       key.RunID,
+			TaskQueue:   "default",
+		})
+	}
+	if err := stateStore.UpdateMutableState(ctx, key, state, 0); err != nil {
+		t.Fatalf("UpdateMutableState() error = %v", err)
+	}
+	p.AddShard(2)
+
+	waitFor(t, func() bool {
+		ackLevel, _ := stateStore.GetTransferAckLevel(ctx, 2)
+		return ackLevel == 3
+	})
+
+	if got := matching.addedCount(); got != 1 {
+		t.Errorf("delivered %d tasks to matching, want 1", got)
+	}
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+	want := []types.TransferTaskType{types.TransferTaskTypeStartChildExecution, types.TransferTaskTypeRecordChildCompletion}
+	if len(executor.executed) != len(want) || executor.executed[0] != want[0] || executor.executed[1] != want[1] {
+		t.Errorf("executed %v, want %v", executor.executed, want)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := NewProcessor(Config{
+		RetryInitialInterval: 100 * time.Millisecond,
+		RetryMaxInterval:     time.Second,
+	})
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 100 * time.Millisecond},
+		{attempt: 2, want: 200 * time.Millisecond},
+		{attempt: 4, want: 800 * time.Millisecond},
+		{attempt: 5, want: time.Second},
+		{attempt: 50, want: time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := p.retryBackoff(tt.attempt); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -8,6 +8,9 @@ import (
 var (
 	ErrExecutionNotFound = errors.New("execution not found")
 	ErrOptimisticLock    = errors.New("optimistic lock failure")
+	// ErrShardOwnershipLost is returned when a write is fenced off because
+	// another host acquired the shard with a higher range ID.
+	ErrShardOwnershipLost = errors.New("shard ownership lost")
 )
 
 type EventType int32
@@ -38,6 +41,15 @@ const (
 	EventTypeWorkflowTaskCompleted
 	EventTypeWorkflowTaskFailed
 	EventTypeWorkflowTaskTimedOut
+	EventTypeExecutionContinuedAsNew
+	EventTypeChildExecutionInitiated
+	EventTypeChildExecutionStarted
+	EventTypeChildExecutionCompleted
+	EventTypeChildExecutionFailed
+	EventTypeExecutionCancelRequested
+	EventTypeExecutionCanceled
+	EventTypeNodeCanceled
+	EventTypeExecutionTimedOut
 )
 
 func (e EventType) String() string {
@@ -67,6 +79,17 @@ func (e EventType) String() string {
 		EventTypeWorkflowTaskCompleted: "WorkflowTaskCompleted",
 		EventTypeWorkflowTaskFailed:    "WorkflowTaskFailed",
 		EventTypeWorkflowTaskTimedOut:  "WorkflowTaskTimedOut",
+
+		EventTypeExecutionContinuedAsNew: "ExecutionContinuedAsNew",
+		EventTypeChildExecutionInitiated: "ChildExecutionInitiated",
+		EventTypeChildExecutionStarted:   "ChildExecutionStarted",
+		EventTypeChildExecutionCompleted: "ChildExecutionCompleted",
+		EventTypeChildExecutionFailed:    "ChildExecutionFailed",
+
+		EventTypeExecutionCancelRequested: "ExecutionCancelRequested",
+		EventTypeExecutionCanceled:        "ExecutionCanceled",
+		EventTypeNodeCanceled:             "NodeCanceled",
+		EventTypeExecutionTimedOut:        "ExecutionTimedOut",
 	}
 	if name, ok := names[e]; ok {
 		return name
@@ -83,6 +106,8 @@ const (
 	ExecutionStatusFailed
 	ExecutionStatusTerminated
 	ExecutionStatusTimedOut
+	ExecutionStatusContinuedAsNew
+	ExecutionStatusCanceled
 )
 
 type ExecutionKey struct {
@@ -106,6 +131,31 @@ type ExecutionInfo struct {
 	TaskTimeout       time.Duration
 	LastEventTaskID   int64
 	LastProcessedNode string
+
+	// ExecutionExpirationTime is when ExecutionTimeout runs out. It is
+	// counted from the start of the first run and carried over to the runs
+	// continued from it, whereas RunTimeout starts over with every run.
+	ExecutionExpirationTime time.Time
+
+	// CreateRequestID is the ID of the start request that created the run.
+	CreateRequestID string
+
+	// FirstRunID is the run that started the chain of runs this one was
+	// continued as new from; it is the run itself for a run that was not.
+	// ContinuedFromRunID and NewRunID link the previous and the next run
+	// of the chain.
+	FirstRunID         string
+	ContinuedFromRunID string
+	NewRunID           string
+
+	// ParentExecution is the run that started this one as a child, and
+	// ParentInitiatedEventID the event of the parent that initiated it.
+	ParentExecution        *ExecutionKey
+	ParentInitiatedEventID int64
+
+	// CancelRequested is set once a cancel of the run was requested; the
+	// run keeps going until its decider closes it as canceled.
+	CancelRequested bool
 }
 
 type ActivityInfo struct {
@@ -124,8 +174,37 @@ type ActivityInfo struct {
 	StartToClose     time.Duration
 	HeartbeatDetails []byte
 	LastHeartbeat    time.Time
+	RequestID        string
+	RetryPolicy      *RetryPolicy
+
+	// CancelRequested tells the worker running the activity to stop on
+	// its next heartbeat.
+	CancelRequested bool
+}
+
+// ChildExecutionInfo is a child workflow execution started for a node that
+// has not closed yet. StartedEventID is zero until the child was created.
+type ChildExecutionInfo struct {
+	InitiatedEventID  int64
+	StartedEventID    int64
+	NodeID            string
+	WorkflowID        string
+	RunID             string
+	WorkflowType      string
+	ParentClosePolicy ParentClosePolicy
 }
 
+// ParentClosePolicy decides what happens to a running child execution when
+// its parent closes. The values match the API's ParentClosePolicy.
+type ParentClosePolicy int32
+
+const (
+	ParentClosePolicyUnspecified ParentClosePolicy = iota
+	ParentClosePolicyTerminate
+	ParentClosePolicyAbandon
+	ParentClosePolicyRequestCancel
+)
+
 type TimerInfo struct {
 	TimerID        string
 	StartedEventID int64
@@ -134,6 +213,20 @@ type TimerInfo struct {
 	TaskStatus     int32
 }
 
+// WorkflowTaskInfo is the workflow task of an execution that is scheduled or
+// started and not yet completed. StartedEventID is zero until a worker picks
+// the task up.
+type WorkflowTaskInfo struct {
+	ScheduledEventID int64
+	StartedEventID   int64
+	Attempt          int32
+	TaskQueue        string
+	StartToClose     time.Duration
+	ScheduledTime    time.Time
+	StartedTime      time.Time
+	RequestID        string
+}
+
 type NodeResult struct {
 	NodeID         string
 	CompletedTime  time.Time
@@ -160,6 +253,22 @@ type ExecutionStartedAttributes struct {
 	TaskTimeout      time.Duration
 	ParentExecution  *ExecutionKey
 	Initiator        string
+
+	// ContinuedFromRunID and FirstRunID are set on a run started by
+	// continue-as-new.
+	ContinuedFromRunID string
+	FirstRunID         string
+
+	// ParentInitiatedEventID is set with ParentExecution on a child run.
+	ParentInitiatedEventID int64
+
+	// ExpirationTime is set on a run continued as new to the execution
+	// expiration time of the run it continued from.
+	ExpirationTime time.Time
+
+	// RequestID identifies the start request that created the run, so that
+	// a retried request finds the run instead of starting another one.
+	RequestID string
 }
 
 type ExecutionCompletedAttributes struct {
@@ -176,17 +285,61 @@ type ExecutionTerminatedAttributes struct {
 	Identity string
 }
 
+// ExecutionCancelRequestedAttributes asks the decider to run the cleanup of
+// the workflow and close the run as canceled.
+type ExecutionCancelRequestedAttributes struct {
+	Reason    string
+	Identity  string
+	RequestID string
+}
+
+// ExecutionCanceledAttributes closes a run whose cancel was requested.
+type ExecutionCanceledAttributes struct {
+	Details []byte
+}
+
+// ExecutionTimedOutAttributes closes a run that ran past its execution or
+// run timeout; TimeoutType tells which.
+type ExecutionTimedOutAttributes struct {
+	TimeoutType string
+}
+
+// ExecutionContinuedAsNewAttributes closes a run in favour of the new run
+// NewRunID, which is started with the given type, task queue and input in
+// the same update.
+type ExecutionContinuedAsNewAttributes struct {
+	NewRunID     string
+	WorkflowType string
+	TaskQueue    string
+	Input        []byte
+	RunTimeout   time.Duration
+	TaskTimeout  time.Duration
+}
+
+// InitiatorContinueAsNew is the initiator recorded on the started event of a
+// run created by continue-as-new.
+const InitiatorContinueAsNew = "ContinueAsNew"
+
+// InitiatorParent is the initiator recorded on the started event of a child
+// run.
+const InitiatorParent = "Parent"
+
 type NodeScheduledAttributes struct {
-	NodeID    string
-	NodeType  string
-	Input     []byte
-	TaskQueue string
+	NodeID           string
+	NodeType         string
+	Input            []byte
+	TaskQueue        string
+	ScheduleToStart  time.Duration
+	StartToClose     time.Duration
+	HeartbeatTimeout time.Duration
+	RetryPolicy      *RetryPolicy
 }
 
 type NodeStartedAttributes struct {
 	NodeID           string
 	ScheduledEventID int64
 	Identity         string
+	RequestID        string
 }
 
 type NodeCompletedAttributes struct {
@@ -207,6 +360,42 @@ type NodeFailedAttributes struct {
 	Logs             []byte
 }
 
+// NodeCanceledAttributes closes a node that was stopped because a cancel of
+// its run was requested. StartedEventID is zero for a node that never
+// started.
+type NodeCanceledAttributes struct {
+	NodeID           string
+	ScheduledEventID int64
+	StartedEventID   int64
+	Details          []byte
+	Identity         string
+}
+
+// Retry states recorded on failed nodes. RetryStateInProgress is never
+// recorded; it is what a failure that is retried would have got.
+const (
+	RetryStateInProgress             int32 = 1
+	RetryStateNonRetryableFailure    int32 = 2
+	RetryStateMaximumAttemptsReached int32 = 3
+	RetryStateRetryPolicyNotSet      int32 = 4
+)
+
+type NodeTimedOutAttributes struct {
+	NodeID           string
+	ScheduledEventID int64
+	StartedEventID   int64
+	TimeoutType      string
+}
+
+// Timeout types recorded on timed out nodes, workflow tasks and runs.
+const (
+	TimeoutTypeScheduleToStart = "ScheduleToStart"
+	TimeoutTypeStartToClose    = "StartToClose"
+	TimeoutTypeHeartbeat       = "Heartbeat"
+	TimeoutTypeExecution       = "Execution"
+	TimeoutTypeRun             = "Run"
+)
+
 type TimerStartedAttributes struct {
 	TimerID     string
 	StartToFire time.Duration
@@ -260,12 +449,14 @@ type RetryPolicy struct {
 	BackoffCoefficient float64
 	MaxInterval        time.Duration
 	MaxAttempts        int32
+	NonRetryableErrors []string
 }
 
 type SignalReceivedAttributes struct {
 	SignalName string
 	Input      []byte
 	Identity   string
+	RequestID  string
 }
 
 type MarkerRecordedAttributes struct {
@@ -273,6 +464,11 @@ type MarkerRecordedAttributes struct {
 	Details    map[string][]byte
 }
 
+// MarkerNameHistoryLimitWarning is the marker recorded once a run's history
+// crosses a soft limit. Its details hold the history size and length at
+// that point.
+const MarkerNameHistoryLimitWarning = "HistoryLimitWarning"
+
 type WorkflowTaskScheduledAttributes struct {
 	TaskQueue    string
 	StartToClose time.Duration
@@ -307,3 +503,111 @@ type WorkflowTaskTimedOutAttributes struct {
 	StartedEventID   int64
 	TimeoutType      string
 }
+
+// ChildExecutionInitiatedAttributes starts a child execution for a node. The
+// run ID is chosen up front, so creating the child can be retried.
+type ChildExecutionInitiatedAttributes struct {
+	NodeID            string
+	WorkflowID        string
+	RunID             string
+	WorkflowType      string
+	TaskQueue         string
+	Input             []byte
+	ExecutionTimeout  time.Duration
+	RunTimeout        time.Duration
+	TaskTimeout       time.Duration
+	ParentClosePolicy ParentClosePolicy
+}
+
+type ChildExecutionStartedAttributes struct {
+	InitiatedEventID int64
+	WorkflowID       string
+	RunID            string
+	WorkflowType     string
+}
+
+// ChildExecutionCompletedAttributes records the result of a child. RunID is
+// the run that completed, which differs from the started one if the child
+// continued as new.
+type ChildExecutionCompletedAttributes struct {
+	InitiatedEventID int64
+	StartedEventID   int64
+	WorkflowID       string
+	RunID            string
+	Result           []byte
+}
+
+// ChildExecutionFailedAttributes records a child that failed, was terminated
+// or timed out; Status tells them apart.
+type ChildExecutionFailedAttributes struct {
+	InitiatedEventID int64
+	StartedEventID   int64
+	WorkflowID       string
+	RunID            string
+	Status           ExecutionStatus
+	Reason           string
+	Details          []byte
+}
+
+type TransferTaskType int32
+
+const (
+	TransferTaskTypeUnspecified TransferTaskType = iota
+	TransferTaskTypeWorkflowTask
+	TransferTaskTypeActivityTask
+	// TransferTaskTypeStartChildExecution creates the child execution
+	// initiated at ScheduledEventID.
+	TransferTaskTypeStartChildExecution
+	// TransferTaskTypeRecordChildCompletion reports the close event
+	// ScheduledEventID of a child run to its parent.
+	TransferTaskTypeRecordChildCompletion
+	// TransferTaskTypeApplyParentClosePolicy applies the parent close policy
+	// to the child initiated at ScheduledEventID of a closed run.
+	TransferTaskTypeApplyParentClosePolicy
+)
+
+func (t TransferTaskType) String() string {
+	switch t {
+	case TransferTaskTypeWorkflowTask:
+		return "WorkflowTask"
+	case TransferTaskTypeActivityTask:
+		return "ActivityTask"
+	case TransferTaskTypeStartChildExecution:
+		return "StartChildExecution"
+	case TransferTaskTypeRecordChildCompletion:
+		return "RecordChildCompletion"
+	case TransferTaskTypeApplyParentClosePolicy:
+		return "ApplyParentClosePolicy"
+	default:
+		return "Unspecified"
+	}
+}
+
+// TransferTask is an outbox entry that hands a workflow or activity task over
+// to matching, or has history update another execution. It is committed in
+// the same transaction as the events that produced it and deleted once the
+// transfer queue has delivered it.
+type TransferTask struct {
+	ShardID          int32
+	TaskID           int64
+	TaskType         TransferTaskType
+	NamespaceID      string
+	WorkflowID       string
+	RunID            string
+	TaskQueue        string
+	ScheduledEventID int64
+	VisibilityTime   time.Time
+}
+
+// TimerTask is a durable timer for the timer service. Like TransferTask it is
+// committed in the same transaction as the events that produced it. A
+// canceled task cancels the pending timer with the same ID instead.
+type TimerTask struct {
+	ShardID     int32
+	NamespaceID string
+	WorkflowID  string
+	RunID       string
+	TimerID     string
+	FireTime    time.Time
+	Canceled    bool
+}
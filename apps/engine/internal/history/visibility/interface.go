@@ -31,6 +31,11 @@ type WorkflowExecutionInfo struct {
 	Status        commonv1.ExecutionStatus
 	HistoryLength int64
 	Memo          *commonv1.Memo
+
+	// ContinuedFromRunID and NewRunID link the runs of a workflow that
+	// continued as new.
+	ContinuedFromRunID string
+	NewRunID           string
 }
 
 // Store defines the interface for visibility storage.
@@ -49,6 +54,9 @@ type RecordWorkflowExecutionStartedRequest struct {
 	StartTime    time.Time
 	Status       commonv1.ExecutionStatus
 	Memo         *commonv1.Memo
+
+	// ContinuedFromRunID is the run this one continued as new from, if any.
+	ContinuedFromRunID string
 }
 
 type RecordWorkflowExecutionClosedRequest struct {
@@ -60,4 +68,7 @@ type RecordWorkflowExecutionClosedRequest struct {
 	Status        commonv1.ExecutionStatus
 	HistoryLength int64
 	Memo          *commonv1.Memo
+
+	// NewRunID is the run a run closed as continued-as-new continued to.
+	NewRunID string
 }
@@ -29,6 +29,8 @@ func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
 //     status INT NOT NULL,
 //     history_length BIGINT,
 //     memo BYTEA,
+//     continued_from_run_id VARCHAR(64),
+//     new_run_id VARCHAR(64),
 //     PRIMARY KEY (namespace_id, run_id)
 // );
 // CREATE INDEX idx_visibility_open ON executions_visibility (namespace_id, start_time DESC) WHERE status = 1;
@@ -39,10 +41,11 @@ func (s *PostgresStore) RecordWorkflowExecutionStarted(ctx context.Context, req
 
 	_, err := s.pool.Exec(ctx, `
 		INSERT INTO executions_visibility (
-			namespace_id, workflow_id, run_id, workflow_type, start_time, status, memo
-		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+			namespace_id, workflow_id, run_id, workflow_type, start_time, status, memo,
+			continued_from_run_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
 		ON CONFLICT (namespace_id, run_id) DO UPDATE SET
-			status = $6, start_time = $5, memo = $7
+			status = $6, start_time = $5, memo = $7, continued_from_run_id = NULLIF($8, '')
 	`,
 		req.NamespaceID,
 		req.Execution.WorkflowId,
@@ -51,6 +54,7 @@ func (s *PostgresStore) RecordWorkflowExecutionStarted(ctx context.Context, req
 		req.StartTime,
 		int32(req.Status),
 		memoBytes,
+		req.ContinuedFromRunID,
 	)
 	return err
 }
@@ -60,7 +64,7 @@ func (s *PostgresStore) RecordWorkflowExecutionClosed(ctx context.Context, req *
 
 	_, err := s.pool.Exec(ctx, `
 		UPDATE executions_visibility
-		SET status = $1, close_time = $2, history_length = $3, memo = $4
+		SET status = $1, close_time = $2, history_length = $3, memo = $4, new_run_id = NULLIF($7, '')
 		WHERE namespace_id = $5 AND run_id = $6
 	`,
 		int32(req.Status),
@@ -69,6 +73,7 @@ func (s *PostgresStore) RecordWorkflowExecutionClosed(ctx context.Context, req *
 		memoBytes,
 		req.NamespaceID,
 		req.Execution.RunId,
+		req.NewRunID,
 	)
 	return err
 }
@@ -85,7 +90,8 @@ func (s *PostgresStore) listExecutions(ctx context.Context, req *ListRequest, op
 	var query string
 	if open {
 		query = `
-			SELECT workflow_id, run_id, workflow_type, start_time, close_time, status, memo
+			SELECT workflow_id, run_id, workflow_type, start_time, close_time, status, memo,
+				continued_from_run_id, new_run_id
 			FROM executions_visibility
 			WHERE namespace_id = $1 AND status = 1
 			ORDER BY start_time DESC
@@ -93,7 +99,8 @@ func (s *PostgresStore) listExecutions(ctx context.Context, req *ListRequest, op
 		`
 	} else {
 		query = `
-			SELECT workflow_id, run_id, workflow_type, start_time, close_time, status, memo
+			SELECT workflow_id, run_id, workflow_type, start_time, close_time, status, memo,
+				continued_from_run_id, new_run_id
 			FROM executions_visibility
 			WHERE namespace_id = $1 AND status != 1
 			ORDER BY close_time DESC
@@ -120,8 +127,9 @@ func (s *PostgresStore) listExecutions(ctx context.Context, req *ListRequest, op
 		var start, close *time.Time
 		var status int32
 		var memoBytes []byte
+		var continuedFrom, newRun *string
 
-		if err := rows.Scan(&wid, &rid, &wtype, &start, &close, &status, &memoBytes); err != nil {
+		if err := rows.Scan(&wid, &rid, &wtype, &start, &close, &status, &memoBytes, &continuedFrom, &newRun); err != nil {
 			return nil, err
 		}
 
@@ -136,6 +144,12 @@ func (s *PostgresStore) listExecutions(ctx context.Context, req *ListRequest, op
 		if close != nil {
 			info.CloseTime = *close
 		}
+		if continuedFrom != nil {
+			info.ContinuedFromRunID = *continuedFrom
+		}
+		if newRun != nil {
+			info.NewRunID = *newRun
+		}
 
 		if len(memoBytes) > 0 {
 			var memo commonv1.Memo
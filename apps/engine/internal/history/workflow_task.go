@@ -0,0 +1,67 @@
+package history
+
+import (
+	"time"
+
+	"github.com/linkflow/engine/internal/history/engine"
+	"github.com/linkflow/engine/internal/history/types"
+)
+
+const (
+	// defaultWorkflowTaskTimeout bounds a workflow task of a run that was
+	// started without a task timeout.
+	defaultWorkflowTaskTimeout = 10 * time.Second
+
+	// Workflow task backoff starts after this many consecutive failed
+	// attempts and doubles from the initial interval up to the maximum.
+	workflowTaskBackoffAfter   = 2
+	workflowTaskBackoffInitial = time.Second
+	workflowTaskBackoffMax     = 10 * time.Minute
+)
+
+// workflowTaskStartToClose returns how long a started workflow task of the
+// run may take before it times out.
+func workflowTaskStartToClose(info *types.ExecutionInfo) time.Duration {
+	if info.TaskTimeout > 0 {
+		return info.TaskTimeout
+	}
+	return defaultWorkflowTaskTimeout
+}
+
+// workflowTaskBackoff returns how long the workflow task of the given attempt
+// waits before it is dispatched. The first attempts go out right away so a
+// single failure costs no latency; after that the delay doubles so a decider
+// that fails every time cannot keep the workers busy.
+func workflowTaskBackoff(attempt int32) time.Duration {
+	if attempt <= workflowTaskBackoffAfter {
+		return 0
+	}
+	backoff := workflowTaskBackoffInitial
+	for i := attempt - workflowTaskBackoffAfter - 1; i > 0; i-- {
+		backoff *= 2
+		if backoff >= workflowTaskBackoffMax {
+			return workflowTaskBackoffMax
+		}
+	}
+	return backoff
+}
+
+// workflowTaskTimedOutEvent returns the event timing out the workflow task
+// scheduled at scheduledEventID, or nil if that task is no longer the started
+// pending one.
+func workflowTaskTimedOutEvent(state *engine.MutableState, scheduledEventID int64) *types.HistoryEvent {
+	task := state.WorkflowTask
+	if !state.IsWorkflowExecutionRunning() || task == nil ||
+		task.ScheduledEventID != scheduledEventID || task.StartedEventID == 0 {
+		return nil
+	}
+	return &types.HistoryEvent{
+		EventType: types.EventTypeWorkflowTaskTimedOut,
+		Timestamp: time.Now(),
+		Attributes: &types.WorkflowTaskTimedOutAttributes{
+			ScheduledEventID: task.ScheduledEventID,
+			StartedEventID:   task.StartedEventID,
+			TimeoutType:      types.TimeoutTypeStartToClose,
+		},
+	}
+}
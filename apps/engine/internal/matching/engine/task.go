@@ -24,6 +24,10 @@ type Task struct {
 	Priority         int32
 	TaskType         int32
 	ScheduledEventID int64
+
+	// QueryType is the query a query task asks, with its arguments in
+	// Input.
+	QueryType string
 }
 
 type Poller struct {
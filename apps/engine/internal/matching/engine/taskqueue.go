@@ -287,6 +287,21 @@ func (tq *TaskQueue) CompleteTask(taskID string) bool {
 	return acked
 }
 
+// ExtendLease pushes the lease of an in-flight task back by the lease
+// timeout, so a task whose worker is still heartbeating is not requeued. It
+// returns false if the task is not in flight, e.g. because its lease already
+// expired.
+func (tq *TaskQueue) ExtendLease(taskID string) bool {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	if _, exists := tq.inFlight[taskID]; !exists {
+		return false
+	}
+	tq.inFlightExpiry[taskID] = time.Now().Add(tq.leaseTimeout)
+	return true
+}
+
 func (tq *TaskQueue) tryDispatchLocked(task *Task) bool {
 	elem := tq.pollers.Front()
 	if elem == nil {
@@ -197,3 +197,35 @@ func TestTaskQueue_RateLimiting(t *testing.T) {
 func taskID(i int) string {
 	return fmt.Sprintf("task-%d", i)
 }
+
+func TestTaskQueue_ExtendLease(t *testing.T) {
+	tq := NewTaskQueue("test-queue", TaskQueueKindNormal, 1000, 100, nil)
+	tq.leaseTimeout = 50 * time.Millisecond
+
+	if err := tq.AddTask(&Task{ID: "task-1", WorkflowID: "workflow-1", ScheduledTime: time.Now()}); err != nil {
+		t.Fatalf("AddTask error = %v", err)
+	}
+	if tq.ExtendLease("task-1") {
+		t.Error("ExtendLease should return false for a task that is not in flight")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := tq.Poll(ctx, "worker-1"); err != nil {
+		t.Fatalf("Poll error = %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !tq.ExtendLease("task-1") {
+		t.Fatal("ExtendLease should return true for an in-flight task")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := tq.RequeueExpiredTasks(); n != 0 {
+		t.Errorf("RequeueExpiredTasks = %d, want 0 after the lease was extended", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if n := tq.RequeueExpiredTasks(); n != 1 {
+		t.Errorf("RequeueExpiredTasks = %d, want 1 after the extended lease expired", n)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -11,6 +12,8 @@ import (
 	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
 	matchingv1 "github.com/linkflow/engine/api/gen/linkflow/matching/v1"
 	"github.com/linkflow/engine/internal/matching/engine"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type GRPCServer struct {
@@ -122,11 +125,17 @@ func (s *GRPCServer) PollTask(ctx context.Context, req *matchingv1.PollTaskReque
 		StartedEventId: 1, // Placeholder
 	}
 
-	if commonv1.TaskType(task.TaskType) == commonv1.TaskType_TASK_TYPE_WORKFLOW_TASK {
+	switch commonv1.TaskType(task.TaskType) {
+	case commonv1.TaskType_TASK_TYPE_WORKFLOW_TASK:
 		resp.WorkflowTaskInfo = &matchingv1.WorkflowTaskInfo{
 			ScheduledEventId: task.ScheduledEventID,
 		}
-	} else {
+	case commonv1.TaskType_TASK_TYPE_QUERY_TASK:
+		resp.QueryTaskInfo = &matchingv1.QueryTaskInfo{
+			QueryType: task.QueryType,
+			QueryArgs: &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: task.Input}}},
+		}
+	default:
 		resp.ActivityTaskInfo = &matchingv1.ActivityTaskInfo{
 			ActivityId:       task.ActivityID,
 			ActivityType:     task.ActivityType,
@@ -151,6 +160,13 @@ func (s *GRPCServer) CompleteTask(ctx context.Context, req *matchingv1.CompleteT
 		return nil, fmt.Errorf("invalid task token")
 	}
 
+	if query := req.GetQueryTaskCompletion(); query != nil {
+		if err := s.service.RespondQueryTask(ctx, queueName, taskID, firstPayload(query.GetQueryResult()), query.GetErrorMessage()); err != nil {
+			return nil, err
+		}
+		return &matchingv1.CompleteTaskResponse{}, nil
+	}
+
 	if err := s.service.CompleteTask(ctx, queueName, taskID); err != nil && err != ErrTaskNotFound {
 		return nil, err
 	}
@@ -159,12 +175,83 @@ func (s *GRPCServer) CompleteTask(ctx context.Context, req *matchingv1.CompleteT
 	return &matchingv1.CompleteTaskResponse{}, nil
 }
 
+// QueryWorkflow hands the query to a worker polling the workflow's task
+// queue as a query task and returns the worker's answer. It waits until the
+// deadline of ctx, which the caller sets to the query timeout.
 func (s *GRPCServer) QueryWorkflow(ctx context.Context, req *matchingv1.MatchingServiceQueryWorkflowRequest) (*matchingv1.MatchingServiceQueryWorkflowResponse, error) {
-	return &matchingv1.MatchingServiceQueryWorkflowResponse{}, nil
+	if req.GetWorkflowExecution().GetWorkflowId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "workflow_id is required")
+	}
+	if req.GetQuery().GetQueryType() == "" {
+		return nil, status.Error(codes.InvalidArgument, "query_type is required")
+	}
+
+	rawToken, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	queueName := req.GetTaskQueue().GetName()
+	if queueName == "" {
+		queueName = "default"
+	}
+
+	// Every query is a task of its own; the random part of the ID keeps two
+	// identical queries apart.
+	taskID := "query:" + string(rawToken[:16])
+	task := &engine.Task{
+		ID:            taskID,
+		Token:         []byte(fmt.Sprintf("%s|%s|%s|%s", req.GetNamespace(), queueName, taskID, string(rawToken))),
+		WorkflowID:    req.GetWorkflowExecution().GetWorkflowId(),
+		RunID:         req.GetWorkflowExecution().GetRunId(),
+		Namespace:     req.GetNamespace(),
+		ScheduledTime: time.Now().UTC(),
+		TaskType:      int32(commonv1.TaskType_TASK_TYPE_QUERY_TASK),
+		QueryType:     req.GetQuery().GetQueryType(),
+		Input:         firstPayload(req.GetQuery().GetQueryArgs()),
+	}
+
+	result, err := s.service.QueryWorkflow(ctx, queueName, task)
+	if err != nil {
+		if errors.Is(err, ErrQueryTimedOut) {
+			return nil, status.Error(codes.DeadlineExceeded, err.Error())
+		}
+		if errors.Is(err, ErrQueryFailed) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, err
+	}
+
+	return &matchingv1.MatchingServiceQueryWorkflowResponse{
+		QueryResult: &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: result}}},
+	}, nil
 }
 
+func firstPayload(payloads *commonv1.Payloads) []byte {
+	if len(payloads.GetPayloads()) == 0 {
+		return nil
+	}
+	return payloads.GetPayloads()[0].GetData()
+}
+
+// HeartbeatTask extends the lease of an activity task that is still being
+// worked on. Whether the activity was cancelled is up to history, which the
+// worker heartbeats as well, so CancelRequested is never set here.
 func (s *GRPCServer) HeartbeatTask(ctx context.Context, req *matchingv1.HeartbeatTaskRequest) (*matchingv1.HeartbeatTaskResponse, error) {
-	return &matchingv1.HeartbeatTaskResponse{CancelRequested: false}, nil
+	_, queueName, taskID, err := parseTaskToken(req.GetTaskToken())
+	if err != nil {
+		return nil, err
+	}
+	if queueName == "" || taskID == "" {
+		return nil, fmt.Errorf("invalid task token")
+	}
+
+	// A task whose lease already ran out may have been handed to another
+	// worker, but history only lets one of them start the activity, so the
+	// heartbeat is not rejected.
+	if err := s.service.HeartbeatTask(ctx, queueName, taskID); err != nil && err != ErrTaskNotFound && err != ErrTaskQueueNotFound {
+		return nil, err
+	}
+	return &matchingv1.HeartbeatTaskResponse{}, nil
 }
 
 func parseTaskToken(token []byte) (namespace string, queueName string, taskID string, err error) {
@@ -1,7 +1,14 @@
 package matching
 
 import (
+	"context"
 	"testing"
+	"time"
+
+	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
+	matchingv1 "github.com/linkflow/engine/api/gen/linkflow/matching/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestGenerateTaskID(t *testing.T) {
@@ -89,3 +96,78 @@ func TestGenerateSecureToken(t *testing.T) {
 		t.Error("generateSecureToken() should produce unique tokens")
 	}
 }
+
+func TestQueryWorkflow(t *testing.T) {
+	ctx := context.Background()
+	server := NewGRPCServer(NewService(Config{}))
+	queue := &matchingv1.TaskQueue{Name: "queries"}
+	query := func(ctx context.Context, queryType string) (*matchingv1.MatchingServiceQueryWorkflowResponse, error) {
+		return server.QueryWorkflow(ctx, &matchingv1.MatchingServiceQueryWorkflowRequest{
+			Namespace:         "default",
+			TaskQueue:         queue,
+			WorkflowExecution: &commonv1.WorkflowExecution{WorkflowId: "wf-1", RunId: "run-1"},
+			Query:             &matchingv1.QueryInput{QueryType: queryType},
+		})
+	}
+	type answer struct {
+		resp *matchingv1.MatchingServiceQueryWorkflowResponse
+		err  error
+	}
+	// ask starts a query and answers it the way a worker polling the queue
+	// does.
+	ask := func(queryType string, completion *matchingv1.QueryTaskCompletion) answer {
+		t.Helper()
+		answered := make(chan answer, 1)
+		go func() {
+			resp, err := query(ctx, queryType)
+			answered <- answer{resp, err}
+		}()
+
+		pollCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		task, err := server.PollTask(pollCtx, &matchingv1.PollTaskRequest{Namespace: "default", TaskQueue: queue})
+		if err != nil {
+			t.Fatalf("PollTask() error = %v", err)
+		}
+		if got := task.GetQueryTaskInfo().GetQueryType(); got != queryType {
+			t.Fatalf("polled query %q, want %q", got, queryType)
+		}
+		_, err = server.CompleteTask(ctx, &matchingv1.CompleteTaskRequest{
+			TaskToken:  task.GetTaskToken(),
+			Namespace:  "default",
+			Completion: &matchingv1.CompleteTaskRequest_QueryTaskCompletion{QueryTaskCompletion: completion},
+		})
+		if err != nil {
+			t.Fatalf("CompleteTask() error = %v", err)
+		}
+
+		select {
+		case a := <-answered:
+			return a
+		case <-pollCtx.Done():
+			t.Fatal("query not answered")
+			return answer{}
+		}
+	}
+
+	// A query nobody answers in time fails, and its task is dropped instead
+	// of being handed to the next poller.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err := query(timeoutCtx, "stale")
+	cancel()
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("unanswered QueryWorkflow() error = %v, want DeadlineExceeded", err)
+	}
+
+	got := ask("progress", &matchingv1.QueryTaskCompletion{
+		QueryResult: &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: []byte(`{"done":2}`)}}},
+	})
+	if got.err != nil || string(firstPayload(got.resp.GetQueryResult())) != `{"done":2}` {
+		t.Errorf("QueryWorkflow() = %v, %v; want the worker's answer", got.resp, got.err)
+	}
+
+	got = ask("unknown", &matchingv1.QueryTaskCompletion{ErrorMessage: "unknown query type"})
+	if status.Code(got.err) != codes.InvalidArgument {
+		t.Errorf("failed QueryWorkflow() error = %v, want InvalidArgument", got.err)
+	}
+}
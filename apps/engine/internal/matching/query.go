@@ -0,0 +1,79 @@
+package matching
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/linkflow/engine/internal/matching/engine"
+)
+
+// queryAnswer is a worker's answer to a query task.
+type queryAnswer struct {
+	result []byte
+	err    error
+}
+
+// QueryWorkflow adds the query task to the queue and waits until a worker
+// answers it or ctx is done. Query tasks are not persisted beyond the wait:
+// once the caller gave up, PollTask drops the task instead of handing it
+// out.
+func (s *Service) QueryWorkflow(ctx context.Context, taskQueueName string, task *engine.Task) ([]byte, error) {
+	answerCh := make(chan queryAnswer, 1)
+	s.queriesMu.Lock()
+	s.queries[task.ID] = answerCh
+	s.queriesMu.Unlock()
+	defer func() {
+		s.queriesMu.Lock()
+		delete(s.queries, task.ID)
+		s.queriesMu.Unlock()
+	}()
+
+	if err := s.AddTask(ctx, taskQueueName, task); err != nil {
+		return nil, err
+	}
+
+	select {
+	case answer := <-answerCh:
+		return answer.result, answer.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %v", ErrQueryTimedOut, ctx.Err())
+	}
+}
+
+// RespondQueryTask completes the query task taskID with a worker's answer. An
+// errMessage means the worker could not answer it. An answer that arrives
+// after the caller gave up is dropped.
+func (s *Service) RespondQueryTask(ctx context.Context, taskQueueName, taskID string, result []byte, errMessage string) error {
+	err := s.CompleteTask(ctx, taskQueueName, taskID)
+	if err != nil && !errors.Is(err, ErrTaskNotFound) && !errors.Is(err, ErrTaskQueueNotFound) {
+		return err
+	}
+
+	answer := queryAnswer{result: result}
+	if errMessage != "" {
+		answer.err = fmt.Errorf("%w: %s", ErrQueryFailed, errMessage)
+	}
+
+	s.queriesMu.Lock()
+	answerCh, ok := s.queries[taskID]
+	s.queriesMu.Unlock()
+	if !ok {
+		return nil
+	}
+	select {
+	case answerCh <- answer:
+	default:
+		// The query was answered already.
+	}
+	return nil
+}
+
+// queryPending reports whether a caller still waits for the query task
+// taskID.
+func (s *Service) queryPending(taskID string) bool {
+	s.queriesMu.Lock()
+	defer s.queriesMu.Unlock()
+	_, ok := s.queries[taskID]
+	return ok
+}
@@ -26,6 +26,11 @@ type Service struct {
 	stopCh  chan struct{}
 	wg      sync.WaitGroup
 	running bool
+
+	// queries holds the callers waiting for the answer to a query task,
+	// by task ID.
+	queriesMu sync.Mutex
+	queries   map[string]chan queryAnswer
 }
 
 type Config struct {
@@ -50,6 +55,7 @@ func NewService(cfg Config) *Service {
 		partitionMgr: partition.NewManager(cfg.NumPartitions, cfg.Replicas, cfg.RedisClient),
 		taskQueues:   make(map[string]*engine.TaskQueue),
 		logger:       cfg.Logger,
+		queries:      make(map[string]chan queryAnswer),
 	}
 }
 
@@ -108,6 +114,23 @@ func (s *Service) CompleteTask(ctx context.Context, taskQueueName string, taskID
 	return nil
 }
 
+// HeartbeatTask extends the lease of an in-flight task of the queue.
+func (s *Service) HeartbeatTask(ctx context.Context, taskQueueName string, taskID string) error {
+	s.mu.RLock()
+	tq, exists := s.taskQueues[taskQueueName]
+	s.mu.RUnlock()
+
+	if !exists {
+		return ErrTaskQueueNotFound
+	}
+
+	if !tq.ExtendLease(taskID) {
+		return ErrTaskNotFound
+	}
+
+	return nil
+}
+
 func (s *Service) PollTask(ctx context.Context, taskQueueName string, identity string) (*engine.Task, error) {
 	s.mu.RLock()
 	tq, exists := s.taskQueues[taskQueueName]
@@ -120,12 +143,18 @@ func (s *Service) PollTask(ctx context.Context, taskQueueName string, identity s
 		tq = s.GetOrCreateTaskQueue(taskQueueName, engine.TaskQueueKindNormal)
 	}
 
-	task, err := tq.Poll(ctx, identity)
-	if err != nil {
-		return nil, err
+	for {
+		task, err := tq.Poll(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+		// A query nobody waits for any more is not worth a worker's time.
+		if task.QueryType != "" && !s.queryPending(task.ID) {
+			tq.CompleteTask(task.ID)
+			continue
+		}
+		return task, nil
 	}
-
-	return task, nil
 }
 
 func (s *Service) GetOrCreateTaskQueue(name string, kind engine.TaskQueueKind) *engine.TaskQueue {
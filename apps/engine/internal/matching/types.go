@@ -6,4 +6,6 @@ var (
 	ErrTaskQueueNotFound = errors.New("task queue not found")
 	ErrTaskNotFound      = errors.New("task not found")
 	ErrRateLimited       = errors.New("rate limited")
+	ErrQueryTimedOut     = errors.New("query timed out")
+	ErrQueryFailed       = errors.New("query failed")
 )
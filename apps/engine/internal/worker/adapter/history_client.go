@@ -55,6 +55,10 @@ func (c *HistoryClient) GetHistory(ctx context.Context, namespaceID, workflowID,
 	return c.client.GetHistory(ctx, req)
 }
 
+func (c *HistoryClient) RecordWorkflowTaskStarted(ctx context.Context, req *historyv1.RecordWorkflowTaskStartedRequest) (*historyv1.RecordWorkflowTaskStartedResponse, error) {
+	return c.client.RecordWorkflowTaskStarted(ctx, req)
+}
+
 func (c *HistoryClient) RespondWorkflowTaskCompleted(ctx context.Context, req *historyv1.RespondWorkflowTaskCompletedRequest) (*historyv1.RespondWorkflowTaskCompletedResponse, error) {
 	return c.client.RespondWorkflowTaskCompleted(ctx, req)
 }
@@ -63,6 +67,14 @@ func (c *HistoryClient) RespondWorkflowTaskFailed(ctx context.Context, req *hist
 	return c.client.RespondWorkflowTaskFailed(ctx, req)
 }
 
+func (c *HistoryClient) RecordActivityTaskStarted(ctx context.Context, req *historyv1.RecordActivityTaskStartedRequest) (*historyv1.RecordActivityTaskStartedResponse, error) {
+	return c.client.RecordActivityTaskStarted(ctx, req)
+}
+
+func (c *HistoryClient) RecordActivityTaskHeartbeat(ctx context.Context, req *historyv1.RecordActivityTaskHeartbeatRequest) (*historyv1.RecordActivityTaskHeartbeatResponse, error) {
+	return c.client.RecordActivityTaskHeartbeat(ctx, req)
+}
+
 func (c *HistoryClient) RespondActivityTaskCompleted(ctx context.Context, req *historyv1.RespondActivityTaskCompletedRequest) (*historyv1.RespondActivityTaskCompletedResponse, error) {
 	return c.client.RespondActivityTaskCompleted(ctx, req)
 }
@@ -70,3 +82,7 @@ func (c *HistoryClient) RespondActivityTaskCompleted(ctx context.Context, req *h
 func (c *HistoryClient) RespondActivityTaskFailed(ctx context.Context, req *historyv1.RespondActivityTaskFailedRequest) (*historyv1.RespondActivityTaskFailedResponse, error) {
 	return c.client.RespondActivityTaskFailed(ctx, req)
 }
+
+func (c *HistoryClient) RespondActivityTaskCanceled(ctx context.Context, req *historyv1.RespondActivityTaskCanceledRequest) (*historyv1.RespondActivityTaskCanceledResponse, error) {
+	return c.client.RespondActivityTaskCanceled(ctx, req)
+}
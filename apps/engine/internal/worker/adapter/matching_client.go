@@ -78,6 +78,18 @@ func (c *MatchingClient) PollTask(ctx context.Context, taskQueue string, identit
 			TimeoutSec:       60,
 			ScheduledEventID: resp.WorkflowTaskInfo.ScheduledEventId,
 		}
+	} else if resp.QueryTaskInfo != nil && len(parts) >= 3 {
+		task = &poller.Task{
+			TaskToken:  resp.TaskToken,
+			TaskID:     parts[2],
+			WorkflowID: resp.WorkflowExecution.GetWorkflowId(),
+			RunID:      resp.WorkflowExecution.GetRunId(),
+			Namespace:  namespace,
+			QueryType:  resp.QueryTaskInfo.QueryType,
+		}
+		if payloads := resp.QueryTaskInfo.GetQueryArgs().GetPayloads(); len(payloads) > 0 {
+			task.Input = payloads[0].GetData()
+		}
 	} else {
 		return nil, nil
 	}
@@ -99,3 +111,44 @@ func (c *MatchingClient) CompleteTask(ctx context.Context, task *poller.Task, id
 	_, err := c.client.CompleteTask(ctx, req)
 	return err
 }
+
+// RespondQueryTask completes a query task with its answer, which matching
+// hands to the caller waiting for it. errMessage reports a query the worker
+// could not answer.
+func (c *MatchingClient) RespondQueryTask(ctx context.Context, task *poller.Task, result []byte, errMessage string, identity string) error {
+	if task == nil || len(task.TaskToken) == 0 {
+		return fmt.Errorf("task token is required")
+	}
+
+	req := &matchingv1.CompleteTaskRequest{
+		TaskToken: task.TaskToken,
+		Namespace: task.Namespace,
+		Identity:  identity,
+		Completion: &matchingv1.CompleteTaskRequest_QueryTaskCompletion{
+			QueryTaskCompletion: &matchingv1.QueryTaskCompletion{
+				QueryResult:  &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: result}}},
+				ErrorMessage: errMessage,
+			},
+		},
+	}
+
+	_, err := c.client.CompleteTask(ctx, req)
+	return err
+}
+
+// HeartbeatTask extends the matching lease of an activity task that is still
+// running, so it is not handed to another worker.
+func (c *MatchingClient) HeartbeatTask(ctx context.Context, task *poller.Task, identity string) error {
+	if task == nil || len(task.TaskToken) == 0 {
+		return fmt.Errorf("task token is required")
+	}
+
+	req := &matchingv1.HeartbeatTaskRequest{
+		TaskToken: task.TaskToken,
+		Namespace: task.Namespace,
+		Identity:  identity,
+	}
+
+	_, err := c.client.HeartbeatTask(ctx, req)
+	return err
+}
@@ -3,6 +3,7 @@ package executor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -115,7 +116,7 @@ func (e *DatabaseExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 	case "execute":
 		response, err = e.executeCommand(ctx, pool, config, &logs)
 	case "transaction":
-		response, err = e.executeTransaction(ctx, pool, config, &logs)
+		response, err = e.executeTransaction(ctx, req, pool, config, &logs)
 	default:
 		return &ExecuteResponse{
 			Error: &ExecutionError{
@@ -127,6 +128,9 @@ func (e *DatabaseExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 		}, nil
 	}
 
+	if errors.Is(err, ErrCancelled) {
+		return nil, err
+	}
 	if err != nil {
 		errorType := ErrorTypeRetryable
 		// Classify error
@@ -275,7 +279,7 @@ func (e *DatabaseExecutor) executeCommand(ctx context.Context, pool *pgxpool.Poo
 	return response, nil
 }
 
-func (e *DatabaseExecutor) executeTransaction(ctx context.Context, pool *pgxpool.Pool, config DatabaseConfig, logs *[]LogEntry) (DatabaseResponse, error) {
+func (e *DatabaseExecutor) executeTransaction(ctx context.Context, req *ExecuteRequest, pool *pgxpool.Pool, config DatabaseConfig, logs *[]LogEntry) (DatabaseResponse, error) {
 	var response DatabaseResponse
 
 	*logs = append(*logs, LogEntry{
@@ -304,6 +308,15 @@ func (e *DatabaseExecutor) executeTransaction(ctx context.Context, pool *pgxpool
 			return response, fmt.Errorf("query %d failed: %w", i+1, err)
 		}
 		totalRowsAffected += tag.RowsAffected()
+
+		// A cancelled activity rolls the transaction back instead of
+		// committing it.
+		if err := req.RecordHeartbeat(ctx, map[string]interface{}{
+			"queries_executed": i + 1,
+			"queries_total":    len(config.Queries),
+		}); err != nil {
+			return response, err
+		}
 	}
 
 	if err := tx.Commit(ctx); err != nil {
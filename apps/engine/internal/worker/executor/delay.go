@@ -7,7 +7,9 @@ import (
 	"time"
 )
 
-// DelayExecutor handles delay/wait nodes.
+// DelayExecutor handles delay/wait nodes by sleeping on the worker. Workflows
+// run by WorkflowExecutor use durable timers for delay nodes instead; this
+// executor only runs when a delay node is scheduled as an activity directly.
 type DelayExecutor struct{}
 
 // DelayConfig represents the configuration for a delay node.
@@ -34,6 +36,55 @@ type DelayResponse struct {
 	DurationMs int64  `json:"duration_ms"`
 }
 
+// duration returns how long a delay node waits when it starts at now. A time
+// in the past yields zero.
+func (c DelayConfig) duration(now time.Time) (time.Duration, error) {
+	var d time.Duration
+
+	switch {
+	case c.Until != "":
+		// Wait until a specific time
+		untilTime, err := time.Parse(time.RFC3339, c.Until)
+		if err != nil {
+			return 0, fmt.Errorf("invalid 'until' time format: %v", err)
+		}
+		d = untilTime.Sub(now)
+		if d < 0 {
+			d = 0 // Already past the time
+		}
+	case c.Duration != "":
+		// Parse duration string
+		var err error
+		d, err = time.ParseDuration(c.Duration)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration format: %v", err)
+		}
+	default:
+		// Calculate from individual components
+		d = time.Duration(c.Milliseconds)*time.Millisecond +
+			time.Duration(c.Seconds)*time.Second +
+			time.Duration(c.Minutes)*time.Minute +
+			time.Duration(c.Hours)*time.Hour +
+			time.Duration(c.Days)*24*time.Hour
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("delay duration cannot be negative")
+	}
+	return d, nil
+}
+
+// newDelayResponse describes a delay that ran from startedAt to endedAt.
+func newDelayResponse(startedAt, endedAt time.Time) DelayResponse {
+	elapsed := endedAt.Sub(startedAt)
+	return DelayResponse{
+		StartedAt:  startedAt.Format(time.RFC3339),
+		EndedAt:    endedAt.Format(time.RFC3339),
+		Duration:   elapsed.String(),
+		DurationMs: elapsed.Milliseconds(),
+	}
+}
+
 // NewDelayExecutor creates a new delay executor.
 func NewDelayExecutor() *DelayExecutor {
 	return &DelayExecutor{}
@@ -65,55 +116,11 @@ func (e *DelayExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*Exec
 		}, nil
 	}
 
-	// Calculate the delay duration
-	var delayDuration time.Duration
-
-	switch {
-	case config.Until != "":
-		// Wait until a specific time
-		untilTime, err := time.Parse(time.RFC3339, config.Until)
-		if err != nil {
-			return &ExecuteResponse{
-				Error: &ExecutionError{
-					Message: fmt.Sprintf("invalid 'until' time format: %v", err),
-					Type:    ErrorTypeNonRetryable,
-				},
-				Logs:     logs,
-				Duration: time.Since(start),
-			}, nil
-		}
-		delayDuration = time.Until(untilTime)
-		if delayDuration < 0 {
-			delayDuration = 0 // Already past the time
-		}
-	case config.Duration != "":
-		// Parse duration string
-		var err error
-		delayDuration, err = time.ParseDuration(config.Duration)
-		if err != nil {
-			return &ExecuteResponse{
-				Error: &ExecutionError{
-					Message: fmt.Sprintf("invalid duration format: %v", err),
-					Type:    ErrorTypeNonRetryable,
-				},
-				Logs:     logs,
-				Duration: time.Since(start),
-			}, nil
-		}
-	default:
-		// Calculate from individual components
-		delayDuration = time.Duration(config.Milliseconds)*time.Millisecond +
-			time.Duration(config.Seconds)*time.Second +
-			time.Duration(config.Minutes)*time.Minute +
-			time.Duration(config.Hours)*time.Hour +
-			time.Duration(config.Days)*24*time.Hour
-	}
-
-	// Validate the delay
-	if delayDuration < 0 {
+	delayDuration, err := config.duration(start)
+	if err != nil {
 		return &ExecuteResponse{
 			Error: &ExecutionError{
-				Message: "delay duration cannot be negative",
+				Message: err.Error(),
 				Type:    ErrorTypeNonRetryable,
 			},
 			Logs:     logs,
@@ -161,14 +168,7 @@ func (e *DelayExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*Exec
 		Message:   "Delay completed",
 	})
 
-	response := DelayResponse{
-		StartedAt:  start.Format(time.RFC3339),
-		EndedAt:    endTime.Format(time.RFC3339),
-		Duration:   time.Since(start).String(),
-		DurationMs: time.Since(start).Milliseconds(),
-	}
-
-	output, err := json.Marshal(response)
+	output, err := json.Marshal(newDelayResponse(start, endTime))
 	if err != nil {
 		return &ExecuteResponse{
 			Error: &ExecutionError{
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -551,6 +552,15 @@ func (e *StorageExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*Ex
 		config.Provider = "local"
 	}
 
+	// Check in before touching storage, so an activity that was cancelled
+	// while it waited for a worker does not write or delete anything.
+	if err := req.RecordHeartbeat(ctx, map[string]interface{}{
+		"operation": config.Operation,
+		"key":       config.Key,
+	}); errors.Is(err, ErrCancelled) {
+		return nil, err
+	}
+
 	var response StorageResponse
 	var err error
 
@@ -3,9 +3,21 @@ package executor
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 )
 
+// ErrCancelled is returned by a heartbeat once the activity it reports on was
+// cancelled, timed out or closed otherwise. The executor should stop and
+// return; whatever it returns is dropped.
+var ErrCancelled = errors.New("activity cancelled")
+
+// HeartbeatFunc reports the progress of a running activity. details are kept
+// by history and handed to the next attempt of the activity as
+// ExecuteRequest.HeartbeatDetails.
+type HeartbeatFunc func(ctx context.Context, details json.RawMessage) error
+
 type Executor interface {
 	Execute(ctx context.Context, req *ExecuteRequest) (*ExecuteResponse, error)
 	NodeType() string
@@ -22,6 +34,26 @@ type ExecuteRequest struct {
 	Deterministic *DeterministicContext
 	Attempt       int32
 	Timeout       time.Duration
+
+	// HeartbeatDetails are the details of the last heartbeat of an earlier
+	// attempt, for a long-running executor to resume from. Heartbeat reports
+	// progress of this attempt; it is nil outside of a worker.
+	HeartbeatDetails json.RawMessage
+	Heartbeat        HeartbeatFunc
+}
+
+// RecordHeartbeat reports details as the progress of the activity. It returns
+// ErrCancelled once the activity should stop, and nil if the request has no
+// heartbeat to report to.
+func (r *ExecuteRequest) RecordHeartbeat(ctx context.Context, details interface{}) error {
+	if r == nil || r.Heartbeat == nil {
+		return nil
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to marshal heartbeat details: %w", err)
+	}
+	return r.Heartbeat(ctx, data)
 }
 
 type ExecuteResponse struct {
@@ -3,6 +3,7 @@ package executor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -297,6 +298,13 @@ type LoopConfig struct {
 	Actions []string `json:"actions"`
 }
 
+// loopProgress is what a loop node reports in its heartbeats: the results of
+// the items processed so far.
+type loopProgress struct {
+	Processed int           `json:"processed"`
+	Results   []interface{} `json:"results"`
+}
+
 // NewLoopExecutor creates a new loop executor.
 func NewLoopExecutor() *LoopExecutor {
 	return &LoopExecutor{}
@@ -394,9 +402,21 @@ func (e *LoopExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*Execu
 		})
 	}
 
-	// Process each item
+	// Process each item, picking up after the items an earlier attempt
+	// already reported as processed.
 	results := make([]interface{}, 0, len(items))
-	for i, item := range items {
+	var progress loopProgress
+	if len(req.HeartbeatDetails) > 0 && json.Unmarshal(req.HeartbeatDetails, &progress) == nil &&
+		progress.Processed == len(progress.Results) && progress.Processed <= len(items) {
+		results = append(results, progress.Results...)
+		logs = append(logs, LogEntry{
+			Timestamp: time.Now(),
+			Level:     "info",
+			Message:   fmt.Sprintf("resuming after item %d/%d", progress.Processed, len(items)),
+		})
+	}
+	for i := len(results); i < len(items); i++ {
+		item := items[i]
 		// Create item context
 		itemContext := make(map[string]interface{})
 		for k, v := range inputData {
@@ -414,6 +434,10 @@ func (e *LoopExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*Execu
 			Level:     "info",
 			Message:   fmt.Sprintf("processed item %d/%d", i+1, len(items)),
 		})
+
+		if err := req.RecordHeartbeat(ctx, loopProgress{Processed: i + 1, Results: results}); errors.Is(err, ErrCancelled) {
+			return nil, err
+		}
 	}
 
 	// Add results to output
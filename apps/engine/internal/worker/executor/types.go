@@ -52,8 +52,14 @@ type Position struct {
 	Y float64 `json:"y"`
 }
 
+// Edge connects two nodes. SourceHandle names the output of a branching
+// source node the edge belongs to; an edge without one is always followed.
+// Condition is an expression on the source's output that must hold for the
+// edge to be followed.
 type Edge struct {
-	ID     string `json:"id"`
-	Source string `json:"source"`
-	Target string `json:"target"`
+	ID           string `json:"id"`
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	SourceHandle string `json:"sourceHandle,omitempty"`
+	Condition    string `json:"condition,omitempty"`
 }
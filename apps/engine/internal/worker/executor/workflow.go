@@ -3,21 +3,33 @@ package executor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
 	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
-	"github.com/linkflow/engine/internal/worker/adapter"
+	"github.com/linkflow/engine/internal/execution/graph"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
+// HistoryClient reads the history of the run a workflow executor decides
+// for.
+type HistoryClient interface {
+	GetHistory(ctx context.Context, namespaceID, workflowID, runID string) (*historyv1.GetHistoryResponse, error)
+}
+
 type WorkflowExecutor struct {
-	historyClient    *adapter.HistoryClient
+	historyClient    HistoryClient
 	logger           *slog.Logger
 	executorRegistry *Registry
+	nodeTaskQueues   map[string]string
 }
 
-func NewWorkflowExecutor(client *adapter.HistoryClient, logger *slog.Logger) *WorkflowExecutor {
+func NewWorkflowExecutor(client HistoryClient, logger *slog.Logger) *WorkflowExecutor {
 	return &WorkflowExecutor{
 		historyClient: client,
 		logger:        logger,
@@ -28,6 +40,12 @@ func (e *WorkflowExecutor) SetRegistry(registry *Registry) {
 	e.executorRegistry = registry
 }
 
+// SetNodeTaskQueues routes the activities of the given node types to the
+// given task queues, unless a node's config names its own.
+func (e *WorkflowExecutor) SetNodeTaskQueues(queues map[string]string) {
+	e.nodeTaskQueues = queues
+}
+
 func (e *WorkflowExecutor) NodeType() string {
 	return "workflow"
 }
@@ -54,15 +72,21 @@ func (e *WorkflowExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 	// 2. Parse Payload from ExecutionStarted
 	var payload JobPayload
 	var payloadFound bool
+	var runInput []byte
+	workflowQueue := defaultTaskQueue
 
 	for _, event := range events {
 		if event.GetEventType() == commonv1.EventType_EVENT_TYPE_EXECUTION_STARTED {
 			attr := event.GetExecutionStartedAttributes()
+			if name := attr.GetTaskQueue().GetName(); name != "" {
+				workflowQueue = name
+			}
 			// Assume payload is in first input
 			if attr != nil && attr.GetInput() != nil && len(attr.GetInput().GetPayloads()) > 0 {
 				inputData := attr.GetInput().GetPayloads()[0].GetData()
 				if err := json.Unmarshal(inputData, &payload); err == nil {
 					payloadFound = true
+					runInput = inputData
 				}
 			}
 			break
@@ -73,10 +97,22 @@ func (e *WorkflowExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 		return nil, fmt.Errorf("workflow definition not found in execution input")
 	}
 
+	// A definition that is not a valid DAG fails the run on its first
+	// decision, instead of leaving it waiting on nodes that can never run.
+	wf, err := newWorkflowGraph(payload.Workflow)
+	if err != nil {
+		return failWorkflowResponse(fmt.Sprintf("invalid workflow definition: %v", err))
+	}
+
 	// 3. Replay History to build State
 	nodeStates := make(map[string]string) // NodeID -> Status
 	nodeOutputs := make(map[string][]byte)
+	nodeFailures := make(map[string]string) // NodeID -> failure message
 	eventIDToNodeID := make(map[int64]string)
+	var signals []receivedSignal
+	timerStarts := make(map[string]time.Time) // Delay node timers, keyed by node ID
+	var cancelRequested bool
+	var cancelReason string
 
 	for _, event := range events {
 		switch event.GetEventType() {
@@ -98,37 +134,144 @@ func (e *WorkflowExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 			attr := event.GetNodeFailedAttributes()
 			if nodeID, ok := eventIDToNodeID[attr.GetScheduledEventId()]; ok {
 				nodeStates[nodeID] = "Failed"
+				nodeFailures[nodeID] = attr.GetFailure().GetMessage()
+			}
+
+		case commonv1.EventType_EVENT_TYPE_NODE_TIMED_OUT:
+			attr := event.GetNodeTimedOutAttributes()
+			if nodeID, ok := eventIDToNodeID[attr.GetScheduledEventId()]; ok {
+				nodeStates[nodeID] = "Failed"
+				nodeFailures[nodeID] = attr.GetFailure().GetMessage()
+			}
+
+		case commonv1.EventType_EVENT_TYPE_NODE_CANCELLED:
+			attr := event.GetNodeCancelledAttributes()
+			if nodeID, ok := eventIDToNodeID[attr.GetScheduledEventId()]; ok {
+				nodeStates[nodeID] = "Cancelled"
+			}
+
+		case commonv1.EventType_EVENT_TYPE_EXECUTION_CANCEL_REQUESTED:
+			cancelRequested = true
+			cancelReason = event.GetExecutionCancelRequestedAttributes().GetReason()
+
+		case commonv1.EventType_EVENT_TYPE_SIGNAL_RECEIVED:
+			attr := event.GetSignalReceivedAttributes()
+			signal := receivedSignal{name: attr.GetSignalName()}
+			if attr.GetInput() != nil && len(attr.GetInput().GetPayloads()) > 0 {
+				signal.input = attr.GetInput().GetPayloads()[0].GetData()
+			}
+			signals = append(signals, signal)
+
+		case commonv1.EventType_EVENT_TYPE_TIMER_STARTED:
+			attr := event.GetTimerStartedAttributes()
+			nodeStates[attr.GetTimerId()] = "Scheduled"
+			timerStarts[attr.GetTimerId()] = event.GetEventTime().AsTime()
+
+		case commonv1.EventType_EVENT_TYPE_TIMER_FIRED:
+			attr := event.GetTimerFiredAttributes()
+			startedAt, ok := timerStarts[attr.GetTimerId()]
+			if !ok {
+				continue
+			}
+			output, err := json.Marshal(newDelayResponse(startedAt, event.GetEventTime().AsTime()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal delay output: %w", err)
+			}
+			nodeStates[attr.GetTimerId()] = "Completed"
+			nodeOutputs[attr.GetTimerId()] = output
+
+		case commonv1.EventType_EVENT_TYPE_TIMER_CANCELLED:
+			nodeStates[event.GetTimerCancelledAttributes().GetTimerId()] = "Cancelled"
+
+		case commonv1.EventType_EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_INITIATED:
+			attr := event.GetChildWorkflowExecutionInitiatedAttributes()
+			nodeStates[attr.GetNodeId()] = "Scheduled"
+			eventIDToNodeID[event.GetEventId()] = attr.GetNodeId()
+
+		case commonv1.EventType_EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_COMPLETED:
+			attr := event.GetChildWorkflowExecutionCompletedAttributes()
+			if nodeID, ok := eventIDToNodeID[attr.GetInitiatedEventId()]; ok {
+				nodeStates[nodeID] = "Completed"
+				if attr.GetResult() != nil && len(attr.GetResult().GetPayloads()) > 0 {
+					nodeOutputs[nodeID] = attr.GetResult().GetPayloads()[0].GetData()
+				}
+			}
+
+		case commonv1.EventType_EVENT_TYPE_CHILD_WORKFLOW_EXECUTION_FAILED:
+			attr := event.GetChildWorkflowExecutionFailedAttributes()
+			if nodeID, ok := eventIDToNodeID[attr.GetInitiatedEventId()]; ok {
+				nodeStates[nodeID] = "Failed"
+				nodeFailures[nodeID] = attr.GetFailure().GetMessage()
 			}
 		}
 	}
 
+	// A node that failed for good fails the workflow, unless its error
+	// handling lets the run go on. After a cancel request the cleanup branch
+	// decides how the run ends instead.
+	if !cancelRequested {
+		failed, err := handleNodeFailures(wf, nodeStates, nodeOutputs, nodeFailures)
+		if err != nil {
+			return failWorkflowResponse(err.Error())
+		}
+		if failed != "" {
+			return failWorkflowResponse(fmt.Sprintf("node %s failed: %s", failed, nodeFailures[failed]))
+		}
+	}
+
+	// Only the branch a condition picked runs; the nodes on the others are
+	// skipped. Signal nodes never run on a worker; they complete as soon as a
+	// matching signal is in history.
+	skipUntakenBranches(wf, nodeStates, nodeOutputs)
+	resolveSignalNodes(wf, nodeStates, nodeOutputs, signals)
+
 	// 4. Decide Next Steps
 	commands := []*historyv1.Command{}
-	graph := payload.Workflow
+
+	// Once a cancel is requested the regular nodes stop and the cleanup
+	// branch runs instead: delays still waiting are cut short and the
+	// cancel triggers complete with the reason of the cancel.
+	cleanup := cancelCleanupNodes(wf)
+	if cancelRequested {
+		for _, id := range wf.dag.Order {
+			if wf.dag.Nodes[id].Type == delayNodeType && !cleanup[id] && nodeStates[id] == "Scheduled" {
+				commands = append(commands, cancelTimerCommand(id))
+			}
+		}
+		resolveCancelTriggers(wf, nodeStates, nodeOutputs, cancelReason)
+	}
 
 	// Check if all nodes are done or if we need to schedule new ones
 	allNodesCompleted := true
 	nodesToSchedule := []Node{}
 	inputs := make(map[string][]byte)
 
-	// Check for Start Node
-	var startNode *Node
-	for _, node := range graph.Nodes {
-		if nodeStates[node.ID] == "" && (node.Type == "trigger_manual" || node.Type == "trigger_webhook" || node.Type == "trigger_schedule") {
-			startNode = &node
-			break
+	// The run starts at its triggers, which get the trigger data as input.
+	var startNodes []Node
+	for _, id := range wf.dag.EntryNodes {
+		if !cancelRequested && nodeStates[id] == "" && graph.IsTriggerNode(wf.dag.Nodes[id].Type) {
+			startNodes = append(startNodes, wf.nodes[id])
 		}
 	}
 
-	if startNode != nil {
+	if len(startNodes) > 0 {
 		allNodesCompleted = false
-		nodesToSchedule = append(nodesToSchedule, *startNode)
 		triggerDataBytes, _ := json.Marshal(payload.TriggerData)
-		inputs[startNode.ID] = triggerDataBytes
+		for _, node := range startNodes {
+			nodesToSchedule = append(nodesToSchedule, node)
+			inputs[node.ID] = triggerDataBytes
+		}
 	} else {
-		// Check dependencies
-		for _, node := range graph.Nodes {
-			if nodeStates[node.ID] != "Completed" {
+		// Check dependencies, level by level
+		for _, id := range wf.dag.Order {
+			node := wf.nodes[id]
+			// The cleanup branch only runs on cancel, and then only it
+			// runs.
+			if cleanup[node.ID] != cancelRequested {
+				continue
+			}
+			// Failed nodes left at this point routed their error on.
+			if state := nodeStates[node.ID]; state != "Completed" && state != "Skipped" && state != "Failed" {
 				allNodesCompleted = false
 			}
 
@@ -137,26 +280,18 @@ func (e *WorkflowExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 				continue
 			}
 
-			// Check incoming edges
-			canRun := true
-			var input []byte
-
-			incomingEdges := 0
-			for _, edge := range graph.Edges {
-				if edge.Target == node.ID {
-					incomingEdges++
-					if nodeStates[edge.Source] != "Completed" {
-						canRun = false
-						break
-					}
-					input = nodeOutputs[edge.Source] // Simple single input
+			// A node runs once the branches leading to it let it, with the
+			// outputs of those that reached it merged into its input the
+			// way its merge mode says. Roots other than the triggers never
+			// run.
+			sources, ready := wf.dag.Ready(node.ID, nodeOutcomes(nodeStates, nodeOutputs))
+			if ready && node.Type != waitForSignalNodeType {
+				input, err := wf.dag.MergeInputs(node.ID, sources, func(nodeID string) json.RawMessage {
+					return nodeOutputs[nodeID]
+				})
+				if err != nil {
+					return failWorkflowResponse(fmt.Sprintf("node %s: %v", node.ID, err))
 				}
-			}
-
-			// If it's a root node (no incoming edges) but not a trigger?
-			// In this graph model, usually triggers are roots.
-			// If canRun is true, schedule it.
-			if canRun && incomingEdges > 0 {
 				nodesToSchedule = append(nodesToSchedule, node)
 				inputs[node.ID] = input
 			}
@@ -170,16 +305,35 @@ func (e *WorkflowExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 			inputData = []byte("{}")
 		}
 
-		// Extract config from node
-		var nodeData struct {
-			Config json.RawMessage `json:"config"`
+		configBytes := []byte(wf.dag.Nodes[node.ID].Config)
+
+		// Reaching a loop-back node ends the run and starts the workflow
+		// over in a new run with the same input, so a polling workflow does
+		// not grow its history without bound. Nodes still running on other
+		// branches are abandoned with the run.
+		if node.Type == continueAsNewNodeType {
+			return commandsResponse([]*historyv1.Command{continueAsNewCommand(runInput)})
 		}
-		configBytes := node.Data
-		if err := json.Unmarshal(node.Data, &nodeData); err == nil && len(nodeData.Config) > 0 {
-			configBytes = nodeData.Config
+
+		// Sub-workflow nodes run as a child execution; its result becomes
+		// the node output.
+		if node.Type == subWorkflowNodeType {
+			cmd, err := startChildWorkflowCommand(node.ID, configBytes, inputData, payload)
+			if err != nil {
+				return failWorkflowResponse(fmt.Sprintf("sub-workflow node %s: %v", node.ID, err))
+			}
+			commands = append(commands, cmd)
+			continue
 		}
-		if len(configBytes) == 0 {
-			configBytes = []byte("{}")
+
+		// Delay nodes wait on a durable timer instead of a worker.
+		if node.Type == delayNodeType {
+			cmd, err := startTimerCommand(node.ID, configBytes, time.Now())
+			if err != nil {
+				return failWorkflowResponse(fmt.Sprintf("delay node %s: %v", node.ID, err))
+			}
+			commands = append(commands, cmd)
+			continue
 		}
 
 		envelopeBytes, err := json.Marshal(struct {
@@ -199,6 +353,11 @@ func (e *WorkflowExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 			return nil, fmt.Errorf("failed to marshal activity envelope: %w", err)
 		}
 
+		retryPolicy, err := nodeRetryPolicy(node)
+		if err != nil {
+			return failWorkflowResponse(fmt.Sprintf("node %s: %v", node.ID, err))
+		}
+
 		cmd := &historyv1.Command{
 			CommandType: historyv1.CommandType_COMMAND_TYPE_SCHEDULE_ACTIVITY_TASK,
 			Attributes: &historyv1.Command_ScheduleActivityTaskAttributes{
@@ -209,8 +368,9 @@ func (e *WorkflowExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 					Input: &commonv1.Payloads{
 						Payloads: []*commonv1.Payload{{Data: envelopeBytes}},
 					},
-					TaskQueue: "default",
-					Config:    configBytes, // We added this field to Command
+					TaskQueue:   nodeTaskQueue(configBytes, node.Type, e.nodeTaskQueues, workflowQueue),
+					Config:      configBytes, // We added this field to Command
+					RetryPolicy: retryPolicy,
 				},
 			},
 		}
@@ -218,6 +378,15 @@ func (e *WorkflowExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 	}
 
 	// 5. Check for Workflow Completion
+	if cancelRequested {
+		// The run closes as cancelled once its cleanup has nothing left
+		// to run. Regular nodes still running are not waited for; they
+		// learn of the cancel from their heartbeats.
+		if len(nodesToSchedule) == 0 && !cleanupRunning(cleanup, nodeStates) {
+			commands = append(commands, cancelWorkflowCommand(cancelReason))
+		}
+		return commandsResponse(commands)
+	}
 	if allNodesCompleted {
 		// Find leaf nodes results? Or just complete.
 		cmd := &historyv1.Command{
@@ -233,8 +402,12 @@ func (e *WorkflowExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 		commands = append(commands, cmd)
 	}
 
-	// Marshal commands to Output
-	outputBytes, err := json.Marshal(commands)
+	return commandsResponse(commands)
+}
+
+// commandsResponse returns the decided commands as the executor output.
+func commandsResponse(commands []*historyv1.Command) (*ExecuteResponse, error) {
+	outputBytes, err := MarshalCommands(commands)
 	if err != nil {
 		return nil, err
 	}
@@ -243,3 +416,592 @@ func (e *WorkflowExecutor) Execute(ctx context.Context, req *ExecuteRequest) (*E
 		Output: outputBytes,
 	}, nil
 }
+
+// failWorkflowResponse decides to fail the workflow with the given reason.
+func failWorkflowResponse(reason string) (*ExecuteResponse, error) {
+	return commandsResponse([]*historyv1.Command{{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_FAIL_WORKFLOW_EXECUTION,
+		Attributes: &historyv1.Command_FailWorkflowExecutionAttributes{
+			FailWorkflowExecutionAttributes: &historyv1.FailWorkflowExecutionCommandAttributes{
+				Failure: &commonv1.Failure{Message: reason},
+			},
+		},
+	}})
+}
+
+// MarshalCommands encodes decider commands as a JSON array. Commands hold
+// oneof fields, so each one is encoded with protojson.
+func MarshalCommands(commands []*historyv1.Command) ([]byte, error) {
+	raw := make([]json.RawMessage, 0, len(commands))
+	for _, cmd := range commands {
+		data, err := protojson.Marshal(cmd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal command: %w", err)
+		}
+		raw = append(raw, data)
+	}
+	return json.Marshal(raw)
+}
+
+// UnmarshalCommands decodes commands encoded by MarshalCommands.
+func UnmarshalCommands(data []byte) ([]*historyv1.Command, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	commands := make([]*historyv1.Command, 0, len(raw))
+	for _, item := range raw {
+		cmd := &historyv1.Command{}
+		if err := protojson.Unmarshal(item, cmd); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal command: %w", err)
+		}
+		commands = append(commands, cmd)
+	}
+	return commands, nil
+}
+
+// defaultTaskQueue is the task queue of a run that was started without one.
+const defaultTaskQueue = "default"
+
+// nodeTaskQueue returns the task queue the activity of a node is scheduled
+// on: the task_queue in its config, else the queue its node type is routed
+// to, else the queue of the workflow itself.
+func nodeTaskQueue(config []byte, nodeType string, typeQueues map[string]string, workflowQueue string) string {
+	var cfg struct {
+		TaskQueue string `json:"task_queue"`
+	}
+	if err := json.Unmarshal(config, &cfg); err == nil && cfg.TaskQueue != "" {
+		return cfg.TaskQueue
+	}
+	if queue := typeQueues[nodeType]; queue != "" {
+		return queue
+	}
+	return workflowQueue
+}
+
+// delayNodeType is the node type that pauses its branch for a configured
+// time. The node ID doubles as the timer ID.
+const delayNodeType = "delay"
+
+// startTimerCommand starts the durable timer of a delay node. Unlike
+// DelayExecutor it does not cap the delay, since no worker waits on it.
+func startTimerCommand(nodeID string, config []byte, now time.Time) (*historyv1.Command, error) {
+	var delay DelayConfig
+	if err := json.Unmarshal(config, &delay); err != nil {
+		return nil, fmt.Errorf("failed to parse delay config: %w", err)
+	}
+	d, err := delay.duration(now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &historyv1.Command{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_START_TIMER,
+		Attributes: &historyv1.Command_StartTimerAttributes{
+			StartTimerAttributes: &historyv1.StartTimerCommandAttributes{
+				TimerId:            nodeID,
+				StartToFireTimeout: durationpb.New(d),
+			},
+		},
+	}, nil
+}
+
+// continueAsNewNodeType is the node type that loops a workflow back to its
+// start by continuing the run as new.
+const continueAsNewNodeType = "continue_as_new"
+
+// continueAsNewCommand continues the run as new with the given input. The
+// workflow type, task queue and timeouts carry over from the closing run.
+func continueAsNewCommand(input []byte) *historyv1.Command {
+	return &historyv1.Command{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_CONTINUE_AS_NEW_WORKFLOW_EXECUTION,
+		Attributes: &historyv1.Command_ContinueAsNewWorkflowExecutionAttributes{
+			ContinueAsNewWorkflowExecutionAttributes: &historyv1.ContinueAsNewWorkflowExecutionCommandAttributes{
+				Input: &commonv1.Payloads{
+					Payloads: []*commonv1.Payload{{Data: input}},
+				},
+			},
+		},
+	}
+}
+
+// subWorkflowNodeType is the node type that runs another workflow
+// definition as a child execution of the run.
+const subWorkflowNodeType = "execute_workflow"
+
+// SubWorkflowConfig is the config of a sub-workflow node. The child runs
+// Workflow with the node input as its trigger data; ParentClosePolicy is
+// one of "terminate" (the default), "abandon" and "request_cancel".
+type SubWorkflowConfig struct {
+	Workflow          WorkflowDefinition `json:"workflow"`
+	WorkflowID        string             `json:"workflow_id"`
+	ParentClosePolicy string             `json:"parent_close_policy"`
+}
+
+var parentClosePolicies = map[string]commonv1.ParentClosePolicy{
+	"":               commonv1.ParentClosePolicy_PARENT_CLOSE_POLICY_TERMINATE,
+	"terminate":      commonv1.ParentClosePolicy_PARENT_CLOSE_POLICY_TERMINATE,
+	"abandon":        commonv1.ParentClosePolicy_PARENT_CLOSE_POLICY_ABANDON,
+	"request_cancel": commonv1.ParentClosePolicy_PARENT_CLOSE_POLICY_REQUEST_CANCEL,
+}
+
+// startChildWorkflowCommand starts the child execution of a sub-workflow
+// node. The child inherits the credentials, variables and deterministic
+// context of the parent; history names it after the parent and the node
+// unless the config sets a workflow ID.
+func startChildWorkflowCommand(nodeID string, config, input []byte, parent JobPayload) (*historyv1.Command, error) {
+	var cfg SubWorkflowConfig
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse sub-workflow config: %w", err)
+	}
+	if len(cfg.Workflow.Nodes) == 0 {
+		return nil, fmt.Errorf("sub-workflow has no nodes")
+	}
+	policy, ok := parentClosePolicies[cfg.ParentClosePolicy]
+	if !ok {
+		return nil, fmt.Errorf("unknown parent_close_policy %q", cfg.ParentClosePolicy)
+	}
+
+	var triggerData map[string]interface{}
+	if err := json.Unmarshal(input, &triggerData); err != nil {
+		triggerData = map[string]interface{}{"input": json.RawMessage(input)}
+	}
+	childInput, err := json.Marshal(JobPayload{
+		ExecutionID:   parent.ExecutionID,
+		WorkflowID:    parent.WorkflowID,
+		WorkspaceID:   parent.WorkspaceID,
+		Workflow:      cfg.Workflow,
+		TriggerData:   triggerData,
+		Credentials:   parent.Credentials,
+		Variables:     parent.Variables,
+		Deterministic: parent.Deterministic,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sub-workflow input: %w", err)
+	}
+
+	return &historyv1.Command{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_START_CHILD_WORKFLOW_EXECUTION,
+		Attributes: &historyv1.Command_StartChildWorkflowExecutionAttributes{
+			StartChildWorkflowExecutionAttributes: &historyv1.StartChildWorkflowExecutionCommandAttributes{
+				NodeId:     nodeID,
+				WorkflowId: cfg.WorkflowID,
+				Input: &commonv1.Payloads{
+					Payloads: []*commonv1.Payload{{Data: childInput}},
+				},
+				ParentClosePolicy: policy,
+			},
+		},
+	}, nil
+}
+
+// NodeRetryConfig is the retry policy of a node, set under "retry" in the
+// node data of the workflow definition. Intervals are Go duration strings;
+// unset fields fall back to the history service's defaults, which allow 3
+// attempts, and a node without it is not retried.
+type NodeRetryConfig struct {
+	MaxAttempts        int32    `json:"max_attempts"`
+	InitialInterval    string   `json:"initial_interval"`
+	BackoffCoefficient float64  `json:"backoff_coefficient"`
+	MaxInterval        string   `json:"max_interval"`
+	NonRetryableErrors []string `json:"non_retryable_errors"`
+}
+
+// nodeRetryPolicy returns the retry policy history applies to failed attempts
+// of the node, or nil if the node has none.
+func nodeRetryPolicy(node Node) (*commonv1.RetryPolicy, error) {
+	var data struct {
+		Retry json.RawMessage `json:"retry"`
+	}
+	if err := json.Unmarshal(node.Data, &data); err != nil || len(data.Retry) == 0 || string(data.Retry) == "null" {
+		return nil, nil
+	}
+	var retry NodeRetryConfig
+	if err := json.Unmarshal(data.Retry, &retry); err != nil {
+		return nil, fmt.Errorf("failed to parse retry config: %w", err)
+	}
+	if retry.MaxAttempts < 0 {
+		return nil, fmt.Errorf("retry max_attempts must be non-negative")
+	}
+	if retry.BackoffCoefficient != 0 && retry.BackoffCoefficient < 1 {
+		return nil, fmt.Errorf("retry backoff_coefficient must be >= 1")
+	}
+
+	policy := &commonv1.RetryPolicy{
+		MaxAttempts:        retry.MaxAttempts,
+		BackoffCoefficient: retry.BackoffCoefficient,
+		NonRetryableErrors: retry.NonRetryableErrors,
+	}
+	for _, interval := range []struct {
+		name  string
+		value string
+		dst   **durationpb.Duration
+	}{
+		{"initial_interval", retry.InitialInterval, &policy.InitialInterval},
+		{"max_interval", retry.MaxInterval, &policy.MaxInterval},
+	} {
+		if interval.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(interval.value)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid retry %s %q", interval.name, interval.value)
+		}
+		*interval.dst = durationpb.New(d)
+	}
+	return policy, nil
+}
+
+// cancelTriggerNodeType is the node type that starts the cleanup branch of a
+// workflow. It completes when a cancel of the run is requested, with the
+// reason of the cancel as its output; the nodes it leads to run only then.
+const cancelTriggerNodeType = "trigger_cancel"
+
+// cancelCleanupNodes returns the nodes of the cleanup branch: the cancel
+// triggers and every node reachable from them.
+func cancelCleanupNodes(wf *workflowGraph) map[string]bool {
+	cleanup := make(map[string]bool)
+	// The order is topological, so a node's sources come before it.
+	for _, id := range wf.dag.Order {
+		if wf.dag.Nodes[id].Type == cancelTriggerNodeType {
+			cleanup[id] = true
+			continue
+		}
+		for _, source := range wf.dag.GetDependencies(id) {
+			if cleanup[source] {
+				cleanup[id] = true
+				break
+			}
+		}
+	}
+	return cleanup
+}
+
+// resolveCancelTriggers completes the cancel triggers of a run whose cancel
+// was requested.
+func resolveCancelTriggers(wf *workflowGraph, nodeStates map[string]string, nodeOutputs map[string][]byte, reason string) {
+	for _, id := range wf.dag.EntryNodes {
+		if wf.dag.Nodes[id].Type != cancelTriggerNodeType || nodeStates[id] != "" {
+			continue
+		}
+		output, _ := json.Marshal(map[string]string{"reason": reason})
+		nodeStates[id] = "Completed"
+		nodeOutputs[id] = output
+	}
+}
+
+// cleanupRunning reports whether a node of the cleanup branch is still
+// running.
+func cleanupRunning(cleanup map[string]bool, nodeStates map[string]string) bool {
+	for nodeID := range cleanup {
+		if nodeStates[nodeID] == "Scheduled" {
+			return true
+		}
+	}
+	return false
+}
+
+// cancelTimerCommand cancels the timer of a delay node.
+func cancelTimerCommand(nodeID string) *historyv1.Command {
+	return &historyv1.Command{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_CANCEL_TIMER,
+		Attributes: &historyv1.Command_CancelTimerAttributes{
+			CancelTimerAttributes: &historyv1.CancelTimerCommandAttributes{TimerId: nodeID},
+		},
+	}
+}
+
+// cancelWorkflowCommand closes the run as cancelled.
+func cancelWorkflowCommand(reason string) *historyv1.Command {
+	details, _ := json.Marshal(map[string]string{"status": "cancelled", "reason": reason})
+	return &historyv1.Command{
+		CommandType: historyv1.CommandType_COMMAND_TYPE_CANCEL_WORKFLOW_EXECUTION,
+		Attributes: &historyv1.Command_CancelWorkflowExecutionAttributes{
+			CancelWorkflowExecutionAttributes: &historyv1.CancelWorkflowExecutionCommandAttributes{
+				Details: &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: details}}},
+			},
+		},
+	}
+}
+
+// waitForSignalNodeType is the node type that pauses its branch until a
+// signal with the configured name is received.
+const waitForSignalNodeType = "wait_for_signal"
+
+type receivedSignal struct {
+	name  string
+	input []byte
+}
+
+// resolveSignalNodes completes the wait-for-signal nodes whose upstream nodes
+// are done and for which a matching signal was received; the signal input
+// becomes the node output. Each signal wakes one node. Signals are consumed in
+// the order they arrived and nodes are visited in topological order, so
+// replaying the same history always pairs them the same way.
+func resolveSignalNodes(wf *workflowGraph, nodeStates map[string]string, nodeOutputs map[string][]byte, signals []receivedSignal) {
+	consumed := make([]bool, len(signals))
+
+	for progress := true; progress; {
+		progress = false
+		for _, id := range wf.dag.Order {
+			node := wf.nodes[id]
+			if node.Type != waitForSignalNodeType || nodeStates[node.ID] != "" {
+				continue
+			}
+			if !upstreamCompleted(wf, node.ID, nodeStates, nodeOutputs) {
+				continue
+			}
+
+			name := signalName(node)
+			for i, signal := range signals {
+				if consumed[i] || signal.name != name {
+					continue
+				}
+				consumed[i] = true
+				nodeStates[node.ID] = "Completed"
+				nodeOutputs[node.ID] = signal.input
+				progress = true
+				break
+			}
+		}
+	}
+}
+
+// upstreamCompleted reports whether the branches leading to a node let it
+// run. A node without incoming edges waits for nothing.
+func upstreamCompleted(wf *workflowGraph, nodeID string, nodeStates map[string]string, nodeOutputs map[string][]byte) bool {
+	_, ready := wf.dag.Ready(nodeID, nodeOutcomes(nodeStates, nodeOutputs))
+	return ready || len(wf.dag.GetDependencies(nodeID)) == 0
+}
+
+// nodeOutcomes reports how the nodes of a run finished, for resolving the
+// edges out of them. A failed node left at this point routes its error on.
+func nodeOutcomes(nodeStates map[string]string, nodeOutputs map[string][]byte) graph.OutcomeFunc {
+	return func(nodeID string) (graph.NodeOutcome, json.RawMessage) {
+		switch nodeStates[nodeID] {
+		case "Completed":
+			return graph.OutcomeCompleted, nodeOutputs[nodeID]
+		case "Failed":
+			return graph.OutcomeFailed, nodeOutputs[nodeID]
+		case "Skipped":
+			return graph.OutcomeSkipped, nil
+		}
+		return graph.OutcomePending, nil
+	}
+}
+
+// incomingBranches resolves the incoming edges of a node the way the
+// in-process scheduler does. It returns the sources of the taken edges, and
+// whether an edge is still pending on a source that has not finished.
+func incomingBranches(wf *workflowGraph, nodeID string, nodeStates map[string]string, nodeOutputs map[string][]byte) (taken []string, pending bool) {
+	return wf.dag.IncomingBranches(nodeID, nodeOutcomes(nodeStates, nodeOutputs))
+}
+
+// skipUntakenBranches marks the nodes no branch reaches as Skipped: those
+// whose incoming edges are all resolved without one being taken. Nodes are
+// visited in topological order, so skips carry downstream in one pass and a
+// join only waits for the branches that can still reach it.
+func skipUntakenBranches(wf *workflowGraph, nodeStates map[string]string, nodeOutputs map[string][]byte) {
+	for _, id := range wf.dag.Order {
+		if nodeStates[id] != "" || len(wf.dag.GetDependencies(id)) == 0 {
+			continue
+		}
+		taken, pending := incomingBranches(wf, id, nodeStates, nodeOutputs)
+		if !pending && len(taken) == 0 {
+			nodeStates[id] = "Skipped"
+		}
+	}
+}
+
+// signalName returns the signal a wait-for-signal node waits for, taken from
+// its config and defaulting to the node ID.
+func signalName(node Node) string {
+	var data struct {
+		Config struct {
+			SignalName string `json:"signal_name"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(node.Data, &data); err == nil && data.Config.SignalName != "" {
+		return data.Config.SignalName
+	}
+	return node.ID
+}
+
+// Error handling modes of a node, set under "on_error" in its node data. The
+// "on_error" workflow setting picks the mode of nodes that set none, and
+// defaults to failing the workflow.
+const (
+	onErrorFail     = "fail"
+	onErrorContinue = "continue"
+	onErrorRoute    = "route"
+)
+
+// nodeErrorMode returns the error handling mode of a node.
+func nodeErrorMode(wf *workflowGraph, node Node) (string, error) {
+	var data struct {
+		OnError string `json:"on_error"`
+	}
+	_ = json.Unmarshal(node.Data, &data)
+	mode := data.OnError
+	if mode == "" {
+		mode, _ = wf.settings["on_error"].(string)
+	}
+	switch mode {
+	case "":
+		return onErrorFail, nil
+	case onErrorFail, onErrorContinue, onErrorRoute:
+		return mode, nil
+	}
+	return "", fmt.Errorf("node %s: unknown on_error mode %q", node.ID, mode)
+}
+
+// handleNodeFailures applies the error handling of the nodes that failed.
+// A node in continue mode completes with its error as output; one in route
+// mode stays failed with its error as output, which takes its error handle
+// and none of its other outgoing edges. A node in route mode whose error
+// takes no edge fails the workflow, as if it were in fail mode. It returns
+// the first failed node, in topological order, that fails the workflow.
+func handleNodeFailures(wf *workflowGraph, nodeStates map[string]string, nodeOutputs map[string][]byte, nodeFailures map[string]string) (string, error) {
+	for _, id := range wf.dag.Order {
+		node := wf.nodes[id]
+		if nodeStates[node.ID] != "Failed" {
+			continue
+		}
+		mode, err := nodeErrorMode(wf, node)
+		if err != nil {
+			return "", err
+		}
+		if mode == onErrorFail {
+			return node.ID, nil
+		}
+		output, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]string{"node_id": node.ID, "message": nodeFailures[node.ID]},
+		})
+		nodeOutputs[node.ID] = output
+		if mode == onErrorContinue {
+			nodeStates[node.ID] = "Completed"
+		} else if !routesError(wf, node.ID, nodeStates, nodeOutputs) {
+			return node.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// routesError reports whether a failed node takes one of its outgoing edges,
+// which can only be along its error handle.
+func routesError(wf *workflowGraph, nodeID string, nodeStates map[string]string, nodeOutputs map[string][]byte) bool {
+	outcome := nodeOutcomes(nodeStates, nodeOutputs)
+	for _, target := range wf.dag.GetDependents(nodeID) {
+		for _, edge := range wf.dag.InEdges[target] {
+			if edge.Source != nodeID {
+				continue
+			}
+			if taken, _ := wf.dag.EdgeTaken(edge, outcome); taken {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// workflowGraph is the workflow definition of a run built into a DAG, which
+// decides the order nodes are visited in and how edges are resolved. The
+// nodes are kept by ID too, for the node data the DAG does not hold.
+type workflowGraph struct {
+	dag      *graph.DAG
+	nodes    map[string]Node
+	settings map[string]interface{}
+}
+
+// newWorkflowGraph builds and validates the DAG of a workflow definition. On
+// top of the DAG's own checks, every root must be able to run and the error
+// handling and retry policy of every node must parse.
+func newWorkflowGraph(def WorkflowDefinition) (*workflowGraph, error) {
+	wf := &workflowGraph{
+		nodes:    make(map[string]Node, len(def.Nodes)),
+		settings: def.Settings,
+	}
+	dagDef := &graph.WorkflowDefinition{
+		Nodes: make([]graph.NodeDef, 0, len(def.Nodes)),
+		Edges: make([]graph.EdgeDef, 0, len(def.Edges)),
+	}
+	for _, node := range def.Nodes {
+		wf.nodes[node.ID] = node
+		dagDef.Nodes = append(dagDef.Nodes, graph.NodeDef{
+			ID:       node.ID,
+			Type:     node.Type,
+			Position: graph.Position{X: node.Position.X, Y: node.Position.Y},
+			Data: graph.NodeData{
+				Label:  node.GetName(),
+				Config: nodeConfig(node),
+				Merge:  nodeMergeMode(node),
+			},
+		})
+	}
+	for _, edge := range def.Edges {
+		dagDef.Edges = append(dagDef.Edges, graph.EdgeDef{
+			ID:           edge.ID,
+			Source:       edge.Source,
+			Target:       edge.Target,
+			SourceHandle: edge.SourceHandle,
+			Condition:    edge.Condition,
+		})
+	}
+
+	dag, err := graph.BuildDAG(dagDef)
+	if err != nil {
+		return nil, err
+	}
+	wf.dag = dag
+
+	var problems []string
+	for _, verr := range dag.Validate() {
+		problems = append(problems, verr.Error())
+	}
+	for _, id := range dag.EntryNodes {
+		switch nodeType := dag.Nodes[id].Type; {
+		case graph.IsTriggerNode(nodeType), nodeType == cancelTriggerNodeType, nodeType == waitForSignalNodeType:
+		default:
+			problems = append(problems, fmt.Sprintf("node %s: has no incoming edges and is not a trigger", id))
+		}
+	}
+	for _, id := range dag.Order {
+		node := wf.nodes[id]
+		if _, err := nodeErrorMode(wf, node); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if _, err := nodeRetryPolicy(node); err != nil {
+			problems = append(problems, fmt.Sprintf("node %s: %v", id, err))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return wf, nil
+}
+
+// nodeConfig returns the config of a node: the config in its node data, or
+// the node data itself if it has none.
+func nodeConfig(node Node) json.RawMessage {
+	var data struct {
+		Config json.RawMessage `json:"config"`
+	}
+	config := node.Data
+	if err := json.Unmarshal(node.Data, &data); err == nil && len(data.Config) > 0 {
+		config = data.Config
+	}
+	if len(config) == 0 {
+		config = json.RawMessage("{}")
+	}
+	return config
+}
+
+// nodeMergeMode returns the merge mode of a node, set under "merge" in its
+// node data.
+func nodeMergeMode(node Node) string {
+	var data struct {
+		Merge string `json:"merge"`
+	}
+	_ = json.Unmarshal(node.Data, &data)
+	return data.Merge
+}
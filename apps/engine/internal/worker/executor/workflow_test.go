@@ -0,0 +1,1041 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "github.com/linkflow/engine/api/gen/linkflow/api/v1"
+	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
+	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
+	"github.com/linkflow/engine/internal/execution/graph"
+	"github.com/linkflow/engine/internal/execution/scheduler"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestResolveSignalNodes(t *testing.T) {
+	t.Parallel()
+
+	def := WorkflowDefinition{
+		Nodes: []Node{
+			{ID: "start", Type: "trigger_manual"},
+			{ID: "approve", Type: waitForSignalNodeType, Data: json.RawMessage(`{"config":{"signal_name":"approved"}}`)},
+			{ID: "second", Type: waitForSignalNodeType, Data: json.RawMessage(`{"config":{"signal_name":"approved"}}`)},
+			{ID: "later", Type: waitForSignalNodeType},
+		},
+		Edges: []Edge{
+			{Source: "start", Target: "approve"},
+			{Source: "approve", Target: "second"},
+			{Source: "second", Target: "later"},
+		},
+	}
+	signals := []receivedSignal{
+		{name: "approved", input: []byte(`"first"`)},
+		{name: "later", input: []byte(`"early"`)},
+		{name: "approved", input: []byte(`"second"`)},
+	}
+	wf := mustWorkflowGraph(t, def)
+
+	tests := []struct {
+		name        string
+		signals     []receivedSignal
+		startState  string
+		wantStates  map[string]string
+		wantOutputs map[string]string
+	}{
+		{
+			name:       "upstream not done",
+			signals:    signals,
+			startState: "Scheduled",
+			wantStates: map[string]string{"approve": "", "second": "", "later": ""},
+		},
+		{
+			name:       "no signal",
+			startState: "Completed",
+			wantStates: map[string]string{"approve": "", "second": "", "later": ""},
+		},
+		{
+			name:        "signals consumed in order",
+			signals:     signals,
+			startState:  "Completed",
+			wantStates:  map[string]string{"approve": "Completed", "second": "Completed", "later": "Completed"},
+			wantOutputs: map[string]string{"approve": `"first"`, "second": `"second"`, "later": `"early"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeStates := map[string]string{"start": tt.startState}
+			nodeOutputs := make(map[string][]byte)
+
+			resolveSignalNodes(wf, nodeStates, nodeOutputs, tt.signals)
+
+			for nodeID, want := range tt.wantStates {
+				if got := nodeStates[nodeID]; got != want {
+					t.Errorf("state of %s = %q, want %q", nodeID, got, want)
+				}
+			}
+			for nodeID, want := range tt.wantOutputs {
+				if got := string(nodeOutputs[nodeID]); got != want {
+					t.Errorf("output of %s = %s, want %s", nodeID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStartTimerCommand(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		config  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "components", config: `{"days":3,"hours":1}`, want: 73 * time.Hour},
+		{name: "duration string", config: `{"duration":"90s"}`, want: 90 * time.Second},
+		{name: "until", config: `{"until":"2026-01-02T12:00:00Z"}`, want: 24 * time.Hour},
+		{name: "until in the past", config: `{"until":"2025-12-31T12:00:00Z"}`, want: 0},
+		{name: "bad duration", config: `{"duration":"soon"}`, wantErr: true},
+		{name: "negative", config: `{"seconds":-5}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := startTimerCommand("wait", []byte(tt.config), now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("startTimerCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// Round-trip through the encoding the worker uses.
+			data, err := MarshalCommands([]*historyv1.Command{cmd})
+			if err != nil {
+				t.Fatalf("MarshalCommands() error = %v", err)
+			}
+			commands, err := UnmarshalCommands(data)
+			if err != nil {
+				t.Fatalf("UnmarshalCommands() error = %v", err)
+			}
+			attr := commands[0].GetStartTimerAttributes()
+			if attr.GetTimerId() != "wait" {
+				t.Errorf("TimerId = %q, want %q", attr.GetTimerId(), "wait")
+			}
+			if got := attr.GetStartToFireTimeout().AsDuration(); got != tt.want {
+				t.Errorf("StartToFireTimeout = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		data            string
+		wantPolicy      bool
+		wantAttempts    int32
+		wantInitial     time.Duration
+		wantNonRetrying []string
+		wantErr         bool
+	}{
+		{name: "no data"},
+		{name: "no retry", data: `{"config":{"url":"https://example.com"}}`},
+		{
+			name:            "retry",
+			data:            `{"retry":{"max_attempts":4,"initial_interval":"2s","non_retryable_errors":["forbidden"]}}`,
+			wantPolicy:      true,
+			wantAttempts:    4,
+			wantInitial:     2 * time.Second,
+			wantNonRetrying: []string{"forbidden"},
+		},
+		{name: "bad interval", data: `{"retry":{"initial_interval":"later"}}`, wantErr: true},
+		{name: "bad coefficient", data: `{"retry":{"backoff_coefficient":0.5}}`, wantErr: true},
+		{name: "malformed", data: `{"retry":{"max_attempts":"three"}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := nodeRetryPolicy(Node{ID: "fetch", Type: "http", Data: json.RawMessage(tt.data)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nodeRetryPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (policy != nil) != tt.wantPolicy {
+				t.Fatalf("nodeRetryPolicy() = %v, want policy %v", policy, tt.wantPolicy)
+			}
+			if policy == nil {
+				return
+			}
+			if policy.GetMaxAttempts() != tt.wantAttempts {
+				t.Errorf("MaxAttempts = %d, want %d", policy.GetMaxAttempts(), tt.wantAttempts)
+			}
+			if got := policy.GetInitialInterval().AsDuration(); got != tt.wantInitial {
+				t.Errorf("InitialInterval = %v, want %v", got, tt.wantInitial)
+			}
+			if len(policy.GetNonRetryableErrors()) != len(tt.wantNonRetrying) {
+				t.Errorf("NonRetryableErrors = %v, want %v", policy.GetNonRetryableErrors(), tt.wantNonRetrying)
+			}
+		})
+	}
+}
+
+func TestStartChildWorkflowCommand(t *testing.T) {
+	t.Parallel()
+
+	parent := JobPayload{
+		WorkflowID: 7,
+		Variables:  map[string]interface{}{"env": "prod"},
+	}
+	child := `{"nodes":[{"id":"start","type":"trigger_manual"}],"edges":[]}`
+	tests := []struct {
+		name       string
+		config     string
+		input      string
+		wantPolicy commonv1.ParentClosePolicy
+		wantErr    bool
+	}{
+		{name: "default policy", config: `{"workflow":` + child + `}`, input: `{"id":1}`, wantPolicy: commonv1.ParentClosePolicy_PARENT_CLOSE_POLICY_TERMINATE},
+		{name: "abandon", config: `{"workflow":` + child + `,"parent_close_policy":"abandon"}`, input: `{"id":1}`, wantPolicy: commonv1.ParentClosePolicy_PARENT_CLOSE_POLICY_ABANDON},
+		{name: "unknown policy", config: `{"workflow":` + child + `,"parent_close_policy":"detach"}`, input: `{}`, wantErr: true},
+		{name: "no workflow", config: `{}`, input: `{}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := startChildWorkflowCommand("sub", []byte(tt.config), []byte(tt.input), parent)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("startChildWorkflowCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			attr := cmd.GetStartChildWorkflowExecutionAttributes()
+			if attr.GetNodeId() != "sub" || attr.GetParentClosePolicy() != tt.wantPolicy {
+				t.Errorf("command = {%s %v}, want {sub %v}", attr.GetNodeId(), attr.GetParentClosePolicy(), tt.wantPolicy)
+			}
+			var payload JobPayload
+			if err := json.Unmarshal(attr.GetInput().GetPayloads()[0].GetData(), &payload); err != nil {
+				t.Fatalf("child input is not a job payload: %v", err)
+			}
+			if len(payload.Workflow.Nodes) != 1 || payload.TriggerData["id"] != float64(1) || payload.Variables["env"] != "prod" {
+				t.Errorf("child payload = %+v, want the sub-workflow with the node input as trigger data", payload)
+			}
+		})
+	}
+}
+
+func TestCancelCleanupNodes(t *testing.T) {
+	t.Parallel()
+
+	def := WorkflowDefinition{
+		Nodes: []Node{
+			{ID: "start", Type: "trigger_manual"},
+			{ID: "work", Type: "http_request"},
+			{ID: "on_cancel", Type: cancelTriggerNodeType},
+			{ID: "notify", Type: "http_request"},
+			{ID: "cleanup", Type: "http_request"},
+		},
+		Edges: []Edge{
+			{Source: "start", Target: "work"},
+			{Source: "on_cancel", Target: "notify"},
+			{Source: "notify", Target: "cleanup"},
+		},
+	}
+
+	wf := mustWorkflowGraph(t, def)
+	cleanup := cancelCleanupNodes(wf)
+	for _, node := range def.Nodes {
+		want := node.ID == "on_cancel" || node.ID == "notify" || node.ID == "cleanup"
+		if cleanup[node.ID] != want {
+			t.Errorf("cleanup[%s] = %v, want %v", node.ID, cleanup[node.ID], want)
+		}
+	}
+
+	nodeStates := map[string]string{"start": "Completed", "work": "Scheduled"}
+	nodeOutputs := map[string][]byte{}
+	resolveCancelTriggers(wf, nodeStates, nodeOutputs, "user")
+	if nodeStates["on_cancel"] != "Completed" || string(nodeOutputs["on_cancel"]) != `{"reason":"user"}` {
+		t.Errorf("cancel trigger = %q with output %s, want completed with the reason", nodeStates["on_cancel"], nodeOutputs["on_cancel"])
+	}
+
+	// A regular node still running does not hold the cancel up; a cleanup
+	// node does.
+	if cleanupRunning(cleanup, nodeStates) {
+		t.Error("cleanupRunning() = true with only regular nodes running")
+	}
+	nodeStates["notify"] = "Scheduled"
+	if !cleanupRunning(cleanup, nodeStates) {
+		t.Error("cleanupRunning() = false with a cleanup node running")
+	}
+}
+
+func TestSkipUntakenBranches(t *testing.T) {
+	t.Parallel()
+
+	// check branches to approve or reject; both lead to notify. route is a
+	// switch whose default case has no edge.
+	def := WorkflowDefinition{
+		Nodes: []Node{
+			{ID: "start", Type: "trigger_manual"},
+			{ID: "check", Type: "condition"},
+			{ID: "approve", Type: "http_request"},
+			{ID: "reject", Type: "http_request"},
+			{ID: "archive", Type: "http_request"},
+			{ID: "notify", Type: "http_request"},
+			{ID: "route", Type: "logic_condition"},
+			{ID: "fast", Type: "http_request"},
+		},
+		Edges: []Edge{
+			{Source: "start", Target: "check"},
+			{Source: "check", Target: "approve", SourceHandle: "true"},
+			{Source: "check", Target: "reject", SourceHandle: "else"},
+			{Source: "reject", Target: "archive"},
+			{Source: "approve", Target: "notify"},
+			{Source: "archive", Target: "notify"},
+			{Source: "start", Target: "route"},
+			{Source: "route", Target: "fast", SourceHandle: "fast"},
+		},
+	}
+
+	nodeStates := map[string]string{"start": "Completed", "check": "Completed", "route": "Completed"}
+	nodeOutputs := map[string][]byte{
+		"check": []byte(`{"matched":true,"output":"true"}`),
+		"route": []byte(`{"matched":false,"output":"default"}`),
+	}
+	wf := mustWorkflowGraph(t, def)
+	skipUntakenBranches(wf, nodeStates, nodeOutputs)
+
+	want := map[string]string{"approve": "", "reject": "Skipped", "archive": "Skipped", "notify": "", "fast": "Skipped"}
+	for nodeID, state := range want {
+		if got := nodeStates[nodeID]; got != state {
+			t.Errorf("state of %s = %q, want %q", nodeID, got, state)
+		}
+	}
+	if taken, pending := incomingBranches(wf, "approve", nodeStates, nodeOutputs); pending || len(taken) != 1 {
+		t.Errorf("approve: taken %v, pending %v; want it ready", taken, pending)
+	}
+
+	// The join waits for the branch that was taken, and not for the one
+	// that was skipped.
+	if _, pending := incomingBranches(wf, "notify", nodeStates, nodeOutputs); !pending {
+		t.Error("notify is ready before approve completed")
+	}
+	nodeStates["approve"] = "Completed"
+	taken, pending := incomingBranches(wf, "notify", nodeStates, nodeOutputs)
+	if pending || len(taken) != 1 || taken[0] != "approve" {
+		t.Errorf("notify: taken %v, pending %v; want it ready with the input of approve", taken, pending)
+	}
+}
+
+func TestSkipUntakenBranchesConditions(t *testing.T) {
+	t.Parallel()
+
+	// Only the edge whose condition holds for the output of fetch is taken.
+	def := WorkflowDefinition{
+		Nodes: []Node{
+			{ID: "start", Type: "trigger_manual"},
+			{ID: "fetch", Type: "http_request"},
+			{ID: "small", Type: "http_request"},
+			{ID: "large", Type: "http_request"},
+		},
+		Edges: []Edge{
+			{Source: "start", Target: "fetch"},
+			{Source: "fetch", Target: "small", Condition: "amount < 100"},
+			{Source: "fetch", Target: "large", Condition: "amount >= 100"},
+		},
+	}
+
+	nodeStates := map[string]string{"start": "Completed", "fetch": "Completed"}
+	nodeOutputs := map[string][]byte{"fetch": []byte(`{"amount":250}`)}
+	wf := mustWorkflowGraph(t, def)
+	skipUntakenBranches(wf, nodeStates, nodeOutputs)
+
+	if got := nodeStates["small"]; got != "Skipped" {
+		t.Errorf("state of small = %q, want Skipped", got)
+	}
+	if taken, pending := incomingBranches(wf, "large", nodeStates, nodeOutputs); pending || len(taken) != 1 {
+		t.Errorf("large: taken %v, pending %v; want it ready", taken, pending)
+	}
+}
+
+func TestHandleNodeFailures(t *testing.T) {
+	t.Parallel()
+
+	def := WorkflowDefinition{
+		Nodes: []Node{
+			{ID: "start", Type: "trigger_manual"},
+			{ID: "fetch", Type: "http_request"},
+			{ID: "charge", Type: "http_request", Data: json.RawMessage(`{"on_error":"route"}`)},
+			{ID: "ship", Type: "http_request"},
+			{ID: "refund", Type: "http_request"},
+		},
+		Edges: []Edge{
+			{Source: "start", Target: "fetch"},
+			{Source: "fetch", Target: "charge"},
+			{Source: "charge", Target: "ship"},
+			{Source: "charge", Target: "refund", SourceHandle: graph.ErrorHandle},
+		},
+	}
+	failures := map[string]string{"fetch": "connection refused", "charge": "card declined"}
+
+	tests := []struct {
+		name       string
+		onError    string
+		states     map[string]string
+		wantFailed string
+		wantState  map[string]string
+	}{
+		{
+			name:       "fails the workflow by default",
+			states:     map[string]string{"start": "Completed", "fetch": "Failed"},
+			wantFailed: "fetch",
+		},
+		{
+			name:      "continue from the workflow settings",
+			onError:   onErrorContinue,
+			states:    map[string]string{"start": "Completed", "fetch": "Failed"},
+			wantState: map[string]string{"fetch": "Completed"},
+		},
+		{
+			name:      "route along the error handle",
+			states:    map[string]string{"start": "Completed", "fetch": "Completed", "charge": "Failed"},
+			wantState: map[string]string{"charge": "Failed", "ship": "Skipped", "refund": ""},
+		},
+		{
+			name:       "route without an error edge fails the workflow",
+			onError:    onErrorRoute,
+			states:     map[string]string{"start": "Completed", "fetch": "Failed"},
+			wantFailed: "fetch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := def
+			if tt.onError != "" {
+				def.Settings = map[string]interface{}{"on_error": tt.onError}
+			}
+			wf := mustWorkflowGraph(t, def)
+			nodeStates := tt.states
+			nodeOutputs := make(map[string][]byte)
+
+			failed, err := handleNodeFailures(wf, nodeStates, nodeOutputs, failures)
+			if err != nil {
+				t.Fatalf("handleNodeFailures() error = %v", err)
+			}
+			if failed != tt.wantFailed {
+				t.Fatalf("handleNodeFailures() = %q, want %q", failed, tt.wantFailed)
+			}
+			skipUntakenBranches(wf, nodeStates, nodeOutputs)
+			for nodeID, want := range tt.wantState {
+				if got := nodeStates[nodeID]; got != want {
+					t.Errorf("state of %s = %q, want %q", nodeID, got, want)
+				}
+			}
+		})
+	}
+
+	// The recovery node gets the error of the node it recovers.
+	wf := mustWorkflowGraph(t, def)
+	nodeStates := map[string]string{"start": "Completed", "fetch": "Completed", "charge": "Failed"}
+	nodeOutputs := make(map[string][]byte)
+	if _, err := handleNodeFailures(wf, nodeStates, nodeOutputs, failures); err != nil {
+		t.Fatalf("handleNodeFailures() error = %v", err)
+	}
+	taken, pending := incomingBranches(wf, "refund", nodeStates, nodeOutputs)
+	if pending || len(taken) != 1 || string(nodeOutputs[taken[0]]) != `{"error":{"message":"card declined","node_id":"charge"}}` {
+		t.Errorf("refund: taken %v, pending %v, input %s; want the error of charge", taken, pending, nodeOutputs["charge"])
+	}
+}
+
+func TestNewWorkflowGraph(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		def     WorkflowDefinition
+		wantErr string
+	}{
+		{
+			name: "cycle",
+			def: WorkflowDefinition{
+				Nodes: []Node{{ID: "start", Type: "trigger_manual"}, {ID: "a", Type: "http_request"}, {ID: "b", Type: "http_request"}},
+				Edges: []Edge{{Source: "start", Target: "a"}, {Source: "a", Target: "b"}, {Source: "b", Target: "a"}},
+			},
+			wantErr: "cycle detected",
+		},
+		{
+			name: "edge to a missing node",
+			def: WorkflowDefinition{
+				Nodes: []Node{{ID: "start", Type: "trigger_manual"}},
+				Edges: []Edge{{Source: "start", Target: "gone"}},
+			},
+			wantErr: "target node gone not found",
+		},
+		{
+			name: "no trigger",
+			def: WorkflowDefinition{
+				Nodes: []Node{{ID: "a", Type: "http_request"}, {ID: "b", Type: "http_request"}},
+				Edges: []Edge{{Source: "a", Target: "b"}},
+			},
+			wantErr: "workflow must have at least one trigger node",
+		},
+		{
+			name: "root that never runs",
+			def: WorkflowDefinition{
+				Nodes: []Node{{ID: "start", Type: "trigger_manual"}, {ID: "orphan", Type: "http_request"}, {ID: "join", Type: "http_request"}},
+				Edges: []Edge{{Source: "start", Target: "join"}, {Source: "orphan", Target: "join"}},
+			},
+			wantErr: "node orphan: has no incoming edges and is not a trigger",
+		},
+		{
+			name: "unknown on_error mode",
+			def: WorkflowDefinition{
+				Nodes:    []Node{{ID: "start", Type: "trigger_manual"}, {ID: "a", Type: "http_request"}},
+				Edges:    []Edge{{Source: "start", Target: "a"}},
+				Settings: map[string]interface{}{"on_error": "ignore"},
+			},
+			wantErr: `node start: unknown on_error mode "ignore"`,
+		},
+		{
+			name: "invalid retry policy",
+			def: WorkflowDefinition{
+				Nodes: []Node{{ID: "start", Type: "trigger_manual"}, {ID: "a", Type: "http_request", Data: json.RawMessage(`{"retry":{"max_attempts":-1}}`)}},
+				Edges: []Edge{{Source: "start", Target: "a"}},
+			},
+			wantErr: "node a: retry max_attempts must be non-negative",
+		},
+		{
+			name: "single trigger",
+			def: WorkflowDefinition{
+				Nodes: []Node{{ID: "start", Type: "trigger_manual"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newWorkflowGraph(tt.def)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("newWorkflowGraph() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newWorkflowGraph() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Nodes are visited level by level, in definition order within a level,
+	// and a join gets the outputs of the branches that reached it.
+	wf := mustWorkflowGraph(t, WorkflowDefinition{
+		Nodes: []Node{
+			{ID: "join", Type: "http_request", Data: json.RawMessage(`{"label":"Join","config":{"url":"https://example.com"}}`)},
+			{ID: "b", Type: "http_request"},
+			{ID: "a", Type: "http_request"},
+			{ID: "start", Type: "trigger_manual"},
+		},
+		Edges: []Edge{
+			{Source: "start", Target: "a"},
+			{Source: "start", Target: "b"},
+			{Source: "a", Target: "join"},
+			{Source: "b", Target: "join"},
+		},
+	})
+	if got, want := strings.Join(wf.dag.Order, ","), "start,b,a,join"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+	if got := string(wf.dag.Nodes["join"].Config); got != `{"url":"https://example.com"}` {
+		t.Errorf("config of join = %s, want the config in its node data", got)
+	}
+	nodeStates := map[string]string{"start": "Completed", "a": "Completed", "b": "Completed"}
+	nodeOutputs := map[string][]byte{"a": []byte(`1`), "b": []byte(`2`)}
+	sources, ready := wf.dag.Ready("join", nodeOutcomes(nodeStates, nodeOutputs))
+	input, err := wf.dag.MergeInputs("join", sources, func(nodeID string) json.RawMessage { return nodeOutputs[nodeID] })
+	if !ready || err != nil || string(input) != `{"a":1,"b":2}` {
+		t.Errorf("join: ready %v, input %s, error %v; want the outputs of a and b", ready, input, err)
+	}
+}
+
+func TestMergeModes(t *testing.T) {
+	t.Parallel()
+
+	// start fans out to three lookups that join again.
+	definition := func(merge string) WorkflowDefinition {
+		return WorkflowDefinition{
+			Nodes: []Node{
+				{ID: "start", Type: "trigger_manual"},
+				{ID: "crm", Type: "http_request"},
+				{ID: "billing", Type: "http_request"},
+				{ID: "geo", Type: "http_request"},
+				{ID: "join", Type: "transform", Data: json.RawMessage(`{"merge":"` + merge + `"}`)},
+			},
+			Edges: []Edge{
+				{Source: "start", Target: "crm"},
+				{Source: "start", Target: "billing"},
+				{Source: "start", Target: "geo"},
+				{Source: "crm", Target: "join"},
+				{Source: "billing", Target: "join"},
+				{Source: "geo", Target: "join"},
+			},
+		}
+	}
+	outputs := map[string][]byte{
+		"crm":     []byte(`{"user":{"name":"Ada"},"source":"crm"}`),
+		"billing": []byte(`{"user":{"plan":"pro"},"source":"billing"}`),
+		"geo":     []byte(`{"country":"NZ"}`),
+	}
+	allDone := map[string]string{"start": "Completed", "crm": "Completed", "billing": "Completed", "geo": "Completed"}
+	// billing and geo are done, crm is still running.
+	partial := map[string]string{"start": "Completed", "crm": "Scheduled", "billing": "Completed", "geo": "Completed"}
+
+	tests := []struct {
+		name      string
+		merge     string
+		states    map[string]string
+		wantReady bool
+		wantInput string
+	}{
+		{
+			name:   "waits for every branch",
+			merge:  graph.MergeKeyed,
+			states: partial,
+		},
+		{
+			name:      "keyed",
+			merge:     graph.MergeKeyed,
+			states:    allDone,
+			wantReady: true,
+			wantInput: `{"billing":{"user":{"plan":"pro"},"source":"billing"},"crm":{"user":{"name":"Ada"},"source":"crm"},"geo":{"country":"NZ"}}`,
+		},
+		{
+			name:      "append in edge order",
+			merge:     graph.MergeAppend,
+			states:    allDone,
+			wantReady: true,
+			wantInput: `[{"user":{"name":"Ada"},"source":"crm"},{"user":{"plan":"pro"},"source":"billing"},{"country":"NZ"}]`,
+		},
+		{
+			name:      "deep merge",
+			merge:     graph.MergeDeepMerge,
+			states:    allDone,
+			wantReady: true,
+			wantInput: `{"country":"NZ","source":"billing","user":{"name":"Ada","plan":"pro"}}`,
+		},
+		{
+			name:      "any takes the first branch in edge order",
+			merge:     graph.MergeAny,
+			states:    partial,
+			wantReady: true,
+			wantInput: `{"user":{"plan":"pro"},"source":"billing"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := mustWorkflowGraph(t, definition(tt.merge))
+			sources, ready := wf.dag.Ready("join", nodeOutcomes(tt.states, outputs))
+			if ready != tt.wantReady {
+				t.Fatalf("Ready() = %v, want %v", ready, tt.wantReady)
+			}
+			if !ready {
+				return
+			}
+			input, err := wf.dag.MergeInputs("join", sources, func(nodeID string) json.RawMessage { return outputs[nodeID] })
+			if err != nil {
+				t.Fatalf("MergeInputs() error = %v", err)
+			}
+			if string(input) != tt.wantInput {
+				t.Errorf("input = %s, want %s", input, tt.wantInput)
+			}
+		})
+	}
+
+	// Deep merge needs objects.
+	wf := mustWorkflowGraph(t, definition(graph.MergeDeepMerge))
+	_, err := wf.dag.MergeInputs("join", []string{"crm", "geo"}, func(nodeID string) json.RawMessage {
+		if nodeID == "geo" {
+			return json.RawMessage(`["NZ"]`)
+		}
+		return outputs[nodeID]
+	})
+	if err == nil {
+		t.Error("MergeInputs() deep-merged an array")
+	}
+
+	if _, err := newWorkflowGraph(definition("zip")); err == nil || !strings.Contains(err.Error(), `node join: unknown merge mode "zip"`) {
+		t.Errorf("newWorkflowGraph() error = %v, want the unknown merge mode", err)
+	}
+}
+
+// recordingExecutor records the input of each node the scheduler runs and
+// outputs the node's ID, which it takes from the node's config.
+type recordingExecutor struct {
+	mu     sync.Mutex
+	inputs map[string]string
+}
+
+func (e *recordingExecutor) Execute(ctx context.Context, nodeType string, input, config json.RawMessage) (*scheduler.NodeResult, error) {
+	var cfg struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	e.inputs[cfg.ID] = string(input)
+	e.mu.Unlock()
+	return &scheduler.NodeResult{Output: json.RawMessage(`{"from":"` + cfg.ID + `"}`)}, nil
+}
+
+func TestMergeInputsMatchScheduler(t *testing.T) {
+	t.Parallel()
+
+	// start fans out to a and b, which join again; single has one parent
+	// and pick merges in a mode of its own.
+	node := func(id, data string) Node {
+		return Node{ID: id, Type: "transform", Data: json.RawMessage(`{"config":{"id":"` + id + `"}` + data + `}`)}
+	}
+	def := WorkflowDefinition{
+		Nodes: []Node{
+			{ID: "start", Type: "trigger_manual", Data: json.RawMessage(`{"config":{"id":"start"}}`)},
+			node("a", ""),
+			node("b", ""),
+			node("join", ""),
+			node("single", ""),
+			node("pick", `,"merge":"append"`),
+		},
+		Edges: []Edge{
+			{Source: "start", Target: "a"},
+			{Source: "start", Target: "b"},
+			{Source: "a", Target: "join"},
+			{Source: "b", Target: "join"},
+			{Source: "a", Target: "single"},
+			{Source: "a", Target: "pick"},
+			{Source: "b", Target: "pick"},
+		},
+	}
+	wf := mustWorkflowGraph(t, def)
+
+	executor := &recordingExecutor{inputs: make(map[string]string)}
+	s := scheduler.NewScheduler(wf.dag, executor, scheduler.DefaultConfig(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if _, err := s.Execute(context.Background(), "exec-1", json.RawMessage(`{"id":1}`)); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	// Given the same upstream outputs, the decider gives every node the
+	// input the scheduler gave it.
+	nodeStates := make(map[string]string)
+	nodeOutputs := make(map[string][]byte)
+	for nodeID := range executor.inputs {
+		nodeStates[nodeID] = "Completed"
+		nodeOutputs[nodeID] = []byte(`{"from":"` + nodeID + `"}`)
+	}
+	for _, nodeID := range []string{"a", "join", "single", "pick"} {
+		sources, ready := wf.dag.Ready(nodeID, nodeOutcomes(nodeStates, nodeOutputs))
+		if !ready {
+			t.Fatalf("%s is not ready", nodeID)
+		}
+		input, err := wf.dag.MergeInputs(nodeID, sources, func(nodeID string) json.RawMessage { return nodeOutputs[nodeID] })
+		if err != nil {
+			t.Fatalf("MergeInputs(%s) error = %v", nodeID, err)
+		}
+		if want := executor.inputs[nodeID]; string(input) != want {
+			t.Errorf("input of %s = %s, scheduler gave it %s", nodeID, input, want)
+		}
+	}
+	if got, want := executor.inputs["single"], `{"from":"a"}`; got != want {
+		t.Errorf("input of single = %s, want %s", got, want)
+	}
+}
+
+func TestNodeTaskQueue(t *testing.T) {
+	t.Parallel()
+
+	typeQueues := map[string]string{"ai_agent": "high-memory", "database": "private-db"}
+
+	tests := []struct {
+		name     string
+		config   string
+		nodeType string
+		want     string
+	}{
+		{name: "node config", config: `{"task_queue":"gpu"}`, nodeType: "ai_agent", want: "gpu"},
+		{name: "node type route", config: `{"model":"gpt-4"}`, nodeType: "ai_agent", want: "high-memory"},
+		{name: "workflow queue", config: `{}`, nodeType: "http_request", want: "workflows-default"},
+		{name: "config that is not an object", config: `"raw"`, nodeType: "database", want: "private-db"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeTaskQueue([]byte(tt.config), tt.nodeType, typeQueues, "workflows-default"); got != tt.want {
+				t.Errorf("nodeTaskQueue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkflowExecutorExecute(t *testing.T) {
+	t.Parallel()
+
+	start := Node{ID: "start", Type: "trigger_manual"}
+	fetch := Node{ID: "fetch", Type: "http_request"}
+	linear := WorkflowDefinition{
+		Nodes: []Node{start, fetch},
+		Edges: []Edge{{Source: "start", Target: "fetch"}},
+	}
+	delayed := WorkflowDefinition{
+		Nodes: []Node{start, {ID: "wait", Type: delayNodeType, Data: json.RawMessage(`{"config":{"seconds":30}}`)}, fetch},
+		Edges: []Edge{{Source: "start", Target: "wait"}, {Source: "wait", Target: "fetch"}},
+	}
+	looping := WorkflowDefinition{
+		Nodes: []Node{start, fetch, {ID: "again", Type: continueAsNewNodeType}},
+		Edges: []Edge{{Source: "start", Target: "fetch"}, {Source: "fetch", Target: "again"}},
+	}
+	routed := WorkflowDefinition{
+		Nodes: []Node{start, {ID: "fetch", Type: "http_request", Data: json.RawMessage(`{"on_error":"route"}`)}, {ID: "notify", Type: "http_request"}},
+		Edges: []Edge{{Source: "start", Target: "fetch"}, {Source: "fetch", Target: "notify"}},
+	}
+	startedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		def    WorkflowDefinition
+		queues map[string]string
+		events []*historyv1.HistoryEvent
+		want   []historyv1.CommandType
+		check  func(t *testing.T, commands []*historyv1.Command)
+	}{
+		{
+			name: "schedules the trigger",
+			def:  linear,
+			want: []historyv1.CommandType{historyv1.CommandType_COMMAND_TYPE_SCHEDULE_ACTIVITY_TASK},
+			check: func(t *testing.T, commands []*historyv1.Command) {
+				attr := commands[0].GetScheduleActivityTaskAttributes()
+				if attr.GetNodeId() != "start" || attr.GetTaskQueue() != "orders" {
+					t.Errorf("scheduled %s on %q, want start on the workflow queue", attr.GetNodeId(), attr.GetTaskQueue())
+				}
+			},
+		},
+		{
+			name:   "routes a node type to its task queue",
+			def:    linear,
+			queues: map[string]string{"http_request": "egress"},
+			events: []*historyv1.HistoryEvent{scheduledEvent("start"), completedEvent(2, `{}`)},
+			want:   []historyv1.CommandType{historyv1.CommandType_COMMAND_TYPE_SCHEDULE_ACTIVITY_TASK},
+			check: func(t *testing.T, commands []*historyv1.Command) {
+				attr := commands[0].GetScheduleActivityTaskAttributes()
+				if attr.GetNodeId() != "fetch" || attr.GetTaskQueue() != "egress" {
+					t.Errorf("scheduled %s on %q, want fetch on egress", attr.GetNodeId(), attr.GetTaskQueue())
+				}
+			},
+		},
+		{
+			name:   "completes once every node completed",
+			def:    linear,
+			events: []*historyv1.HistoryEvent{scheduledEvent("start"), completedEvent(2, `{}`), scheduledEvent("fetch"), completedEvent(4, `{"status":200}`)},
+			want:   []historyv1.CommandType{historyv1.CommandType_COMMAND_TYPE_COMPLETE_WORKFLOW_EXECUTION},
+		},
+		{
+			name:   "fails on a failed node",
+			def:    linear,
+			events: []*historyv1.HistoryEvent{scheduledEvent("start"), completedEvent(2, `{}`), scheduledEvent("fetch"), failedEvent(4, "connection refused")},
+			want:   []historyv1.CommandType{historyv1.CommandType_COMMAND_TYPE_FAIL_WORKFLOW_EXECUTION},
+			check: func(t *testing.T, commands []*historyv1.Command) {
+				if reason := commands[0].GetFailWorkflowExecutionAttributes().GetFailure().GetMessage(); !strings.Contains(reason, "connection refused") {
+					t.Errorf("failure = %q, want the error of fetch", reason)
+				}
+			},
+		},
+		{
+			name:   "fails on a routed error without an error edge",
+			def:    routed,
+			events: []*historyv1.HistoryEvent{scheduledEvent("start"), completedEvent(2, `{}`), scheduledEvent("fetch"), failedEvent(4, "connection refused")},
+			want:   []historyv1.CommandType{historyv1.CommandType_COMMAND_TYPE_FAIL_WORKFLOW_EXECUTION},
+		},
+		{
+			name:   "starts a timer for a delay",
+			def:    delayed,
+			events: []*historyv1.HistoryEvent{scheduledEvent("start"), completedEvent(2, `{}`)},
+			want:   []historyv1.CommandType{historyv1.CommandType_COMMAND_TYPE_START_TIMER},
+			check: func(t *testing.T, commands []*historyv1.Command) {
+				if got := commands[0].GetStartTimerAttributes().GetStartToFireTimeout().AsDuration(); got != 30*time.Second {
+					t.Errorf("StartToFireTimeout = %v, want 30s", got)
+				}
+			},
+		},
+		{
+			name: "goes on once the timer fired",
+			def:  delayed,
+			events: []*historyv1.HistoryEvent{
+				scheduledEvent("start"), completedEvent(2, `{}`),
+				timerStartedEvent("wait", startedAt), timerFiredEvent("wait", startedAt.Add(30*time.Second)),
+			},
+			want: []historyv1.CommandType{historyv1.CommandType_COMMAND_TYPE_SCHEDULE_ACTIVITY_TASK},
+			check: func(t *testing.T, commands []*historyv1.Command) {
+				if nodeID := commands[0].GetScheduleActivityTaskAttributes().GetNodeId(); nodeID != "fetch" {
+					t.Errorf("scheduled %s, want fetch", nodeID)
+				}
+			},
+		},
+		{
+			name:   "continues as new",
+			def:    looping,
+			events: []*historyv1.HistoryEvent{scheduledEvent("start"), completedEvent(2, `{}`), scheduledEvent("fetch"), completedEvent(4, `{}`)},
+			want:   []historyv1.CommandType{historyv1.CommandType_COMMAND_TYPE_CONTINUE_AS_NEW_WORKFLOW_EXECUTION},
+			check: func(t *testing.T, commands []*historyv1.Command) {
+				var payload JobPayload
+				input := commands[0].GetContinueAsNewWorkflowExecutionAttributes().GetInput().GetPayloads()[0].GetData()
+				if err := json.Unmarshal(input, &payload); err != nil || len(payload.Workflow.Nodes) != 3 {
+					t.Errorf("new run input = %s, want the input of this run", input)
+				}
+			},
+		},
+		{
+			name: "cancels a running delay",
+			def:  delayed,
+			events: []*historyv1.HistoryEvent{
+				scheduledEvent("start"), completedEvent(2, `{}`),
+				timerStartedEvent("wait", startedAt), cancelRequestedEvent("no longer needed"),
+			},
+			want: []historyv1.CommandType{historyv1.CommandType_COMMAND_TYPE_CANCEL_TIMER, historyv1.CommandType_COMMAND_TYPE_CANCEL_WORKFLOW_EXECUTION},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := json.Marshal(JobPayload{Workflow: tt.def, TriggerData: map[string]interface{}{"id": 1}})
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			events := append([]*historyv1.HistoryEvent{{
+				EventType: commonv1.EventType_EVENT_TYPE_EXECUTION_STARTED,
+				Attributes: &historyv1.HistoryEvent_ExecutionStartedAttributes{
+					ExecutionStartedAttributes: &historyv1.ExecutionStartedEventAttributes{
+						TaskQueue: &apiv1.TaskQueue{Name: "orders"},
+						Input:     &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: input}}},
+					},
+				},
+			}}, tt.events...)
+			for i, event := range events {
+				event.EventId = int64(i + 1)
+			}
+
+			e := NewWorkflowExecutor(&fakeHistory{events: events}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			e.SetNodeTaskQueues(tt.queues)
+			resp, err := e.Execute(context.Background(), &ExecuteRequest{WorkflowID: "wf-1", RunID: "run-1"})
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			commands, err := UnmarshalCommands(resp.Output)
+			if err != nil {
+				t.Fatalf("UnmarshalCommands() error = %v", err)
+			}
+
+			got := make([]historyv1.CommandType, 0, len(commands))
+			for _, cmd := range commands {
+				got = append(got, cmd.GetCommandType())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("commands = %v, want %v", got, tt.want)
+			}
+			if tt.check != nil {
+				tt.check(t, commands)
+			}
+		})
+	}
+}
+
+// fakeHistory serves a fixed history.
+type fakeHistory struct {
+	events []*historyv1.HistoryEvent
+}
+
+func (h *fakeHistory) GetHistory(ctx context.Context, namespaceID, workflowID, runID string) (*historyv1.GetHistoryResponse, error) {
+	return &historyv1.GetHistoryResponse{History: &historyv1.History{Events: h.events}}, nil
+}
+
+func scheduledEvent(nodeID string) *historyv1.HistoryEvent {
+	return &historyv1.HistoryEvent{
+		EventType: commonv1.EventType_EVENT_TYPE_NODE_SCHEDULED,
+		Attributes: &historyv1.HistoryEvent_NodeScheduledAttributes{
+			NodeScheduledAttributes: &historyv1.NodeScheduledEventAttributes{NodeId: nodeID},
+		},
+	}
+}
+
+func completedEvent(scheduledEventID int64, output string) *historyv1.HistoryEvent {
+	return &historyv1.HistoryEvent{
+		EventType: commonv1.EventType_EVENT_TYPE_NODE_COMPLETED,
+		Attributes: &historyv1.HistoryEvent_NodeCompletedAttributes{
+			NodeCompletedAttributes: &historyv1.NodeCompletedEventAttributes{
+				ScheduledEventId: scheduledEventID,
+				Result:           &commonv1.Payloads{Payloads: []*commonv1.Payload{{Data: []byte(output)}}},
+			},
+		},
+	}
+}
+
+func failedEvent(scheduledEventID int64, message string) *historyv1.HistoryEvent {
+	return &historyv1.HistoryEvent{
+		EventType: commonv1.EventType_EVENT_TYPE_NODE_FAILED,
+		Attributes: &historyv1.HistoryEvent_NodeFailedAttributes{
+			NodeFailedAttributes: &historyv1.NodeFailedEventAttributes{
+				ScheduledEventId: scheduledEventID,
+				Failure:          &commonv1.Failure{Message: message},
+			},
+		},
+	}
+}
+
+func timerStartedEvent(timerID string, at time.Time) *historyv1.HistoryEvent {
+	return &historyv1.HistoryEvent{
+		EventType: commonv1.EventType_EVENT_TYPE_TIMER_STARTED,
+		EventTime: timestamppb.New(at),
+		Attributes: &historyv1.HistoryEvent_TimerStartedAttributes{
+			TimerStartedAttributes: &historyv1.TimerStartedEventAttributes{TimerId: timerID},
+		},
+	}
+}
+
+func timerFiredEvent(timerID string, at time.Time) *historyv1.HistoryEvent {
+	return &historyv1.HistoryEvent{
+		EventType: commonv1.EventType_EVENT_TYPE_TIMER_FIRED,
+		EventTime: timestamppb.New(at),
+		Attributes: &historyv1.HistoryEvent_TimerFiredAttributes{
+			TimerFiredAttributes: &historyv1.TimerFiredEventAttributes{TimerId: timerID},
+		},
+	}
+}
+
+func cancelRequestedEvent(reason string) *historyv1.HistoryEvent {
+	return &historyv1.HistoryEvent{
+		EventType: commonv1.EventType_EVENT_TYPE_EXECUTION_CANCEL_REQUESTED,
+		Attributes: &historyv1.HistoryEvent_ExecutionCancelRequestedAttributes{
+			ExecutionCancelRequestedAttributes: &historyv1.ExecutionCancelRequestedEventAttributes{Reason: reason},
+		},
+	}
+}
+
+func mustWorkflowGraph(t *testing.T, def WorkflowDefinition) *workflowGraph {
+	t.Helper()
+	wf, err := newWorkflowGraph(def)
+	if err != nil {
+		t.Fatalf("newWorkflowGraph() error = %v", err)
+	}
+	return wf
+}
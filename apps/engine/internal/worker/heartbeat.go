@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/linkflow/engine/internal/worker/executor"
+	"github.com/linkflow/engine/internal/worker/poller"
+
+	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
+	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
+)
+
+// maxHeartbeatInterval is the longest an activity goes between heartbeats
+// that are sent out. It stays well below the matching lease, so a heartbeating
+// activity keeps its task.
+const maxHeartbeatInterval = 30 * time.Second
+
+// activityHeartbeater sends the heartbeats of one running activity task to
+// matching, which extends the task's lease, and to history, which keeps the
+// details and pushes back the heartbeat timeout. Executors may heartbeat as
+// often as they like; heartbeats within the interval only update the details
+// that go out with the next one.
+type activityHeartbeater struct {
+	svc      *Service
+	task     *poller.Task
+	interval time.Duration
+	cancel   context.CancelFunc
+
+	mu        sync.Mutex
+	lastSent  time.Time
+	cancelled bool
+
+	// cancelRequested tells a cancel of the workflow apart from an
+	// activity history no longer knows about: history waits to hear that
+	// a cancel-requested activity stopped.
+	cancelRequested bool
+}
+
+// newActivityHeartbeater returns the heartbeater of task. cancel is called
+// once the activity is cancelled, to stop the executor even if it does not
+// check the result of its heartbeats.
+func newActivityHeartbeater(svc *Service, task *poller.Task, heartbeatTimeout time.Duration, cancel context.CancelFunc) *activityHeartbeater {
+	interval := maxHeartbeatInterval
+	if heartbeatTimeout > 0 && heartbeatTimeout/2 < interval {
+		interval = heartbeatTimeout / 2
+	}
+	return &activityHeartbeater{
+		svc:      svc,
+		task:     task,
+		interval: interval,
+		cancel:   cancel,
+	}
+}
+
+// heartbeat is the executor.HeartbeatFunc of the activity.
+func (h *activityHeartbeater) heartbeat(ctx context.Context, details json.RawMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cancelled {
+		return executor.ErrCancelled
+	}
+	if time.Since(h.lastSent) < h.interval {
+		return nil
+	}
+	h.lastSent = time.Now()
+
+	if h.svc.matchingClient != nil {
+		if err := h.svc.matchingClient.HeartbeatTask(ctx, h.task, h.svc.identity); err != nil {
+			h.svc.logger.Warn("failed to extend activity task lease",
+				slog.String("workflow_id", h.task.WorkflowID),
+				slog.Int64("scheduled_event_id", h.task.ScheduledEventID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
+	req := &historyv1.RecordActivityTaskHeartbeatRequest{
+		Namespace: h.task.Namespace,
+		WorkflowExecution: &commonv1.WorkflowExecution{
+			WorkflowId: h.task.WorkflowID,
+			RunId:      h.task.RunID,
+		},
+		ScheduledEventId: h.task.ScheduledEventID,
+		Identity:         h.svc.identity,
+	}
+	if len(details) > 0 {
+		req.Details = &commonv1.Payloads{
+			Payloads: []*commonv1.Payload{{Data: details}},
+		}
+	}
+	resp, err := h.svc.historyClient.RecordActivityTaskHeartbeat(ctx, req)
+	switch code := status.Code(err); {
+	case code == codes.NotFound || code == codes.FailedPrecondition:
+		// The activity timed out or its workflow closed.
+		h.cancelled = true
+	case err != nil:
+		// A lost heartbeat is made up for by the next one; the activity
+		// keeps running.
+		h.svc.logger.Warn("failed to record activity heartbeat",
+			slog.String("workflow_id", h.task.WorkflowID),
+			slog.Int64("scheduled_event_id", h.task.ScheduledEventID),
+			slog.String("error", err.Error()),
+		)
+		return nil
+	case resp.GetCancelRequested():
+		h.cancelled = true
+		h.cancelRequested = true
+	}
+
+	if h.cancelled {
+		h.cancel()
+		return executor.ErrCancelled
+	}
+	return nil
+}
+
+// isCancelled reports whether a heartbeat found the activity cancelled.
+func (h *activityHeartbeater) isCancelled() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.cancelled
+}
+
+// isCancelRequested reports whether a heartbeat found that the workflow of
+// the activity asked it to stop.
+func (h *activityHeartbeater) isCancelRequested() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.cancelRequested
+}
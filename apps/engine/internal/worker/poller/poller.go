@@ -21,6 +21,9 @@ type Task struct {
 	Attempt          int32                  `json:"attempt"`
 	TimeoutSec       int32                  `json:"timeout_sec"`
 	ScheduledEventID int64                  `json:"scheduled_event_id"`
+
+	// QueryType is set on a query task, whose arguments are in Input.
+	QueryType string `json:"query_type,omitempty"`
 }
 
 type TaskResult struct {
@@ -7,6 +7,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -16,25 +17,30 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 
+	"github.com/linkflow/engine/internal/retry"
 	"github.com/linkflow/engine/internal/worker/adapter"
 	"github.com/linkflow/engine/internal/worker/executor"
 	"github.com/linkflow/engine/internal/worker/poller"
-	"github.com/linkflow/engine/internal/worker/retry"
 
 	commonv1 "github.com/linkflow/engine/api/gen/linkflow/common/v1"
 	historyv1 "github.com/linkflow/engine/api/gen/linkflow/history/v1"
 )
 
 type Service struct {
-	historyClient *adapter.HistoryClient
-	matchingConn  *grpc.ClientConn
+	historyClient  *adapter.HistoryClient
+	matchingClient *adapter.MatchingClient
+	matchingConn   *grpc.ClientConn
 	executors     map[string]executor.Executor
+	queryHandlers map[string]QueryHandler
 	taskPollers   []*poller.Poller
 	retryPolicy   *retry.Policy
 	callbackHTTP  *http.Client
 	callbackKey   string
+	identity      string
 	logger        *slog.Logger
 	wg            sync.WaitGroup
 	stopCh        chan struct{}
@@ -54,6 +60,10 @@ type Config struct {
 	CallbackTimeout time.Duration
 	Logger          *slog.Logger
 	HistoryClient   *adapter.HistoryClient
+
+	// QueueConcurrency sets how many tasks of a queue in TaskQueues the
+	// worker runs at once, by queue name. Queues not in it get NumPollers.
+	QueueConcurrency map[string]int
 }
 
 // NewService creates a new worker service.
@@ -91,9 +101,15 @@ func NewService(cfg Config) (*Service, error) {
 
 	var pollers []*poller.Poller
 	for _, queue := range cfg.TaskQueues {
-		for i := 0; i < cfg.NumPollers; i++ {
+		// Each poller runs one task at a time, so a queue's concurrency is
+		// its number of pollers.
+		numPollers := cfg.NumPollers
+		if n := cfg.QueueConcurrency[queue]; n > 0 {
+			numPollers = n
+		}
+		for i := 0; i < numPollers; i++ {
 			identity := cfg.Identity
-			if cfg.NumPollers > 1 {
+			if numPollers > 1 {
 				identity = fmt.Sprintf("%s-%d", cfg.Identity, i+1)
 			}
 
@@ -109,15 +125,18 @@ func NewService(cfg Config) (*Service, error) {
 	}
 
 	svc := &Service{
-		historyClient: cfg.HistoryClient,
-		matchingConn:  conn,
+		historyClient:  cfg.HistoryClient,
+		matchingClient: client,
+		matchingConn:   conn,
 		executors:     make(map[string]executor.Executor),
+		queryHandlers: make(map[string]QueryHandler),
 		taskPollers:   pollers,
 		retryPolicy:   cfg.RetryPolicy,
 		callbackHTTP: &http.Client{
 			Timeout: cfg.CallbackTimeout,
 		},
 		callbackKey: cfg.CallbackKey,
+		identity:    cfg.Identity,
 		logger:      cfg.Logger,
 		stopCh:      make(chan struct{}),
 	}
@@ -136,6 +155,15 @@ func (s *Service) RegisterExecutor(exec executor.Executor) {
 	s.logger.Info("registered executor", slog.String("node_type", exec.NodeType()))
 }
 
+// RegisterQueryHandler makes the worker answer custom queries of queryType
+// with handler.
+func (s *Service) RegisterQueryHandler(queryType string, handler QueryHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queryHandlers[queryType] = handler
+	s.logger.Info("registered query handler", slog.String("query_type", queryType))
+}
+
 func (s *Service) Start(ctx context.Context) error {
 	s.mu.Lock()
 	if s.running {
@@ -194,12 +222,47 @@ func (s *Service) handleTask(ctx context.Context, task *poller.Task) (*poller.Ta
 	// Dispatch based on task type (Workflow vs Activity)
 	// Currently the poller returns a generic task. We should infer type from task.NodeType or similar.
 	// The poller.Task struct has NodeType.
+	if task.QueryType != "" {
+		return s.processQueryTask(ctx, task)
+	}
 	if task.NodeType == "workflow" {
 		return s.processWorkflowTask(ctx, task)
 	}
 	return s.processActivityTask(ctx, task)
 }
 
+// processQueryTask answers a query task with the handler registered for its
+// type. A query without a handler, or one its handler fails, is answered
+// with the error, so the caller does not wait for the query timeout.
+func (s *Service) processQueryTask(ctx context.Context, task *poller.Task) (*poller.TaskResult, error) {
+	s.mu.RLock()
+	handler, ok := s.queryHandlers[task.QueryType]
+	s.mu.RUnlock()
+
+	var result []byte
+	var errMessage string
+	if !ok {
+		errMessage = fmt.Sprintf("unknown query type %q", task.QueryType)
+	} else {
+		var err error
+		result, err = handler(ctx, &QueryRequest{
+			Namespace:  task.Namespace,
+			WorkflowID: task.WorkflowID,
+			RunID:      task.RunID,
+			QueryType:  task.QueryType,
+			Args:       task.Input,
+		})
+		if err != nil {
+			errMessage = err.Error()
+		}
+	}
+
+	if err := s.matchingClient.RespondQueryTask(ctx, task, result, errMessage, s.identity); err != nil {
+		return nil, fmt.Errorf("failed to respond to query task: %w", err)
+	}
+	return &poller.TaskResult{TaskID: task.TaskID, Output: result, Error: errMessage}, nil
+}
+
 func (s *Service) processWorkflowTask(ctx context.Context, task *poller.Task) (*poller.TaskResult, error) {
 	s.logger.Info("processing workflow task", slog.String("workflow_id", task.WorkflowID))
 	startedAt := time.Now()
@@ -218,6 +281,31 @@ func (s *Service) processWorkflowTask(ctx context.Context, task *poller.Task) (*
 		return nil, fmt.Errorf("workflow executor not found")
 	}
 
+	// Claim the workflow task before deciding. A task that was already
+	// started by another worker, superseded, or whose run has closed is
+	// acked and dropped, so a duplicate delivery never produces a second
+	// decision and a task history refuses for good is not redelivered.
+	_, err := s.historyClient.RecordWorkflowTaskStarted(ctx, &historyv1.RecordWorkflowTaskStartedRequest{
+		Namespace: task.Namespace,
+		WorkflowExecution: &commonv1.WorkflowExecution{
+			WorkflowId: task.WorkflowID,
+			RunId:      task.RunID,
+		},
+		ScheduledEventId: task.ScheduledEventID,
+		Identity:         s.identity,
+		RequestId:        string(task.TaskToken),
+	})
+	if err != nil {
+		if code := status.Code(err); code == codes.NotFound || code == codes.FailedPrecondition {
+			s.logger.Info("dropping stale workflow task",
+				slog.String("workflow_id", task.WorkflowID),
+				slog.Int64("scheduled_event_id", task.ScheduledEventID),
+			)
+			return &poller.TaskResult{TaskID: task.TaskID}, nil
+		}
+		return nil, fmt.Errorf("failed to start workflow task: %w", err)
+	}
+
 	req := &executor.ExecuteRequest{
 		NodeType:   "workflow",
 		WorkflowID: task.WorkflowID,
@@ -250,8 +338,8 @@ func (s *Service) processWorkflowTask(ctx context.Context, task *poller.Task) (*
 	}
 
 	// ExecuteResponse.Output now contains the Commands (marshaled)
-	var commands []*historyv1.Command
-	if err := json.Unmarshal(resp.Output, &commands); err != nil {
+	commands, err := executor.UnmarshalCommands(resp.Output)
+	if err != nil {
 		s.logger.Error("failed to unmarshal workflow commands", slog.String("error", err.Error()))
 		return nil, err
 	}
@@ -264,7 +352,17 @@ func (s *Service) processWorkflowTask(ctx context.Context, task *poller.Task) (*
 		},
 		TaskToken: task.ScheduledEventID,
 		Commands:  commands,
+		Identity:  s.identity,
 	})
+	if status.Code(err) == codes.NotFound {
+		// The task timed out or was superseded while deciding; history
+		// dropped these commands and the next workflow task decides again.
+		s.logger.Info("workflow task became stale while deciding",
+			slog.String("workflow_id", task.WorkflowID),
+			slog.Int64("scheduled_event_id", task.ScheduledEventID),
+		)
+		return &poller.TaskResult{TaskID: task.TaskID}, nil
+	}
 	if err != nil {
 		s.logger.Error("failed to respond workflow task completed", slog.String("error", err.Error()))
 		s.sendLegacyCallback(jobPayload, "failed", time.Since(startedAt), map[string]interface{}{
@@ -311,6 +409,46 @@ func (s *Service) processActivityTask(ctx context.Context, task *poller.Task) (*
 		return nil, fmt.Errorf("executor not found for type: %s", task.NodeType)
 	}
 
+	// Claim the node before running it, which starts its start-to-close
+	// timeout. A node that timed out, was claimed by another worker, or
+	// whose run has closed is acked and dropped.
+	started, err := s.historyClient.RecordActivityTaskStarted(ctx, &historyv1.RecordActivityTaskStartedRequest{
+		Namespace: task.Namespace,
+		WorkflowExecution: &commonv1.WorkflowExecution{
+			WorkflowId: task.WorkflowID,
+			RunId:      task.RunID,
+		},
+		ScheduledEventId: task.ScheduledEventID,
+		Identity:         s.identity,
+		RequestId:        string(task.TaskToken),
+	})
+	if err != nil {
+		if code := status.Code(err); code == codes.NotFound || code == codes.AlreadyExists || code == codes.FailedPrecondition {
+			s.logger.Info("dropping stale activity task",
+				slog.String("workflow_id", task.WorkflowID),
+				slog.Int64("scheduled_event_id", task.ScheduledEventID),
+			)
+			return &poller.TaskResult{TaskID: task.TaskID}, nil
+		}
+		return nil, fmt.Errorf("failed to start activity task: %w", err)
+	}
+
+	timeout := time.Duration(task.TimeoutSec) * time.Second
+	if startToClose := started.GetStartToCloseTimeout().AsDuration(); startToClose > 0 && (timeout <= 0 || startToClose < timeout) {
+		timeout = startToClose
+	}
+
+	execCtx, cancelExec := context.WithCancel(ctx)
+	defer cancelExec()
+	heartbeater := newActivityHeartbeater(s, task, started.GetHeartbeatTimeout().AsDuration(), cancelExec)
+
+	// Hand the last heartbeat of an earlier attempt to the executor, so it
+	// can resume from there.
+	var heartbeatDetails json.RawMessage
+	if details := started.GetHeartbeatDetails(); len(details.GetPayloads()) > 0 {
+		heartbeatDetails = details.GetPayloads()[0].GetData()
+	}
+
 	req := &executor.ExecuteRequest{
 		NodeType:      task.NodeType,
 		NodeID:        task.NodeID,
@@ -320,11 +458,45 @@ func (s *Service) processActivityTask(ctx context.Context, task *poller.Task) (*
 		Config:        task.Config,
 		Input:         task.Input,
 		Deterministic: deterministicFromTask(task.Deterministic),
-		Attempt:       task.Attempt,
-		Timeout:       time.Duration(task.TimeoutSec) * time.Second,
+		Attempt:       started.GetAttempt(),
+		Timeout:       timeout,
+
+		HeartbeatDetails: heartbeatDetails,
+		Heartbeat:        heartbeater.heartbeat,
 	}
 
-	resp, err := exec.Execute(ctx, req)
+	resp, err := exec.Execute(execCtx, req)
+
+	if heartbeater.isCancelRequested() {
+		// The workflow is being cancelled and waits to hear that the
+		// activity stopped before it runs its cleanup.
+		s.logger.Info("activity task cancelled by its workflow",
+			slog.String("workflow_id", task.WorkflowID),
+			slog.Int64("scheduled_event_id", task.ScheduledEventID),
+		)
+		_, err = s.historyClient.RespondActivityTaskCanceled(ctx, &historyv1.RespondActivityTaskCanceledRequest{
+			Namespace: task.Namespace,
+			WorkflowExecution: &commonv1.WorkflowExecution{
+				WorkflowId: task.WorkflowID,
+				RunId:      task.RunID,
+			},
+			ScheduledEventId: task.ScheduledEventID,
+			Identity:         s.identity,
+		})
+		if code := status.Code(err); code == codes.NotFound || code == codes.FailedPrecondition {
+			err = nil
+		}
+		return &poller.TaskResult{TaskID: task.TaskID}, err
+	}
+	if errors.Is(err, executor.ErrCancelled) || heartbeater.isCancelled() {
+		// History no longer waits for this attempt; there is nobody to
+		// report to.
+		s.logger.Info("activity task cancelled",
+			slog.String("workflow_id", task.WorkflowID),
+			slog.Int64("scheduled_event_id", task.ScheduledEventID),
+		)
+		return &poller.TaskResult{TaskID: task.TaskID}, nil
+	}
 
 	// Handle execution result
 	if err != nil {
@@ -356,6 +528,7 @@ func (s *Service) processActivityTask(ctx context.Context, task *poller.Task) (*
 			Failure: &commonv1.Failure{
 				Message:     resp.Error.Message,
 				FailureType: commonv1.FailureType_FAILURE_TYPE_APPLICATION,
+				ErrorType:   resp.Error.Type,
 			},
 		})
 
@@ -376,6 +549,15 @@ func (s *Service) processActivityTask(ctx context.Context, task *poller.Task) (*
 		},
 	})
 
+	if status.Code(err) == codes.NotFound {
+		// The node timed out while it ran; its result is no longer wanted.
+		s.logger.Info("dropping result of timed out activity task",
+			slog.String("workflow_id", task.WorkflowID),
+			slog.Int64("scheduled_event_id", task.ScheduledEventID),
+		)
+		return &poller.TaskResult{TaskID: task.TaskID}, nil
+	}
+
 	s.sendLegacyProgress(jobPayload, task.NodeID, 80, resp)
 
 	if err != nil {
@@ -568,6 +750,54 @@ func (s *Service) collectExecutionNodesForCallback(ctx context.Context, task *po
 			node["error"] = map[string]interface{}{
 				"message": errMsg,
 			}
+
+		case commonv1.EventType_EVENT_TYPE_NODE_TIMED_OUT:
+			attr := event.GetNodeTimedOutAttributes()
+			if attr == nil {
+				continue
+			}
+
+			node, ok := nodeByScheduledEventID[attr.GetScheduledEventId()]
+			if !ok {
+				continue
+			}
+
+			node["status"] = "failed"
+			node["completed_at"] = event.GetEventTime().AsTime().UTC().Format(time.RFC3339Nano)
+			node["error"] = map[string]interface{}{
+				"message": attr.GetFailure().GetMessage(),
+			}
+
+		case commonv1.EventType_EVENT_TYPE_TIMER_STARTED:
+			// Delay nodes run as durable timers named after the node.
+			attr := event.GetTimerStartedAttributes()
+			if attr == nil {
+				continue
+			}
+
+			sequence++
+			nodeByNodeID[attr.GetTimerId()] = map[string]interface{}{
+				"node_id":    attr.GetTimerId(),
+				"node_type":  "delay",
+				"node_name":  attr.GetTimerId(),
+				"status":     "running",
+				"started_at": event.GetEventTime().AsTime().UTC().Format(time.RFC3339Nano),
+				"sequence":   sequence,
+			}
+
+		case commonv1.EventType_EVENT_TYPE_TIMER_FIRED:
+			attr := event.GetTimerFiredAttributes()
+			if attr == nil {
+				continue
+			}
+
+			node, ok := nodeByNodeID[attr.GetTimerId()]
+			if !ok {
+				continue
+			}
+
+			node["status"] = "completed"
+			node["completed_at"] = event.GetEventTime().AsTime().UTC().Format(time.RFC3339Nano)
 		}
 	}
 
@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"context"
 	"errors"
 )
 
@@ -40,3 +41,17 @@ const (
 	ErrorTypeNonRetryable = "NON_RETRYABLE"
 	ErrorTypeTimeout      = "TIMEOUT"
 )
+
+// QueryRequest is a custom query of a workflow run, routed to this worker
+// because history does not answer it itself.
+type QueryRequest struct {
+	Namespace  string
+	WorkflowID string
+	RunID      string
+	QueryType  string
+	Args       []byte
+}
+
+// QueryHandler answers the custom queries of one type. Queries are
+// read-only, so a handler must not change the run it is asked about.
+type QueryHandler func(ctx context.Context, req *QueryRequest) ([]byte, error)
@@ -0,0 +1,4 @@
+-- Transfer queue rollback
+
+DROP TABLE IF EXISTS transfer_tasks;
+DROP TABLE IF EXISTS shards;
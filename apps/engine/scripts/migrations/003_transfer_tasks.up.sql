@@ -0,0 +1,30 @@
+-- Transfer queue: durable outbox for history-to-matching task dispatch
+
+-- =============================================================================
+-- SHARDS (per-shard queue metadata)
+-- =============================================================================
+CREATE TABLE IF NOT EXISTS shards (
+    shard_id            INTEGER PRIMARY KEY,
+    next_task_id        BIGINT NOT NULL DEFAULT 1,
+    transfer_ack_level  BIGINT NOT NULL DEFAULT 0,
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- =============================================================================
+-- TRANSFER_TASKS (written in the same transaction as mutable state)
+-- =============================================================================
+CREATE TABLE IF NOT EXISTS transfer_tasks (
+    shard_id            INTEGER NOT NULL,
+    task_id             BIGINT NOT NULL,
+    task_type           SMALLINT NOT NULL,
+    namespace_id        VARCHAR(255) NOT NULL,
+    workflow_id         VARCHAR(255) NOT NULL,
+    run_id              UUID NOT NULL,
+    task_queue          VARCHAR(255) NOT NULL,
+    scheduled_event_id  BIGINT NOT NULL,
+    visibility_time     TIMESTAMPTZ NOT NULL,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (shard_id, task_id)
+);
+
+CREATE INDEX idx_transfer_tasks_workflow ON transfer_tasks (namespace_id, workflow_id, run_id);
@@ -0,0 +1,6 @@
+-- Shard ownership rollback
+
+ALTER TABLE shards
+    DROP COLUMN IF EXISTS lease_expires_at,
+    DROP COLUMN IF EXISTS owner,
+    DROP COLUMN IF EXISTS range_id;
@@ -0,0 +1,11 @@
+-- Shard ownership: leases and range IDs used to fence writes
+
+-- =============================================================================
+-- SHARDS (ownership columns)
+-- =============================================================================
+-- range_id is bumped on every acquisition. Writers check it inside their
+-- transaction, so a host that lost the shard cannot commit.
+ALTER TABLE shards
+    ADD COLUMN IF NOT EXISTS range_id          BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS owner             VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS lease_expires_at  TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+-- Current run rollback
+
+DROP TABLE IF EXISTS current_executions;
@@ -0,0 +1,15 @@
+-- Current run of each workflow ID
+
+-- =============================================================================
+-- CURRENT_EXECUTIONS (written in the same transaction that creates a run)
+-- =============================================================================
+-- Points a workflow ID at its most recently created run, which is the one
+-- workflow ID reuse policies are checked against.
+CREATE TABLE IF NOT EXISTS current_executions (
+    shard_id        INTEGER NOT NULL,
+    namespace_id    VARCHAR(255) NOT NULL,
+    workflow_id     VARCHAR(255) NOT NULL,
+    run_id          UUID NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (namespace_id, workflow_id)
+);